@@ -13,24 +13,45 @@ type tokenTypeKey struct{}
 
 // WithCredentials 返回一个包含密钥信息的context
 func WithCredentials(ctx context.Context, cred *Credentials) context.Context {
+	return WithCredentialsProvider(ctx, cred)
+}
+
+// WithCredentialsType 返回一个context, 保存了密钥信息和token类型
+func WithCredentialsType(ctx context.Context, cred *Credentials, t TokenType) context.Context {
+	return WithCredentialsProviderType(ctx, cred, t)
+}
+
+// WithCredentialsProvider 返回一个包含密钥获取方式的context, 发送请求时才获取密钥
+func WithCredentialsProvider(ctx context.Context, provider CredentialsProvider) context.Context {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	return context.WithValue(ctx, macContextKey{}, cred)
+	return context.WithValue(ctx, macContextKey{}, provider)
 }
 
-// WithCredentialsType 返回一个context, 保存了密钥信息和token类型
-func WithCredentialsType(ctx context.Context, cred *Credentials, t TokenType) context.Context {
-	ctx = WithCredentials(ctx, cred)
+// WithCredentialsProviderType 返回一个context, 保存了密钥获取方式和token类型
+func WithCredentialsProviderType(ctx context.Context, provider CredentialsProvider, t TokenType) context.Context {
+	ctx = WithCredentialsProvider(ctx, provider)
 	return context.WithValue(ctx, tokenTypeKey{}, t)
 }
 
-// CredentialsFromContext 从context获取密钥信息
-func CredentialsFromContext(ctx context.Context) (cred *Credentials, t TokenType, ok bool) {
-	cred, ok = ctx.Value(macContextKey{}).(*Credentials)
+// CredentialsProviderFromContext 从context获取密钥获取方式
+func CredentialsProviderFromContext(ctx context.Context) (provider CredentialsProvider, t TokenType, ok bool) {
+	provider, ok = ctx.Value(macContextKey{}).(CredentialsProvider)
 	t, yes := ctx.Value(tokenTypeKey{}).(TokenType)
 	if !yes {
 		t = TokenQBox
 	}
 	return
 }
+
+// CredentialsFromContext 从context获取密钥信息
+func CredentialsFromContext(ctx context.Context) (cred *Credentials, t TokenType, ok bool) {
+	provider, t, ok := CredentialsProviderFromContext(ctx)
+	if !ok {
+		return
+	}
+	cred, err := provider.Retrieve()
+	ok = err == nil
+	return
+}
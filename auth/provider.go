@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 环境变量名称
+const (
+	// EnvAccessKey 保存 AccessKey 的环境变量
+	EnvAccessKey = "QINIU_ACCESS_KEY"
+
+	// EnvSecretKey 保存 SecretKey 的环境变量
+	EnvSecretKey = "QINIU_SECRET_KEY"
+
+	// EnvCredentialsFile 指定密钥配置文件路径的环境变量
+	EnvCredentialsFile = "QINIU_CREDENTIALS_FILE"
+
+	// EnvProfile 指定密钥配置文件中使用哪个配置的环境变量
+	EnvProfile = "QINIU_PROFILE"
+)
+
+// DefaultProfile 是密钥配置文件中默认使用的配置名称
+const DefaultProfile = "default"
+
+// ErrNoCredentials 表示没有获取到密钥信息
+var ErrNoCredentials = errors.New("no credentials")
+
+// CredentialsProvider 用来获取密钥信息
+// SDK 在每次发送请求的时候都会调用 Retrieve 获取密钥，因此实现可以在不重建各种 Manager 的情况下更换密钥
+// 实现需要保证并发安全，并且 Retrieve 应该尽可能快地返回，需要的话自己缓存
+type CredentialsProvider interface {
+	Retrieve() (*Credentials, error)
+}
+
+// Retrieve 使 Credentials 本身也是一个 CredentialsProvider，总是返回自己
+func (ath *Credentials) Retrieve() (*Credentials, error) {
+	if ath == nil {
+		return nil, ErrNoCredentials
+	}
+	return ath, nil
+}
+
+// StaticProvider 返回固定的密钥，可以通过 Update 更换密钥
+type StaticProvider struct {
+	lock sync.RWMutex
+	cred *Credentials
+}
+
+// NewStaticProvider 返回一个 StaticProvider
+func NewStaticProvider(accessKey, secretKey string) *StaticProvider {
+	return &StaticProvider{cred: New(accessKey, secretKey)}
+}
+
+// Retrieve 返回当前的密钥
+func (p *StaticProvider) Retrieve() (*Credentials, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if p.cred == nil || p.cred.AccessKey == "" {
+		return nil, ErrNoCredentials
+	}
+	return p.cred, nil
+}
+
+// Update 更换密钥，之后的请求都会使用新的密钥
+func (p *StaticProvider) Update(accessKey, secretKey string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.cred = New(accessKey, secretKey)
+}
+
+// EnvProvider 从环境变量 QINIU_ACCESS_KEY 和 QINIU_SECRET_KEY 中获取密钥
+// 每次调用都会重新读取环境变量
+type EnvProvider struct{}
+
+// NewEnvProvider 返回一个 EnvProvider
+func NewEnvProvider() *EnvProvider {
+	return &EnvProvider{}
+}
+
+// Retrieve 从环境变量中获取密钥
+func (p *EnvProvider) Retrieve() (*Credentials, error) {
+	accessKey, secretKey := os.Getenv(EnvAccessKey), os.Getenv(EnvSecretKey)
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("%s or %s not set: %w", EnvAccessKey, EnvSecretKey, ErrNoCredentials)
+	}
+	return New(accessKey, secretKey), nil
+}
+
+// ProfileProvider 从密钥配置文件中获取密钥
+// 配置文件是 INI 格式(兼容简单的 TOML 格式)，每个配置是一个小节，例如:
+//
+//	[default]
+//	access_key = "<AccessKey>"
+//	secret_key = "<SecretKey>"
+//
+//	[prod]
+//	access_key = "<AccessKey>"
+//	secret_key = "<SecretKey>"
+//
+// 配置文件修改后会自动重新加载，可以通过修改文件来更换密钥
+type ProfileProvider struct {
+	path    string
+	profile string
+
+	lock    sync.Mutex
+	modTime time.Time
+	size    int64
+	cred    *Credentials
+	err     error
+}
+
+// NewProfileProvider 返回一个 ProfileProvider
+// path 为空时依次使用环境变量 QINIU_CREDENTIALS_FILE 和 ~/.qiniu/credentials
+// profile 为空时依次使用环境变量 QINIU_PROFILE 和 DefaultProfile
+func NewProfileProvider(path, profile string) *ProfileProvider {
+	if path == "" {
+		path = os.Getenv(EnvCredentialsFile)
+	}
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".qiniu", "credentials")
+		}
+	}
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
+	}
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	return &ProfileProvider{path: path, profile: profile}
+}
+
+// Retrieve 从配置文件中获取密钥，文件没有修改时使用上一次读取的结果
+func (p *ProfileProvider) Retrieve() (*Credentials, error) {
+	if p.path == "" {
+		return nil, fmt.Errorf("credentials file not found: %w", ErrNoCredentials)
+	}
+	fi, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrNoCredentials)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.cred == nil && p.err == nil || !fi.ModTime().Equal(p.modTime) || fi.Size() != p.size {
+		p.cred, p.err = loadProfile(p.path, p.profile)
+		p.modTime, p.size = fi.ModTime(), fi.Size()
+	}
+	return p.cred, p.err
+}
+
+// loadProfile 从 path 文件中读取 profile 配置
+func loadProfile(path, profile string) (*Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrNoCredentials)
+	}
+	defer f.Close()
+
+	var (
+		section   string
+		accessKey string
+		secretKey string
+		found     bool
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			section = strings.Trim(section, `"'`)
+			if section == profile {
+				found = true
+			}
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+		switch key {
+		case "access_key", "accesskey", "ak":
+			accessKey = value
+		case "secret_key", "secretkey", "sk":
+			secretKey = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("profile %q not found in %s: %w", profile, path, ErrNoCredentials)
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("profile %q in %s has no access_key or secret_key: %w", profile, path, ErrNoCredentials)
+	}
+	return New(accessKey, secretKey), nil
+}
+
+// RotatingProvider 通过 fetch 函数获取密钥，并缓存 interval 时长，过期后重新获取
+// 适用于从密钥管理服务等外部系统中获取会定期轮换的密钥
+// 重新获取失败时继续使用之前的密钥
+type RotatingProvider struct {
+	fetch    func() (*Credentials, error)
+	interval time.Duration
+
+	lock     sync.Mutex
+	cred     *Credentials
+	deadline time.Time
+}
+
+// NewRotatingProvider 返回一个 RotatingProvider
+func NewRotatingProvider(fetch func() (*Credentials, error), interval time.Duration) *RotatingProvider {
+	return &RotatingProvider{fetch: fetch, interval: interval}
+}
+
+// Retrieve 返回缓存的密钥，缓存过期后重新获取
+func (p *RotatingProvider) Retrieve() (*Credentials, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.cred != nil && time.Now().Before(p.deadline) {
+		return p.cred, nil
+	}
+	cred, err := p.fetch()
+	if err != nil || cred == nil {
+		if p.cred != nil {
+			return p.cred, nil
+		}
+		if err == nil {
+			err = ErrNoCredentials
+		}
+		return nil, err
+	}
+	p.cred = cred
+	p.deadline = time.Now().Add(p.interval)
+	return cred, nil
+}
+
+// Expire 使缓存的密钥立即过期，下一次请求时重新获取
+func (p *RotatingProvider) Expire() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.deadline = time.Time{}
+}
+
+// ChainProvider 依次尝试多个 CredentialsProvider，返回第一个成功获取到的密钥
+type ChainProvider struct {
+	Providers []CredentialsProvider
+}
+
+// NewChainProvider 返回一个 ChainProvider
+func NewChainProvider(providers ...CredentialsProvider) *ChainProvider {
+	return &ChainProvider{Providers: providers}
+}
+
+// Retrieve 依次尝试每个 CredentialsProvider
+func (p *ChainProvider) Retrieve() (*Credentials, error) {
+	errs := make([]string, 0, len(p.Providers))
+	for _, provider := range p.Providers {
+		cred, err := provider.Retrieve()
+		if err == nil && cred != nil {
+			return cred, nil
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoCredentials, strings.Join(errs, "; "))
+}
+
+// NewDefaultProvider 返回默认的 CredentialsProvider，依次从环境变量和默认的密钥配置文件中获取密钥
+func NewDefaultProvider() *ChainProvider {
+	return NewChainProvider(NewEnvProvider(), NewProfileProvider("", ""))
+}
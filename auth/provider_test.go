@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStaticProvider(t *testing.T) {
+	p := NewStaticProvider("ak1", "sk1")
+	cred, err := p.Retrieve()
+	if err != nil || cred.AccessKey != "ak1" {
+		t.Fatalf("Retrieve() got %v, %v", cred, err)
+	}
+
+	p.Update("ak2", "sk2")
+	cred, err = p.Retrieve()
+	if err != nil || cred.AccessKey != "ak2" || string(cred.SecretKey) != "sk2" {
+		t.Fatalf("Retrieve() after Update() got %v, %v", cred, err)
+	}
+
+	var nilCred *Credentials
+	if _, err = nilCred.Retrieve(); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("nil Credentials Retrieve() want ErrNoCredentials, got %v", err)
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	defer os.Unsetenv(EnvAccessKey)
+	defer os.Unsetenv(EnvSecretKey)
+
+	os.Unsetenv(EnvAccessKey)
+	os.Unsetenv(EnvSecretKey)
+	if _, err := NewEnvProvider().Retrieve(); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("want ErrNoCredentials, got %v", err)
+	}
+
+	os.Setenv(EnvAccessKey, "envak")
+	os.Setenv(EnvSecretKey, "envsk")
+	cred, err := NewEnvProvider().Retrieve()
+	if err != nil || cred.AccessKey != "envak" || string(cred.SecretKey) != "envsk" {
+		t.Errorf("Retrieve() got %v, %v", cred, err)
+	}
+}
+
+func TestProfileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qiniu-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials")
+	content := `# qiniu credentials
+[default]
+access_key = defaultak
+secret_key = defaultsk
+
+[prod]
+access_key = "prodak"
+secret_key = "prodsk"
+`
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cred, err := NewProfileProvider(path, "").Retrieve()
+	if err != nil || cred.AccessKey != "defaultak" {
+		t.Errorf("default profile got %v, %v", cred, err)
+	}
+
+	p := NewProfileProvider(path, "prod")
+	cred, err = p.Retrieve()
+	if err != nil || cred.AccessKey != "prodak" || string(cred.SecretKey) != "prodsk" {
+		t.Errorf("prod profile got %v, %v", cred, err)
+	}
+
+	if _, err = NewProfileProvider(path, "missing").Retrieve(); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("missing profile want ErrNoCredentials, got %v", err)
+	}
+
+	// 修改文件后重新加载
+	content = "[prod]\naccess_key = newprodak\nsecret_key = newprodsk\n"
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cred, err = p.Retrieve()
+	if err != nil || cred.AccessKey != "newprodak" {
+		t.Errorf("prod profile after rotation got %v, %v", cred, err)
+	}
+}
+
+func TestRotatingProvider(t *testing.T) {
+	fetched := 0
+	p := NewRotatingProvider(func() (*Credentials, error) {
+		fetched++
+		if fetched == 3 {
+			return nil, errors.New("fetch failed")
+		}
+		return New("ak", "sk"), nil
+	}, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.Retrieve(); err != nil {
+			t.Fatalf("Retrieve() error: %v", err)
+		}
+	}
+	if fetched != 1 {
+		t.Errorf("want 1 fetch, got %d", fetched)
+	}
+
+	p.Expire()
+	p.Retrieve()
+	p.Expire()
+	// 获取失败时继续使用之前的密钥
+	if cred, err := p.Retrieve(); err != nil || cred.AccessKey != "ak" {
+		t.Errorf("Retrieve() after failed fetch got %v, %v", cred, err)
+	}
+	if fetched != 3 {
+		t.Errorf("want 3 fetches, got %d", fetched)
+	}
+}
+
+func TestChainProvider(t *testing.T) {
+	p := NewChainProvider(NewStaticProvider("", ""), NewStaticProvider("ak", "sk"))
+	cred, err := p.Retrieve()
+	if err != nil || cred.AccessKey != "ak" {
+		t.Errorf("Retrieve() got %v, %v", cred, err)
+	}
+
+	p = NewChainProvider(NewStaticProvider("", ""))
+	if _, err = p.Retrieve(); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("want ErrNoCredentials, got %v", err)
+	}
+}
+
+func TestCredentialsProviderFromContext(t *testing.T) {
+	p := NewStaticProvider("ak1", "sk1")
+	ctx := WithCredentialsProviderType(context.Background(), p, TokenQiniu)
+
+	p.Update("ak2", "sk2")
+	cred, tokenType, ok := CredentialsFromContext(ctx)
+	if !ok || cred.AccessKey != "ak2" || tokenType != TokenQiniu {
+		t.Errorf("CredentialsFromContext() got %v, %v, %v", cred, tokenType, ok)
+	}
+
+	cred, tokenType, ok = CredentialsFromContext(WithCredentials(context.Background(), at))
+	if !ok || cred != at || tokenType != TokenQBox {
+		t.Errorf("CredentialsFromContext() got %v, %v, %v", cred, tokenType, ok)
+	}
+}
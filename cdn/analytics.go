@@ -0,0 +1,519 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+// AnalyticsLocation 是 CDN 统计数据使用的时区，查询和返回的时间都按这个时区解释
+var AnalyticsLocation = time.FixedZone("CST", 8*3600)
+
+// Granularity 为统计数据的时间粒度
+type Granularity string
+
+// 统计数据的时间粒度
+const (
+	Granularity5Min Granularity = "5min"
+	GranularityHour Granularity = "1hour"
+	GranularityDay  Granularity = "1day"
+)
+
+// Duration 返回时间粒度对应的时长
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case GranularityHour:
+		return time.Hour
+	case GranularityDay:
+		return 24 * time.Hour
+	default:
+		return 5 * time.Minute
+	}
+}
+
+// trafficGranularity 返回带宽和流量接口使用的粒度
+func (g Granularity) trafficGranularity() string {
+	switch g {
+	case GranularityHour:
+		return "hour"
+	case GranularityDay:
+		return "day"
+	default:
+		return "5min"
+	}
+}
+
+// 统计数据的区域
+const (
+	RegionChina   = "china"
+	RegionOversea = "oversea"
+	RegionGlobal  = "global"
+)
+
+// 排行的指标
+const (
+	TopByCount   = "count"
+	TopByTraffic = "traffic"
+)
+
+// ErrInvalidAnalyticsQuery 表示统计查询的参数不正确
+var ErrInvalidAnalyticsQuery = errors.New("invalid analytics query, need domains and start <= end")
+
+// AnalyticsQuery 为统计数据的查询条件，Start 和 End 都包括在查询范围内
+//
+//	q := cdn.NewAnalyticsQuery(start, end, cdn.GranularityHour, "a.example.com", "b.example.com").WithRegion(cdn.RegionChina)
+//	result, err := m.QueryHitMiss(q)
+type AnalyticsQuery struct {
+	Domains     []string
+	Start       time.Time
+	End         time.Time
+	Granularity Granularity
+	Region      string
+}
+
+// NewAnalyticsQuery 返回 domains 在 start 到 end 之间按 granularity 统计的查询条件
+func NewAnalyticsQuery(start, end time.Time, granularity Granularity, domains ...string) *AnalyticsQuery {
+	return &AnalyticsQuery{Domains: domains, Start: start, End: end, Granularity: granularity}
+}
+
+// WithRegion 设置查询的区域，参考 RegionChina 等
+func (q *AnalyticsQuery) WithRegion(region string) *AnalyticsQuery {
+	q.Region = region
+	return q
+}
+
+// Times 返回按时间粒度对齐后的时间点，第一个时间点是 Start 所在的时间段，最后一个是 End 所在的时间段
+func (q *AnalyticsQuery) Times() []time.Time {
+	d := q.Granularity.Duration()
+	var times []time.Time
+	for t := q.align(q.Start); !t.After(q.End); t = t.Add(d) {
+		times = append(times, t)
+	}
+	return times
+}
+
+// align 返回 t 所在的时间段的开始时间
+func (q *AnalyticsQuery) align(t time.Time) time.Time {
+	t = t.In(AnalyticsLocation)
+	if q.Granularity == GranularityDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, AnalyticsLocation)
+	}
+	return t.Truncate(q.Granularity.Duration())
+}
+
+func (q *AnalyticsQuery) validate() error {
+	if q == nil || len(q.Domains) == 0 || q.End.Before(q.Start) {
+		return ErrInvalidAnalyticsQuery
+	}
+	return nil
+}
+
+func (q *AnalyticsQuery) request() analyticsReq {
+	return analyticsReq{
+		Domains:   q.Domains,
+		Freq:      string(q.Granularity),
+		Region:    q.Region,
+		StartDate: q.Start.In(AnalyticsLocation).Format("2006-01-02"),
+		EndDate:   q.End.In(AnalyticsLocation).Format("2006-01-02"),
+	}
+}
+
+type analyticsReq struct {
+	Domains   []string `json:"domains"`
+	Freq      string   `json:"freq,omitempty"`
+	Region    string   `json:"region,omitempty"`
+	Regions   []string `json:"regions,omitempty"`
+	StartDate string   `json:"startDate"`
+	EndDate   string   `json:"endDate"`
+}
+
+// TimeSeries 为按时间粒度对齐的统计数据，Times 和 Values 一一对应，没有数据的时间点为 0
+type TimeSeries struct {
+	Times  []time.Time
+	Values []int64
+}
+
+// Sum 返回所有时间点的和
+func (s TimeSeries) Sum() (sum int64) {
+	for _, v := range s.Values {
+		sum += v
+	}
+	return
+}
+
+// Peak 返回最大值和它的时间点，有多个最大值时返回第一个
+func (s TimeSeries) Peak() (t time.Time, peak int64) {
+	for i, v := range s.Values {
+		if i == 0 || v > peak {
+			t, peak = s.Times[i], v
+		}
+	}
+	return
+}
+
+// SumSeries 把多个时间点相同的 TimeSeries 按时间点相加，比如把多个域名的数据合并
+func SumSeries(series ...TimeSeries) TimeSeries {
+	var sum TimeSeries
+	for _, s := range series {
+		if sum.Times == nil {
+			sum.Times = s.Times
+			sum.Values = make([]int64, len(s.Values))
+		}
+		for i, v := range s.Values {
+			if i < len(sum.Values) {
+				sum.Values[i] += v
+			}
+		}
+	}
+	return sum
+}
+
+// SumSeriesMap 把 series 中所有的 TimeSeries 按时间点相加，比如 SumSeriesMap(bandwidth).Peak() 返回所有域名合计的峰值带宽
+func SumSeriesMap(series map[string]TimeSeries) TimeSeries {
+	list := make([]TimeSeries, 0, len(series))
+	for _, key := range sortedKeys(series) {
+		list = append(list, series[key])
+	}
+	return SumSeries(list...)
+}
+
+func sortedKeys(series map[string]TimeSeries) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 服务端返回的时间格式
+var analyticsTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02-15-04", "2006-01-02"}
+
+func parseAnalyticsTime(s string) (t time.Time, err error) {
+	for _, layout := range analyticsTimeLayouts {
+		if t, err = time.ParseInLocation(layout, s, AnalyticsLocation); err == nil {
+			return
+		}
+	}
+	return t, fmt.Errorf("invalid time %q", s)
+}
+
+// alignSeries 把服务端返回的 times 和 values 对齐到查询的时间点，查询范围之外的数据被丢弃
+func (q *AnalyticsQuery) alignSeries(times []string, values []int64) (series TimeSeries, err error) {
+	series.Times = q.Times()
+	series.Values = make([]int64, len(series.Times))
+	if len(series.Times) == 0 {
+		return
+	}
+	first, d := series.Times[0], q.Granularity.Duration()
+	for i, s := range times {
+		if i >= len(values) {
+			break
+		}
+		t, pErr := parseAnalyticsTime(s)
+		if pErr != nil {
+			return series, pErr
+		}
+		t = q.align(t)
+		if t.Before(first) {
+			continue
+		}
+		if idx := int(t.Sub(first) / d); idx < len(series.Values) {
+			series.Values[idx] += values[i]
+		}
+	}
+	return
+}
+
+func (q *AnalyticsQuery) alignSeriesMap(times []string, values map[string][]int64) (map[string]TimeSeries, error) {
+	result := make(map[string]TimeSeries, len(values))
+	for key, v := range values {
+		s, err := q.alignSeries(times, v)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = s
+	}
+	return result, nil
+}
+
+// HitMissResult 为缓存命中统计，请求数和流量都按时间点对齐
+type HitMissResult struct {
+	Hit         TimeSeries
+	Miss        TimeSeries
+	TrafficHit  TimeSeries
+	TrafficMiss TimeSeries
+}
+
+// HitRate 返回整个查询范围的请求命中率
+func (r *HitMissResult) HitRate() float64 {
+	hit, miss := r.Hit.Sum(), r.Miss.Sum()
+	if hit+miss == 0 {
+		return 0
+	}
+	return float64(hit) / float64(hit+miss)
+}
+
+// TrafficHitRate 返回整个查询范围的流量命中率
+func (r *HitMissResult) TrafficHitRate() float64 {
+	hit, miss := r.TrafficHit.Sum(), r.TrafficMiss.Sum()
+	if hit+miss == 0 {
+		return 0
+	}
+	return float64(hit) / float64(hit+miss)
+}
+
+// QueryHitMiss 查询缓存命中和未命中的请求数和流量
+func (m *CdnManager) QueryHitMiss(q *AnalyticsQuery) (result HitMissResult, err error) {
+	return m.QueryHitMissContext(context.Background(), q)
+}
+
+// QueryHitMissContext 和 QueryHitMiss 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) QueryHitMissContext(ctx context.Context, q *AnalyticsQuery) (result HitMissResult, err error) {
+	var data struct {
+		Time        []string `json:"time"`
+		Hit         []int64  `json:"hit"`
+		Miss        []int64  `json:"miss"`
+		TrafficHit  []int64  `json:"trafficHit"`
+		TrafficMiss []int64  `json:"trafficMiss"`
+	}
+	if err = m.analyticsCall(ctx, "/v2/tune/loganalyze/hitmiss", q, nil, &data); err != nil {
+		return
+	}
+	if result.Hit, err = q.alignSeries(data.Time, data.Hit); err != nil {
+		return
+	}
+	if result.Miss, err = q.alignSeries(data.Time, data.Miss); err != nil {
+		return
+	}
+	if result.TrafficHit, err = q.alignSeries(data.Time, data.TrafficHit); err != nil {
+		return
+	}
+	result.TrafficMiss, err = q.alignSeries(data.Time, data.TrafficMiss)
+	return
+}
+
+// QueryStatusCodes 查询各个状态码的请求数，返回状态码到请求数的映射
+func (m *CdnManager) QueryStatusCodes(q *AnalyticsQuery) (result map[string]TimeSeries, err error) {
+	return m.QueryStatusCodesContext(context.Background(), q)
+}
+
+// QueryStatusCodesContext 和 QueryStatusCodes 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) QueryStatusCodesContext(ctx context.Context, q *AnalyticsQuery) (result map[string]TimeSeries, err error) {
+	var data struct {
+		Time   []string           `json:"time"`
+		Status map[string][]int64 `json:"status"`
+	}
+	if err = m.analyticsCall(ctx, "/v2/tune/loganalyze/statuscode", q, nil, &data); err != nil {
+		return
+	}
+	return q.alignSeriesMap(data.Time, data.Status)
+}
+
+// QueryRequestCount 查询请求数
+func (m *CdnManager) QueryRequestCount(q *AnalyticsQuery) (result TimeSeries, err error) {
+	return m.QueryRequestCountContext(context.Background(), q)
+}
+
+// QueryRequestCountContext 和 QueryRequestCount 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) QueryRequestCountContext(ctx context.Context, q *AnalyticsQuery) (result TimeSeries, err error) {
+	var data struct {
+		Time  []string `json:"time"`
+		Value []int64  `json:"value"`
+	}
+	if err = m.analyticsCall(ctx, "/v2/tune/loganalyze/reqcount", q, nil, &data); err != nil {
+		return
+	}
+	return q.alignSeries(data.Time, data.Value)
+}
+
+// QueryISPTraffic 查询各个运营商的流量，返回运营商到流量的映射，q.Region 为空时查询全部区域
+func (m *CdnManager) QueryISPTraffic(q *AnalyticsQuery) (result map[string]TimeSeries, err error) {
+	return m.QueryISPTrafficContext(context.Background(), q)
+}
+
+// QueryISPTrafficContext 和 QueryISPTraffic 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) QueryISPTrafficContext(ctx context.Context, q *AnalyticsQuery) (result map[string]TimeSeries, err error) {
+	var data struct {
+		Time  []string           `json:"time"`
+		Value map[string][]int64 `json:"value"`
+	}
+	if err = m.analyticsCall(ctx, "/v2/tune/loganalyze/isptraffic", q, func(req *analyticsReq) {
+		if req.Region != "" {
+			req.Regions, req.Region = []string{req.Region}, ""
+		}
+	}, &data); err != nil {
+		return
+	}
+	return q.alignSeriesMap(data.Time, data.Value)
+}
+
+// QueryRegionTraffic 查询 regions 中每个区域的流量，返回区域到流量的映射，每个区域发出一次请求
+// regions 可以是 RegionChina 等，也可以是省份，比如 beijing，具体参考接口文档
+func (m *CdnManager) QueryRegionTraffic(q *AnalyticsQuery, regions ...string) (result map[string]TimeSeries, err error) {
+	return m.QueryRegionTrafficContext(context.Background(), q, regions...)
+}
+
+// QueryRegionTrafficContext 和 QueryRegionTraffic 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) QueryRegionTrafficContext(ctx context.Context, q *AnalyticsQuery, regions ...string) (result map[string]TimeSeries, err error) {
+	if err = q.validate(); err != nil {
+		return
+	}
+	result = make(map[string]TimeSeries, len(regions))
+	for _, region := range regions {
+		rq := *q
+		rq.Region = region
+		isps, qErr := m.QueryISPTrafficContext(ctx, &rq)
+		if qErr != nil {
+			return nil, qErr
+		}
+		s := SumSeriesMap(isps)
+		if s.Times == nil {
+			s = TimeSeries{Times: q.Times(), Values: make([]int64, len(q.Times()))}
+		}
+		result[region] = s
+	}
+	return
+}
+
+// TopItem 为排行中的一项
+type TopItem struct {
+	Key   string
+	Value int64
+}
+
+// QueryTopURLs 查询请求数或者流量最多的 URL，metric 为 TopByCount 或者 TopByTraffic
+func (m *CdnManager) QueryTopURLs(q *AnalyticsQuery, metric string) ([]TopItem, error) {
+	return m.QueryTopURLsContext(context.Background(), q, metric)
+}
+
+// QueryTopURLsContext 和 QueryTopURLs 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) QueryTopURLsContext(ctx context.Context, q *AnalyticsQuery, metric string) ([]TopItem, error) {
+	return m.queryTop(ctx, q, "url", metric)
+}
+
+// QueryTopIPs 查询请求数或者流量最多的客户端 IP，metric 为 TopByCount 或者 TopByTraffic
+func (m *CdnManager) QueryTopIPs(q *AnalyticsQuery, metric string) ([]TopItem, error) {
+	return m.QueryTopIPsContext(context.Background(), q, metric)
+}
+
+// QueryTopIPsContext 和 QueryTopIPs 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) QueryTopIPsContext(ctx context.Context, q *AnalyticsQuery, metric string) ([]TopItem, error) {
+	return m.queryTop(ctx, q, "ip", metric)
+}
+
+func (m *CdnManager) queryTop(ctx context.Context, q *AnalyticsQuery, kind, metric string) (items []TopItem, err error) {
+	if metric != TopByTraffic {
+		metric = TopByCount
+	}
+	var data struct {
+		URLs    []string `json:"urls"`
+		IPs     []string `json:"ips"`
+		Count   []int64  `json:"count"`
+		Traffic []int64  `json:"traffic"`
+	}
+	if err = m.analyticsCall(ctx, "/v2/tune/loganalyze/top"+metric+kind, q, func(req *analyticsReq) {
+		req.Freq = ""
+		if req.Region == "" {
+			req.Region = RegionGlobal
+		}
+	}, &data); err != nil {
+		return
+	}
+	keys, values := data.URLs, data.Count
+	if kind == "ip" {
+		keys = data.IPs
+	}
+	if metric == TopByTraffic {
+		values = data.Traffic
+	}
+	for i, key := range keys {
+		if i < len(values) {
+			items = append(items, TopItem{Key: key, Value: values[i]})
+		}
+	}
+	return
+}
+
+// QueryBandwidth 查询每个域名的带宽，单位为 bps，国内和海外的带宽相加
+func (m *CdnManager) QueryBandwidth(q *AnalyticsQuery) (map[string]TimeSeries, error) {
+	return m.QueryBandwidthContext(context.Background(), q)
+}
+
+// QueryBandwidthContext 和 QueryBandwidth 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) QueryBandwidthContext(ctx context.Context, q *AnalyticsQuery) (map[string]TimeSeries, error) {
+	return m.queryTraffic(ctx, "/v2/tune/bandwidth", q, m.GetBandwidthDataContext)
+}
+
+// QueryFlux 查询每个域名的流量，单位为字节，国内和海外的流量相加
+func (m *CdnManager) QueryFlux(q *AnalyticsQuery) (map[string]TimeSeries, error) {
+	return m.QueryFluxContext(context.Background(), q)
+}
+
+// QueryFluxContext 和 QueryFlux 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) QueryFluxContext(ctx context.Context, q *AnalyticsQuery) (map[string]TimeSeries, error) {
+	return m.queryTraffic(ctx, "/v2/tune/flux", q, m.GetFluxDataContext)
+}
+
+func (m *CdnManager) queryTraffic(ctx context.Context, op string, q *AnalyticsQuery,
+	get func(ctx context.Context, startDate, endDate, granularity string, domains []string) (TrafficResp, error)) (map[string]TimeSeries, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	req := q.request()
+	resp, err := get(ctx, req.StartDate, req.EndDate, q.Granularity.trafficGranularity(), q.Domains)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkCode(op, resp.Code, resp.Error); err != nil {
+		return nil, err
+	}
+	values := make(map[string][]int64, len(resp.Data))
+	for domain, data := range resp.Data {
+		v := make([]int64, len(resp.Time))
+		for i := range v {
+			if i < len(data.DomainChina) {
+				v[i] += int64(data.DomainChina[i])
+			}
+			if i < len(data.DomainOversea) {
+				v[i] += int64(data.DomainOversea[i])
+			}
+		}
+		values[domain] = v
+	}
+	return q.alignSeriesMap(resp.Time, values)
+}
+
+// analyticsCall 检查 q 后发出统计查询请求，update 可以修改请求参数，把响应中的 data 解析到 data
+func (m *CdnManager) analyticsCall(ctx context.Context, path string, q *AnalyticsQuery, update func(req *analyticsReq), data interface{}) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	req := q.request()
+	if update != nil {
+		update(&req)
+	}
+	var ret struct {
+		Code  int             `json:"code"`
+		Error string          `json:"error"`
+		Data  json.RawMessage `json:"data"`
+	}
+	if err := m.call(client.WithIdempotent(ctx, true), "POST", path, req, &ret); err != nil {
+		return err
+	}
+	if err := checkCode(path, ret.Code, ret.Error); err != nil {
+		return err
+	}
+	if len(ret.Data) == 0 || string(ret.Data) == "null" {
+		return nil
+	}
+	if decodeErr := json.Unmarshal(ret.Data, data); decodeErr != nil {
+		return &CdnError{Op: path, Err: decodeErr}
+	}
+	return nil
+}
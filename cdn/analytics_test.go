@@ -0,0 +1,146 @@
+package cdn
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAnalyticsQueryTimes(t *testing.T) {
+	start := time.Date(2020, 7, 1, 10, 7, 0, 0, AnalyticsLocation)
+	q := NewAnalyticsQuery(start, start.Add(11*time.Minute), Granularity5Min, "a.com")
+	times := q.Times()
+	if len(times) != 3 || !times[0].Equal(time.Date(2020, 7, 1, 10, 5, 0, 0, AnalyticsLocation)) {
+		t.Errorf("5min Times() = %v", times)
+	}
+
+	// UTC 的 7 月 1 日 20 点是北京时间 7 月 2 日
+	q = NewAnalyticsQuery(time.Date(2020, 7, 1, 20, 0, 0, 0, time.UTC), time.Date(2020, 7, 3, 0, 0, 0, 0, AnalyticsLocation), GranularityDay, "a.com")
+	times = q.Times()
+	if len(times) != 2 || times[0].Day() != 2 || times[1].Day() != 3 {
+		t.Errorf("day Times() = %v", times)
+	}
+	if req := q.request(); req.StartDate != "2020-07-02" || req.EndDate != "2020-07-03" {
+		t.Errorf("request() = %+v", req)
+	}
+}
+
+func TestTimeSeriesHelpers(t *testing.T) {
+	t0 := time.Date(2020, 7, 1, 0, 0, 0, 0, AnalyticsLocation)
+	times := []time.Time{t0, t0.Add(time.Hour), t0.Add(2 * time.Hour)}
+	series := map[string]TimeSeries{
+		"a.com": {Times: times, Values: []int64{1, 5, 2}},
+		"b.com": {Times: times, Values: []int64{4, 1, 4}},
+	}
+	sum := SumSeriesMap(series)
+	if sum.Sum() != 17 || sum.Values[0] != 5 || sum.Values[2] != 6 {
+		t.Errorf("SumSeriesMap() = %+v", sum)
+	}
+	if peakAt, peak := sum.Peak(); peak != 6 || !peakAt.Equal(times[1]) {
+		t.Errorf("Peak() = %v, %d", peakAt, peak)
+	}
+}
+
+func TestQueryAnalytics(t *testing.T) {
+	m, requests := newDomainServer(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/tune/loganalyze/hitmiss":
+			// 10:00 没有数据，11:00 不在查询范围内
+			w.Write([]byte(`{"code":200,"error":"","data":{"time":["2020-07-01 08:00:00","2020-07-01 09:00:00","2020-07-01 11:00:00"],
+				"hit":[3,6,100],"miss":[1,2,100],"trafficHit":[30,60,0],"trafficMiss":[10,20,0]}}`))
+		case "/v2/tune/loganalyze/statuscode":
+			w.Write([]byte(`{"code":200,"data":{"time":["2020-07-01 09:00:00"],"status":{"200":[8],"404":[1]}}}`))
+		case "/v2/tune/loganalyze/isptraffic":
+			w.Write([]byte(`{"code":200,"data":{"time":["2020-07-01 08:00:00"],"value":{"telecom":[5],"unicom":[2]}}}`))
+		case "/v2/tune/loganalyze/toptrafficip":
+			w.Write([]byte(`{"code":200,"data":{"ips":["1.1.1.1","2.2.2.2"],"traffic":[9,3]}}`))
+		case "/v2/tune/loganalyze/topcounturl":
+			w.Write([]byte(`{"code":200,"data":{"urls":["http://a.com/1"],"count":[7]}}`))
+		case "/v2/tune/flux":
+			w.Write([]byte(`{"code":200,"time":["2020-07-01 08:00:00","2020-07-01 10:00:00"],
+				"data":{"a.com":{"china":[1,2],"oversea":[1,0]},"b.com":{"china":[3,3]}}}`))
+		case "/v2/tune/loganalyze/reqcount":
+			w.Write([]byte(`{"code":400000,"error":"invalid domain"}`))
+		}
+	})
+
+	// lastBody 返回最后一次请求 path 的请求内容
+	lastBody := func(path string) (body analyticsReq) {
+		for _, r := range *requests {
+			if r.Path == path {
+				body = analyticsReq{}
+				json.Unmarshal([]byte(r.Body), &body)
+			}
+		}
+		return
+	}
+
+	start := time.Date(2020, 7, 1, 8, 0, 0, 0, AnalyticsLocation)
+	q := NewAnalyticsQuery(start, start.Add(2*time.Hour), GranularityHour, "a.com", "b.com")
+
+	hitMiss, err := m.QueryHitMiss(q)
+	if err != nil {
+		t.Fatalf("QueryHitMiss() error: %v", err)
+	}
+	if len(hitMiss.Hit.Values) != 3 || hitMiss.Hit.Values[2] != 0 || hitMiss.HitRate() != 0.75 || hitMiss.TrafficHitRate() != 0.75 {
+		t.Errorf("QueryHitMiss() = %+v", hitMiss)
+	}
+	if body := lastBody("/v2/tune/loganalyze/hitmiss"); body.Freq != "1hour" || body.StartDate != "2020-07-01" || len(body.Domains) != 2 {
+		t.Errorf("unexpected request %+v", body)
+	}
+
+	codes, err := m.QueryStatusCodes(q)
+	if err != nil || len(codes["200"].Values) != 3 || codes["200"].Values[1] != 8 || codes["404"].Sum() != 1 {
+		t.Errorf("QueryStatusCodes() = %+v, %v", codes, err)
+	}
+
+	regions, err := m.QueryRegionTraffic(q, RegionChina, RegionOversea)
+	if err != nil || regions[RegionChina].Sum() != 7 || len(regions) != 2 {
+		t.Errorf("QueryRegionTraffic() = %+v, %v", regions, err)
+	}
+	if body := lastBody("/v2/tune/loganalyze/isptraffic"); body.Region != "" || len(body.Regions) != 1 || body.Regions[0] != RegionOversea {
+		t.Errorf("unexpected request %+v", body)
+	}
+
+	ips, err := m.QueryTopIPs(q, TopByTraffic)
+	if err != nil || len(ips) != 2 || ips[0] != (TopItem{"1.1.1.1", 9}) {
+		t.Errorf("QueryTopIPs() = %+v, %v", ips, err)
+	}
+	urls, err := m.QueryTopURLs(q, TopByCount)
+	if err != nil || len(urls) != 1 || urls[0] != (TopItem{"http://a.com/1", 7}) {
+		t.Errorf("QueryTopURLs() = %+v, %v", urls, err)
+	}
+	if body := lastBody("/v2/tune/loganalyze/topcounturl"); body.Region != RegionGlobal || body.Freq != "" {
+		t.Errorf("unexpected request %+v", body)
+	}
+
+	flux, err := m.QueryFlux(q)
+	if err != nil || flux["a.com"].Values[0] != 2 || flux["a.com"].Values[2] != 2 || SumSeriesMap(flux).Sum() != 10 {
+		t.Errorf("QueryFlux() = %+v, %v", flux, err)
+	}
+
+	if _, err = m.QueryRequestCount(q); err == nil {
+		t.Errorf("QueryRequestCount() should fail")
+	}
+	if _, err = m.QueryRequestCount(NewAnalyticsQuery(start, start, GranularityHour)); err != ErrInvalidAnalyticsQuery {
+		t.Errorf("query without domains: error = %v", err)
+	}
+
+	nilQueries := map[string]func() error{
+		"QueryHitMiss":       func() error { _, err := m.QueryHitMiss(nil); return err },
+		"QueryStatusCodes":   func() error { _, err := m.QueryStatusCodes(nil); return err },
+		"QueryRequestCount":  func() error { _, err := m.QueryRequestCount(nil); return err },
+		"QueryISPTraffic":    func() error { _, err := m.QueryISPTraffic(nil); return err },
+		"QueryRegionTraffic": func() error { _, err := m.QueryRegionTraffic(nil, RegionChina); return err },
+		"QueryTopURLs":       func() error { _, err := m.QueryTopURLs(nil, TopByCount); return err },
+		"QueryTopIPs":        func() error { _, err := m.QueryTopIPs(nil, TopByTraffic); return err },
+		"QueryBandwidth":     func() error { _, err := m.QueryBandwidth(nil); return err },
+		"QueryFlux":          func() error { _, err := m.QueryFlux(nil); return err },
+	}
+	for name, query := range nilQueries {
+		if err := query(); err != ErrInvalidAnalyticsQuery {
+			t.Errorf("%s(nil) error = %v", name, err)
+		}
+	}
+}
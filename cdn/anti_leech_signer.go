@@ -0,0 +1,268 @@
+package cdn
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 防盗链校验失败的原因
+var (
+	ErrAntileechMissing   = errors.New("antileech: missing sign or timestamp")
+	ErrAntileechTimestamp = errors.New("antileech: invalid timestamp")
+	ErrAntileechExpired   = errors.New("antileech: url expired")
+	ErrAntileechSignature = errors.New("antileech: signature mismatch")
+	ErrAntileechNoKey     = errors.New("antileech: no key")
+)
+
+// AntileechMode 为防盗链的签名方式，签名中的时间戳都是链接的过期时间
+type AntileechMode int
+
+const (
+	// AntileechModeQuery 为七牛的时间戳防盗链，sign=md5(key+path+timestamp)&t=timestamp
+	AntileechModeQuery AntileechMode = iota
+
+	// AntileechModeToken 把签名放在一个参数中，sign=timestamp-rand-uid-md5(path-timestamp-rand-uid-key)
+	AntileechModeToken
+
+	// AntileechModePath 把签名放在路径的开头，/md5(key+path+timestamp)/timestamp/path
+	AntileechModePath
+)
+
+// TimestampFormat 为签名中时间戳的格式
+type TimestampFormat int
+
+const (
+	// TimestampHex 为十六进制的 Unix 时间戳，七牛的时间戳防盗链使用这种格式
+	TimestampHex TimestampFormat = iota
+
+	// TimestampDecimal 为十进制的 Unix 时间戳
+	TimestampDecimal
+
+	// TimestampBase64 为十进制 Unix 时间戳的 URL 安全的 base64 编码，没有填充
+	TimestampBase64
+)
+
+// 默认的签名参数名和时间戳参数名
+const (
+	DefaultAntileechSignParam = "sign"
+	DefaultAntileechTimeParam = "t"
+)
+
+// AntileechSigner 生成和校验防盗链链接
+//
+//	Mode		签名方式
+//	Keys		密钥，签名时使用第一个，校验时任意一个匹配即可，更换密钥时可以同时配置新旧两个密钥
+//	SignParam	签名的参数名，为空时使用 DefaultAntileechSignParam，AntileechModePath 不使用
+//	TimeParam	时间戳的参数名，为空时使用 DefaultAntileechTimeParam，只有 AntileechModeQuery 使用
+//	TimeFormat	时间戳的格式
+//	Skew		校验时允许的时钟误差，链接在过期后 Skew 内仍然有效
+type AntileechSigner struct {
+	Mode       AntileechMode
+	Keys       []string
+	SignParam  string
+	TimeParam  string
+	TimeFormat TimestampFormat
+	Skew       time.Duration
+}
+
+// NewAntileechSigner 返回一个使用七牛时间戳防盗链签名方式的 AntileechSigner
+func NewAntileechSigner(keys ...string) *AntileechSigner {
+	return &AntileechSigner{Keys: keys}
+}
+
+// VerifyTimestampAntileechURL 校验 CreateTimestampAntileechURL 生成的链接，skew 为允许的时钟误差
+func VerifyTimestampAntileechURL(urlStr string, encryptKey string, skew time.Duration) error {
+	s := NewAntileechSigner(encryptKey)
+	s.Skew = skew
+	return s.Verify(urlStr)
+}
+
+func (s *AntileechSigner) signParam() string {
+	if s.SignParam == "" {
+		return DefaultAntileechSignParam
+	}
+	return s.SignParam
+}
+
+func (s *AntileechSigner) timeParam() string {
+	if s.TimeParam == "" {
+		return DefaultAntileechTimeParam
+	}
+	return s.TimeParam
+}
+
+func (s *AntileechSigner) formatTime(t time.Time) string {
+	switch s.TimeFormat {
+	case TimestampDecimal:
+		return strconv.FormatInt(t.Unix(), 10)
+	case TimestampBase64:
+		return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(t.Unix(), 10)))
+	default:
+		return strconv.FormatInt(t.Unix(), 16)
+	}
+}
+
+func (s *AntileechSigner) parseTime(str string) (t time.Time, err error) {
+	var sec int64
+	switch s.TimeFormat {
+	case TimestampDecimal:
+		sec, err = strconv.ParseInt(str, 10, 64)
+	case TimestampBase64:
+		var b []byte
+		if b, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(str, "=")); err == nil {
+			sec, err = strconv.ParseInt(string(b), 10, 64)
+		}
+	default:
+		sec, err = strconv.ParseInt(str, 16, 64)
+	}
+	if err != nil {
+		return t, ErrAntileechTimestamp
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// hash 计算签名，extra 为 AntileechModeToken 中的 rand-uid
+func (s *AntileechSigner) hash(key, path, ts, extra string) string {
+	var toSign string
+	if s.Mode == AntileechModeToken {
+		toSign = strings.Join([]string{path, ts, extra, key}, "-")
+	} else {
+		toSign = key + path + ts
+	}
+	return fmt.Sprintf("%x", md5.Sum([]byte(toSign)))
+}
+
+// Sign 返回 urlStr 签名后的链接，链接在 expire 之后失效
+func (s *AntileechSigner) Sign(urlStr string, expire time.Time) (signedURL string, err error) {
+	if len(s.Keys) == 0 {
+		return "", ErrAntileechNoKey
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return
+	}
+	key, path, ts := s.Keys[0], u.EscapedPath(), s.formatTime(expire)
+
+	q := url.Values{}
+	switch s.Mode {
+	case AntileechModePath:
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		u.RawPath = "/" + s.hash(key, path, ts, "") + "/" + ts + path
+		if u.Path, err = url.PathUnescape(u.RawPath); err != nil {
+			return
+		}
+		return u.String(), nil
+	case AntileechModeToken:
+		b := make([]byte, 8)
+		if _, err = rand.Read(b); err != nil {
+			return
+		}
+		extra := hex.EncodeToString(b) + "-0"
+		q.Set(s.signParam(), strings.Join([]string{ts, extra, s.hash(key, path, ts, extra)}, "-"))
+	default:
+		q.Set(s.signParam(), s.hash(key, path, ts, ""))
+		q.Set(s.timeParam(), ts)
+	}
+	if u.RawQuery == "" {
+		u.RawQuery = q.Encode()
+	} else {
+		u.RawQuery += "&" + q.Encode()
+	}
+	return u.String(), nil
+}
+
+// Verify 校验签名后的链接
+func (s *AntileechSigner) Verify(urlStr string) error {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return err
+	}
+	_, err = s.verify(u)
+	return err
+}
+
+// VerifyRequest 校验请求的链接
+func (s *AntileechSigner) VerifyRequest(req *http.Request) error {
+	_, err := s.verify(req.URL)
+	return err
+}
+
+// verify 校验链接，返回去掉签名后的原始路径，只有 AntileechModePath 会改变路径
+func (s *AntileechSigner) verify(u *url.URL) (rawPath string, err error) {
+	if len(s.Keys) == 0 {
+		return "", ErrAntileechNoKey
+	}
+	path := u.EscapedPath()
+	var sign, ts, extra string
+	switch s.Mode {
+	case AntileechModePath:
+		parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+		if len(parts) < 3 {
+			return "", ErrAntileechMissing
+		}
+		sign, ts, path = parts[0], parts[1], "/"+parts[2]
+	case AntileechModeToken:
+		// base64 格式的时间戳中可能包含 -，所以从后往前取 md5，uid 和 rand
+		parts := strings.Split(u.Query().Get(s.signParam()), "-")
+		n := len(parts)
+		if n < 4 {
+			return "", ErrAntileechMissing
+		}
+		ts, extra, sign = strings.Join(parts[:n-3], "-"), parts[n-3]+"-"+parts[n-2], parts[n-1]
+	default:
+		q := u.Query()
+		sign, ts = q.Get(s.signParam()), q.Get(s.timeParam())
+	}
+	if sign == "" || ts == "" {
+		return "", ErrAntileechMissing
+	}
+
+	expire, err := s.parseTime(ts)
+	if err != nil {
+		return "", err
+	}
+	if timeNow().After(expire.Add(s.Skew)) {
+		return "", ErrAntileechExpired
+	}
+	for _, key := range s.Keys {
+		want := s.hash(key, path, ts, extra)
+		if subtle.ConstantTimeCompare([]byte(strings.ToLower(sign)), []byte(want)) == 1 {
+			return path, nil
+		}
+	}
+	return "", ErrAntileechSignature
+}
+
+// Handler 返回一个校验防盗链的 http.Handler，校验失败时返回 403，校验成功后交给 next 处理
+// AntileechModePath 的请求交给 next 时路径中的签名和时间戳已经去掉
+func (s *AntileechSigner) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path, err := s.verify(req.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if s.Mode == AntileechModePath {
+			req = req.Clone(req.Context())
+			req.URL.RawPath = path
+			if req.URL.Path, err = url.PathUnescape(path); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.RequestURI = req.URL.RequestURI()
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,111 @@
+package cdn
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyTimestampAntileechURL(t *testing.T) {
+	signed, err := CreateTimestampAntileechURL("http://www.example.com/a%20b.jpg?x=1", "abc123", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyTimestampAntileechURL(signed, "abc123", 0); err != nil {
+		t.Errorf("VerifyTimestampAntileechURL() error: %v", err)
+	}
+	if err = VerifyTimestampAntileechURL(signed, "other", 0); err != ErrAntileechSignature {
+		t.Errorf("wrong key: error = %v", err)
+	}
+	if err = VerifyTimestampAntileechURL(strings.Replace(signed, "a%20b", "a%20c", 1), "abc123", 0); err != ErrAntileechSignature {
+		t.Errorf("wrong path: error = %v", err)
+	}
+	if err = VerifyTimestampAntileechURL("http://www.example.com/a.jpg", "abc123", 0); err != ErrAntileechMissing {
+		t.Errorf("unsigned url: error = %v", err)
+	}
+
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return time.Now().Add(90 * time.Second) }
+	if err = VerifyTimestampAntileechURL(signed, "abc123", 0); err != ErrAntileechExpired {
+		t.Errorf("expired url: error = %v", err)
+	}
+	if err = VerifyTimestampAntileechURL(signed, "abc123", time.Minute); err != nil {
+		t.Errorf("expired url within skew: error = %v", err)
+	}
+}
+
+func TestAntileechSignerModes(t *testing.T) {
+	expire := time.Now().Add(time.Minute)
+	signers := map[string]*AntileechSigner{
+		"query":   {Mode: AntileechModeQuery, Keys: []string{"new", "old"}, SignParam: "s", TimeParam: "e", TimeFormat: TimestampDecimal},
+		"token":   {Mode: AntileechModeToken, Keys: []string{"new", "old"}, SignParam: "auth_key", TimeFormat: TimestampBase64},
+		"path":    {Mode: AntileechModePath, Keys: []string{"new", "old"}},
+		"default": NewAntileechSigner("new", "old"),
+	}
+	for name, s := range signers {
+		signed, err := s.Sign("http://www.example.com/dir/a.jpg?x=1", expire)
+		if err != nil {
+			t.Fatalf("%s: Sign() error: %v", name, err)
+		}
+		if err = s.Verify(signed); err != nil {
+			t.Errorf("%s: Verify(%s) error: %v", name, signed, err)
+		}
+
+		// 使用旧密钥签名的链接仍然有效
+		old := *s
+		old.Keys = []string{"old"}
+		if signed, err = old.Sign("http://www.example.com/dir/a.jpg", expire); err != nil || s.Verify(signed) != nil {
+			t.Errorf("%s: url signed with old key should be valid, %v", name, err)
+		}
+		other := *s
+		other.Keys = []string{"other"}
+		if err = other.Verify(signed); err != ErrAntileechSignature {
+			t.Errorf("%s: wrong key: error = %v", name, err)
+		}
+	}
+
+	signed, _ := signers["query"].Sign("http://www.example.com/a.jpg", expire)
+	u, _ := url.Parse(signed)
+	if u.Query().Get("e") != strconv.FormatInt(expire.Unix(), 10) || u.Query().Get("s") == "" {
+		t.Errorf("unexpected params: %s", signed)
+	}
+}
+
+func TestAntileechHandler(t *testing.T) {
+	var gotPath string
+	origin := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotPath = req.URL.Path
+		w.Write([]byte("ok"))
+	})
+	s := &AntileechSigner{Mode: AntileechModePath, Keys: []string{"key"}}
+	srv := httptest.NewServer(s.Handler(origin))
+	defer srv.Close()
+
+	signed, err := s.Sign(srv.URL+"/dir/a%20b.jpg", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" || gotPath != "/dir/a b.jpg" {
+		t.Errorf("signed request: status %d, body %q, path %q", resp.StatusCode, body, gotPath)
+	}
+
+	resp, err = http.Get(srv.URL + "/dir/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unsigned request: status %d, want 403", resp.StatusCode)
+	}
+}
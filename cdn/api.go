@@ -1,7 +1,7 @@
 package cdn
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/endpoints"
 )
 
 // Fusion CDN服务域名
@@ -19,12 +21,65 @@ var (
 
 // CdnManager 提供了文件和目录刷新，文件预取，获取域名带宽和流量数据，获取域名日志列表等功能
 type CdnManager struct {
-	mac *auth.Credentials
+	client *client.Client
+	mac    auth.CredentialsProvider
+	host   string
+}
+
+// CdnManagerOptions 为构建 CdnManager 的选项
+//
+//	Host		CDN 服务地址，为空时使用 FusionHost，参考 SetHost
+//	Transport	发送请求使用的 http.RoundTripper，为 nil 时使用 client.Client 的 Transport
+type CdnManagerOptions struct {
+	Host      string
+	Transport http.RoundTripper
 }
 
 // NewCdnManager 用来构建一个新的 CdnManager
 func NewCdnManager(mac *auth.Credentials) *CdnManager {
-	return &CdnManager{mac: mac}
+	return NewCdnManagerEx(mac, nil, nil)
+}
+
+// NewCdnManagerWithProvider 用来构建一个使用 provider 获取密钥的 CdnManager
+// 每个请求都会通过 provider 获取密钥，因此更换密钥不需要重新构建 CdnManager
+func NewCdnManagerWithProvider(provider auth.CredentialsProvider) *CdnManager {
+	return NewCdnManagerEx(provider, nil, nil)
+}
+
+// NewCdnManagerEx 用来构建一个使用 clt 发送请求的 CdnManager，clt 为 nil 时使用 client.DefaultClient
+// 请求会经过 clt 的重试策略，中间件和日志，opts 可以为 nil
+// 指定了 opts.Transport 时 CdnManager 会复制 clt，不会修改它
+func NewCdnManagerEx(mac auth.CredentialsProvider, clt *client.Client, opts *CdnManagerOptions) *CdnManager {
+	if clt == nil {
+		clt = &client.DefaultClient
+	}
+	if opts == nil {
+		opts = &CdnManagerOptions{}
+	}
+	if opts.Transport != nil {
+		c := *clt
+		hc := http.Client{}
+		if c.Client != nil {
+			hc = *c.Client
+		}
+		hc.Transport = opts.Transport
+		c.Client = &hc
+		clt = &c
+	}
+	return &CdnManager{client: clt, mac: mac, host: opts.Host}
+}
+
+// SetHost 设置这个 CdnManager 使用的 CDN 服务地址，比如私有云的地址，为空时使用 FusionHost
+// 需要在发送请求之前设置，参考 endpoints.Profile
+func (m *CdnManager) SetHost(host string) {
+	m.host = host
+}
+
+func (m *CdnManager) apiHost() string {
+	if m.host == "" {
+		return FusionHost
+	}
+	return endpoints.URL(m.host, strings.HasPrefix(FusionHost, "https://"))
 }
 
 // TrafficReq 为批量查询带宽/流量的API请求内容
@@ -59,6 +114,12 @@ type TrafficData struct {
 //	Granularity	string		必须	粒度，取值：5min ／ hour ／day
 //	Domains		[]string	必须	域名列表
 func (m *CdnManager) GetBandwidthData(startDate, endDate, granularity string,
+	domainList []string) (bandwidthData TrafficResp, err error) {
+	return m.GetBandwidthDataContext(context.Background(), startDate, endDate, granularity, domainList)
+}
+
+// GetBandwidthDataContext 和 GetBandwidthData 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) GetBandwidthDataContext(ctx context.Context, startDate, endDate, granularity string,
 	domainList []string) (bandwidthData TrafficResp, err error) {
 	domains := strings.Join(domainList, ";")
 	reqBody := TrafficReq{
@@ -68,16 +129,18 @@ func (m *CdnManager) GetBandwidthData(startDate, endDate, granularity string,
 		Domains:     domains,
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/bandwidth", reqBody)
+	resData, reqErr := m.postRequest(client.WithIdempotent(ctx, true), "/v2/tune/bandwidth", reqBody)
 	if reqErr != nil {
 		err = reqErr
 		return
 	}
-	umErr := json.Unmarshal(resData, &bandwidthData)
-	if umErr != nil {
-		err = umErr
+	if decodeErr := json.Unmarshal(resData, &bandwidthData); decodeErr != nil {
+		err = &CdnError{Op: "/v2/tune/bandwidth", Err: decodeErr}
 		return
 	}
+
+	err = checkCode("/v2/tune/bandwidth", bandwidthData.Code, bandwidthData.Error)
+
 	return
 }
 
@@ -87,6 +150,12 @@ func (m *CdnManager) GetBandwidthData(startDate, endDate, granularity string,
 //	Granularity	string		必须	粒度，取值：5min ／ hour ／day
 //	Domains		[]string	必须	域名列表
 func (m *CdnManager) GetFluxData(startDate, endDate, granularity string,
+	domainList []string) (fluxData TrafficResp, err error) {
+	return m.GetFluxDataContext(context.Background(), startDate, endDate, granularity, domainList)
+}
+
+// GetFluxDataContext 和 GetFluxData 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) GetFluxDataContext(ctx context.Context, startDate, endDate, granularity string,
 	domainList []string) (fluxData TrafficResp, err error) {
 	domains := strings.Join(domainList, ";")
 	reqBody := TrafficReq{
@@ -96,18 +165,19 @@ func (m *CdnManager) GetFluxData(startDate, endDate, granularity string,
 		Domains:     domains,
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/flux", reqBody)
+	resData, reqErr := m.postRequest(client.WithIdempotent(ctx, true), "/v2/tune/flux", reqBody)
 	if reqErr != nil {
 		err = reqErr
 		return
 	}
 
-	umErr := json.Unmarshal(resData, &fluxData)
-	if umErr != nil {
-		err = umErr
+	if decodeErr := json.Unmarshal(resData, &fluxData); decodeErr != nil {
+		err = &CdnError{Op: "/v2/tune/flux", Err: decodeErr}
 		return
 	}
 
+	err = checkCode("/v2/tune/flux", fluxData.Code, fluxData.Error)
+
 	return
 }
 
@@ -136,6 +206,11 @@ type RefreshResp struct {
 // dirs	要刷新的目录url列表，单次方法调用总数不超过10条；目录dir，即表示一个目录级的url，
 // 例如：http://bar.foo.com/dir/，
 func (m *CdnManager) RefreshUrlsAndDirs(urls, dirs []string) (result RefreshResp, err error) {
+	return m.RefreshUrlsAndDirsContext(context.Background(), urls, dirs)
+}
+
+// RefreshUrlsAndDirsContext 和 RefreshUrlsAndDirs 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) RefreshUrlsAndDirsContext(ctx context.Context, urls, dirs []string) (result RefreshResp, err error) {
 	if len(urls) > 100 {
 		err = errors.New("urls count exceeds the limit of 100")
 		return
@@ -150,28 +225,39 @@ func (m *CdnManager) RefreshUrlsAndDirs(urls, dirs []string) (result RefreshResp
 		Dirs: dirs,
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/refresh", reqBody)
+	resData, reqErr := m.postRequest(ctx, "/v2/tune/refresh", reqBody)
 	if reqErr != nil {
 		err = reqErr
 		return
 	}
-	umErr := json.Unmarshal(resData, &result)
-	if umErr != nil {
-		err = reqErr
+	if decodeErr := json.Unmarshal(resData, &result); decodeErr != nil {
+		err = &CdnError{Op: "/v2/tune/refresh", Err: decodeErr}
 		return
 	}
 
+	err = checkCode("/v2/tune/refresh", result.Code, result.Error)
+
 	return
 }
 
 // RefreshUrls 刷新文件
 func (m *CdnManager) RefreshUrls(urls []string) (result RefreshResp, err error) {
-	return m.RefreshUrlsAndDirs(urls, nil)
+	return m.RefreshUrlsContext(context.Background(), urls)
+}
+
+// RefreshUrlsContext 和 RefreshUrls 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) RefreshUrlsContext(ctx context.Context, urls []string) (result RefreshResp, err error) {
+	return m.RefreshUrlsAndDirsContext(ctx, urls, nil)
 }
 
 // RefreshDirs 刷新目录
 func (m *CdnManager) RefreshDirs(dirs []string) (result RefreshResp, err error) {
-	return m.RefreshUrlsAndDirs(nil, dirs)
+	return m.RefreshDirsContext(context.Background(), dirs)
+}
+
+// RefreshDirsContext 和 RefreshDirs 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) RefreshDirsContext(ctx context.Context, dirs []string) (result RefreshResp, err error) {
+	return m.RefreshUrlsAndDirsContext(ctx, nil, dirs)
 }
 
 // PrefetchReq 文件预取请求内容
@@ -191,6 +277,11 @@ type PrefetchResp struct {
 
 // PrefetchUrls 预取文件链接，每次最多不可以超过100条
 func (m *CdnManager) PrefetchUrls(urls []string) (result PrefetchResp, err error) {
+	return m.PrefetchUrlsContext(context.Background(), urls)
+}
+
+// PrefetchUrlsContext 和 PrefetchUrls 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) PrefetchUrlsContext(ctx context.Context, urls []string) (result PrefetchResp, err error) {
 	if len(urls) > 100 {
 		err = errors.New("urls count exceeds the limit of 100")
 		return
@@ -200,18 +291,19 @@ func (m *CdnManager) PrefetchUrls(urls []string) (result PrefetchResp, err error
 		Urls: urls,
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/prefetch", reqBody)
+	resData, reqErr := m.postRequest(ctx, "/v2/tune/prefetch", reqBody)
 	if reqErr != nil {
 		err = reqErr
 		return
 	}
 
-	umErr := json.Unmarshal(resData, &result)
-	if umErr != nil {
-		err = umErr
+	if decodeErr := json.Unmarshal(resData, &result); decodeErr != nil {
+		err = &CdnError{Op: "/v2/tune/prefetch", Err: decodeErr}
 		return
 	}
 
+	err = checkCode("/v2/tune/prefetch", result.Code, result.Error)
+
 	return
 }
 
@@ -238,6 +330,12 @@ type LogDomainInfo struct {
 
 // GetCdnLogList 获取CDN域名访问日志的下载链接
 func (m *CdnManager) GetCdnLogList(day string, domains []string) (
+	listLogResult ListLogResult, err error) {
+	return m.GetCdnLogListContext(context.Background(), day, domains)
+}
+
+// GetCdnLogListContext 和 GetCdnLogList 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) GetCdnLogListContext(ctx context.Context, day string, domains []string) (
 	listLogResult ListLogResult, err error) {
 	//new log query request
 	logReq := ListLogRequest{
@@ -245,55 +343,55 @@ func (m *CdnManager) GetCdnLogList(day string, domains []string) (
 		Domains: strings.Join(domains, ";"),
 	}
 
-	resData, reqErr := postRequest(m.mac, "/v2/tune/log/list", logReq)
+	resData, reqErr := m.postRequest(client.WithIdempotent(ctx, true), "/v2/tune/log/list", logReq)
 	if reqErr != nil {
-		err = fmt.Errorf("get response error, %s", reqErr)
+		err = reqErr
 		return
 	}
 
 	if decodeErr := json.Unmarshal(resData, &listLogResult); decodeErr != nil {
-		err = fmt.Errorf("get response error, %s", decodeErr)
+		err = &CdnError{Op: "/v2/tune/log/list", Err: decodeErr}
 		return
 	}
 
-	if listLogResult.Error != "" {
-		err = fmt.Errorf("get log list error, %d %s", listLogResult.Code, listLogResult.Error)
-		return
-	}
+	err = checkCode("/v2/tune/log/list", listLogResult.Code, listLogResult.Error)
 
 	return
 }
 
-// RequestWithBody 带body对api发出请求并且返回response body
-func postRequest(mac *auth.Credentials, path string, body interface{}) (resData []byte,
+// postRequest 带body对api发出请求并且返回response body
+func (m *CdnManager) postRequest(ctx context.Context, path string, body interface{}) (resData []byte,
 	err error) {
-	urlStr := fmt.Sprintf("%s%s", FusionHost, path)
-	reqData, _ := json.Marshal(body)
-	req, reqErr := http.NewRequest("POST", urlStr, bytes.NewReader(reqData))
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
+	return m.doRequest(ctx, "POST", path, body)
+}
 
-	accessToken, signErr := mac.SignRequest(req)
-	if signErr != nil {
-		err = signErr
-		return
+// doRequest 对api发出请求并且返回response body，body 为 nil 时不发送请求内容
+// 出错时返回 *CdnError
+func (m *CdnManager) doRequest(ctx context.Context, method, path string, body interface{}) (resData []byte,
+	err error) {
+	urlStr := fmt.Sprintf("%s%s", m.apiHost(), path)
+	// 通过 m.client 发送请求，使用它的重试策略，每次重试都重新签名
+	ctx = auth.WithCredentialsProviderType(ctx, m.mac, auth.TokenQBox)
+	var resp *http.Response
+	var respErr error
+	if body == nil {
+		resp, respErr = m.client.DoRequest(ctx, method, urlStr, nil)
+	} else {
+		resp, respErr = m.client.DoRequestWithJson(ctx, method, urlStr, nil, body)
 	}
-
-	req.Header.Add("Authorization", "QBox "+accessToken)
-	req.Header.Add("Content-Type", "application/json")
-
-	resp, respErr := http.DefaultClient.Do(req)
 	if respErr != nil {
-		err = respErr
+		err = &CdnError{Op: path, Err: respErr}
 		return
 	}
 	defer resp.Body.Close()
 
 	resData, ioErr := ioutil.ReadAll(resp.Body)
 	if ioErr != nil {
-		err = ioErr
+		err = &CdnError{Op: path, HTTPCode: resp.StatusCode, Reqid: resp.Header.Get("X-Reqid"), Err: ioErr}
+		return
+	}
+	if resp.StatusCode/100 != 2 {
+		err = newResponseError(path, client.NewResponseError(resp, resData))
 		return
 	}
 
@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"os"
 	"testing"
-	"time"
 
 	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client/httpreplay"
 )
 
 //global variables
@@ -16,12 +16,27 @@ var (
 	sk     = os.Getenv("secretKey")
 	domain = os.Getenv("QINIU_TEST_DOMAIN")
 
-	layout    = "2006-01-02"
-	now       = time.Now()
-	startDate = now.AddDate(0, 0, -2).Format(layout)
-	endDate   = now.AddDate(0, 0, -1).Format(layout)
-	logDate   = now.AddDate(0, 0, -1).Format(layout)
+	// 日期是请求内容的一部分，需要和 golden 文件中的一致
+	startDate = "2020-07-01"
+	endDate   = "2020-07-02"
+	logDate   = "2020-07-02"
+)
+
+var (
+	mac      *auth.Credentials
+	testUrls []string
+	testDirs []string
+)
 
+func init() {
+	if domain == "" {
+		domain = "gosdk.qiniudn.com"
+	}
+	if ak == "" || sk == "" {
+		mac = auth.New("ak", "sk")
+	} else {
+		mac = auth.New(ak, sk)
+	}
 	testUrls = []string{
 		fmt.Sprintf("http://%s/qiniu.png", domain),
 		fmt.Sprintf("http://%s/qiniu-fetch.png", domain),
@@ -30,17 +45,14 @@ var (
 		fmt.Sprintf("http://%s/gosdkintegration/", domain),
 		fmt.Sprintf("http://%s/gosdkintegration1/", domain),
 	}
-)
-
-var mac *auth.Credentials
-var cdnManager *CdnManager
+}
 
-func init() {
-	if ak == "" || sk == "" {
-		panic("ak/sk should not be empty")
-	}
-	mac = auth.New(ak, sk)
-	cdnManager = NewCdnManager(mac)
+// newReplayCdnManager 返回从 testdata/<name>.json 回放请求的 CdnManager，
+// testdata 中的 golden 文件是按照接口文档构造的示例数据，不是真实服务的录制，
+// 设置 QINIU_HTTP_REPLAY=record 以及 accessKey，secretKey 和 QINIU_TEST_DOMAIN 环境变量可以录制真实的回复替换它们
+func newReplayCdnManager(t *testing.T, name string) *CdnManager {
+	rt := httpreplay.NewForTest(t, name, ak, sk)
+	return NewCdnManagerEx(mac, rt.Client(), nil)
 }
 
 //TestGetBandwidthData
@@ -69,6 +81,7 @@ func TestGetBandwidthData(t *testing.T) {
 		},
 	}
 
+	cdnManager := newReplayCdnManager(t, "bandwidth")
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			ret, err := cdnManager.GetBandwidthData(tc.args.startDate, tc.args.endDate,
@@ -107,6 +120,7 @@ func TestGetFluxData(t *testing.T) {
 		},
 	}
 
+	cdnManager := newReplayCdnManager(t, "flux")
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			ret, err := cdnManager.GetFluxData(tc.args.startDate, tc.args.endDate,
@@ -139,6 +153,7 @@ func TestRefreshUrls(t *testing.T) {
 		},
 	}
 
+	cdnManager := newReplayCdnManager(t, "refresh_urls")
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			ret, err := cdnManager.RefreshUrls(tc.args.urls)
@@ -170,6 +185,7 @@ func TestRefreshDirs(t *testing.T) {
 		},
 	}
 
+	cdnManager := newReplayCdnManager(t, "refresh_dirs")
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			ret, err := cdnManager.RefreshDirs(tc.args.dirs)
@@ -206,6 +222,7 @@ func TestPrefetchUrls(t *testing.T) {
 		},
 	}
 
+	cdnManager := newReplayCdnManager(t, "prefetch")
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			ret, err := cdnManager.PrefetchUrls(tc.args.urls)
@@ -238,6 +255,7 @@ func TestGetCdnLogList(t *testing.T) {
 		},
 	}
 
+	cdnManager := newReplayCdnManager(t, "log_list")
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			_, err := cdnManager.GetCdnLogList(tc.args.date, tc.args.domains)
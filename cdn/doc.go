@@ -1,3 +1,3 @@
 // cdn 包提供了 Fusion CDN的常见功能。相关功能的文档参考：https://developer.qiniu.com/fusion。
-// 目前提供了文件和目录刷新，文件预取，获取域名带宽和流量数据，获取域名日志列表等功能。
+// 目前提供了文件和目录刷新，文件预取，获取域名带宽，流量，命中率，状态码，排行和运营商等统计数据，获取域名日志列表，下载和解析访问日志，域名的创建和配置管理，证书管理，防盗链链接的生成和校验等功能。
 package cdn
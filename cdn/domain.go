@@ -0,0 +1,483 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+// 域名类型
+const (
+	DomainTypeNormal   = "normal"
+	DomainTypeWildcard = "wildcard"
+)
+
+// 域名的使用场景
+const (
+	PlatformWeb      = "web"
+	PlatformDownload = "download"
+	PlatformVod      = "vod"
+)
+
+// 域名的覆盖范围
+const (
+	GeoCoverChina   = "china"
+	GeoCoverForeign = "foreign"
+	GeoCoverGlobal  = "global"
+)
+
+// 域名的访问协议
+const (
+	ProtocolHTTP  = "http"
+	ProtocolHTTPS = "https"
+)
+
+// 域名的操作状态
+const (
+	DomainStateProcessing = "processing"
+	DomainStateSuccess    = "success"
+	DomainStateFailed     = "failed"
+	DomainStateFrozen     = "frozen"
+	DomainStateOfflined   = "offlined"
+)
+
+// 回源类型
+const (
+	SourceTypeDomain      = "domain"
+	SourceTypeIP          = "ip"
+	SourceTypeQiniuBucket = "qiniuBucket"
+)
+
+// 缓存规则的类型
+const (
+	CacheTypeAll    = "all"
+	CacheTypePath   = "path"
+	CacheTypeSuffix = "suffix"
+	CacheTypeFollow = "follow"
+)
+
+// 缓存时间的单位
+const (
+	CacheTimeUnitSecond = iota
+	CacheTimeUnitMinute
+	CacheTimeUnitHour
+	CacheTimeUnitDay
+	CacheTimeUnitWeek
+	CacheTimeUnitMonth
+	CacheTimeUnitYear
+)
+
+// 防盗链的黑白名单类型
+const (
+	ACLTypeBlack = "black"
+	ACLTypeWhite = "white"
+)
+
+// 响应头的操作
+const (
+	HeaderOpSet = "set"
+	HeaderOpDel = "del"
+)
+
+// ErrEmptyDomainName 表示没有指定域名
+var ErrEmptyDomainName = errors.New("empty domain name")
+
+// DomainSource 为域名的回源配置
+//
+//	SourceType			回源类型，domain/ip/qiniuBucket
+//	SourceHost			回源时使用的 Host，为空时使用加速域名
+//	SourceIPs			回源 IP 列表，SourceType 为 ip 时使用
+//	SourceDomain		回源域名，SourceType 为 domain 时使用
+//	SourceQiniuBucket	回源的七牛空间，SourceType 为 qiniuBucket 时使用
+//	SourceURLScheme		回源协议，http/https，为空时跟随请求的协议
+//	TestURLPath			用来检查回源是否正常的资源路径
+type DomainSource struct {
+	SourceType        string   `json:"sourceType"`
+	SourceHost        string   `json:"sourceHost,omitempty"`
+	SourceIPs         []string `json:"sourceIPs,omitempty"`
+	SourceDomain      string   `json:"sourceDomain,omitempty"`
+	SourceQiniuBucket string   `json:"sourceQiniuBucket,omitempty"`
+	SourceURLScheme   string   `json:"sourceURLScheme,omitempty"`
+	TestURLPath       string   `json:"testURLPath,omitempty"`
+}
+
+// NewBucketSource 返回回源到七牛空间 bucket 的配置
+func NewBucketSource(bucket string) DomainSource {
+	return DomainSource{SourceType: SourceTypeQiniuBucket, SourceQiniuBucket: bucket}
+}
+
+// NewURLSource 返回回源到 originURL 的配置，originURL 的 Host 是 IP 时按 IP 回源，否则按域名回源
+// originURL 中的协议作为回源协议，比如 https://origin.example.com
+func NewURLSource(originURL string) (source DomainSource, err error) {
+	u, err := url.Parse(originURL)
+	if err != nil {
+		return
+	}
+	if u.Host == "" {
+		err = fmt.Errorf("invalid origin url %q", originURL)
+		return
+	}
+	source.SourceURLScheme = u.Scheme
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		source.SourceType = SourceTypeIP
+		source.SourceIPs = []string{u.Host}
+	} else {
+		source.SourceType = SourceTypeDomain
+		source.SourceDomain = u.Host
+	}
+	return
+}
+
+// CacheControl 为一条缓存规则
+//
+//	Type		规则类型，all/path/suffix/follow
+//	Rule		规则内容，比如路径 /images/ 或者后缀 .jpg;.png，多个用 ; 分隔
+//	Time		缓存时间，0 表示不缓存
+//	TimeUnit	缓存时间的单位，参考 CacheTimeUnitSecond 等
+type CacheControl struct {
+	Type     string `json:"type"`
+	Rule     string `json:"rule"`
+	Time     int    `json:"time"`
+	TimeUnit int    `json:"timeunit"`
+}
+
+// DomainCache 为域名的缓存配置
+//
+//	CacheControls	缓存规则，按顺序匹配
+//	IgnoreParam		缓存时是否忽略 URL 中的参数
+type DomainCache struct {
+	CacheControls []CacheControl `json:"cacheControls"`
+	IgnoreParam   bool           `json:"ignoreParam"`
+}
+
+// DomainReferer 为域名的 Referer 防盗链配置
+//
+//	RefererType		black/white，为空时关闭 Referer 防盗链
+//	RefererValues	Referer 列表，支持 *.example.com 这样的通配
+//	NullReferer		是否允许空 Referer
+type DomainReferer struct {
+	RefererType   string   `json:"refererType"`
+	RefererValues []string `json:"refererValues"`
+	NullReferer   bool     `json:"nullReferer"`
+}
+
+// DomainIPACL 为域名的 IP 黑白名单配置
+//
+//	IPACLType	black/white，为空时关闭 IP 黑白名单
+//	IPACLValues	IP 或者 IP 段列表
+type DomainIPACL struct {
+	IPACLType   string   `json:"ipACLType"`
+	IPACLValues []string `json:"ipACLValues"`
+}
+
+// DomainTimeACL 为域名的时间戳防盗链配置，参考 CreateTimestampAntileechURL
+//
+//	Enable		是否开启
+//	TimeACLKeys	加密密钥，最多两个，更换密钥时可以同时使用新旧两个密钥
+//	CheckURL	用来检查配置是否正确的链接
+type DomainTimeACL struct {
+	Enable      bool     `json:"enable"`
+	TimeACLKeys []string `json:"timeACLKeys"`
+	CheckURL    string   `json:"checkUrl,omitempty"`
+}
+
+// DomainHTTPS 为域名的 HTTPS 配置
+//
+//	CertID		证书 ID
+//	ForceHTTPS	是否强制把 HTTP 请求跳转到 HTTPS
+//	HTTP2Enable	是否开启 HTTP/2
+type DomainHTTPS struct {
+	CertID      string `json:"certId"`
+	ForceHTTPS  bool   `json:"forceHttps"`
+	HTTP2Enable bool   `json:"http2Enable"`
+}
+
+// ResponseHeaderControl 为一条响应头配置
+//
+//	Op		操作，set/del
+//	Key		响应头名称
+//	Value	响应头的值，Op 为 del 时不需要
+type ResponseHeaderControl struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// CreateDomainReq 为创建域名的请求内容
+//
+//	Type		域名类型，normal/wildcard，为空时为 normal
+//	Platform	使用场景，web/download/vod
+//	GeoCover	覆盖范围，china/foreign/global
+//	Protocol	访问协议，http/https，使用 https 时需要设置 HTTPS
+//	Source		回源配置，参考 NewBucketSource 和 NewURLSource
+type CreateDomainReq struct {
+	Type     string         `json:"type,omitempty"`
+	Platform string         `json:"platform"`
+	GeoCover string         `json:"geoCover"`
+	Protocol string         `json:"protocol"`
+	Source   DomainSource   `json:"source"`
+	Cache    *DomainCache   `json:"cache,omitempty"`
+	Referer  *DomainReferer `json:"referer,omitempty"`
+	IPACL    *DomainIPACL   `json:"ipACL,omitempty"`
+	TimeACL  *DomainTimeACL `json:"timeACL,omitempty"`
+	HTTPS    *DomainHTTPS   `json:"https,omitempty"`
+}
+
+// DomainInfo 为域名的详细信息
+type DomainInfo struct {
+	Name                   string                  `json:"name"`
+	Type                   string                  `json:"type"`
+	CName                  string                  `json:"cname"`
+	Platform               string                  `json:"platform"`
+	GeoCover               string                  `json:"geoCover"`
+	Protocol               string                  `json:"protocol"`
+	OperationType          string                  `json:"operationType"`
+	OperatingState         string                  `json:"operatingState"`
+	OperatingStateDesc     string                  `json:"operatingStateDesc"`
+	CreateAt               string                  `json:"createAt"`
+	ModifyAt               string                  `json:"modifyAt"`
+	Source                 DomainSource            `json:"source"`
+	Cache                  DomainCache             `json:"cache"`
+	Referer                DomainReferer           `json:"referer"`
+	IPACL                  DomainIPACL             `json:"ipACL"`
+	TimeACL                DomainTimeACL           `json:"timeACL"`
+	HTTPS                  DomainHTTPS             `json:"https"`
+	ResponseHeaderControls []ResponseHeaderControl `json:"responseHeaderControls"`
+}
+
+// ListDomainsResp 为列举域名的响应内容，Marker 为空时表示没有更多的域名
+type ListDomainsResp struct {
+	Marker  string       `json:"marker"`
+	Domains []DomainInfo `json:"domains"`
+}
+
+// CreateDomain 创建加速域名，创建是异步的，可以通过 GetDomain 查询 OperatingState
+func (m *CdnManager) CreateDomain(name string, req CreateDomainReq) error {
+	return m.CreateDomainContext(context.Background(), name, req)
+}
+
+// CreateDomainContext 和 CreateDomain 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) CreateDomainContext(ctx context.Context, name string, req CreateDomainReq) error {
+	return m.domainCall(ctx, "POST", name, "", req, nil)
+}
+
+// CreateBucketDomain 创建回源到七牛空间 bucket 的加速域名，使用场景为 web，覆盖范围为中国大陆，协议为 http
+func (m *CdnManager) CreateBucketDomain(name, bucket string) error {
+	return m.CreateBucketDomainContext(context.Background(), name, bucket)
+}
+
+// CreateBucketDomainContext 和 CreateBucketDomain 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) CreateBucketDomainContext(ctx context.Context, name, bucket string) error {
+	return m.CreateDomainContext(ctx, name, CreateDomainReq{
+		Platform: PlatformWeb,
+		GeoCover: GeoCoverChina,
+		Protocol: ProtocolHTTP,
+		Source:   NewBucketSource(bucket),
+	})
+}
+
+// CreateURLDomain 创建回源到 originURL 的加速域名，使用场景为 web，覆盖范围为中国大陆，协议为 http
+func (m *CdnManager) CreateURLDomain(name, originURL string) error {
+	return m.CreateURLDomainContext(context.Background(), name, originURL)
+}
+
+// CreateURLDomainContext 和 CreateURLDomain 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) CreateURLDomainContext(ctx context.Context, name, originURL string) error {
+	source, err := NewURLSource(originURL)
+	if err != nil {
+		return err
+	}
+	return m.CreateDomainContext(ctx, name, CreateDomainReq{
+		Platform: PlatformWeb,
+		GeoCover: GeoCoverChina,
+		Protocol: ProtocolHTTP,
+		Source:   source,
+	})
+}
+
+// GetDomain 获取域名的详细信息
+func (m *CdnManager) GetDomain(name string) (info DomainInfo, err error) {
+	return m.GetDomainContext(context.Background(), name)
+}
+
+// GetDomainContext 和 GetDomain 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) GetDomainContext(ctx context.Context, name string) (info DomainInfo, err error) {
+	err = m.domainCall(client.WithIdempotent(ctx, true), "GET", name, "", nil, &info)
+	return
+}
+
+// ListDomains 列举域名，marker 为上次列举返回的 Marker，第一次列举时为空，limit 为 0 时使用服务端的默认值
+func (m *CdnManager) ListDomains(marker string, limit int) (result ListDomainsResp, err error) {
+	return m.ListDomainsContext(context.Background(), marker, limit)
+}
+
+// ListDomainsContext 和 ListDomains 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) ListDomainsContext(ctx context.Context, marker string, limit int) (result ListDomainsResp, err error) {
+	query := url.Values{}
+	if marker != "" {
+		query.Set("marker", marker)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/domain"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	err = m.call(client.WithIdempotent(ctx, true), "GET", path, nil, &result)
+	return
+}
+
+// OnlineDomain 上线被下线的域名
+func (m *CdnManager) OnlineDomain(name string) error {
+	return m.OnlineDomainContext(context.Background(), name)
+}
+
+// OnlineDomainContext 和 OnlineDomain 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) OnlineDomainContext(ctx context.Context, name string) error {
+	return m.domainCall(ctx, "POST", name, "/online", nil, nil)
+}
+
+// OfflineDomain 下线域名，下线后域名不能访问，但是配置会保留
+func (m *CdnManager) OfflineDomain(name string) error {
+	return m.OfflineDomainContext(context.Background(), name)
+}
+
+// OfflineDomainContext 和 OfflineDomain 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) OfflineDomainContext(ctx context.Context, name string) error {
+	return m.domainCall(ctx, "POST", name, "/offline", nil, nil)
+}
+
+// DeleteDomain 删除域名，只能删除已经下线的域名
+func (m *CdnManager) DeleteDomain(name string) error {
+	return m.DeleteDomainContext(context.Background(), name)
+}
+
+// DeleteDomainContext 和 DeleteDomain 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) DeleteDomainContext(ctx context.Context, name string) error {
+	return m.domainCall(ctx, "DELETE", name, "", nil, nil)
+}
+
+// UpdateDomainSource 修改域名的回源配置
+func (m *CdnManager) UpdateDomainSource(name string, source DomainSource) error {
+	return m.UpdateDomainSourceContext(context.Background(), name, source)
+}
+
+// UpdateDomainSourceContext 和 UpdateDomainSource 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) UpdateDomainSourceContext(ctx context.Context, name string, source DomainSource) error {
+	return m.domainCall(client.WithIdempotent(ctx, true), "PUT", name, "/source", source, nil)
+}
+
+// UpdateDomainCache 修改域名的缓存规则
+func (m *CdnManager) UpdateDomainCache(name string, cache DomainCache) error {
+	return m.UpdateDomainCacheContext(context.Background(), name, cache)
+}
+
+// UpdateDomainCacheContext 和 UpdateDomainCache 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) UpdateDomainCacheContext(ctx context.Context, name string, cache DomainCache) error {
+	return m.domainCall(client.WithIdempotent(ctx, true), "PUT", name, "/cache", cache, nil)
+}
+
+// UpdateDomainReferer 修改域名的 Referer 防盗链配置
+func (m *CdnManager) UpdateDomainReferer(name string, referer DomainReferer) error {
+	return m.UpdateDomainRefererContext(context.Background(), name, referer)
+}
+
+// UpdateDomainRefererContext 和 UpdateDomainReferer 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) UpdateDomainRefererContext(ctx context.Context, name string, referer DomainReferer) error {
+	body := struct {
+		Referer DomainReferer `json:"referer"`
+	}{referer}
+	return m.domainCall(client.WithIdempotent(ctx, true), "PUT", name, "/referer", body, nil)
+}
+
+// UpdateDomainIPACL 修改域名的 IP 黑白名单
+func (m *CdnManager) UpdateDomainIPACL(name string, ipACL DomainIPACL) error {
+	return m.UpdateDomainIPACLContext(context.Background(), name, ipACL)
+}
+
+// UpdateDomainIPACLContext 和 UpdateDomainIPACL 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) UpdateDomainIPACLContext(ctx context.Context, name string, ipACL DomainIPACL) error {
+	body := struct {
+		IPACL DomainIPACL `json:"ipACL"`
+	}{ipACL}
+	return m.domainCall(client.WithIdempotent(ctx, true), "PUT", name, "/ipacl", body, nil)
+}
+
+// UpdateDomainTimeACL 修改域名的时间戳防盗链配置
+func (m *CdnManager) UpdateDomainTimeACL(name string, timeACL DomainTimeACL) error {
+	return m.UpdateDomainTimeACLContext(context.Background(), name, timeACL)
+}
+
+// UpdateDomainTimeACLContext 和 UpdateDomainTimeACL 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) UpdateDomainTimeACLContext(ctx context.Context, name string, timeACL DomainTimeACL) error {
+	body := struct {
+		TimeACL DomainTimeACL `json:"timeACL"`
+	}{timeACL}
+	return m.domainCall(client.WithIdempotent(ctx, true), "PUT", name, "/timeacl", body, nil)
+}
+
+// UpdateDomainHTTPS 修改 https 域名的证书，强制 HTTPS 和 HTTP/2 配置
+func (m *CdnManager) UpdateDomainHTTPS(name string, https DomainHTTPS) error {
+	return m.UpdateDomainHTTPSContext(context.Background(), name, https)
+}
+
+// UpdateDomainHTTPSContext 和 UpdateDomainHTTPS 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) UpdateDomainHTTPSContext(ctx context.Context, name string, https DomainHTTPS) error {
+	return m.domainCall(client.WithIdempotent(ctx, true), "PUT", name, "/httpsconf", https, nil)
+}
+
+// EnableDomainHTTPS 把 http 域名升级为 https 域名
+func (m *CdnManager) EnableDomainHTTPS(name string, https DomainHTTPS) error {
+	return m.EnableDomainHTTPSContext(context.Background(), name, https)
+}
+
+// EnableDomainHTTPSContext 和 EnableDomainHTTPS 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) EnableDomainHTTPSContext(ctx context.Context, name string, https DomainHTTPS) error {
+	return m.domainCall(client.WithIdempotent(ctx, true), "PUT", name, "/sslize", https, nil)
+}
+
+// UpdateDomainResponseHeaders 修改域名的响应头配置，controls 会覆盖原来的配置
+func (m *CdnManager) UpdateDomainResponseHeaders(name string, controls []ResponseHeaderControl) error {
+	return m.UpdateDomainResponseHeadersContext(context.Background(), name, controls)
+}
+
+// UpdateDomainResponseHeadersContext 和 UpdateDomainResponseHeaders 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) UpdateDomainResponseHeadersContext(ctx context.Context, name string, controls []ResponseHeaderControl) error {
+	body := struct {
+		ResponseHeaderControls []ResponseHeaderControl `json:"responseHeaderControls"`
+	}{controls}
+	if body.ResponseHeaderControls == nil {
+		body.ResponseHeaderControls = []ResponseHeaderControl{}
+	}
+	return m.domainCall(client.WithIdempotent(ctx, true), "PUT", name, "/responseheader", body, nil)
+}
+
+// domainCall 对域名 name 的 /domain/<name><action> 接口发出请求
+func (m *CdnManager) domainCall(ctx context.Context, method, name, action string, body, ret interface{}) error {
+	if name == "" {
+		return ErrEmptyDomainName
+	}
+	return m.call(ctx, method, "/domain/"+url.PathEscape(name)+action, body, ret)
+}
+
+// call 发出请求，ret 不为 nil 时把响应内容解析到 ret
+func (m *CdnManager) call(ctx context.Context, method, path string, body, ret interface{}) error {
+	resData, err := m.doRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	if ret == nil || len(resData) == 0 {
+		return nil
+	}
+	if decodeErr := json.Unmarshal(resData, ret); decodeErr != nil {
+		return &CdnError{Op: path, Err: decodeErr}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package cdn
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+func newDomainServer(t *testing.T, handler func(w http.ResponseWriter, req *http.Request)) (*CdnManager, *[]recordedRequest) {
+	var requests []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "QBox ak:") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		requests = append(requests, recordedRequest{req.Method, req.URL.RequestURI(), string(body)})
+		handler(w, req)
+	}))
+	t.Cleanup(srv.Close)
+	m := NewCdnManager(auth.New("ak", "sk"))
+	m.SetHost(srv.URL)
+	return m, &requests
+}
+
+func TestNewURLSource(t *testing.T) {
+	source, err := NewURLSource("https://origin.example.com")
+	if err != nil || source.SourceType != SourceTypeDomain || source.SourceDomain != "origin.example.com" || source.SourceURLScheme != "https" {
+		t.Errorf("NewURLSource() = %+v, %v", source, err)
+	}
+	source, err = NewURLSource("http://1.2.3.4:8080")
+	if err != nil || source.SourceType != SourceTypeIP || source.SourceIPs[0] != "1.2.3.4:8080" {
+		t.Errorf("NewURLSource() = %+v, %v", source, err)
+	}
+	if _, err = NewURLSource("origin.example.com"); err == nil {
+		t.Errorf("NewURLSource() should fail without scheme")
+	}
+}
+
+func TestDomainLifecycle(t *testing.T) {
+	m, requests := newDomainServer(t, func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "GET" && req.URL.Path == "/domain":
+			w.Write([]byte(`{"marker":"","domains":[{"name":"a.example.com","operatingState":"success"}]}`))
+		case req.Method == "GET":
+			w.Write([]byte(`{"name":"a.example.com","cname":"a.example.com.qiniudns.com","source":{"sourceType":"qiniuBucket","sourceQiniuBucket":"b"}}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	})
+
+	if err := m.CreateBucketDomain("a.example.com", "b"); err != nil {
+		t.Fatalf("CreateBucketDomain() error: %v", err)
+	}
+	var created CreateDomainReq
+	json.Unmarshal([]byte((*requests)[0].Body), &created)
+	if (*requests)[0].Method != "POST" || (*requests)[0].Path != "/domain/a.example.com" ||
+		created.Source.SourceQiniuBucket != "b" || created.Platform != PlatformWeb {
+		t.Errorf("unexpected create request: %+v", (*requests)[0])
+	}
+
+	info, err := m.GetDomain("a.example.com")
+	if err != nil || info.CName != "a.example.com.qiniudns.com" || info.Source.SourceType != SourceTypeQiniuBucket {
+		t.Errorf("GetDomain() = %+v, %v", info, err)
+	}
+	list, err := m.ListDomains("m", 10)
+	if err != nil || len(list.Domains) != 1 || list.Domains[0].OperatingState != DomainStateSuccess {
+		t.Errorf("ListDomains() = %+v, %v", list, err)
+	}
+
+	calls := []func() error{
+		func() error { return m.OfflineDomain("a.example.com") },
+		func() error { return m.OnlineDomain("a.example.com") },
+		func() error { return m.UpdateDomainSource("a.example.com", NewBucketSource("c")) },
+		func() error {
+			return m.UpdateDomainCache("a.example.com", DomainCache{CacheControls: []CacheControl{
+				{Type: CacheTypeSuffix, Rule: ".jpg;.png", Time: 1, TimeUnit: CacheTimeUnitDay}}})
+		},
+		func() error {
+			return m.UpdateDomainReferer("a.example.com", DomainReferer{RefererType: ACLTypeWhite, RefererValues: []string{"*.example.com"}})
+		},
+		func() error {
+			return m.UpdateDomainIPACL("a.example.com", DomainIPACL{IPACLType: ACLTypeBlack, IPACLValues: []string{"1.2.3.4"}})
+		},
+		func() error {
+			return m.UpdateDomainTimeACL("a.example.com", DomainTimeACL{Enable: true, TimeACLKeys: []string{"key"}})
+		},
+		func() error {
+			return m.UpdateDomainHTTPS("a.example.com", DomainHTTPS{CertID: "cert", ForceHTTPS: true, HTTP2Enable: true})
+		},
+		func() error {
+			return m.UpdateDomainResponseHeaders("a.example.com", []ResponseHeaderControl{{Op: HeaderOpSet, Key: "X-A", Value: "1"}})
+		},
+		func() error { return m.DeleteDomain("a.example.com") },
+	}
+	for _, call := range calls {
+		if err := call(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	want := []recordedRequest{
+		{"GET", "/domain/a.example.com", ""},
+		{"GET", "/domain?limit=10&marker=m", ""},
+		{"POST", "/domain/a.example.com/offline", ""},
+		{"POST", "/domain/a.example.com/online", ""},
+		{"PUT", "/domain/a.example.com/source", `{"sourceType":"qiniuBucket","sourceQiniuBucket":"c"}`},
+		{"PUT", "/domain/a.example.com/cache", `{"cacheControls":[{"type":"suffix","rule":".jpg;.png","time":1,"timeunit":3}],"ignoreParam":false}`},
+		{"PUT", "/domain/a.example.com/referer", `{"referer":{"refererType":"white","refererValues":["*.example.com"],"nullReferer":false}}`},
+		{"PUT", "/domain/a.example.com/ipacl", `{"ipACL":{"ipACLType":"black","ipACLValues":["1.2.3.4"]}}`},
+		{"PUT", "/domain/a.example.com/timeacl", `{"timeACL":{"enable":true,"timeACLKeys":["key"]}}`},
+		{"PUT", "/domain/a.example.com/httpsconf", `{"certId":"cert","forceHttps":true,"http2Enable":true}`},
+		{"PUT", "/domain/a.example.com/responseheader", `{"responseHeaderControls":[{"op":"set","key":"X-A","value":"1"}]}`},
+		{"DELETE", "/domain/a.example.com", ""},
+	}
+	got := (*requests)[1:]
+	if len(got) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDomainError(t *testing.T) {
+	m, _ := newDomainServer(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":404001,"error":"domain not found"}`))
+	})
+	_, err := m.GetDomain("missing.example.com")
+	if !client.IsNotFound(err) {
+		t.Errorf("GetDomain() error = %v, want not found", err)
+	}
+	if err = m.DeleteDomain(""); err != ErrEmptyDomainName {
+		t.Errorf("DeleteDomain() error = %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package cdn
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+// CdnError 是 CdnManager 返回的错误，可以通过 errors.As 获取
+// Err 为底层的错误，比如网络错误或者 *client.ErrorInfo，因此 errors.Is(err, context.Canceled) 和
+// client.IsNotFound(err) 等判断仍然有效
+type CdnError struct {
+	// 接口路径，比如 /v2/tune/refresh
+	Op string
+
+	// HTTP 状态码，没有收到回复时为 0
+	HTTPCode int
+
+	// 接口返回的业务错误码，没有时和 HTTPCode 相同
+	Code int
+
+	// 接口返回的错误信息
+	Message string
+
+	// 请求的 X-Reqid
+	Reqid string
+
+	// 底层的错误
+	Err error
+}
+
+func (e *CdnError) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return fmt.Sprintf("cdn %s: %s", e.Op, e.Err)
+	}
+	return fmt.Sprintf("cdn %s: %d %s", e.Op, e.Code, e.Message)
+}
+
+// Unwrap 返回底层的错误
+func (e *CdnError) Unwrap() error {
+	return e.Err
+}
+
+// newResponseError 把 HTTP 状态码不是 2xx 的回复转换为 *CdnError
+func newResponseError(op string, info *client.ErrorInfo) *CdnError {
+	code := info.Code
+	if info.Errno != 0 {
+		code = info.Errno
+	}
+	return &CdnError{Op: op, HTTPCode: info.Code, Code: code, Message: info.Err, Reqid: info.Reqid, Err: info}
+}
+
+// checkCode 检查回复内容中的 code，0 和 200 表示成功
+func checkCode(op string, code int, message string) error {
+	if code == 0 || code == 200 {
+		return nil
+	}
+	return &CdnError{Op: op, HTTPCode: 200, Code: code, Message: message}
+}
+
+// IsCdnError 判断 err 是否为接口返回的错误，不包括网络错误
+func IsCdnError(err error) bool {
+	var e *CdnError
+	return errors.As(err, &e) && e.HTTPCode != 0
+}
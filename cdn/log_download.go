@@ -0,0 +1,270 @@
+package cdn
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+// 日志下载的默认设置
+var (
+	// DefaultLogDownloadConcurrency 是同时下载的日志文件数
+	DefaultLogDownloadConcurrency = 4
+
+	// DefaultLogDownloadRetries 是每个日志文件下载失败后的重试次数
+	DefaultLogDownloadRetries = 3
+
+	// DefaultLogDownloadRetryInterval 是第一次重试前等待的时间，之后每次重试加倍
+	DefaultLogDownloadRetryInterval = time.Second
+)
+
+// LogDownloadOptions 是下载日志文件的选项
+type LogDownloadOptions struct {
+	// 保存日志文件的目录，不存在时会自动创建，为空时使用当前目录
+	Dir string
+
+	// 同时下载的日志文件数，为 0 时使用 DefaultLogDownloadConcurrency
+	Concurrency int
+
+	// 每个日志文件下载失败后的重试次数，为 0 时使用 DefaultLogDownloadRetries，小于 0 时不重试
+	Retries int
+
+	// 为 true 时同时保存解压后的日志文件，文件名去掉 .gz 后缀
+	Decompress bool
+
+	// 下载使用的 http.Client，为 nil 时 DownloadLogs 使用 CdnManager 的 http.Client，
+	// DownloadLogFiles 使用 client.DefaultClient 的 http.Client
+	Client *http.Client
+}
+
+// LogFile 是一个日志文件的下载结果
+type LogFile struct {
+	// 日志所属的域名
+	Domain string
+
+	// 日志列表中的日志文件信息
+	Info LogDomainInfo
+
+	// 下载的 gzip 压缩的日志文件路径
+	Path string
+
+	// 解压后的日志文件路径，没有设置 Decompress 时为空
+	DecompressedPath string
+
+	// 本地已经有同名并且大小相同的文件，没有重新下载
+	Skipped bool
+
+	// 下载失败的原因
+	Err error
+}
+
+// DownloadLogs 获取 day 这一天 domains 的日志列表并下载所有日志文件，day 的格式为 2006-01-02
+// 返回每个日志文件的下载结果，有日志文件下载失败时 err 为第一个失败的原因
+func (m *CdnManager) DownloadLogs(ctx context.Context, day string, domains []string, opts *LogDownloadOptions) (files []LogFile, err error) {
+	listLogResult, err := m.GetCdnLogListContext(ctx, day, domains)
+	if err != nil {
+		return
+	}
+	o := LogDownloadOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Client == nil {
+		o.Client = m.client.Client
+	}
+	return DownloadLogFiles(ctx, listLogResult.Data, &o)
+}
+
+// DownloadLogFiles 并发下载 GetCdnLogList 返回的日志文件，本地已经有同名并且大小相同的文件时跳过
+// 返回的结果按照域名和文件名排序，有日志文件下载失败时 err 为第一个失败的原因
+func DownloadLogFiles(ctx context.Context, logs map[string][]LogDomainInfo, opts *LogDownloadOptions) (files []LogFile, err error) {
+	if opts == nil {
+		opts = &LogDownloadOptions{}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultLogDownloadConcurrency
+	}
+	if opts.Dir != "" {
+		if err = os.MkdirAll(opts.Dir, 0755); err != nil {
+			return
+		}
+	}
+
+	for domain, infos := range logs {
+		for _, info := range infos {
+			files = append(files, LogFile{Domain: domain, Info: info})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Domain != files[j].Domain {
+			return files[i].Domain < files[j].Domain
+		}
+		return files[i].Info.Name < files[j].Info.Name
+	})
+
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				opts.download(ctx, &files[index])
+			}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, file := range files {
+		if file.Err != nil {
+			err = fmt.Errorf("download %s error, %w", file.Info.Name, file.Err)
+			break
+		}
+	}
+	return
+}
+
+func (opts *LogDownloadOptions) download(ctx context.Context, file *LogFile) {
+	name := filepath.Base(file.Info.Name)
+	file.Path = filepath.Join(opts.Dir, name)
+	if opts.Decompress {
+		file.DecompressedPath = strings.TrimSuffix(file.Path, ".gz")
+		if file.DecompressedPath == file.Path {
+			file.DecompressedPath += ".log"
+		}
+	}
+
+	if fi, err := os.Stat(file.Path); err == nil && fi.Size() == file.Info.Size {
+		file.Skipped = true
+	} else {
+		file.Err = opts.downloadWithRetry(ctx, file)
+		if file.Err != nil {
+			return
+		}
+	}
+	if opts.Decompress {
+		if _, err := os.Stat(file.DecompressedPath); err != nil || !file.Skipped {
+			file.Err = decompressFile(file.Path, file.DecompressedPath)
+		}
+	}
+}
+
+func (opts *LogDownloadOptions) downloadWithRetry(ctx context.Context, file *LogFile) (err error) {
+	retries := opts.Retries
+	if retries == 0 {
+		retries = DefaultLogDownloadRetries
+	}
+	interval := DefaultLogDownloadRetryInterval
+	for attempt := 0; ; attempt++ {
+		err = opts.downloadOnce(ctx, file)
+		if err == nil || attempt >= retries || ctx.Err() != nil {
+			return
+		}
+		var statusErr *logStatusError
+		if errors.As(err, &statusErr) && statusErr.code/100 == 4 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+// logStatusError 是下载日志文件时服务端返回的错误状态码
+type logStatusError struct {
+	code int
+}
+
+func (e *logStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.code)
+}
+
+// downloadOnce 下载日志文件到临时文件，检查大小后重命名，避免留下不完整的文件
+func (opts *LogDownloadOptions) downloadOnce(ctx context.Context, file *LogFile) error {
+	hc := opts.Client
+	if hc == nil {
+		hc = client.DefaultClient.Client
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.Info.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return &logStatusError{code: resp.StatusCode}
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file.Path), filepath.Base(file.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(tmp, resp.Body)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil && file.Info.Size > 0 && n != file.Info.Size {
+		err = fmt.Errorf("size mismatch, want %d, got %d", file.Info.Size, n)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file.Path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// decompressFile 把 gzip 文件 src 解压到 dst
+func decompressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, gr)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,296 @@
+package cdn
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogTimeLayout 是 CDN 日志中请求时间的格式
+const LogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// 缓存命中状态
+const (
+	LogHit  = "HIT"
+	LogMiss = "MISS"
+)
+
+// LogEntry 是 CDN 访问日志中的一条记录，日志格式为:
+//
+//	客户端IP 命中状态 响应时间(毫秒) [请求时间] "请求方法 请求URL 协议" 状态码 响应大小 "Referer" "User-Agent"
+type LogEntry struct {
+	ClientIP     string
+	Hit          string
+	ResponseTime time.Duration
+	Time         time.Time
+	Method       string
+	URL          string
+	Protocol     string
+	StatusCode   int
+	Bytes        int64
+	Referer      string
+	UserAgent    string
+}
+
+// IsHit 判断请求是否命中缓存
+func (e *LogEntry) IsHit() bool {
+	return strings.EqualFold(e.Hit, LogHit)
+}
+
+// ParseLogLine 解析一行 CDN 访问日志，Referer 和 User-Agent 为 "-" 时解析为空字符串
+func ParseLogLine(line string) (entry LogEntry, err error) {
+	fields, err := splitLogLine(line)
+	if err != nil {
+		return
+	}
+	if len(fields) < 9 {
+		err = fmt.Errorf("invalid log line, want at least 9 fields, got %d", len(fields))
+		return
+	}
+
+	entry.ClientIP = fields[0]
+	entry.Hit = fields[1]
+	if fields[2] != "-" {
+		ms, pErr := strconv.ParseInt(fields[2], 10, 64)
+		if pErr != nil {
+			err = fmt.Errorf("invalid response time %q", fields[2])
+			return
+		}
+		entry.ResponseTime = time.Duration(ms) * time.Millisecond
+	}
+	if entry.Time, err = time.Parse(LogTimeLayout, fields[3]); err != nil {
+		err = fmt.Errorf("invalid time %q", fields[3])
+		return
+	}
+	request := strings.Fields(fields[4])
+	if len(request) > 0 {
+		entry.Method = request[0]
+	}
+	if len(request) > 1 {
+		entry.URL = request[1]
+	}
+	if len(request) > 2 {
+		entry.Protocol = request[2]
+	}
+	if entry.StatusCode, err = strconv.Atoi(fields[5]); err != nil {
+		err = fmt.Errorf("invalid status code %q", fields[5])
+		return
+	}
+	if fields[6] != "-" {
+		if entry.Bytes, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+			err = fmt.Errorf("invalid bytes %q", fields[6])
+			return
+		}
+	}
+	entry.Referer = dashToEmpty(fields[7])
+	entry.UserAgent = dashToEmpty(fields[8])
+	return
+}
+
+func dashToEmpty(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// splitLogLine 按空格分割日志，双引号和方括号中的内容作为一个字段
+func splitLogLine(line string) (fields []string, err error) {
+	for i := 0; i < len(line); {
+		switch c := line[i]; c {
+		case ' ', '\t':
+			i++
+		case '"', '[':
+			end := byte('"')
+			if c == '[' {
+				end = ']'
+			}
+			j := i + 1
+			for j < len(line) && line[j] != end {
+				if end == '"' && line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(line) {
+				return nil, fmt.Errorf("invalid log line, unterminated %c", c)
+			}
+			fields = append(fields, line[i+1:j])
+			i = j + 1
+		default:
+			j := i
+			for j < len(line) && line[j] != ' ' && line[j] != '\t' {
+				j++
+			}
+			fields = append(fields, line[i:j])
+			i = j
+		}
+	}
+	return
+}
+
+// LogScanner 逐行读取 CDN 访问日志，用法和 bufio.Scanner 类似:
+//
+//	scanner, err := cdn.NewLogScanner(f)
+//	for scanner.Scan() {
+//		entry := scanner.Entry()
+//	}
+//	if err := scanner.Err(); err != nil {
+//	}
+//
+// 格式不正确的行会被跳过，可以通过 Invalid 获取跳过的行数
+type LogScanner struct {
+	scanner *bufio.Scanner
+	closer  io.Closer
+	entry   LogEntry
+	invalid int
+	err     error
+}
+
+// NewLogScanner 返回一个从 r 读取日志的 LogScanner，r 的内容是 gzip 压缩的时候自动解压
+func NewLogScanner(r io.Reader) (*LogScanner, error) {
+	br := bufio.NewReader(r)
+	s := &LogScanner{}
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		s.closer = gr
+		s.scanner = bufio.NewScanner(gr)
+	} else {
+		s.scanner = bufio.NewScanner(br)
+	}
+	s.scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	return s, nil
+}
+
+// Scan 读取下一条日志，没有更多日志或者出错时返回 false
+func (s *LogScanner) Scan() bool {
+	for s.err == nil && s.scanner.Scan() {
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry, err := ParseLogLine(line)
+		if err != nil {
+			s.invalid++
+			continue
+		}
+		s.entry = entry
+		return true
+	}
+	if s.err == nil {
+		s.err = s.scanner.Err()
+	}
+	if s.closer != nil {
+		s.closer.Close()
+		s.closer = nil
+	}
+	return false
+}
+
+// Entry 返回 Scan 读取的日志
+func (s *LogScanner) Entry() *LogEntry {
+	return &s.entry
+}
+
+// Invalid 返回格式不正确被跳过的行数
+func (s *LogScanner) Invalid() int {
+	return s.invalid
+}
+
+// Err 返回读取日志时遇到的错误
+func (s *LogScanner) Err() error {
+	return s.err
+}
+
+// LogCount 是一个统计项和它的请求数
+type LogCount struct {
+	Key   string
+	Count int64
+}
+
+// LogStats 统计 CDN 访问日志的请求数，流量，命中率，状态码，URL 和 Referer 的分布
+type LogStats struct {
+	Requests    int64
+	Bytes       int64
+	Hits        int64
+	StatusCodes map[int]int64
+
+	urls     map[string]int64
+	referers map[string]int64
+}
+
+// NewLogStats 返回一个空的 LogStats
+func NewLogStats() *LogStats {
+	return &LogStats{
+		StatusCodes: make(map[int]int64),
+		urls:        make(map[string]int64),
+		referers:    make(map[string]int64),
+	}
+}
+
+// Add 统计一条日志
+func (s *LogStats) Add(entry *LogEntry) {
+	s.Requests++
+	s.Bytes += entry.Bytes
+	if entry.IsHit() {
+		s.Hits++
+	}
+	s.StatusCodes[entry.StatusCode]++
+	s.urls[entry.URL]++
+	if entry.Referer != "" {
+		s.referers[entry.Referer]++
+	}
+}
+
+// AddAll 统计 scanner 中剩余的所有日志
+func (s *LogStats) AddAll(scanner *LogScanner) error {
+	for scanner.Scan() {
+		s.Add(scanner.Entry())
+	}
+	return scanner.Err()
+}
+
+// HitRate 返回缓存命中率
+func (s *LogStats) HitRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Requests)
+}
+
+// TopURLs 返回请求数最多的 n 个 URL，n 小于等于 0 时返回全部
+func (s *LogStats) TopURLs(n int) []LogCount {
+	return topN(s.urls, n)
+}
+
+// TopReferers 返回请求数最多的 n 个 Referer，不包括没有 Referer 的请求，n 小于等于 0 时返回全部
+func (s *LogStats) TopReferers(n int) []LogCount {
+	return topN(s.referers, n)
+}
+
+// topN 按请求数从大到小排序，请求数相同时按 Key 排序
+func topN(counts map[string]int64, n int) []LogCount {
+	result := make([]LogCount, 0, len(counts))
+	for key, count := range counts {
+		result = append(result, LogCount{Key: key, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
@@ -0,0 +1,195 @@
+package cdn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+const testLogs = `101.226.66.179 HIT 0 [16/Jul/2016:08:58:23 +0800] "GET http://www.example.com/a.png HTTP/1.1" 200 3236 "http://ref.com/" "Mozilla/5.0 (Windows NT 6.1)"
+101.226.66.180 MISS 12 [16/Jul/2016:08:58:24 +0800] "GET http://www.example.com/b.png HTTP/1.1" 404 100 "-" "-"
+invalid line
+101.226.66.181 HIT 1 [16/Jul/2016:08:58:25 +0800] "GET http://www.example.com/a.png HTTP/1.1" 200 3236 "http://ref.com/" "curl/7.0"
+`
+
+func gzipData(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(data))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseLogLine(t *testing.T) {
+	entry, err := ParseLogLine(strings.Split(testLogs, "\n")[0])
+	if err != nil {
+		t.Fatalf("ParseLogLine() error: %v", err)
+	}
+	want := LogEntry{
+		ClientIP:   "101.226.66.179",
+		Hit:        LogHit,
+		Time:       time.Date(2016, 7, 16, 0, 58, 23, 0, time.UTC),
+		Method:     "GET",
+		URL:        "http://www.example.com/a.png",
+		Protocol:   "HTTP/1.1",
+		StatusCode: 200,
+		Bytes:      3236,
+		Referer:    "http://ref.com/",
+		UserAgent:  "Mozilla/5.0 (Windows NT 6.1)",
+	}
+	if !entry.Time.Equal(want.Time) {
+		t.Errorf("Time = %v, want %v", entry.Time, want.Time)
+	}
+	entry.Time = want.Time
+	if entry != want {
+		t.Errorf("ParseLogLine() = %+v, want %+v", entry, want)
+	}
+
+	if _, err = ParseLogLine(`1.1.1.1 HIT 0 [16/Jul/2016:08:58:23 +0800] "GET /a`); err == nil {
+		t.Errorf("ParseLogLine() should fail on unterminated quote")
+	}
+}
+
+func TestLogScannerAndStats(t *testing.T) {
+	for _, data := range [][]byte{[]byte(testLogs), gzipData(t, testLogs)} {
+		scanner, err := NewLogScanner(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("NewLogScanner() error: %v", err)
+		}
+		stats := NewLogStats()
+		if err = stats.AddAll(scanner); err != nil {
+			t.Fatalf("AddAll() error: %v", err)
+		}
+		if stats.Requests != 3 || stats.Hits != 2 || stats.Bytes != 6572 || scanner.Invalid() != 1 {
+			t.Errorf("unexpected stats: %+v, invalid %d", stats, scanner.Invalid())
+		}
+		if stats.StatusCodes[200] != 2 || stats.StatusCodes[404] != 1 {
+			t.Errorf("unexpected status codes: %v", stats.StatusCodes)
+		}
+		urls := stats.TopURLs(1)
+		if len(urls) != 1 || urls[0] != (LogCount{Key: "http://www.example.com/a.png", Count: 2}) {
+			t.Errorf("TopURLs() = %v", urls)
+		}
+		if referers := stats.TopReferers(0); len(referers) != 1 || referers[0].Count != 2 {
+			t.Errorf("TopReferers() = %v", referers)
+		}
+	}
+}
+
+func TestDownloadLogFiles(t *testing.T) {
+	gz := gzipData(t, testLogs)
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch req.URL.Path {
+		case "/flaky.gz":
+			if n == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+		case "/missing.gz":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(gz)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "cdnlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	interval := DefaultLogDownloadRetryInterval
+	DefaultLogDownloadRetryInterval = time.Millisecond
+	defer func() { DefaultLogDownloadRetryInterval = interval }()
+
+	size := int64(len(gz))
+	logs := map[string][]LogDomainInfo{
+		"a.com": {{Name: "flaky.gz", Size: size, URL: srv.URL + "/flaky.gz"}},
+		"b.com": {{Name: "ok.gz", Size: size, URL: srv.URL + "/ok.gz"}},
+	}
+	opts := &LogDownloadOptions{Dir: dir, Concurrency: 1, Decompress: true}
+	files, err := DownloadLogFiles(context.Background(), logs, opts)
+	if err != nil {
+		t.Fatalf("DownloadLogFiles() error: %v", err)
+	}
+	if len(files) != 2 || files[0].Domain != "a.com" || files[0].Skipped || requests != 3 {
+		t.Fatalf("unexpected result: %+v, requests %d", files, requests)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "ok"))
+	if err != nil || string(data) != testLogs {
+		t.Errorf("decompressed file = %q, %v", data, err)
+	}
+
+	// 已经下载过的文件不再下载
+	files, err = DownloadLogFiles(context.Background(), logs, opts)
+	if err != nil || !files[0].Skipped || !files[1].Skipped || requests != 3 {
+		t.Errorf("files should be skipped: %+v, %v, requests %d", files, err, requests)
+	}
+
+	// 4xx 错误不重试
+	logs = map[string][]LogDomainInfo{"a.com": {{Name: "missing.gz", URL: srv.URL + "/missing.gz"}}}
+	files, err = DownloadLogFiles(context.Background(), logs, opts)
+	if err == nil || files[0].Err == nil || requests != 4 {
+		t.Errorf("want error without retry, got %v, requests %d", err, requests)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "missing.gz")); !os.IsNotExist(err) {
+		t.Errorf("failed download should not leave a file")
+	}
+}
+
+func TestDownloadLogs(t *testing.T) {
+	gz := gzipData(t, testLogs)
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/tune/log/list":
+			w.Write([]byte(`{"code":200,"data":{"a.com":[{"name":"a.gz","size":` + strconv.Itoa(len(gz)) + `,"url":"` + srvURL + `/a.gz"}]}}`))
+		default:
+			w.Write(gz)
+		}
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	dir, err := ioutil.TempDir("", "cdnlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 日志列表和日志文件都通过 CdnManager 的 Client 下载
+	tr := &countingTransport{}
+	m := NewCdnManagerEx(auth.New("ak", "sk"), nil, &CdnManagerOptions{Host: srv.URL, Transport: tr})
+	opts := &LogDownloadOptions{Dir: dir}
+	files, err := m.DownloadLogs(context.Background(), "2020-07-01", []string{"a.com"}, opts)
+	if err != nil || len(files) != 1 || files[0].Path != filepath.Join(dir, "a.gz") {
+		t.Fatalf("DownloadLogs() = %+v, %v", files, err)
+	}
+	if tr.count != 2 || opts.Client != nil {
+		t.Errorf("want 2 requests through manager transport without modifying opts, got %d", tr.count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = m.DownloadLogs(ctx, "2020-07-01", []string{"a.com"}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("DownloadLogs() with canceled ctx error = %v", err)
+	}
+}
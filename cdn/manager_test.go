@@ -0,0 +1,125 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/reqid"
+)
+
+type countingTransport struct {
+	count int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewCdnManagerEx(t *testing.T) {
+	var gotReqid string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotReqid = req.Header.Get("X-Reqid")
+		switch req.URL.Path {
+		case "/domain/missing.com":
+			w.Header().Set("X-Reqid", "server-reqid")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404001,"error":"domain not found"}`))
+		case "/v2/tune/log/list":
+			w.Write([]byte(`{"code":400032,"error":"invalid day"}`))
+		default:
+			w.Write([]byte(`{"code":200,"error":"success","items":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	var seen []string
+	clt := &client.Client{Client: &http.Client{}}
+	clt.Use(func(next client.Handler) client.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			seen = append(seen, req.URL.Path)
+			return next(req)
+		}
+	})
+	tr := &countingTransport{}
+	m := NewCdnManagerEx(auth.New("ak", "sk"), clt, &CdnManagerOptions{Host: srv.URL, Transport: tr})
+	if clt.Client.Transport != nil {
+		t.Errorf("NewCdnManagerEx should not modify clt")
+	}
+
+	ctx := reqid.WithReqid(context.Background(), "my-reqid")
+	if _, err := m.ListRefreshTasksContext(ctx, ListTaskReq{RequestID: "r"}); err != nil {
+		t.Fatalf("ListRefreshTasksContext() error: %v", err)
+	}
+	if gotReqid != "my-reqid" || len(seen) != 1 || tr.count != 1 {
+		t.Errorf("request should go through client and transport, reqid %q, seen %v, transport %d", gotReqid, seen, tr.count)
+	}
+
+	_, err := m.GetDomainContext(ctx, "missing.com")
+	var cdnErr *CdnError
+	if !errors.As(err, &cdnErr) || !client.IsNotFound(err) || !IsCdnError(err) {
+		t.Fatalf("GetDomainContext() error = %#v", err)
+	}
+	if cdnErr.Op != "/domain/missing.com" || cdnErr.HTTPCode != 404 || cdnErr.Code != 404001 ||
+		cdnErr.Message != "domain not found" || cdnErr.Reqid != "server-reqid" {
+		t.Errorf("unexpected error %+v", cdnErr)
+	}
+
+	_, err = m.GetCdnLogListContext(ctx, "2020-07-01", []string{"a.com"})
+	if !errors.As(err, &cdnErr) || cdnErr.HTTPCode != 200 || cdnErr.Code != 400032 || cdnErr.Message != "invalid day" {
+		t.Errorf("GetCdnLogListContext() error = %#v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = m.RefreshUrlsContext(cancelled, []string{"http://a.com/1"})
+	if !errors.Is(err, context.Canceled) || IsCdnError(err) {
+		t.Errorf("RefreshUrlsContext() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestResponseCodeErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/tune/flux":
+			w.Write([]byte(`not json`))
+		default:
+			w.Write([]byte(`{"code":400001,"error":"invalid request"}`))
+		}
+	}))
+	defer srv.Close()
+
+	m := NewCdnManagerEx(auth.New("ak", "sk"), nil, &CdnManagerOptions{Host: srv.URL})
+	ctx := context.Background()
+	calls := map[string]func() error{
+		"/v2/tune/bandwidth": func() error {
+			_, err := m.GetBandwidthDataContext(ctx, "2020-07-01", "2020-07-02", "day", []string{"a.com"})
+			return err
+		},
+		"/v2/tune/refresh": func() error {
+			_, err := m.RefreshUrlsAndDirsContext(ctx, []string{"http://a.com/1"}, nil)
+			return err
+		},
+		"/v2/tune/prefetch": func() error {
+			_, err := m.PrefetchUrlsContext(ctx, []string{"http://a.com/1"})
+			return err
+		},
+	}
+	for op, call := range calls {
+		var cdnErr *CdnError
+		if err := call(); !errors.As(err, &cdnErr) || cdnErr.Op != op || cdnErr.Code != 400001 || cdnErr.Message != "invalid request" {
+			t.Errorf("%s error = %#v", op, err)
+		}
+	}
+
+	_, err := m.GetFluxDataContext(ctx, "2020-07-01", "2020-07-02", "day", []string{"a.com"})
+	var cdnErr *CdnError
+	if !errors.As(err, &cdnErr) || cdnErr.Op != "/v2/tune/flux" || cdnErr.Err == nil {
+		t.Errorf("GetFluxDataContext() with invalid json error = %#v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+// 刷新和预取接口单次请求的数量限制
+const (
+	MaxRefreshUrlsPerRequest  = 100
+	MaxRefreshDirsPerRequest  = 10
+	MaxPrefetchUrlsPerRequest = 100
+)
+
+// DefaultTaskPollInterval 是 RefreshScheduler 查询任务状态的默认间隔
+var DefaultTaskPollInterval = 10 * time.Second
+
+// DefaultMaxTaskPolls 是 RefreshScheduler 默认最多查询任务状态的轮数，使用默认间隔时约为一小时
+var DefaultMaxTaskPolls = 360
+
+// ErrTaskPollLimit 表示查询任务状态的轮数达到上限时仍然有任务没有完成
+var ErrTaskPollLimit = errors.New("cdn: task poll limit exceeded")
+
+// 除了 TaskStateSuccess 和 TaskStateFailure 之外 URLResult 可能的状态
+const (
+	// 链接格式不正确，服务端拒绝了这个链接
+	TaskStateInvalid = "invalid"
+
+	// 当天的刷新或预取额度已经用完，没有提交这个链接
+	TaskStateQuotaExceeded = "quota_exceeded"
+
+	// 无法得到任务的状态，比如查询任务状态返回了不可重试的错误，或者同一次提交的其他任务都已完成但是查询不到这个链接
+	TaskStateUnknown = "unknown"
+)
+
+// URLResult 是一个链接的刷新或预取结果
+type URLResult struct {
+	// 链接
+	URL string
+
+	// 是否为目录刷新
+	Dir bool
+
+	// 提交刷新或预取时返回的 requestId，没有提交时为空
+	RequestID string
+
+	// 任务状态，参考 TaskStateSuccess，TaskStateFailure，TaskStateInvalid，TaskStateQuotaExceeded，TaskStateUnknown，
+	// ctx 结束或者查询轮数达到上限时还没有完成的任务为 TaskStateProcessing
+	State string
+
+	// 提交失败或者查询任务状态失败的原因
+	Err error
+}
+
+// RefreshScheduler 把大量的链接按照接口的限制分批提交刷新或预取，然后查询任务状态直到每个链接都完成
+// 提交时遵守服务端返回的当天剩余额度，额度用完后剩余的链接不再提交
+type RefreshScheduler struct {
+	manager *CdnManager
+
+	// 每批提交的链接数，为 0 时使用接口的限制
+	URLBatchSize      int
+	DirBatchSize      int
+	PrefetchBatchSize int
+
+	// 查询任务状态的间隔，为 0 时使用 DefaultTaskPollInterval
+	PollInterval time.Duration
+
+	// 最多查询任务状态的轮数，为 0 时使用 DefaultMaxTaskPolls，达到上限后返回 ErrTaskPollLimit
+	MaxPolls int
+}
+
+// NewRefreshScheduler 返回一个使用 m 提交任务的 RefreshScheduler
+func NewRefreshScheduler(m *CdnManager) *RefreshScheduler {
+	return &RefreshScheduler{manager: m}
+}
+
+// Refresh 刷新 urls 和 dirs 并等待所有任务完成，返回的结果顺序和 urls，dirs 相同
+// 提交遇到不可重试的错误时剩余的链接不再提交，和提交失败的链接一样标记为 TaskStateFailure
+// ctx 结束时返回已经得到的结果和 ctx 的错误，可以用 context.WithTimeout 限制等待的时间，参考 MaxPolls
+func (s *RefreshScheduler) Refresh(ctx context.Context, urls, dirs []string) ([]URLResult, error) {
+	results := make([]URLResult, 0, len(urls)+len(dirs))
+	for _, u := range urls {
+		results = append(results, URLResult{URL: u})
+	}
+	for _, d := range dirs {
+		results = append(results, URLResult{URL: d, Dir: true})
+	}
+	urlResults, dirResults := results[:len(urls)], results[len(urls):]
+
+	urlBatch := batchSize(s.URLBatchSize, MaxRefreshUrlsPerRequest)
+	dirBatch := batchSize(s.DirBatchSize, MaxRefreshDirsPerRequest)
+	urlSurplus, dirSurplus := -1, -1
+	for len(urlResults) > 0 || len(dirResults) > 0 {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		urlChunk := nextChunk(&urlResults, urlBatch, &urlSurplus)
+		dirChunk := nextChunk(&dirResults, dirBatch, &dirSurplus)
+		if len(urlChunk) == 0 && len(dirChunk) == 0 {
+			break
+		}
+
+		resp, err := s.manager.RefreshUrlsAndDirsContext(ctx, chunkURLs(urlChunk), chunkURLs(dirChunk))
+		if err != nil {
+			setErr(urlChunk, err)
+			setErr(dirChunk, err)
+			if ctx.Err() == nil && !client.IsRetryable(err) {
+				// 和 poll 一样，不可重试的错误(比如认证失败)之后的提交同样会失败，剩余的链接不再提交
+				setErr(urlResults, err)
+				setErr(dirResults, err)
+				break
+			}
+			continue
+		}
+		submitted(urlChunk, resp.RequestID, resp.InvalidUrls)
+		submitted(dirChunk, resp.RequestID, resp.InvalidDirs)
+		urlSurplus, dirSurplus = resp.URLSurplusDay, resp.DirSurplusDay
+		if resp.URLQuotaDay == 0 {
+			urlSurplus = -1
+		}
+		if resp.DirQuotaDay == 0 {
+			dirSurplus = -1
+		}
+	}
+	return results, s.poll(ctx, results, "/v2/tune/refresh/list")
+}
+
+// Prefetch 预取 urls 并等待所有任务完成，返回的结果顺序和 urls 相同
+// 提交遇到不可重试的错误时剩余的链接不再提交，和提交失败的链接一样标记为 TaskStateFailure
+// ctx 结束时返回已经得到的结果和 ctx 的错误，可以用 context.WithTimeout 限制等待的时间，参考 MaxPolls
+func (s *RefreshScheduler) Prefetch(ctx context.Context, urls []string) ([]URLResult, error) {
+	results := make([]URLResult, 0, len(urls))
+	for _, u := range urls {
+		results = append(results, URLResult{URL: u})
+	}
+	pending := results
+
+	batch := batchSize(s.PrefetchBatchSize, MaxPrefetchUrlsPerRequest)
+	surplus := -1
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		chunk := nextChunk(&pending, batch, &surplus)
+		if len(chunk) == 0 {
+			break
+		}
+
+		resp, err := s.manager.PrefetchUrlsContext(ctx, chunkURLs(chunk))
+		if err != nil {
+			setErr(chunk, err)
+			if ctx.Err() == nil && !client.IsRetryable(err) {
+				setErr(pending, err)
+				break
+			}
+			continue
+		}
+		submitted(chunk, resp.RequestID, resp.InvalidUrls)
+		surplus = resp.SurplusDay
+		if resp.QuotaDay == 0 {
+			surplus = -1
+		}
+	}
+	return results, s.poll(ctx, results, "/v2/tune/prefetch/list")
+}
+
+func batchSize(size, limit int) int {
+	if size <= 0 || size > limit {
+		return limit
+	}
+	return size
+}
+
+// nextChunk 从 pending 中取出下一批链接，surplus 不小于 0 时最多取 surplus 个
+// 额度用完时剩余的链接标记为 TaskStateQuotaExceeded
+func nextChunk(pending *[]URLResult, size int, surplus *int) []URLResult {
+	if *surplus >= 0 && size > *surplus {
+		size = *surplus
+	}
+	if size == 0 && len(*pending) > 0 {
+		for i := range *pending {
+			(*pending)[i].State = TaskStateQuotaExceeded
+		}
+		*pending = nil
+		return nil
+	}
+	if size > len(*pending) {
+		size = len(*pending)
+	}
+	chunk := (*pending)[:size]
+	*pending = (*pending)[size:]
+	return chunk
+}
+
+func chunkURLs(chunk []URLResult) []string {
+	if len(chunk) == 0 {
+		return nil
+	}
+	urls := make([]string, len(chunk))
+	for i, r := range chunk {
+		urls[i] = r.URL
+	}
+	return urls
+}
+
+func setErr(chunk []URLResult, err error) {
+	for i := range chunk {
+		chunk[i].State = TaskStateFailure
+		chunk[i].Err = err
+	}
+}
+
+func submitted(chunk []URLResult, requestID string, invalid []string) {
+	invalidSet := make(map[string]bool, len(invalid))
+	for _, u := range invalid {
+		invalidSet[u] = true
+	}
+	for i := range chunk {
+		if invalidSet[chunk[i].URL] {
+			chunk[i].State = TaskStateInvalid
+			continue
+		}
+		chunk[i].RequestID = requestID
+		chunk[i].State = TaskStateProcessing
+	}
+}
+
+// poll 按 requestId 查询任务状态，直到所有已提交的任务都成功，失败或者无法得到状态
+func (s *RefreshScheduler) poll(ctx context.Context, results []URLResult, path string) error {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = DefaultTaskPollInterval
+	}
+	maxPolls := s.MaxPolls
+	if maxPolls <= 0 {
+		maxPolls = DefaultMaxTaskPolls
+	}
+
+	for polls := 0; ; polls++ {
+		pending := make(map[string][]*URLResult)
+		for i := range results {
+			if results[i].State == TaskStateProcessing {
+				pending[results[i].RequestID] = append(pending[results[i].RequestID], &results[i])
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if polls >= maxPolls {
+			return ErrTaskPollLimit
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		for requestID, rs := range pending {
+			states, err := s.taskStates(ctx, path, requestID)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if client.IsRetryable(err) {
+					// 查询失败时下一轮再查询
+					continue
+				}
+				for _, r := range rs {
+					r.State, r.Err = TaskStateUnknown, err
+				}
+				continue
+			}
+			finished := len(states) > 0
+			for _, state := range states {
+				if state != TaskStateSuccess && state != TaskStateFailure {
+					finished = false
+				}
+			}
+			for _, r := range rs {
+				state, ok := states[r.URL]
+				switch {
+				case state == TaskStateSuccess || state == TaskStateFailure:
+					r.State = state
+				case !ok && finished:
+					// 同一次提交的其他任务都已完成，不再等待查询不到的链接
+					r.State = TaskStateUnknown
+				}
+			}
+		}
+	}
+}
+
+// taskStates 查询 requestID 的所有任务，返回链接到状态的映射
+func (s *RefreshScheduler) taskStates(ctx context.Context, path, requestID string) (map[string]string, error) {
+	const pageSize = 500
+	states := make(map[string]string)
+	for pageNo := 0; ; pageNo++ {
+		resp, err := s.manager.listTasks(ctx, path, ListTaskReq{RequestID: requestID, PageNo: pageNo, PageSize: pageSize})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Items {
+			states[item.URL] = item.State
+		}
+		if len(resp.Items) == 0 || (pageNo+1)*pageSize >= resp.Total {
+			return states, nil
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+// fakeFusion 模拟刷新和预取接口，每个链接第一次查询时处理中，第二次查询时完成
+// 链接中包含 fail 时任务失败，包含 invalid 时提交时返回链接无效
+type fakeFusion struct {
+	lock     sync.Mutex
+	surplus  int
+	batches  [][]string
+	tasks    map[string][]string
+	queried  map[string]int
+	requests int
+}
+
+func (f *fakeFusion) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var ret interface{}
+	switch req.URL.Path {
+	case "/v2/tune/refresh", "/v2/tune/prefetch":
+		var body RefreshReq
+		json.NewDecoder(req.Body).Decode(&body)
+		urls := append(body.Urls, body.Dirs...)
+		f.batches = append(f.batches, urls)
+		f.requests++
+		requestID := fmt.Sprintf("req-%d", f.requests)
+		f.surplus -= len(urls)
+		var invalid []string
+		for _, u := range urls {
+			if strings.Contains(u, "invalid") {
+				invalid = append(invalid, u)
+			} else {
+				f.tasks[requestID] = append(f.tasks[requestID], u)
+			}
+		}
+		if req.URL.Path == "/v2/tune/refresh" {
+			ret = RefreshResp{Code: 200, Error: "success", RequestID: requestID, InvalidUrls: invalid,
+				URLQuotaDay: 1000, URLSurplusDay: f.surplus, DirQuotaDay: 10, DirSurplusDay: 10}
+		} else {
+			ret = PrefetchResp{Code: 200, Error: "success", RequestID: requestID, InvalidUrls: invalid,
+				QuotaDay: 1000, SurplusDay: f.surplus}
+		}
+	case "/v2/tune/refresh/list", "/v2/tune/prefetch/list":
+		var body ListTaskReq
+		json.NewDecoder(req.Body).Decode(&body)
+		resp := ListTaskResp{Code: 200, Total: len(f.tasks[body.RequestID])}
+		for _, u := range f.tasks[body.RequestID] {
+			f.queried[u]++
+			state := TaskStateProcessing
+			if f.queried[u] > 1 {
+				state = TaskStateSuccess
+				if strings.Contains(u, "fail") {
+					state = TaskStateFailure
+				}
+			}
+			resp.Items = append(resp.Items, TaskItem{RequestID: body.RequestID, URL: u, State: state})
+		}
+		ret = resp
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ret)
+}
+
+func newFakeFusion(t *testing.T, surplus int) (*fakeFusion, *CdnManager) {
+	f := &fakeFusion{surplus: surplus, tasks: make(map[string][]string), queried: make(map[string]int)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	m := NewCdnManager(auth.New("ak", "sk"))
+	m.SetHost(srv.URL)
+	return f, m
+}
+
+func TestRefreshScheduler(t *testing.T) {
+	f, m := newFakeFusion(t, 5)
+	s := NewRefreshScheduler(m)
+	s.URLBatchSize = 2
+	s.PollInterval = time.Millisecond
+
+	urls := []string{"http://a.com/1", "http://a.com/invalid", "http://a.com/fail", "http://a.com/4", "http://a.com/5", "http://a.com/6"}
+	results, err := s.Refresh(context.Background(), urls, []string{"http://a.com/dir/"})
+	if err != nil {
+		t.Fatalf("Refresh() error: %v", err)
+	}
+
+	// 第一批 2 个链接和 1 个目录后剩余额度为 2，第二批 2 个链接后额度用完
+	if len(f.batches) != 2 || len(f.batches[0]) != 3 || len(f.batches[1]) != 2 {
+		t.Errorf("unexpected batches: %v", f.batches)
+	}
+	want := []string{TaskStateSuccess, TaskStateInvalid, TaskStateFailure, TaskStateSuccess,
+		TaskStateQuotaExceeded, TaskStateQuotaExceeded, TaskStateSuccess}
+	for i, r := range results {
+		if r.State != want[i] {
+			t.Errorf("%s: state = %s, want %s", r.URL, r.State, want[i])
+		}
+	}
+	if !results[6].Dir || results[0].RequestID != "req-1" || results[3].RequestID != "req-2" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestPrefetchSchedulerTimeout(t *testing.T) {
+	_, m := newFakeFusion(t, 100)
+	s := NewRefreshScheduler(m)
+	s.PollInterval = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	results, err := s.Prefetch(ctx, []string{"http://a.com/1"})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("want DeadlineExceeded, got %v", err)
+	}
+	if len(results) != 1 || results[0].State != TaskStateProcessing || results[0].RequestID != "req-1" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestRefreshSchedulerPollStops(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		mode  string
+		polls int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		var ret interface{}
+		switch req.URL.Path {
+		case "/v2/tune/refresh":
+			ret = RefreshResp{Code: 200, RequestID: "req-1"}
+		case "/v2/tune/refresh/list":
+			polls++
+			switch mode {
+			case "error":
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":400031,"error":"invalid requestId"}`))
+				return
+			case "missing":
+				ret = ListTaskResp{Code: 200, Total: 1, Items: []TaskItem{{URL: "http://a.com/1", State: TaskStateSuccess}}}
+			default:
+				ret = ListTaskResp{Code: 200, Total: 2, Items: []TaskItem{
+					{URL: "http://a.com/1", State: TaskStateProcessing}, {URL: "http://a.com/2", State: TaskStateProcessing}}}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ret)
+	}))
+	defer srv.Close()
+
+	m := NewCdnManager(auth.New("ak", "sk"))
+	m.SetHost(srv.URL)
+	s := NewRefreshScheduler(m)
+	s.PollInterval = time.Millisecond
+	s.MaxPolls = 3
+	urls := []string{"http://a.com/1", "http://a.com/2"}
+
+	cases := []struct {
+		mode   string
+		err    error
+		states []string
+		polls  int
+	}{
+		// 不可重试的错误不再查询
+		{mode: "error", states: []string{TaskStateUnknown, TaskStateUnknown}, polls: 1},
+		// 其他任务都已完成时查询不到的链接状态未知
+		{mode: "missing", states: []string{TaskStateSuccess, TaskStateUnknown}, polls: 1},
+		// 达到查询轮数上限
+		{mode: "processing", err: ErrTaskPollLimit, states: []string{TaskStateProcessing, TaskStateProcessing}, polls: 3},
+	}
+	for _, c := range cases {
+		lock.Lock()
+		mode, polls = c.mode, 0
+		lock.Unlock()
+
+		results, err := s.Refresh(context.Background(), urls, nil)
+		if err != c.err {
+			t.Errorf("%s: Refresh() error = %v, want %v", c.mode, err, c.err)
+		}
+		for i, r := range results {
+			if r.State != c.states[i] {
+				t.Errorf("%s: %s state = %s, want %s", c.mode, r.URL, r.State, c.states[i])
+			}
+		}
+		if c.mode == "error" && !IsCdnError(results[0].Err) {
+			t.Errorf("%s: want CdnError, got %v", c.mode, results[0].Err)
+		}
+		if polls != c.polls {
+			t.Errorf("%s: polls = %d, want %d", c.mode, polls, c.polls)
+		}
+	}
+}
+
+func TestRefreshSchedulerSubmitStops(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		status int
+		submit int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		submit++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"code":400032,"error":"invalid url"}`))
+	}))
+	defer srv.Close()
+
+	m := NewCdnManager(auth.New("ak", "sk"))
+	m.SetHost(srv.URL)
+	s := NewRefreshScheduler(m)
+	s.URLBatchSize = 1
+	s.PrefetchBatchSize = 1
+	urls := []string{"http://a.com/1", "http://a.com/2", "http://a.com/3"}
+
+	cases := []struct {
+		status  int
+		submits int
+	}{
+		// 不可重试的错误之后不再提交，剩余的链接同样失败
+		{http.StatusBadRequest, 1},
+		// 可以重试的错误继续提交下一批
+		{http.StatusServiceUnavailable, 3},
+	}
+	for _, c := range cases {
+		for _, name := range []string{"Refresh", "Prefetch"} {
+			lock.Lock()
+			status, submit = c.status, 0
+			lock.Unlock()
+
+			var results []URLResult
+			var err error
+			if name == "Refresh" {
+				results, err = s.Refresh(context.Background(), urls, nil)
+			} else {
+				results, err = s.Prefetch(context.Background(), urls)
+			}
+			if err != nil {
+				t.Errorf("%s(%d) error: %v", name, c.status, err)
+			}
+			for _, r := range results {
+				if r.State != TaskStateFailure || r.Err == nil {
+					t.Errorf("%s(%d): %s = %+v, want failure", name, c.status, r.URL, r)
+				}
+			}
+			if submit != c.submits {
+				t.Errorf("%s(%d): submits = %d, want %d", name, c.status, submit, c.submits)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+// 刷新和预取任务的状态
+const (
+	TaskStateProcessing = "processing"
+	TaskStateSuccess    = "success"
+	TaskStateFailure    = "failure"
+)
+
+// ListTaskReq 为查询刷新或预取任务的请求内容
+//
+//	RequestID	刷新或预取请求返回的 requestId
+//	Urls		要查询的 url 列表
+//	State		任务状态，processing/success/failure
+//	PageNo		页号，从 0 开始
+//	PageSize	每页的任务数，最大为 500，默认为 100
+//	StartTime	开始时间，格式例如：2016-09-01 00:00:00
+//	EndTime		结束时间，格式例如：2016-09-10 00:00:00
+type ListTaskReq struct {
+	RequestID string   `json:"requestId,omitempty"`
+	Urls      []string `json:"urls,omitempty"`
+	State     string   `json:"state,omitempty"`
+	PageNo    int      `json:"pageNo,omitempty"`
+	PageSize  int      `json:"pageSize,omitempty"`
+	StartTime string   `json:"startTime,omitempty"`
+	EndTime   string   `json:"endTime,omitempty"`
+}
+
+// ListTaskResp 为查询刷新或预取任务的响应内容
+type ListTaskResp struct {
+	Code     int        `json:"code"`
+	Error    string     `json:"error"`
+	PageNo   int        `json:"pageNo"`
+	PageSize int        `json:"pageSize"`
+	Total    int        `json:"total"`
+	Items    []TaskItem `json:"items"`
+}
+
+// TaskItem 为一个刷新或预取任务
+type TaskItem struct {
+	RequestID string `json:"requestId"`
+	URL       string `json:"url"`
+	State     string `json:"state"`
+	StateDesc string `json:"stateDesc"`
+	Progress  int    `json:"progress"`
+	Type      string `json:"type"`
+	CreateAt  string `json:"createAt"`
+	BeginAt   string `json:"beginAt"`
+	EndAt     string `json:"endAt"`
+}
+
+// ListRefreshTasks 查询刷新任务的状态
+func (m *CdnManager) ListRefreshTasks(req ListTaskReq) (result ListTaskResp, err error) {
+	return m.ListRefreshTasksContext(context.Background(), req)
+}
+
+// ListRefreshTasksContext 和 ListRefreshTasks 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) ListRefreshTasksContext(ctx context.Context, req ListTaskReq) (result ListTaskResp, err error) {
+	return m.listTasks(ctx, "/v2/tune/refresh/list", req)
+}
+
+// ListPrefetchTasks 查询预取任务的状态
+func (m *CdnManager) ListPrefetchTasks(req ListTaskReq) (result ListTaskResp, err error) {
+	return m.ListPrefetchTasksContext(context.Background(), req)
+}
+
+// ListPrefetchTasksContext 和 ListPrefetchTasks 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) ListPrefetchTasksContext(ctx context.Context, req ListTaskReq) (result ListTaskResp, err error) {
+	return m.listTasks(ctx, "/v2/tune/prefetch/list", req)
+}
+
+func (m *CdnManager) listTasks(ctx context.Context, path string, req ListTaskReq) (result ListTaskResp, err error) {
+	resData, reqErr := m.postRequest(client.WithIdempotent(ctx, true), path, req)
+	if reqErr != nil {
+		err = reqErr
+		return
+	}
+	if decodeErr := json.Unmarshal(resData, &result); decodeErr != nil {
+		err = &CdnError{Op: path, Err: decodeErr}
+		return
+	}
+	err = checkCode(path, result.Code, result.Error)
+	return
+}
@@ -0,0 +1,296 @@
+package cdn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+// ErrEmptyCertID 表示没有指定证书 ID
+var ErrEmptyCertID = errors.New("empty cert id")
+
+// timeNow 用来在测试中替换当前时间
+var timeNow = time.Now
+
+// CertInfo 为证书信息，NotBefore，NotAfter 和 CreateTime 为 Unix 时间戳，单位为秒
+// 只有 GetCert 返回 PrivateKey 和 Certificate
+type CertInfo struct {
+	CertID      string   `json:"certid"`
+	Name        string   `json:"name"`
+	CommonName  string   `json:"common_name"`
+	DNSNames    []string `json:"dnsnames"`
+	NotBefore   int64    `json:"not_before"`
+	NotAfter    int64    `json:"not_after"`
+	CreateTime  int64    `json:"create_time"`
+	PrivateKey  string   `json:"pri,omitempty"`
+	Certificate string   `json:"ca,omitempty"`
+}
+
+// ExpireTime 返回证书的过期时间
+func (c *CertInfo) ExpireTime() time.Time {
+	return time.Unix(c.NotAfter, 0)
+}
+
+// UploadCertReq 为上传证书的请求内容
+//
+//	Name		证书名称
+//	CommonName	证书的通用名称
+//	PrivateKey	PEM 格式的私钥
+//	Certificate	PEM 格式的证书链，第一个为域名证书，后面为中间证书
+type UploadCertReq struct {
+	Name        string `json:"name"`
+	CommonName  string `json:"common_name"`
+	PrivateKey  string `json:"pri"`
+	Certificate string `json:"ca"`
+}
+
+// ListCertsResp 为列举证书的响应内容，Marker 为空时表示没有更多的证书
+type ListCertsResp struct {
+	Marker string     `json:"marker"`
+	Certs  []CertInfo `json:"certs"`
+}
+
+// ParsedCert 为本地校验证书得到的信息
+type ParsedCert struct {
+	Leaf          *x509.Certificate
+	Intermediates []*x509.Certificate
+}
+
+// ValidateCert 在本地校验 PEM 格式的证书链和私钥
+//
+// 检查私钥和域名证书是否匹配，证书链中每个证书是否由下一个证书签发，证书链中所有证书在当前时间是否有效，
+// 以及域名证书是否包含 domains 中的所有域名，泛域名 .example.com 需要证书包含 *.example.com
+func ValidateCert(certPEM, keyPEM string, domains ...string) (parsed *ParsedCert, err error) {
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cert or key, %s", err)
+	}
+	certs := make([]*x509.Certificate, len(pair.Certificate))
+	for i, der := range pair.Certificate {
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("invalid cert, %s", err)
+		}
+	}
+
+	now := timeNow()
+	for i, cert := range certs {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return nil, fmt.Errorf("cert %q is not valid at %s, valid from %s to %s", cert.Subject.CommonName,
+				now.Format(time.RFC3339), cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		}
+		if i+1 < len(certs) {
+			if err = cert.CheckSignatureFrom(certs[i+1]); err != nil {
+				return nil, fmt.Errorf("cert %q is not signed by %q, %s", cert.Subject.CommonName,
+					certs[i+1].Subject.CommonName, err)
+			}
+		}
+	}
+
+	leaf := certs[0]
+	for _, domain := range domains {
+		if !certMatchesDomain(leaf, domain) {
+			return nil, fmt.Errorf("cert %q does not match domain %s", leaf.Subject.CommonName, domain)
+		}
+	}
+	return &ParsedCert{Leaf: leaf, Intermediates: certs[1:]}, nil
+}
+
+// certMatchesDomain 判断证书是否包含域名，泛域名以 . 开头
+func certMatchesDomain(cert *x509.Certificate, domain string) bool {
+	if strings.HasPrefix(domain, ".") {
+		for _, name := range cert.DNSNames {
+			if strings.EqualFold(name, "*"+domain) {
+				return true
+			}
+		}
+		return false
+	}
+	return cert.VerifyHostname(domain) == nil
+}
+
+// UploadCert 上传证书，返回证书 ID
+func (m *CdnManager) UploadCert(req UploadCertReq) (certID string, err error) {
+	return m.UploadCertContext(context.Background(), req)
+}
+
+// UploadCertContext 和 UploadCert 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) UploadCertContext(ctx context.Context, req UploadCertReq) (certID string, err error) {
+	var ret struct {
+		CertID string `json:"certID"`
+	}
+	err = m.call(ctx, "POST", "/sslcert", req, &ret)
+	certID = ret.CertID
+	return
+}
+
+// UploadCertForDomains 用 ValidateCert 在本地校验证书后上传，证书的通用名称使用域名证书的 CommonName
+// domains 为要使用这个证书的域名，可以为空
+func (m *CdnManager) UploadCertForDomains(name, certPEM, keyPEM string, domains ...string) (certID string, err error) {
+	return m.UploadCertForDomainsContext(context.Background(), name, certPEM, keyPEM, domains...)
+}
+
+// UploadCertForDomainsContext 和 UploadCertForDomains 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) UploadCertForDomainsContext(ctx context.Context, name, certPEM, keyPEM string, domains ...string) (certID string, err error) {
+	parsed, err := ValidateCert(certPEM, keyPEM, domains...)
+	if err != nil {
+		return
+	}
+	commonName := parsed.Leaf.Subject.CommonName
+	if commonName == "" && len(parsed.Leaf.DNSNames) > 0 {
+		commonName = parsed.Leaf.DNSNames[0]
+	}
+	return m.UploadCertContext(ctx, UploadCertReq{
+		Name:        name,
+		CommonName:  commonName,
+		PrivateKey:  keyPEM,
+		Certificate: certPEM,
+	})
+}
+
+// GetCert 获取证书信息，包括私钥和证书内容
+func (m *CdnManager) GetCert(certID string) (cert CertInfo, err error) {
+	return m.GetCertContext(context.Background(), certID)
+}
+
+// GetCertContext 和 GetCert 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) GetCertContext(ctx context.Context, certID string) (cert CertInfo, err error) {
+	if certID == "" {
+		err = ErrEmptyCertID
+		return
+	}
+	var ret struct {
+		Cert CertInfo `json:"cert"`
+	}
+	err = m.call(client.WithIdempotent(ctx, true), "GET", "/sslcert/"+url.PathEscape(certID), nil, &ret)
+	cert = ret.Cert
+	return
+}
+
+// ListCerts 列举证书，marker 为上次列举返回的 Marker，第一次列举时为空，limit 为 0 时使用服务端的默认值
+func (m *CdnManager) ListCerts(marker string, limit int) (result ListCertsResp, err error) {
+	return m.ListCertsContext(context.Background(), marker, limit)
+}
+
+// ListCertsContext 和 ListCerts 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) ListCertsContext(ctx context.Context, marker string, limit int) (result ListCertsResp, err error) {
+	query := url.Values{}
+	if marker != "" {
+		query.Set("marker", marker)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/sslcert"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	err = m.call(client.WithIdempotent(ctx, true), "GET", path, nil, &result)
+	return
+}
+
+// DeleteCert 删除证书，正在被域名使用的证书不能删除
+func (m *CdnManager) DeleteCert(certID string) error {
+	return m.DeleteCertContext(context.Background(), certID)
+}
+
+// DeleteCertContext 和 DeleteCert 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) DeleteCertContext(ctx context.Context, certID string) error {
+	if certID == "" {
+		return ErrEmptyCertID
+	}
+	return m.call(ctx, "DELETE", "/sslcert/"+url.PathEscape(certID), nil, nil)
+}
+
+// BindDomainCert 让域名使用证书 certID，https 域名保留原来的强制 HTTPS 和 HTTP/2 配置，http 域名会升级为 https 域名
+func (m *CdnManager) BindDomainCert(domain, certID string) error {
+	return m.BindDomainCertContext(context.Background(), domain, certID)
+}
+
+// BindDomainCertContext 和 BindDomainCert 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) BindDomainCertContext(ctx context.Context, domain, certID string) error {
+	if certID == "" {
+		return ErrEmptyCertID
+	}
+	info, err := m.GetDomainContext(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if info.Protocol == ProtocolHTTPS {
+		https := info.HTTPS
+		https.CertID = certID
+		return m.UpdateDomainHTTPSContext(ctx, domain, https)
+	}
+	return m.EnableDomainHTTPSContext(ctx, domain, DomainHTTPS{CertID: certID})
+}
+
+// ExpiringDomain 为证书即将过期的域名
+type ExpiringDomain struct {
+	Domain   string
+	CertID   string
+	CertName string
+	NotAfter time.Time
+}
+
+// ListExpiringCertDomains 列举证书在 days 天内过期的 https 域名，包括证书已经过期的域名，按过期时间排序
+func (m *CdnManager) ListExpiringCertDomains(days int) (domains []ExpiringDomain, err error) {
+	return m.ListExpiringCertDomainsContext(context.Background(), days)
+}
+
+// ListExpiringCertDomainsContext 和 ListExpiringCertDomains 相同，ctx 可以用来取消请求和传递 reqid
+func (m *CdnManager) ListExpiringCertDomainsContext(ctx context.Context, days int) (domains []ExpiringDomain, err error) {
+	deadline := timeNow().Add(time.Duration(days) * 24 * time.Hour)
+	// 列举证书只返回证书信息，不像 GetCert 那样下载私钥
+	certs := make(map[string]CertInfo)
+	marker := ""
+	for {
+		list, lErr := m.ListCertsContext(ctx, marker, 0)
+		if lErr != nil {
+			return nil, lErr
+		}
+		for _, cert := range list.Certs {
+			certs[cert.CertID] = cert
+		}
+		if list.Marker == "" || len(list.Certs) == 0 {
+			break
+		}
+		marker = list.Marker
+	}
+
+	marker = ""
+	for {
+		list, lErr := m.ListDomainsContext(ctx, marker, 0)
+		if lErr != nil {
+			return nil, lErr
+		}
+		for _, d := range list.Domains {
+			certID := d.HTTPS.CertID
+			if d.Protocol != ProtocolHTTPS || certID == "" {
+				continue
+			}
+			cert, ok := certs[certID]
+			if !ok {
+				continue
+			}
+			if expire := cert.ExpireTime(); expire.Before(deadline) {
+				domains = append(domains, ExpiringDomain{Domain: d.Name, CertID: certID, CertName: cert.Name, NotAfter: expire})
+			}
+		}
+		if list.Marker == "" || len(list.Domains) == 0 {
+			break
+		}
+		marker = list.Marker
+	}
+	sort.SliceStable(domains, func(i, j int) bool {
+		return domains[i].NotAfter.Before(domains[j].NotAfter)
+	})
+	return
+}
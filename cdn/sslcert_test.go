@@ -0,0 +1,191 @@
+package cdn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func newTestCert(t *testing.T, cn string, dnsNames []string, notAfter time.Time, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              dnsNames,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, pem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+func (c *testCert) keyPEM(t *testing.T) string {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+func TestValidateCert(t *testing.T) {
+	expire := time.Now().Add(60 * 24 * time.Hour)
+	ca := newTestCert(t, "Test CA", nil, expire, nil)
+	leaf := newTestCert(t, "a.example.com", []string{"a.example.com", "*.example.com"}, expire, ca)
+	other := newTestCert(t, "Other CA", nil, expire, nil)
+	chain := leaf.pem + ca.pem
+
+	parsed, err := ValidateCert(chain, leaf.keyPEM(t), "a.example.com", "b.example.com", ".example.com")
+	if err != nil {
+		t.Fatalf("ValidateCert() error: %v", err)
+	}
+	if parsed.Leaf.Subject.CommonName != "a.example.com" || len(parsed.Intermediates) != 1 {
+		t.Errorf("unexpected parsed cert: %+v", parsed)
+	}
+
+	cases := []struct {
+		name, cert, key, domain, err string
+	}{
+		{"key mismatch", chain, ca.keyPEM(t), "", "invalid cert or key"},
+		{"broken chain", leaf.pem + other.pem, leaf.keyPEM(t), "", "is not signed by"},
+		{"domain mismatch", chain, leaf.keyPEM(t), "a.other.com", "does not match domain"},
+		{"wildcard mismatch", chain, leaf.keyPEM(t), ".a.example.com", "does not match domain"},
+	}
+	for _, c := range cases {
+		var domains []string
+		if c.domain != "" {
+			domains = append(domains, c.domain)
+		}
+		if _, err = ValidateCert(c.cert, c.key, domains...); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: error = %v, want %q", c.name, err, c.err)
+		}
+	}
+
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return expire.Add(time.Hour) }
+	if _, err = ValidateCert(chain, leaf.keyPEM(t)); err == nil || !strings.Contains(err.Error(), "is not valid at") {
+		t.Errorf("expired cert: error = %v", err)
+	}
+}
+
+func TestCertAPI(t *testing.T) {
+	expire := time.Now().Add(60 * 24 * time.Hour)
+	ca := newTestCert(t, "Test CA", nil, expire, nil)
+	leaf := newTestCert(t, "a.example.com", []string{"a.example.com"}, expire, ca)
+
+	soon := time.Now().Add(10 * 24 * time.Hour).Unix()
+	later := time.Now().Add(50 * 24 * time.Hour).Unix()
+	m, requests := newDomainServer(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method + " " + req.URL.RequestURI() {
+		case "POST /sslcert":
+			w.Write([]byte(`{"certID":"cert-new"}`))
+		case "GET /sslcert":
+			w.Write([]byte(`{"marker":"next","certs":[{"certid":"cert-soon","name":"soon","not_after":` + strconv.FormatInt(soon, 10) + `}]}`))
+		case "GET /sslcert?marker=next":
+			w.Write([]byte(`{"marker":"","certs":[{"certid":"cert-later","name":"later","not_after":` + strconv.FormatInt(later, 10) + `}]}`))
+		case "GET /domain":
+			w.Write([]byte(`{"marker":"next","domains":[
+				{"name":"a.example.com","protocol":"https","https":{"certId":"cert-soon","forceHttps":true}},
+				{"name":"b.example.com","protocol":"http"}]}`))
+		case "GET /domain?marker=next":
+			w.Write([]byte(`{"marker":"","domains":[
+				{"name":"c.example.com","protocol":"https","https":{"certId":"cert-later"}},
+				{"name":"d.example.com","protocol":"https","https":{"certId":"cert-soon"}}]}`))
+		case "GET /domain/a.example.com":
+			w.Write([]byte(`{"name":"a.example.com","protocol":"https","https":{"certId":"cert-soon","forceHttps":true,"http2Enable":true}}`))
+		case "GET /domain/b.example.com":
+			w.Write([]byte(`{"name":"b.example.com","protocol":"http"}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	})
+
+	certID, err := m.UploadCertForDomains("a", leaf.pem+ca.pem, leaf.keyPEM(t), "a.example.com")
+	if err != nil || certID != "cert-new" {
+		t.Fatalf("UploadCertForDomains() = %q, %v", certID, err)
+	}
+	var upload UploadCertReq
+	json.Unmarshal([]byte((*requests)[0].Body), &upload)
+	if upload.CommonName != "a.example.com" || upload.Name != "a" || upload.Certificate != leaf.pem+ca.pem {
+		t.Errorf("unexpected upload request: %+v", upload)
+	}
+	if _, err = m.UploadCertForDomains("a", leaf.pem, leaf.keyPEM(t), "b.example.com"); err == nil || len(*requests) != 1 {
+		t.Errorf("invalid cert should not be uploaded, err %v", err)
+	}
+
+	expiring, err := m.ListExpiringCertDomains(30)
+	if err != nil {
+		t.Fatalf("ListExpiringCertDomains() error: %v", err)
+	}
+	if len(expiring) != 2 || expiring[0].Domain != "a.example.com" || expiring[1].Domain != "d.example.com" ||
+		expiring[0].CertName != "soon" || expiring[0].NotAfter.Unix() != soon {
+		t.Errorf("ListExpiringCertDomains() = %+v", expiring)
+	}
+	certRequests := 0
+	for _, r := range *requests {
+		if strings.HasPrefix(r.Path, "/sslcert/") {
+			t.Errorf("private keys should not be downloaded: %+v", r)
+		}
+		if r.Method == "GET" && strings.HasPrefix(r.Path, "/sslcert") {
+			certRequests++
+		}
+	}
+	if certRequests != 2 {
+		t.Errorf("certs should be listed page by page, got %d requests", certRequests)
+	}
+
+	*requests = nil
+	if err = m.BindDomainCert("a.example.com", "cert-new"); err != nil {
+		t.Fatalf("BindDomainCert() error: %v", err)
+	}
+	if err = m.BindDomainCert("b.example.com", "cert-new"); err != nil {
+		t.Fatalf("BindDomainCert() error: %v", err)
+	}
+	if err = m.DeleteCert("cert-soon"); err != nil {
+		t.Fatalf("DeleteCert() error: %v", err)
+	}
+	want := []recordedRequest{
+		{"GET", "/domain/a.example.com", ""},
+		{"PUT", "/domain/a.example.com/httpsconf", `{"certId":"cert-new","forceHttps":true,"http2Enable":true}`},
+		{"GET", "/domain/b.example.com", ""},
+		{"PUT", "/domain/b.example.com/sslize", `{"certId":"cert-new","forceHttps":false,"http2Enable":false}`},
+		{"DELETE", "/sslcert/cert-soon", ""},
+	}
+	if len(*requests) != len(want) {
+		t.Fatalf("got requests %+v", *requests)
+	}
+	for i := range want {
+		if (*requests)[i] != want[i] {
+			t.Errorf("request %d = %+v, want %+v", i, (*requests)[i], want[i])
+		}
+	}
+}
@@ -9,19 +9,20 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptrace"
-	"net/http/httputil"
 	"net/url"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/qiniu/api.v7/v7/auth"
 	"github.com/qiniu/api.v7/v7/conf"
-	"github.com/qiniu/api.v7/v7/internal/log"
+	"github.com/qiniu/api.v7/v7/logging"
 	"github.com/qiniu/api.v7/v7/reqid"
+	"github.com/qiniu/api.v7/v7/telemetry"
 )
 
 var UserAgent = "Golang qiniu/client package"
-var DefaultClient = Client{&http.Client{Transport: http.DefaultTransport}}
+var DefaultClient = Client{Client: &http.Client{Transport: defaultTransport}}
 
 // 用来打印调试信息
 var DebugMode = false
@@ -32,6 +33,15 @@ var DeepDebugInfo = false
 // Client 负责发送HTTP请求到七牛接口服务器
 type Client struct {
 	*http.Client
+
+	// 请求失败时的重试策略，为 nil 时不重试，参考 RetryPolicy
+	RetryPolicy *RetryPolicy
+
+	// 发送请求的中间件，第一个中间件最先处理请求，每次重试都会经过所有中间件
+	Middlewares []Middleware
+
+	// 输出请求日志的 Logger，为 nil 时使用 logging.DefaultLogger，参考 logging.Logger
+	Logger logging.Logger
 }
 
 // TurnOnDebug 开启Debug模式
@@ -60,61 +70,73 @@ func newRequest(ctx context.Context, method, reqUrl string, headers http.Header,
 
 	req.Header = headers
 	req = req.WithContext(ctx)
+	return
+}
 
-	//check access token
-	mac, t, ok := auth.CredentialsFromContext(ctx)
-	if ok {
-		err = mac.AddToken(t, req)
-		if err != nil {
-			return
-		}
+// signRequest 使用 context 中的密钥对请求签名
+func signRequest(req *http.Request) error {
+	provider, t, ok := auth.CredentialsProviderFromContext(req.Context())
+	if !ok {
+		return nil
 	}
-	if DebugMode {
+	// 每个请求都重新获取密钥，以便支持密钥轮换
+	mac, err := provider.Retrieve()
+	if err != nil {
+		return err
+	}
+	return mac.AddToken(t, req)
+}
+
+// send 是中间件链的最后一环，签名并发送请求
+// 签名放在中间件之后，这样中间件添加的 X-Qiniu-* 头部和修改的域名也会被签名
+func (r Client) send(req *http.Request) (resp *http.Response, err error) {
+	if err = signRequest(req); err != nil {
+		return
+	}
+	ctx := req.Context()
+	logger := r.logger()
+	if DebugMode && logger.Enabled(ctx, logging.LevelDebug) {
 		trace := &httptrace.ClientTrace{
 			GotConn: func(connInfo httptrace.GotConnInfo) {
 				remoteAddr := connInfo.Conn.RemoteAddr()
-				log.Debug(fmt.Sprintf("Network: %s, Remote ip:%s, URL: %s", remoteAddr.Network(), remoteAddr.String(), req.URL))
+				logger.Log(ctx, logging.LevelDebug, "connection established",
+					logging.String("network", remoteAddr.Network()),
+					logging.String("remote", remoteAddr.String()),
+					logging.String("url", logging.RedactURL(req.URL.String())))
 			},
 		}
-		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
-		bs, bErr := httputil.DumpRequest(req, DeepDebugInfo)
+		req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+		bs, bErr := dumpRequest(req, DeepDebugInfo)
 		if bErr != nil {
 			err = bErr
 			return
 		}
-		log.Debug(string(bs))
+		logger.Log(ctx, logging.LevelDebug, "request dump", logging.String("dump", string(bs)))
+	}
+	start := time.Now()
+	resp, err = r.Client.Do(req)
+	elapsed := time.Since(start)
+	logAttempt(logger, req, resp, err, elapsed)
+	if telemetry.Enabled(ctx) {
+		recordAttempt(req, resp, err, elapsed)
 	}
 	return
 }
 
 func (r Client) DoRequest(ctx context.Context, method, reqUrl string, headers http.Header) (resp *http.Response, err error) {
-	req, err := newRequest(ctx, method, reqUrl, headers, nil)
-	if err != nil {
-		return
-	}
-	return r.Do(ctx, req)
+	return r.doWithRetry(ctx, method, reqUrl, headers, nil, 0)
 }
 
 func (r Client) DoRequestWith(ctx context.Context, method, reqUrl string, headers http.Header, body io.Reader,
 	bodyLength int) (resp *http.Response, err error) {
 
-	req, err := newRequest(ctx, method, reqUrl, headers, body)
-	if err != nil {
-		return
-	}
-	req.ContentLength = int64(bodyLength)
-	return r.Do(ctx, req)
+	return r.doWithRetry(ctx, method, reqUrl, headers, body, int64(bodyLength))
 }
 
 func (r Client) DoRequestWith64(ctx context.Context, method, reqUrl string, headers http.Header, body io.Reader,
 	bodyLength int64) (resp *http.Response, err error) {
 
-	req, err := newRequest(ctx, method, reqUrl, headers, body)
-	if err != nil {
-		return
-	}
-	req.ContentLength = bodyLength
-	return r.Do(ctx, req)
+	return r.doWithRetry(ctx, method, reqUrl, headers, body, bodyLength)
 }
 
 func (r Client) DoRequestWithForm(ctx context.Context, method, reqUrl string, headers http.Header,
@@ -166,18 +188,22 @@ func (r Client) Do(ctx context.Context, req *http.Request) (resp *http.Response,
 		req.Header.Set("User-Agent", UserAgent)
 	}
 
-	resp, err = r.Client.Do(req)
-	return
+	return Chain(r.send, r.Middlewares...)(req)
 }
 
 // --------------------------------------------------------------------
 
+// ErrorInfo 是 SDK 统一的接口错误类型，可以通过 errors.As 获取，通过 errors.Is 和 IsNotFound 等函数判断错误类型
 type ErrorInfo struct {
 	Err   string `json:"error,omitempty"`
 	Key   string `json:"key,omitempty"`
 	Reqid string `json:"reqid,omitempty"`
 	Errno int    `json:"errno,omitempty"`
 	Code  int    `json:"code"`
+
+	// 请求的域名和方法
+	Host   string `json:"host,omitempty"`
+	Method string `json:"method,omitempty"`
 }
 
 func (r *ErrorInfo) ErrorDetail() string {
@@ -211,25 +237,31 @@ func parseError(e *ErrorInfo, r io.Reader) {
 		return
 	}
 
+	parseErrorBody(e, body)
+}
+
+func parseErrorBody(e *ErrorInfo, body []byte) {
 	var ret struct {
 		Err   string `json:"error"`
 		Key   string `json:"key"`
 		Errno int    `json:"errno"`
+		Code  int    `json:"code"`
 	}
 	if json.Unmarshal(body, &ret) == nil && ret.Err != "" {
 		// qiniu error msg style returns here
 		e.Err, e.Key, e.Errno = ret.Err, ret.Key, ret.Errno
+		// cdn 和 rtc 等服务在 code 字段中返回业务错误码
+		if e.Errno == 0 && ret.Code != 0 && ret.Code != e.Code {
+			e.Errno = ret.Code
+		}
 		return
 	}
-	e.Err = string(body)
+	e.Err = strings.TrimRight(string(body), "\n")
 }
 
 func ResponseError(resp *http.Response) (err error) {
 
-	e := &ErrorInfo{
-		Reqid: resp.Header.Get("X-Reqid"),
-		Code:  resp.StatusCode,
-	}
+	e := newErrorInfo(resp)
 	if resp.StatusCode > 299 {
 		if resp.ContentLength != 0 {
 			ct, ok := resp.Header["Content-Type"]
@@ -247,20 +279,30 @@ func ResponseError(resp *http.Response) (err error) {
 	return e
 }
 
+// CallRet 解析回复，没有使用 Client 发送的请求使用默认的 Logger 输出调试日志
 func CallRet(ctx context.Context, ret interface{}, resp *http.Response) (err error) {
+	return callRet(ctx, defaultLogger(), ret, resp)
+}
+
+// callRet 解析回复，使用发送请求的 Client 的 Logger 输出调试日志
+func (r Client) callRet(ctx context.Context, ret interface{}, resp *http.Response) (err error) {
+	return callRet(ctx, r.logger(), ret, resp)
+}
+
+func callRet(ctx context.Context, logger logging.Logger, ret interface{}, resp *http.Response) (err error) {
 
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
 		resp.Body.Close()
 	}()
 
-	if DebugMode {
-		bs, dErr := httputil.DumpResponse(resp, DeepDebugInfo)
+	if DebugMode && logger.Enabled(ctx, logging.LevelDebug) {
+		bs, dErr := dumpResponse(resp, DeepDebugInfo)
 		if dErr != nil {
 			err = dErr
 			return
 		}
-		log.Debug(string(bs))
+		logger.Log(ctx, logging.LevelDebug, "response dump", logging.String("dump", string(bs)))
 	}
 	if resp.StatusCode/100 == 2 {
 		if ret != nil && resp.ContentLength != 0 {
@@ -281,7 +323,7 @@ func (r Client) CallWithForm(ctx context.Context, ret interface{}, method, reqUr
 	if err != nil {
 		return err
 	}
-	return CallRet(ctx, ret, resp)
+	return r.callRet(ctx, ret, resp)
 }
 
 func (r Client) CallWithJson(ctx context.Context, ret interface{}, method, reqUrl string, headers http.Header,
@@ -291,7 +333,7 @@ func (r Client) CallWithJson(ctx context.Context, ret interface{}, method, reqUr
 	if err != nil {
 		return err
 	}
-	return CallRet(ctx, ret, resp)
+	return r.callRet(ctx, ret, resp)
 }
 
 func (r Client) CallWith(ctx context.Context, ret interface{}, method, reqUrl string, headers http.Header, body io.Reader,
@@ -301,7 +343,7 @@ func (r Client) CallWith(ctx context.Context, ret interface{}, method, reqUrl st
 	if err != nil {
 		return err
 	}
-	return CallRet(ctx, ret, resp)
+	return r.callRet(ctx, ret, resp)
 }
 
 func (r Client) CallWith64(ctx context.Context, ret interface{}, method, reqUrl string, headers http.Header, body io.Reader,
@@ -311,7 +353,7 @@ func (r Client) CallWith64(ctx context.Context, ret interface{}, method, reqUrl
 	if err != nil {
 		return err
 	}
-	return CallRet(ctx, ret, resp)
+	return r.callRet(ctx, ret, resp)
 }
 
 func (r Client) Call(ctx context.Context, ret interface{}, method, reqUrl string, headers http.Header) (err error) {
@@ -320,35 +362,35 @@ func (r Client) Call(ctx context.Context, ret interface{}, method, reqUrl string
 	if err != nil {
 		return err
 	}
-	return CallRet(ctx, ret, resp)
+	return r.callRet(ctx, ret, resp)
 }
 
-func (r Client) CredentialedCallWithForm(ctx context.Context, cred *auth.Credentials, tokenType auth.TokenType, ret interface{},
+func (r Client) CredentialedCallWithForm(ctx context.Context, cred auth.CredentialsProvider, tokenType auth.TokenType, ret interface{},
 	method, reqUrl string, headers http.Header, param map[string][]string) error {
-	ctx = auth.WithCredentialsType(ctx, cred, tokenType)
+	ctx = auth.WithCredentialsProviderType(ctx, cred, tokenType)
 	return r.CallWithForm(ctx, ret, method, reqUrl, headers, param)
 }
 
-func (r Client) CredentialedCallWithJson(ctx context.Context, cred *auth.Credentials, tokenType auth.TokenType, ret interface{},
+func (r Client) CredentialedCallWithJson(ctx context.Context, cred auth.CredentialsProvider, tokenType auth.TokenType, ret interface{},
 	method, reqUrl string, headers http.Header, param interface{}) error {
-	ctx = auth.WithCredentialsType(ctx, cred, tokenType)
+	ctx = auth.WithCredentialsProviderType(ctx, cred, tokenType)
 	return r.CallWithJson(ctx, ret, method, reqUrl, headers, param)
 }
 
-func (r Client) CredentialedCallWith(ctx context.Context, cred *auth.Credentials, tokenType auth.TokenType, ret interface{},
+func (r Client) CredentialedCallWith(ctx context.Context, cred auth.CredentialsProvider, tokenType auth.TokenType, ret interface{},
 	method, reqUrl string, headers http.Header, body io.Reader, bodyLength int) error {
-	ctx = auth.WithCredentialsType(ctx, cred, tokenType)
+	ctx = auth.WithCredentialsProviderType(ctx, cred, tokenType)
 	return r.CallWith(ctx, ret, method, reqUrl, headers, body, bodyLength)
 }
 
-func (r Client) CredentialedCallWith64(ctx context.Context, cred *auth.Credentials, tokenType auth.TokenType, ret interface{},
+func (r Client) CredentialedCallWith64(ctx context.Context, cred auth.CredentialsProvider, tokenType auth.TokenType, ret interface{},
 	method, reqUrl string, headers http.Header, body io.Reader, bodyLength int64) error {
-	ctx = auth.WithCredentialsType(ctx, cred, tokenType)
+	ctx = auth.WithCredentialsProviderType(ctx, cred, tokenType)
 	return r.CallWith64(ctx, ret, method, reqUrl, headers, body, bodyLength)
 }
 
-func (r Client) CredentialedCall(ctx context.Context, cred *auth.Credentials, tokenType auth.TokenType, ret interface{},
+func (r Client) CredentialedCall(ctx context.Context, cred auth.CredentialsProvider, tokenType auth.TokenType, ret interface{},
 	method, reqUrl string, headers http.Header) error {
-	ctx = auth.WithCredentialsType(ctx, cred, tokenType)
+	ctx = auth.WithCredentialsProviderType(ctx, cred, tokenType)
 	return r.Call(ctx, ret, method, reqUrl, headers)
 }
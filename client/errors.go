@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// 用于 errors.Is 判断的错误类型，*ErrorInfo 根据 HTTP 状态码和回复中的错误码 Errno 匹配这些错误
+var (
+	// ErrNotFound 表示资源不存在，比如 612(文件不存在)，631(空间不存在)，404
+	ErrNotFound = errors.New("not found")
+
+	// ErrAlreadyExists 表示资源已经存在，比如 614(文件已存在)
+	ErrAlreadyExists = errors.New("already exists")
+
+	// ErrQuotaExceeded 表示超过了配额或者频率限制，比如 573，429
+	ErrQuotaExceeded = errors.New("quota exceeded")
+
+	// ErrUnauthorized 表示认证失败，比如 401
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrRetryable 表示可以重试的错误，参考 IsRetryableStatus
+	ErrRetryable = errors.New("retryable")
+)
+
+// Is 使 errors.Is 可以根据 HTTP 状态码和错误码判断错误类型
+func (r *ErrorInfo) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return r.hasCode(612, 631) || r.Code == http.StatusNotFound
+	case ErrAlreadyExists:
+		return r.hasCode(614)
+	case ErrQuotaExceeded:
+		return r.hasCode(573) || r.Code == http.StatusTooManyRequests
+	case ErrUnauthorized:
+		return r.Code == http.StatusUnauthorized
+	case ErrRetryable:
+		return IsRetryableStatus(r.Code)
+	}
+	return false
+}
+
+// hasCode 判断 HTTP 状态码或者错误码是否是 codes 之一，有的服务在 HTTP 状态码为 400 等时通过错误码返回 612 这样的错误
+func (r *ErrorInfo) hasCode(codes ...int) bool {
+	for _, code := range codes {
+		if r.Code == code || r.Errno == code {
+			return true
+		}
+	}
+	return false
+}
+
+// newErrorInfo 根据回复构建错误，不读取回复内容
+func newErrorInfo(resp *http.Response) *ErrorInfo {
+	e := &ErrorInfo{
+		Reqid: resp.Header.Get("X-Reqid"),
+		Code:  resp.StatusCode,
+	}
+	if req := resp.Request; req != nil {
+		e.Method = req.Method
+		if req.URL != nil {
+			e.Host = req.URL.Host
+		}
+	}
+	return e
+}
+
+// NewResponseError 根据回复和已经读取的回复内容构建错误，用于调用方需要自己读取回复内容的场景
+func NewResponseError(resp *http.Response, body []byte) *ErrorInfo {
+	e := newErrorInfo(resp)
+	if len(body) > 0 {
+		parseErrorBody(e, body)
+	}
+	return e
+}
+
+// IsNotFound 判断错误是否表示资源不存在
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsAlreadyExists 判断错误是否表示资源已经存在
+func IsAlreadyExists(err error) bool {
+	return errors.Is(err, ErrAlreadyExists)
+}
+
+// IsQuotaExceeded 判断错误是否表示超过了配额或者频率限制
+func IsQuotaExceeded(err error) bool {
+	return errors.Is(err, ErrQuotaExceeded)
+}
+
+// IsUnauthorized 判断错误是否表示认证失败
+func IsUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+// IsRetryable 判断错误是否可以重试，包括可以重试的接口错误和网络错误，不包括 context 取消和超时
+// 注意网络错误发生时请求可能已经被处理，非幂等的请求需要调用方自己判断是否重试
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrRetryable) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorInfoIs(t *testing.T) {
+	cases := []struct {
+		code   int
+		target error
+		want   bool
+	}{
+		{612, ErrNotFound, true},
+		{631, ErrNotFound, true},
+		{614, ErrNotFound, false},
+		{614, ErrAlreadyExists, true},
+		{573, ErrQuotaExceeded, true},
+		{401, ErrUnauthorized, true},
+		{403, ErrUnauthorized, false},
+		{599, ErrRetryable, true},
+		{400, ErrRetryable, false},
+	}
+	for _, c := range cases {
+		err := fmt.Errorf("wrapped: %w", &ErrorInfo{Code: c.code})
+		if got := errors.Is(err, c.target); got != c.want {
+			t.Errorf("errors.Is(%d, %v) = %v, want %v", c.code, c.target, got, c.want)
+		}
+	}
+
+	if !IsNotFound(&ErrorInfo{Code: 612}) || !IsAlreadyExists(&ErrorInfo{Code: 614}) ||
+		!IsQuotaExceeded(&ErrorInfo{Code: 429}) || !IsUnauthorized(&ErrorInfo{Code: 401}) {
+		t.Errorf("predicates should match")
+	}
+	if IsNotFound(errors.New("no such file or directory")) || IsNotFound(nil) {
+		t.Errorf("IsNotFound should not match plain errors")
+	}
+
+	// HTTP 状态码为 400 等时根据错误码判断
+	if !IsNotFound(&ErrorInfo{Code: 400, Errno: 612}) || !IsQuotaExceeded(&ErrorInfo{Code: 400, Errno: 573}) ||
+		IsAlreadyExists(&ErrorInfo{Code: 400, Errno: 400031}) {
+		t.Errorf("predicates should match errno")
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	if !IsRetryable(&ErrorInfo{Code: 503}) || IsRetryable(&ErrorInfo{Code: 612}) {
+		t.Errorf("IsRetryable() classifies status codes wrong")
+	}
+	if IsRetryable(context.Canceled) || IsRetryable(nil) {
+		t.Errorf("IsRetryable() should not match context errors")
+	}
+
+	_, err := http.Get("http://127.0.0.1:1/")
+	if !IsRetryable(err) {
+		t.Errorf("IsRetryable() should match network error %v", err)
+	}
+}
+
+func TestResponseErrorCarriesRequestInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Reqid", "reqid-1")
+		w.WriteHeader(612)
+		w.Write([]byte(`{"error":"no such file or directory"}`))
+	}))
+	defer srv.Close()
+
+	err := DefaultClient.Call(context.Background(), nil, "POST", srv.URL+"/stat/xxx", nil)
+	var e *ErrorInfo
+	if !errors.As(err, &e) {
+		t.Fatalf("want *ErrorInfo, got %T", err)
+	}
+	if e.Code != 612 || e.Reqid != "reqid-1" || e.Err != "no such file or directory" ||
+		e.Method != "POST" || e.Host != strings.TrimPrefix(srv.URL, "http://") {
+		t.Errorf("unexpected error info: %+v", e)
+	}
+	if !IsNotFound(err) {
+		t.Errorf("IsNotFound() should match %v", err)
+	}
+}
+
+func TestNewResponseError(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://fusion.qiniuapi.com/v2/tune/refresh", nil)
+	resp := &http.Response{StatusCode: 400, Header: http.Header{"X-Reqid": {"r"}}, Request: req}
+
+	e := NewResponseError(resp, []byte(`{"code":400031,"error":"invalid url"}`))
+	if e.Code != 400 || e.Errno != 400031 || e.Err != "invalid url" || e.Host != "fusion.qiniuapi.com" || e.Method != "POST" {
+		t.Errorf("unexpected error info: %+v", e)
+	}
+
+	e = NewResponseError(resp, []byte("bad request\n"))
+	if e.Err != "bad request" || e.Errno != 0 {
+		t.Errorf("unexpected error info for plain body: %+v", e)
+	}
+}
@@ -0,0 +1,447 @@
+// Package httpreplay 提供录制和回放 HTTP 请求的 http.RoundTripper，用于在没有网络和真实密钥的情况下运行依赖七牛服务的测试
+//
+// 录制模式下请求会发送到真实的服务，请求和回复保存到 golden 文件中，其中的密钥，签名和凭证会被隐藏；
+// 回放模式下不发送请求，根据请求方法，路径，查询参数和规范化后的请求体从 golden 文件中找到对应的回复:
+//
+//	func TestStat(t *testing.T) {
+//		rt := httpreplay.NewForTest(t, "stat", accessKey, secretKey)
+//		bucketManager := storage.NewBucketManagerEx(mac, &cfg, rt.Client())
+//		...
+//	}
+//
+// 设置环境变量 QINIU_HTTP_REPLAY=record 运行测试来录制 golden 文件，默认为回放模式。
+// golden 文件也可以按照接口文档手工构造，这时应该在测试中注明它们不是真实服务的录制。
+// 各个 Manager 都可以通过 NewXxxEx 构造函数使用 Client() 返回的 client.Client，
+// 比如 cdn.NewCdnManagerEx(mac, rt.Client(), nil) 和 rtc.NewManagerEx(mac, rt.Client())。
+package httpreplay
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/logging"
+)
+
+// Mode 是 Transport 的工作模式
+type Mode int
+
+const (
+	// ModeReplay 从 golden 文件回放请求，不发送真实的请求
+	ModeReplay Mode = iota
+
+	// ModeRecord 发送真实的请求并录制到 golden 文件
+	ModeRecord
+)
+
+// EnvMode 是指定工作模式的环境变量，值为 record 时使用 ModeRecord，否则使用 ModeReplay
+const EnvMode = "QINIU_HTTP_REPLAY"
+
+// ModeFromEnv 根据环境变量 QINIU_HTTP_REPLAY 返回工作模式
+func ModeFromEnv() Mode {
+	if strings.EqualFold(os.Getenv(EnvMode), "record") {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// Redacted 是 golden 文件中隐藏后的内容
+const Redacted = logging.Redacted
+
+// ErrNoInteraction 表示回放时没有找到匹配的请求
+var ErrNoInteraction = errors.New("httpreplay: no recorded interaction matches the request")
+
+// inlineBodyLimit 是请求体原样保存的最大长度，更长的请求体和二进制请求体保存为 SHA1 和长度
+const inlineBodyLimit = 4 << 10
+
+// Request 是录制的请求
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+
+	// 规范化后的请求体，JSON 和表单按键排序，multipart 表单每个字段一行，二进制内容保存为 SHA1 和长度
+	Body string `json:"body,omitempty"`
+}
+
+// Response 是录制的回复
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+
+	// 回复体不是 UTF-8 文本时使用 base64 编码保存
+	BodyBase64 bool `json:"body_base64,omitempty"`
+}
+
+// Interaction 是一次录制的请求和回复
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Transport 录制或者回放 HTTP 请求
+type Transport struct {
+	// 录制时发送真实请求使用的 http.RoundTripper，为 nil 时使用 http.DefaultTransport
+	Transport http.RoundTripper
+
+	// 需要在 golden 文件中隐藏的字符串，比如 AccessKey 和 SecretKey
+	Secrets []string
+
+	path string
+	mode Mode
+
+	lock         sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// New 返回一个使用 path 作为 golden 文件的 Transport，回放模式下会读取 golden 文件
+func New(path string, mode Mode, secrets ...string) (*Transport, error) {
+	t := &Transport{path: path, mode: mode, Secrets: secrets}
+	if mode == ModeRecord {
+		return t, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &t.interactions); err != nil {
+		return nil, fmt.Errorf("httpreplay: parse %s: %v", path, err)
+	}
+	t.used = make([]bool, len(t.interactions))
+	return t, nil
+}
+
+// NewForTest 返回一个使用 testdata/<name>.json 作为 golden 文件的 Transport，工作模式由环境变量 QINIU_HTTP_REPLAY 决定
+// 录制模式下测试结束时保存 golden 文件
+func NewForTest(tb testing.TB, name string, secrets ...string) *Transport {
+	tb.Helper()
+	mode := ModeFromEnv()
+	t, err := New(filepath.Join("testdata", name+".json"), mode, secrets...)
+	if err != nil {
+		tb.Fatalf("httpreplay: %v, run with %s=record to record it", err, EnvMode)
+	}
+	if mode == ModeRecord {
+		tb.Cleanup(func() {
+			if err := t.Save(); err != nil {
+				tb.Errorf("httpreplay: %v", err)
+			}
+		})
+	}
+	return t
+}
+
+// Mode 返回工作模式
+func (t *Transport) Mode() Mode {
+	return t.mode
+}
+
+// Client 返回一个使用这个 Transport 发送请求的 client.Client，可以用来构建各种 Manager
+func (t *Transport) Client() *client.Client {
+	return &client.Client{Client: &http.Client{Transport: t}}
+}
+
+// Interactions 返回录制或者加载的所有请求
+func (t *Transport) Interactions() []*Interaction {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]*Interaction(nil), t.interactions...)
+}
+
+// Save 把录制的请求保存到 golden 文件，回放模式下不做任何事情
+func (t *Transport) Save() error {
+	if t.mode != ModeRecord {
+		return nil
+	}
+	t.lock.Lock()
+	data, err := json.MarshalIndent(t.interactions, "", "  ")
+	t.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(t.path, append(data, '\n'), 0644)
+}
+
+// RoundTrip 录制或者回放一个请求
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	recorded := t.recordRequest(req, body)
+	if t.mode == ModeRecord {
+		return t.record(req, body, recorded)
+	}
+	return t.replay(req, recorded)
+}
+
+func (t *Transport) record(req *http.Request, body []byte, recorded Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	req = req.Clone(req.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		Request: recorded,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     t.scrubHeader(resp.Header),
+		},
+	}
+	if utf8.Valid(respBody) {
+		interaction.Response.Body = t.scrub(string(respBody))
+	} else {
+		interaction.Response.Body = base64.StdEncoding.EncodeToString(respBody)
+		interaction.Response.BodyBase64 = true
+	}
+	t.lock.Lock()
+	t.interactions = append(t.interactions, interaction)
+	t.used = append(t.used, true)
+	t.lock.Unlock()
+	return resp, nil
+}
+
+// replay 按照录制的顺序返回第一个没有使用过的匹配请求的回复
+func (t *Transport) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	t.lock.Lock()
+	var found *Interaction
+	for i, interaction := range t.interactions {
+		if !t.used[i] && match(&interaction.Request, &recorded) {
+			t.used[i] = true
+			found = interaction
+			break
+		}
+	}
+	t.lock.Unlock()
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, recorded.URL)
+	}
+
+	body := []byte(found.Response.Body)
+	if found.Response.BodyBase64 {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(found.Response.Body); err != nil {
+			return nil, err
+		}
+	}
+	header := make(http.Header, len(found.Response.Header))
+	for k, v := range found.Response.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", found.Response.StatusCode, http.StatusText(found.Response.StatusCode)),
+		StatusCode:    found.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// match 判断两个请求的方法，路径，查询参数和规范化后的请求体是否相同
+// 查询参数按键排序后比较，敏感参数的值已经隐藏，不参与比较
+func match(a, b *Request) bool {
+	if a.Method != b.Method || a.Body != b.Body {
+		return false
+	}
+	ua, errA := url.Parse(a.URL)
+	ub, errB := url.Parse(b.URL)
+	if errA != nil || errB != nil {
+		return a.URL == b.URL
+	}
+	return ua.EscapedPath() == ub.EscapedPath() && canonicalQuery(ua) == canonicalQuery(ub)
+}
+
+// canonicalQuery 返回按键排序并且隐藏了敏感参数值的查询参数
+func canonicalQuery(u *url.URL) string {
+	return redactValues(u.Query()).Encode()
+}
+
+// readBody 读取并关闭请求体，RoundTripper 需要负责关闭请求体
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return ioutil.ReadAll(req.Body)
+}
+
+// recordRequest 返回隐藏了敏感信息的请求
+func (t *Transport) recordRequest(req *http.Request, body []byte) Request {
+	return Request{
+		Method: req.Method,
+		URL:    t.scrubURL(req.URL),
+		Header: t.scrubHeader(req.Header),
+		Body:   t.scrub(canonicalBody(req.Header.Get("Content-Type"), body)),
+	}
+}
+
+// scrub 隐藏 s 中的 Secrets
+func (t *Transport) scrub(s string) string {
+	for _, secret := range t.Secrets {
+		if secret != "" {
+			s = strings.Replace(s, secret, Redacted, -1)
+		}
+	}
+	return s
+}
+
+func (t *Transport) scrubURL(u *url.URL) string {
+	c := *u
+	c.User = nil
+	if c.RawQuery != "" {
+		query := c.Query()
+		for key := range query {
+			if isSensitiveKey(key) {
+				query.Set(key, Redacted)
+			}
+		}
+		c.RawQuery = query.Encode()
+	}
+	return t.scrub(c.String())
+}
+
+func (t *Transport) scrubHeader(header http.Header) http.Header {
+	h := make(http.Header, len(header))
+	for k, values := range header {
+		redact := false
+		for _, name := range logging.RedactedHeaders {
+			if strings.EqualFold(k, name) {
+				redact = true
+			}
+		}
+		for _, v := range values {
+			if redact {
+				v = Redacted
+			}
+			h[k] = append(h[k], t.scrub(v))
+		}
+	}
+	return h
+}
+
+// accountParams 是和录制使用的账号相关的查询参数，比如 v4/query 的 ak，golden 文件中同样隐藏，回放时不参与比较
+var accountParams = []string{"ak"}
+
+// isSensitiveKey 判断查询参数或者表单字段是否需要隐藏，参考 logging.RedactedQueryParams
+func isSensitiveKey(key string) bool {
+	for _, params := range [][]string{logging.RedactedQueryParams, accountParams} {
+		for _, param := range params {
+			if strings.EqualFold(key, param) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canonicalBody 返回规范化的请求体，内容相同但是字段顺序或者 multipart 分隔符不同的请求体规范化后相同
+func canonicalBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			if b, err := json.Marshal(v); err == nil {
+				return string(b)
+			}
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return redactValues(values).Encode()
+		}
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if s, err := canonicalMultipart(body, params["boundary"]); err == nil {
+			return s
+		}
+	}
+	return canonicalBytes(body)
+}
+
+func redactValues(values url.Values) url.Values {
+	for key := range values {
+		if isSensitiveKey(key) {
+			values.Set(key, Redacted)
+		}
+	}
+	return values
+}
+
+// canonicalMultipart 把 multipart 表单的每个字段转换为一行 name=value，按字段名排序
+func canonicalMultipart(body []byte, boundary string) (string, error) {
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+	var lines []string
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return "", err
+		}
+		value := string(data)
+		switch {
+		case isSensitiveKey(part.FormName()):
+			value = Redacted
+		case part.FileName() != "":
+			value = "@" + part.FileName() + " " + canonicalBytes(data)
+		default:
+			value = canonicalBytes(data)
+		}
+		lines = append(lines, part.FormName()+"="+value)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+func canonicalBytes(data []byte) string {
+	if len(data) <= inlineBodyLimit && utf8.Valid(data) {
+		return string(data)
+	}
+	sum := sha1.Sum(data)
+	return fmt.Sprintf("sha1:%s size:%d", hex.EncodeToString(sum[:]), len(data))
+}
@@ -0,0 +1,131 @@
+package httpreplay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/storage"
+	"github.com/qiniu/api.v7/v7/storage/storagetest"
+)
+
+func tempPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "httpreplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "testdata", "golden.json")
+}
+
+func run(t *testing.T, rt *Transport, srv *storagetest.Server, cfg *storage.Config) (storage.PutRet, storage.FileInfo) {
+	var ret storage.PutRet
+	uploader := storage.NewFormUploaderEx(cfg, rt.Client())
+	err := uploader.Put(context.Background(), &ret, srv.UploadToken("test", "a.txt"), "a.txt",
+		bytes.NewReader([]byte("hello")), 5, &storage.PutExtra{Params: map[string]string{"x:foo": "bar"}})
+	if err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	m := storage.NewBucketManagerEx(srv.Credentials, cfg, rt.Client())
+	info, err := m.Stat("test", "a.txt")
+	if err != nil {
+		t.Fatalf("Stat() error: %v", err)
+	}
+	return ret, info
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := tempPath(t)
+	srv := storagetest.NewServer()
+	srv.CreateBucket("test")
+	cfg := srv.Config()
+	ak, sk := srv.Credentials.AccessKey, string(srv.Credentials.SecretKey)
+
+	rt, err := New(path, ModeRecord, ak, sk)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	recordedRet, recordedInfo := run(t, rt, srv, cfg)
+	if err = rt.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	srv.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{ak, sk, "Qiniu " + ak, "UpToken"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("golden file contains %q", secret)
+		}
+	}
+
+	// 服务已经关闭，回放不会发送请求
+	rt, err = New(path, ModeReplay, ak, sk)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	ret, info := run(t, rt, srv, cfg)
+	if ret != recordedRet || info.Hash != recordedInfo.Hash || info.Fsize != 5 {
+		t.Errorf("replay got %+v %+v, want %+v %+v", ret, info, recordedRet, recordedInfo)
+	}
+
+	// 录制的请求都已经使用过
+	m := storage.NewBucketManagerEx(srv.Credentials, cfg, rt.Client())
+	if _, err = m.Stat("test", "a.txt"); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("want ErrNoInteraction, got %v", err)
+	}
+}
+
+func TestCanonicalBody(t *testing.T) {
+	cases := []struct {
+		contentType string
+		a, b        string
+	}{
+		{"application/json", `{"b":1,"a":[1,2]}`, `{"a":[1,2], "b":1}`},
+		{"application/x-www-form-urlencoded", "b=1&a=2&token=x", "a=2&b=1&token=y"},
+		{"multipart/form-data; boundary=AAA", "--AAA\r\nContent-Disposition: form-data; name=\"token\"\r\n\r\nx\r\n--AAA--\r\n",
+			"--AAA\r\nContent-Disposition: form-data; name=\"token\"\r\n\r\ny\r\n--AAA--\r\n"},
+	}
+	for _, c := range cases {
+		if a, b := canonicalBody(c.contentType, []byte(c.a)), canonicalBody(c.contentType, []byte(c.b)); a != b {
+			t.Errorf("canonicalBody(%s) differs: %q != %q", c.contentType, a, b)
+		}
+	}
+	if got := canonicalBody("application/octet-stream", make([]byte, 8<<10)); !strings.HasPrefix(got, "sha1:") {
+		t.Errorf("large body should be hashed, got %q", got)
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	recorded := &Request{Method: "GET", URL: "https://rsf.qiniu.com/list?bucket=test&limit=10&marker=m1"}
+	cases := []struct {
+		url  string
+		want bool
+	}{
+		{"https://rsf.qiniu.com/list?marker=m1&bucket=test&limit=10", true},
+		{"https://rsf.qiniu.com/list?bucket=test&limit=10&marker=m2", false},
+		{"https://rsf.qiniu.com/list?bucket=test&limit=10", false},
+		{"https://rsf.qiniu.com/list", false},
+	}
+	for _, c := range cases {
+		if got := match(recorded, &Request{Method: "GET", URL: c.url}); got != c.want {
+			t.Errorf("match(%s) = %v, want %v", c.url, got, c.want)
+		}
+	}
+
+	// 敏感参数和账号相关的参数的值不参与比较
+	recorded = &Request{Method: "GET", URL: "https://uc.qbox.me/v4/query?ak=REDACTED&bucket=test&token=REDACTED"}
+	if !match(recorded, &Request{Method: "GET", URL: "https://uc.qbox.me/v4/query?bucket=test&ak=ak1&token=t1"}) {
+		t.Errorf("redacted query params should not be compared")
+	}
+	if match(recorded, &Request{Method: "GET", URL: "https://uc.qbox.me/v4/query?ak=ak1&bucket=other&token=t1"}) {
+		t.Errorf("other query params should be compared")
+	}
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/logging"
+)
+
+// debugLogger 是开启 DebugMode 且没有设置 Logger 时使用的 Logger
+var debugLogger = logging.NewTextLogger(os.Stdout, logging.LevelDebug)
+
+// defaultLogger 返回没有单独设置 Logger 时使用的 Logger
+func defaultLogger() logging.Logger {
+	if DebugMode && logging.DefaultLogger == logging.Discard {
+		return debugLogger
+	}
+	if logging.DefaultLogger == nil {
+		return logging.Discard
+	}
+	return logging.DefaultLogger
+}
+
+func (r Client) logger() logging.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return defaultLogger()
+}
+
+// LoggerOf 返回 clt 输出日志使用的 Logger，clt 为 nil 或者没有设置 Logger 时和 Client 一样使用默认的 Logger
+func LoggerOf(clt *Client) logging.Logger {
+	if clt == nil {
+		return defaultLogger()
+	}
+	return clt.logger()
+}
+
+// LogRequests 返回一个输出请求日志的中间件，用于没有通过 Client 发送请求的场景，logger 为 nil 时和 Client 一样使用默认的 Logger
+// Client 本身会使用 Client.Logger 输出请求日志，不需要再添加这个中间件
+func LogRequests(logger logging.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			l := logger
+			if l == nil {
+				l = defaultLogger()
+			}
+			logAttempt(l, req, resp, err, time.Since(start))
+			return resp, err
+		}
+	}
+}
+
+// logAttempt 输出一次请求的日志，请求成功或者收到回复时为 Debug 级别，网络错误为 Warn 级别
+func logAttempt(logger logging.Logger, req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	ctx := req.Context()
+	level := logging.LevelDebug
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		level = logging.LevelWarn
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	fields := []logging.Field{
+		logging.String("method", req.Method),
+		logging.String("url", logging.RedactURL(req.URL.String())),
+	}
+	if resp != nil {
+		fields = append(fields,
+			logging.Int("status", resp.StatusCode),
+			logging.String("reqid", resp.Header.Get("X-Reqid")))
+	}
+	fields = append(fields,
+		logging.Duration("duration", elapsed),
+		logging.Int("attempt", attemptFromContext(ctx)))
+	if err != nil {
+		fields = append(fields, logging.Err(err))
+	}
+	logger.Log(ctx, level, "http request", fields...)
+}
+
+// dumpRequest 导出请求内容，隐藏其中的敏感信息
+func dumpRequest(req *http.Request, body bool) ([]byte, error) {
+	header, u := req.Header, req.URL
+	if redacted, err := url.Parse(logging.RedactURL(u.String())); err == nil {
+		req.URL = redacted
+	}
+	req.Header = logging.RedactHeader(header)
+	defer func() { req.Header, req.URL = header, u }()
+	dump, err := httputil.DumpRequest(req, body)
+	if err != nil || !body {
+		return dump, err
+	}
+	return redactDumpBody(dump, header.Get("Content-Type")), nil
+}
+
+// redactDumpBody 隐藏导出的请求体中的上传凭证等敏感字段，和查询参数使用相同的规则
+func redactDumpBody(dump []byte, contentType string) []byte {
+	idx := bytes.Index(dump, []byte("\r\n\r\n"))
+	if idx < 0 {
+		return dump
+	}
+	head, reqBody := dump[:idx+4], dump[idx+4:]
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return dump
+	}
+	switch mediaType {
+	case "multipart/form-data":
+		reqBody = logging.RedactMultipart(reqBody, params["boundary"])
+	case "application/x-www-form-urlencoded":
+		reqBody = []byte(logging.RedactForm(string(reqBody)))
+	default:
+		return dump
+	}
+	return append(head[:len(head):len(head)], reqBody...)
+}
+
+// dumpResponse 导出回复内容，隐藏其中的敏感信息
+func dumpResponse(resp *http.Response, body bool) ([]byte, error) {
+	header := resp.Header
+	resp.Header = logging.RedactHeader(header)
+	defer func() { resp.Header = header }()
+	return httputil.DumpResponse(resp, body)
+}
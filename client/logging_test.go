@@ -0,0 +1,138 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/logging"
+)
+
+type logEntry struct {
+	level  logging.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+type testLogger struct {
+	lock    sync.Mutex
+	entries []logEntry
+}
+
+func (l *testLogger) Enabled(ctx context.Context, level logging.Level) bool {
+	return true
+}
+
+func (l *testLogger) Log(ctx context.Context, level logging.Level, msg string, fields ...logging.Field) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: logging.Map(fields)})
+}
+
+func TestClientLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Reqid", "reqid-1")
+		w.WriteHeader(612)
+	}))
+	defer srv.Close()
+
+	logger := &testLogger{}
+	clt := Client{Client: &http.Client{}, Logger: logger}
+	clt.Call(context.Background(), nil, "GET", srv.URL+"/file?e=1&token=ak:sign", nil)
+	clt.Call(context.Background(), nil, "GET", "http://127.0.0.1:1/", nil)
+
+	if len(logger.entries) != 2 {
+		t.Fatalf("want 2 log entries, got %d", len(logger.entries))
+	}
+	e := logger.entries[0]
+	if e.level != logging.LevelDebug || e.msg != "http request" || e.fields["method"] != "GET" ||
+		e.fields["status"] != 612 || e.fields["reqid"] != "reqid-1" || e.fields["attempt"] != 1 ||
+		e.fields["url"] != srv.URL+"/file?e=1&token=ak%3AREDACTED" {
+		t.Errorf("unexpected log entry: %+v", e)
+	}
+	if _, ok := e.fields["duration"]; !ok {
+		t.Errorf("duration missing: %+v", e)
+	}
+	if e = logger.entries[1]; e.level != logging.LevelWarn || e.fields["error"] == nil {
+		t.Errorf("network error should be logged as warning: %+v", e)
+	}
+}
+
+func TestDebugDumpRedactsAuthorization(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	var b bytes.Buffer
+	DebugMode = true
+	defer func() { DebugMode = false }()
+
+	clt := Client{Client: &http.Client{}, Logger: logging.NewTextLogger(&b, logging.LevelDebug)}
+	ctx := auth.WithCredentialsProviderType(context.Background(), auth.New("ak", "sk"), auth.TokenQiniu)
+	if err := clt.Call(ctx, nil, "GET", srv.URL, nil); err != nil {
+		t.Fatalf("Call() error: %v", err)
+	}
+	out := b.String()
+	if !strings.Contains(out, "Authorization: Qiniu ak:REDACTED") || !strings.Contains(out, "request dump") {
+		t.Errorf("request dump should redact Authorization: %s", out)
+	}
+}
+
+func TestDebugDumpUsesClientLoggerAndRedactsBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"key":"a.txt"}`))
+	}))
+	defer srv.Close()
+
+	var b bytes.Buffer
+	DebugMode, DeepDebugInfo = true, true
+	defer func() { DebugMode, DeepDebugInfo = false, false }()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("token", "ak:sign:policy")
+	writer.WriteField("key", "a.txt")
+	writer.Close()
+	headers := http.Header{"Content-Type": {writer.FormDataContentType()}}
+
+	clt := Client{Client: &http.Client{}, Logger: logging.NewTextLogger(&b, logging.LevelDebug)}
+	if err := clt.CallWith(context.Background(), nil, "POST", srv.URL, headers, &body, body.Len()); err != nil {
+		t.Fatalf("CallWith() error: %v", err)
+	}
+	if err := clt.CallWithForm(context.Background(), nil, "POST", srv.URL, nil, map[string][]string{"token": {"ak:sign"}}); err != nil {
+		t.Fatalf("CallWithForm() error: %v", err)
+	}
+	out := b.String()
+	if strings.Contains(out, "sign") || !strings.Contains(out, "ak:REDACTED") || !strings.Contains(out, "a.txt") {
+		t.Errorf("request dump should redact token field: %s", out)
+	}
+	// 回复使用 Client 的 Logger 输出
+	if !strings.Contains(out, "response dump") {
+		t.Errorf("response dump should use client logger: %s", out)
+	}
+}
+
+func TestLogRequestsNilLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	// logger 和 logging.DefaultLogger 都为 nil 时不输出日志
+	old := logging.DefaultLogger
+	logging.DefaultLogger = nil
+	defer func() { logging.DefaultLogger = old }()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := LogRequests(nil)(http.DefaultClient.Do)(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler 发送一个请求并返回回复
+type Handler func(req *http.Request) (*http.Response, error)
+
+// Middleware 是请求的中间件，可以在调用 next 前后修改请求和回复，也可以不调用 next 直接返回
+//
+// 中间件在请求签名之前执行，因此可以修改请求的域名和头部，修改后的请求会被签名。
+// 一个中间件的例子:
+//
+//	func(next client.Handler) client.Handler {
+//		return func(req *http.Request) (*http.Response, error) {
+//			req.Header.Set("X-Qiniu-Foo", "bar")
+//			return next(req)
+//		}
+//	}
+type Middleware func(next Handler) Handler
+
+// Chain 把中间件串联起来，第一个中间件最先处理请求，最后调用 h
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Use 添加中间件
+func (r *Client) Use(middlewares ...Middleware) {
+	r.Middlewares = append(r.Middlewares, middlewares...)
+}
+
+// middlewareTransport 在 http.RoundTripper 之前执行中间件
+type middlewareTransport struct {
+	transport   http.RoundTripper
+	middlewares []Middleware
+}
+
+// NewMiddlewareTransport 返回一个先执行中间件再由 transport 发送请求的 http.RoundTripper
+// 用于没有通过 Client 发送请求，而是直接使用 http.Client 的场景，transport 为 nil 时使用 http.DefaultTransport
+// 如果 transport 负责签名，中间件同样在签名之前执行
+func NewMiddlewareTransport(transport http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if len(middlewares) == 0 {
+		return transport
+	}
+	return &middlewareTransport{transport: transport, middlewares: middlewares}
+}
+
+// RoundTrip 执行中间件并发送请求
+func (t *middlewareTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// http.RoundTripper 不应该修改请求，复制一份交给中间件
+	req = req.Clone(req.Context())
+	return Chain(t.transport.RoundTrip, t.middlewares...)(req)
+}
+
+// AddHeader 返回一个给每个请求添加头部的中间件，以 X-Qiniu- 开头的头部会参与签名
+func AddHeader(key, value string) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Add(key, value)
+			return next(req)
+		}
+	}
+}
+
+// RewriteHost 返回一个替换请求域名的中间件，用于私有云部署等场景
+// hosts 的键是原域名，值是新域名，都可以带端口，比如 {"rs.qiniu.com": "rs.example.com:8080"}
+func RewriteHost(hosts map[string]string) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			if newHost, ok := hosts[req.URL.Host]; ok {
+				req.URL.Host = newHost
+				req.Host = newHost
+			} else if newHost, ok = hosts[req.URL.Hostname()]; ok {
+				req.URL.Host = newHost
+				req.Host = newHost
+			}
+			return next(req)
+		}
+	}
+}
+
+// Observe 返回一个在每个请求完成后调用 fn 的中间件，可以用来记录请求数量和耗时等指标
+// resp 和 err 只有一个不为 nil
+func Observe(fn func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			fn(req, resp, err, time.Since(start))
+			return resp, err
+		}
+	}
+}
+
+// tokenBucket 是一个简单的令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimitPerHost 返回一个按域名限制请求速率的中间件，每个域名每秒最多 rate 个请求，允许 burst 个突发请求
+// 超过速率的请求会等待，直到请求的 context 结束
+func RateLimitPerHost(rate float64, burst int) Middleware {
+	if burst < 1 {
+		burst = 1
+	}
+	var (
+		lock    sync.Mutex
+		buckets = make(map[string]*tokenBucket)
+	)
+	// reserve 获取一个令牌，返回需要等待的时长
+	reserve := func(host string) time.Duration {
+		lock.Lock()
+		defer lock.Unlock()
+
+		now := time.Now()
+		b, ok := buckets[host]
+		if !ok {
+			b = &tokenBucket{tokens: float64(burst), last: now}
+			buckets[host] = b
+		}
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+		b.last = now
+		b.tokens--
+		if b.tokens >= 0 {
+			return 0
+		}
+		return time.Duration(-b.tokens / rate * float64(time.Second))
+	}
+
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			if rate > 0 {
+				host := req.URL.Host
+				if h, _, err := net.SplitHostPort(host); err == nil {
+					host = h
+				}
+				if d := reserve(strings.ToLower(host)); d > 0 {
+					timer := time.NewTimer(d)
+					select {
+					case <-req.Context().Done():
+						timer.Stop()
+						return nil, req.Context().Err()
+					case <-timer.C:
+					}
+				}
+			}
+			return next(req)
+		}
+	}
+}
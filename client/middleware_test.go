@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+// headerServer 记录收到的请求头和 Host
+type headerServer struct {
+	lock    sync.Mutex
+	headers []http.Header
+	hosts   []string
+}
+
+func (s *headerServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.headers = append(s.headers, req.Header.Clone())
+	s.hosts = append(s.hosts, req.Host)
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+" before")
+				resp, err := next(req)
+				order = append(order, name+" after")
+				return resp, err
+			}
+		}
+	}
+	h := Chain(func(req *http.Request) (*http.Response, error) {
+		order = append(order, "handler")
+		return &http.Response{StatusCode: 200}, nil
+	}, mark("a"), mark("b"))
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	h(req)
+	want := "a before,b before,handler,b after,a after"
+	if got := strings.Join(order, ","); got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+func TestMiddlewareHeaderIsSigned(t *testing.T) {
+	s := &headerServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	mac := auth.New("ak", "sk")
+	ctx := auth.WithCredentialsProviderType(context.Background(), mac, auth.TokenQiniu)
+
+	clt := Client{Client: &http.Client{}}
+	clt.Use(AddHeader("X-Qiniu-Tenant", "a"))
+	if err := clt.Call(ctx, nil, "GET", srv.URL+"/path", nil); err != nil {
+		t.Fatalf("Call() error: %v", err)
+	}
+	if s.headers[0].Get("X-Qiniu-Tenant") != "a" {
+		t.Fatalf("header not added: %v", s.headers[0])
+	}
+
+	// 签名应该包含中间件添加的头部
+	req, _ := http.NewRequest("GET", srv.URL+"/path", nil)
+	req.Header.Set("X-Qiniu-Tenant", "a")
+	token, _ := mac.SignRequestV2(req)
+	if got := s.headers[0].Get("Authorization"); got != "Qiniu "+token {
+		t.Errorf("Authorization = %s, want %s", got, "Qiniu "+token)
+	}
+}
+
+func TestRewriteHost(t *testing.T) {
+	s := &headerServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	clt := Client{Client: &http.Client{}}
+	clt.Use(RewriteHost(map[string]string{"rs.qiniu.com": host}))
+	if err := clt.Call(context.Background(), nil, "POST", "http://rs.qiniu.com/stat/xxx", nil); err != nil {
+		t.Fatalf("Call() error: %v", err)
+	}
+	if len(s.hosts) != 1 || s.hosts[0] != host {
+		t.Errorf("hosts = %v, want %s", s.hosts, host)
+	}
+}
+
+func TestFaultInjectionMiddleware(t *testing.T) {
+	s := &headerServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// 第一个请求返回 503，验证重试会再次经过中间件
+	calls := 0
+	fault := func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			calls++
+			if calls == 1 {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Header:     http.Header{},
+					Body:       http.NoBody,
+					Request:    req,
+				}, nil
+			}
+			return next(req)
+		}
+	}
+	var observed []int
+	observe := Observe(func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+		observed = append(observed, resp.StatusCode)
+	})
+
+	clt := newRetryClient(2)
+	clt.Use(observe, fault)
+	if err := clt.Call(context.Background(), nil, "GET", srv.URL, nil); err != nil {
+		t.Fatalf("Call() error: %v", err)
+	}
+	if calls != 2 || len(s.headers) != 1 {
+		t.Errorf("want 2 calls and 1 request, got %d calls and %d requests", calls, len(s.headers))
+	}
+	if len(observed) != 2 || observed[0] != 503 || observed[1] != 200 {
+		t.Errorf("observed = %v", observed)
+	}
+}
+
+func TestRateLimitPerHost(t *testing.T) {
+	var count int
+	h := Chain(func(req *http.Request) (*http.Response, error) {
+		count++
+		return &http.Response{StatusCode: 200}, nil
+	}, RateLimitPerHost(20, 2))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest("GET", "http://a.com/", nil)
+		h(req)
+	}
+	// 突发 2 个请求，之后每 50 毫秒一个请求
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("requests not limited, elapsed %v", elapsed)
+	}
+
+	// 不同域名分别计算
+	start = time.Now()
+	req, _ := http.NewRequest("GET", "http://b.com/", nil)
+	h(req)
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("other host should not be limited, elapsed %v", elapsed)
+	}
+
+	// 等待时 context 结束
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	h = Chain(h, RateLimitPerHost(0.1, 1))
+	req, _ = http.NewRequest("GET", "http://c.com/", nil)
+	h(req)
+	req, _ = http.NewRequestWithContext(ctx, "GET", "http://c.com/", nil)
+	if _, err := h(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestMiddlewareTransport(t *testing.T) {
+	s := &headerServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	hc := &http.Client{Transport: NewMiddlewareTransport(nil, AddHeader("X-Qiniu-Foo", "bar"))}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := hc.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+	resp.Body.Close()
+	if s.headers[0].Get("X-Qiniu-Foo") != "bar" {
+		t.Errorf("header not added: %v", s.headers[0])
+	}
+	if req.Header.Get("X-Qiniu-Foo") != "" {
+		t.Errorf("original request should not be modified")
+	}
+}
@@ -0,0 +1,279 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver 把域名解析为 IP 地址列表，*net.Resolver 实现了这个接口
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+// ResolverFunc 把一个函数转换为 Resolver
+type ResolverFunc func(ctx context.Context, host string) ([]string, error)
+
+// LookupHost 调用 f 解析域名
+func (f ResolverFunc) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return f(ctx, host)
+}
+
+// StaticResolver 使用固定的域名到 IP 地址的映射解析域名，没有映射的域名由 Fallback 解析
+type StaticResolver struct {
+	// 域名到 IP 地址列表的映射，域名不区分大小写
+	Hosts map[string][]string
+
+	// 解析没有映射的域名，为 nil 时使用 net.DefaultResolver
+	Fallback Resolver
+}
+
+// NewStaticResolver 返回一个使用 hosts 映射的 StaticResolver
+func NewStaticResolver(hosts map[string][]string) *StaticResolver {
+	return &StaticResolver{Hosts: hosts}
+}
+
+// LookupHost 返回域名映射的 IP 地址，没有映射时使用 Fallback 解析
+func (r *StaticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	for h, ips := range r.Hosts {
+		if strings.EqualFold(h, host) && len(ips) > 0 {
+			return append([]string(nil), ips...), nil
+		}
+	}
+	if r.Fallback != nil {
+		return r.Fallback.LookupHost(ctx, host)
+	}
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// DefaultFreezeDuration 是连接失败的 IP 地址默认被冻结的时间
+var DefaultFreezeDuration = 10 * time.Minute
+
+// Dialer 使用 Resolver 解析域名并建立连接
+// 域名解析到多个 IP 地址时依次尝试，连接失败的 IP 地址在冻结时间内排在其他地址后面
+type Dialer struct {
+	// 解析域名，为 nil 时使用 net.DefaultResolver
+	Resolver Resolver
+
+	// 连接失败的 IP 地址的冻结时间，为 0 时使用 DefaultFreezeDuration
+	FreezeDuration time.Duration
+
+	// 连接每个 IP 地址使用的 net.Dialer，为 nil 时使用和 http.DefaultTransport 相同的设置
+	Dialer *net.Dialer
+
+	lock   sync.Mutex
+	frozen map[string]time.Time
+}
+
+// NewDialer 返回一个使用 resolver 解析域名的 Dialer
+func NewDialer(resolver Resolver) *Dialer {
+	return &Dialer{Resolver: resolver}
+}
+
+// DialContext 解析 address 中的域名，依次连接解析得到的 IP 地址，直到连接成功
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	var resolver Resolver = net.DefaultResolver
+	if d.Resolver != nil {
+		resolver = d.Resolver
+	}
+	ips, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	var lastErr error
+	for _, addr := range d.order(ips, port) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			d.unfreeze(addr)
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+		d.freeze(addr)
+	}
+	return nil, lastErr
+}
+
+// order 返回连接的地址列表，没有被冻结的地址排在前面，都保持解析结果的顺序
+func (d *Dialer) order(ips []string, port string) []string {
+	now := time.Now()
+	active := make([]string, 0, len(ips))
+	var frozen []string
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, ip := range ips {
+		addr := net.JoinHostPort(ip, port)
+		if until, ok := d.frozen[addr]; ok {
+			if now.Before(until) {
+				frozen = append(frozen, addr)
+				continue
+			}
+			delete(d.frozen, addr)
+		}
+		active = append(active, addr)
+	}
+	return append(active, frozen...)
+}
+
+func (d *Dialer) freeze(addr string) {
+	duration := d.FreezeDuration
+	if duration <= 0 {
+		duration = DefaultFreezeDuration
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.frozen == nil {
+		d.frozen = make(map[string]time.Time)
+	}
+	d.frozen[addr] = time.Now().Add(duration)
+}
+
+func (d *Dialer) unfreeze(addr string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.frozen, addr)
+}
+
+// Frozen 判断 IP 地址和端口组成的 addr 当前是否被冻结
+func (d *Dialer) Frozen(addr string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	until, ok := d.frozen[addr]
+	return ok && time.Now().Before(until)
+}
+
+// NewResolverTransport 返回一个使用 resolver 解析域名的 http.Transport，其他设置和 http.DefaultTransport 相同
+// HTTPS 请求仍然使用请求的域名校验证书
+func NewResolverTransport(resolver Resolver) *http.Transport {
+	return NewDialerTransport(NewDialer(resolver))
+}
+
+// NewDialerTransport 返回一个使用 dialer 建立连接的 http.Transport，其他设置和 http.DefaultTransport 相同
+func NewDialerTransport(dialer *Dialer) *http.Transport {
+	var t *http.Transport
+	if dt, ok := http.DefaultTransport.(*http.Transport); ok {
+		t = dt.Clone()
+	} else {
+		t = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+	t.DialContext = dialer.DialContext
+	return t
+}
+
+// SetDefaultResolver 设置 DefaultClient 使用 resolver 解析域名，resolver 为 nil 时恢复使用系统的域名解析
+// 可以和使用 DefaultClient 的请求并发调用，设置后 DefaultClient 和复制了 DefaultClient.Transport 的 Manager(比如 sms)发送的新请求立即生效
+// 解析域名的 Transport 基于 SetDefaultTransport 设置的 Transport 构建，保留它的代理、TLS 等设置和中间件；
+// 直接替换了 DefaultClient.Transport 时不会生效，需要改用 SetDefaultTransport 替换。
+// 使用自己的 Client 的 Manager(比如通过 cdn.NewCdnManagerEx，rtc.NewManagerEx，storage.NewBucketManagerEx 构建的)不受影响，
+// 需要使用 NewResolverTransport 设置 Client 的 Transport
+func SetDefaultResolver(resolver Resolver) {
+	defaultTransport.lock.Lock()
+	defer defaultTransport.lock.Unlock()
+
+	defaultTransport.resolver = resolver
+	defaultTransport.rebuild()
+}
+
+// SetDefaultTransport 设置 DefaultClient 发送请求使用的 Transport，transport 为 nil 时恢复使用 http.DefaultTransport
+// 和直接修改 DefaultClient.Transport 不同，可以和使用 DefaultClient 的请求并发调用，设置过 Resolver 时新的 Transport 同样使用它解析域名
+func SetDefaultTransport(transport http.RoundTripper) {
+	if transport == nil || transport == http.RoundTripper(defaultTransport) {
+		transport = http.DefaultTransport
+	}
+	defaultTransport.lock.Lock()
+	defer defaultTransport.lock.Unlock()
+
+	defaultTransport.base = transport
+	defaultTransport.rebuild()
+}
+
+// defaultTransport 是 DefaultClient 默认使用的 Transport，SetDefaultTransport 和 SetDefaultResolver 通过它切换 Transport
+var defaultTransport = &switchTransport{base: http.DefaultTransport}
+
+// switchTransport 在设置了 resolver 时使用基于 base 构建的 resolved 发送请求，否则使用 base
+type switchTransport struct {
+	lock     sync.RWMutex
+	base     http.RoundTripper
+	resolver Resolver
+	resolved http.RoundTripper
+}
+
+// rebuild 根据 base 和 resolver 重新构建 resolved，并关闭之前的 resolved 的空闲连接，调用时需要持有写锁
+func (t *switchTransport) rebuild() {
+	old := t.resolved
+	t.resolved = nil
+	if t.resolver != nil {
+		t.resolved = withDialer(t.base, NewDialer(t.resolver))
+	}
+	if old != nil {
+		closeIdleConnections(old)
+	}
+}
+
+func (t *switchTransport) current() http.RoundTripper {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.resolved != nil {
+		return t.resolved
+	}
+	return t.base
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *switchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.current().RoundTrip(req)
+}
+
+// CloseIdleConnections 关闭当前 Transport 的空闲连接
+func (t *switchTransport) CloseIdleConnections() {
+	closeIdleConnections(t.current())
+}
+
+// withDialer 返回一个和 transport 设置相同，但是使用 dialer 建立连接的 http.RoundTripper
+// transport 是 *http.Transport 时复制它的设置，是本包的中间件或重试 Transport 时保留外层并替换内层的 Transport，
+// 其他无法替换建立连接方式的 Transport 原样返回
+func withDialer(transport http.RoundTripper, dialer *Dialer) http.RoundTripper {
+	switch t := transport.(type) {
+	case *http.Transport:
+		c := t.Clone()
+		c.DialContext = dialer.DialContext
+		return c
+	case *middlewareTransport:
+		return &middlewareTransport{transport: withDialer(t.transport, dialer), middlewares: t.middlewares}
+	case *retryTransport:
+		return &retryTransport{transport: withDialer(t.transport, dialer), policy: t.policy}
+	}
+	return transport
+}
+
+// closeIdleConnections 关闭 transport 以及它包装的 Transport 的空闲连接
+func closeIdleConnections(transport http.RoundTripper) {
+	switch t := transport.(type) {
+	case *middlewareTransport:
+		closeIdleConnections(t.transport)
+	case *retryTransport:
+		closeIdleConnections(t.transport)
+	case interface{ CloseIdleConnections() }:
+		t.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaticResolver(t *testing.T) {
+	fallback := ResolverFunc(func(ctx context.Context, host string) ([]string, error) {
+		return nil, errors.New("not found")
+	})
+	r := &StaticResolver{Hosts: map[string][]string{"up.qiniup.com": {"10.0.0.1", "10.0.0.2"}}, Fallback: fallback}
+	ips, err := r.LookupHost(context.Background(), "UP.qiniup.com")
+	if err != nil || len(ips) != 2 || ips[0] != "10.0.0.1" {
+		t.Errorf("LookupHost() = %v, %v", ips, err)
+	}
+	if _, err = r.LookupHost(context.Background(), "rs.qiniu.com"); err == nil {
+		t.Errorf("LookupHost() should use the fallback resolver")
+	}
+}
+
+func TestDialerFreeze(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Host))
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+
+	// 服务只监听 127.0.0.1，连接 127.0.0.2 会失败
+	var lookups int
+	d := NewDialer(ResolverFunc(func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		if host != "up.example.com" {
+			return nil, errors.New("unexpected host " + host)
+		}
+		return []string{"127.0.0.2", "127.0.0.1"}, nil
+	}))
+	d.Dialer = &net.Dialer{Timeout: time.Second}
+	tr := NewDialerTransport(d)
+	tr.DisableKeepAlives = true
+	hc := &http.Client{Transport: tr}
+
+	for i := 0; i < 2; i++ {
+		resp, err := hc.Get("http://up.example.com:" + port + "/")
+		if err != nil {
+			t.Fatalf("Get() error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if lookups != 2 {
+		t.Errorf("lookups = %d, want 2", lookups)
+	}
+	if !d.Frozen(net.JoinHostPort("127.0.0.2", port)) || d.Frozen(net.JoinHostPort("127.0.0.1", port)) {
+		t.Errorf("127.0.0.2 should be frozen and 127.0.0.1 should not")
+	}
+	if order := d.order([]string{"127.0.0.2", "127.0.0.1"}, port); order[0] != net.JoinHostPort("127.0.0.1", port) {
+		t.Errorf("frozen address should be tried last, got %v", order)
+	}
+
+	// 冻结时间过后恢复原来的顺序
+	d.FreezeDuration = time.Millisecond
+	d.freeze(net.JoinHostPort("127.0.0.2", port))
+	time.Sleep(5 * time.Millisecond)
+	if order := d.order([]string{"127.0.0.2", "127.0.0.1"}, port); order[0] != net.JoinHostPort("127.0.0.2", port) {
+		t.Errorf("address should be unfrozen, got %v", order)
+	}
+}
+
+func TestSetDefaultResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+
+	// 解析域名的 Transport 基于 SetDefaultTransport 设置的 Transport 构建，保留它的中间件
+	var custom int32
+	SetDefaultTransport(NewMiddlewareTransport(http.DefaultTransport.(*http.Transport).Clone(), func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&custom, 1)
+			return next(req)
+		}
+	}))
+	defer SetDefaultTransport(nil)
+	if DefaultClient.Transport != http.RoundTripper(defaultTransport) {
+		t.Fatalf("SetDefaultTransport should not replace DefaultClient.Transport")
+	}
+
+	SetDefaultResolver(NewStaticResolver(map[string][]string{"rs.qiniu.com": {"127.0.0.1"}}))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := DefaultClient.Call(context.Background(), nil, "GET", "http://rs.qiniu.com:"+port+"/", nil); err != nil {
+				t.Errorf("Call() error: %v", err)
+			}
+		}()
+	}
+	// 和请求并发设置
+	SetDefaultResolver(NewStaticResolver(map[string][]string{"rs.qiniu.com": {"127.0.0.1"}}))
+	wg.Wait()
+	if atomic.LoadInt32(&custom) != 4 {
+		t.Errorf("resolver transport should keep the custom transport, got %d requests", atomic.LoadInt32(&custom))
+	}
+
+	SetDefaultResolver(nil)
+	if err := DefaultClient.Call(context.Background(), nil, "GET", srv.URL, nil); err != nil {
+		t.Fatalf("Call() after reset error: %v", err)
+	}
+	if atomic.LoadInt32(&custom) != 5 {
+		t.Errorf("SetDefaultResolver(nil) should keep the custom transport")
+	}
+}
+
+func TestSetDefaultResolverClosesIdleConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+
+	SetDefaultResolver(NewStaticResolver(map[string][]string{"rs.qiniu.com": {"127.0.0.1"}}))
+	defer SetDefaultResolver(nil)
+	if err := DefaultClient.Call(context.Background(), nil, "GET", "http://rs.qiniu.com:"+port+"/", nil); err != nil {
+		t.Fatalf("Call() error: %v", err)
+	}
+
+	// 替换 Resolver 时关闭之前的 Transport 的空闲连接
+	SetDefaultResolver(nil)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("idle connections of the previous resolver transport should be closed")
+	}
+}
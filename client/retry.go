@@ -0,0 +1,375 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy 描述 Client 发送请求失败时的重试策略
+//
+// Client 的 RetryPolicy 为 nil 时每个请求只发送一次。
+// 每次重试都会重新签名请求，请求体需要实现 io.Seeker(比如 bytes.Reader，strings.Reader)才能重试，
+// 否则请求只发送一次。
+type RetryPolicy struct {
+	// 最多尝试的次数，包括第一次请求，小于等于 1 表示不重试
+	MaxAttempts int
+
+	// 第一次重试前等待的时长，之后每次重试翻倍，默认 100 毫秒
+	BaseDelay time.Duration
+
+	// 重试前等待的最长时长，默认 10 秒
+	MaxDelay time.Duration
+
+	// 等待时长的随机抖动比例，取值范围 [0, 1]，比如 0.5 表示在计算出的时长的 50% 到 100% 之间随机等待
+	// 默认为 0 表示不抖动
+	Jitter float64
+
+	// 重试额度，多个 RetryPolicy 可以共用一个额度来限制整体的重试请求比例，为 nil 表示不限制
+	Budget *RetryBudget
+
+	// 是否重试非幂等的请求，默认只重试幂等的请求，参考 IsIdempotent
+	RetryNonIdempotent bool
+
+	// 自定义判断请求是否需要重试，为 nil 时使用 DefaultShouldRetry
+	// resp 和 err 只有一个不为 nil
+	ShouldRetry func(req *http.Request, resp *http.Response, err error) bool
+}
+
+// NewRetryPolicy 返回一个最多尝试 maxAttempts 次，使用默认退避时长和 50% 抖动的重试策略
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		Jitter:      0.5,
+	}
+}
+
+// RetryBudget 是重试额度，每个请求增加 Ratio 个额度，每次重试消耗一个额度，额度不足时不再重试
+// 用来避免服务端故障时大量重试请求加重服务端负担
+type RetryBudget struct {
+	// 每个请求增加的额度，比如 0.1 表示重试请求最多占请求总数的 10% 左右
+	Ratio float64
+
+	// 额度上限，也是初始额度
+	Capacity float64
+
+	lock   sync.Mutex
+	tokens float64
+	inited bool
+}
+
+// NewRetryBudget 返回一个重试额度
+func NewRetryBudget(ratio, capacity float64) *RetryBudget {
+	return &RetryBudget{Ratio: ratio, Capacity: capacity}
+}
+
+func (b *RetryBudget) init() {
+	if !b.inited {
+		b.tokens = b.Capacity
+		b.inited = true
+	}
+}
+
+// deposit 在每个请求开始的时候增加额度
+func (b *RetryBudget) deposit() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.init()
+	b.tokens += b.Ratio
+	if b.tokens > b.Capacity {
+		b.tokens = b.Capacity
+	}
+}
+
+// withdraw 在重试前消耗额度，额度不足时返回 false
+func (b *RetryBudget) withdraw() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.init()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent 返回一个标记请求为幂等的 context，使用 POST 等方法但是可以安全重试的接口(比如查询接口)用它来允许重试
+func WithIdempotent(ctx context.Context, idempotent bool) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, idempotent)
+}
+
+// IsIdempotent 判断请求是否幂等
+// 优先使用 WithIdempotent 的标记，否则 GET，HEAD，OPTIONS，PUT，DELETE 请求是幂等的
+func IsIdempotent(req *http.Request) bool {
+	if idempotent, ok := req.Context().Value(idempotentKey{}).(bool); ok {
+		return idempotent
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// IsRetryableStatus 判断 HTTP 状态码是否表示可以重试的错误
+// 包括 5xx 错误和七牛的 573(请求过于频繁)，579(上传回调失败)，599(服务端操作失败)，但不包括 501(未实现)
+func IsRetryableStatus(code int) bool {
+	switch code {
+	case 573, 579, 599:
+		return true
+	case http.StatusNotImplemented:
+		return false
+	}
+	return code >= 500 && code < 600
+}
+
+// isDialError 判断是否是建立连接时发生的错误，这时请求还没有发出，任何请求都可以安全重试
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// DefaultShouldRetry 是默认的重试判断
+//
+// 建立连接失败总是重试；573 表示请求被限流没有被处理，也总是重试；
+// 其他网络错误和 IsRetryableStatus 的状态码只在请求幂等时重试
+func DefaultShouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		return isDialError(err) || IsIdempotent(req)
+	}
+	if resp.StatusCode == 573 {
+		return true
+	}
+	return IsRetryableStatus(resp.StatusCode) && IsIdempotent(req)
+}
+
+func (p *RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(req, resp, err)
+	}
+	if p.RetryNonIdempotent {
+		req = req.WithContext(WithIdempotent(req.Context(), true))
+	}
+	return DefaultShouldRetry(req, resp, err)
+}
+
+// delay 计算第 attempt 次重试(从 1 开始)前等待的时长，服务端返回 Retry-After 时不小于该时长
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	base, max := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		d = time.Duration(float64(d) * (1 - jitter*rand.Float64()))
+	}
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			if after := time.Duration(seconds) * time.Second; after > d {
+				d = after
+			}
+		}
+	}
+	return d
+}
+
+// requestBody 记录请求体的起始位置，重试前回到起始位置
+type requestBody struct {
+	body   io.Reader
+	offset int64
+	seeker io.Seeker
+}
+
+func newRequestBody(body io.Reader) *requestBody {
+	b := &requestBody{body: body}
+	if seeker, ok := body.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			b.seeker, b.offset = seeker, offset
+		}
+	}
+	return b
+}
+
+// rewindable 判断请求体是否可以重新发送
+func (b *requestBody) rewindable() bool {
+	return b.body == nil || b.body == http.NoBody || b.seeker != nil
+}
+
+func (b *requestBody) rewind() error {
+	if b.seeker == nil {
+		return nil
+	}
+	_, err := b.seeker.Seek(b.offset, io.SeekStart)
+	return err
+}
+
+// doWithRetry 按照重试策略发送请求，每次尝试都重新构建和签名请求
+func (r Client) doWithRetry(ctx context.Context, method, reqUrl string, headers http.Header, body io.Reader,
+	bodyLength int64) (resp *http.Response, err error) {
+
+	policy := r.RetryPolicy
+	reqBody := newRequestBody(body)
+	if policy == nil || policy.MaxAttempts <= 1 || !reqBody.rewindable() {
+		return r.doOnce(ctx, method, reqUrl, headers, body, bodyLength)
+	}
+	if policy.Budget != nil {
+		policy.Budget.deposit()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if err = reqBody.rewind(); err != nil {
+				return
+			}
+		}
+		req, rErr := newRequest(withAttempt(ctx, attempt), method, reqUrl, cloneHeader(headers), body)
+		if rErr != nil {
+			return nil, rErr
+		}
+		req.ContentLength = bodyLength
+		resp, err = r.Do(ctx, req)
+
+		if err == nil && resp.StatusCode/100 == 2 {
+			return
+		}
+		if attempt >= policy.MaxAttempts || !policy.shouldRetry(req, resp, err) ||
+			policy.Budget != nil && !policy.Budget.withdraw() {
+			return
+		}
+
+		d := policy.delay(attempt, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			resp = nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (r Client) doOnce(ctx context.Context, method, reqUrl string, headers http.Header, body io.Reader,
+	bodyLength int64) (resp *http.Response, err error) {
+
+	req, err := newRequest(ctx, method, reqUrl, headers, body)
+	if err != nil {
+		return
+	}
+	req.ContentLength = bodyLength
+	return r.Do(ctx, req)
+}
+
+// cloneHeader 复制请求头，避免签名时写入的 Authorization 等头部影响下一次尝试
+func cloneHeader(headers http.Header) http.Header {
+	if headers == nil {
+		return nil
+	}
+	h := make(http.Header, len(headers))
+	for k, v := range headers {
+		h[k] = append([]string(nil), v...)
+	}
+	return h
+}
+
+// retryTransport 按照重试策略发送请求的 http.RoundTripper
+type retryTransport struct {
+	transport http.RoundTripper
+	policy    *RetryPolicy
+}
+
+// NewRetryTransport 返回一个按照 policy 重试的 http.RoundTripper
+// 用于没有通过 Client 发送请求，而是直接使用 http.Client 的场景，transport 为 nil 时使用 http.DefaultTransport
+// 每次尝试都交给 transport 重新发送，如果 transport 负责签名，每次重试同样会重新签名；
+// 请求体需要可以通过 req.GetBody 重新获取(比如 http.NewRequest 使用 bytes.Reader 等构建的请求)才能重试
+func NewRetryTransport(transport http.RoundTripper, policy *RetryPolicy) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return transport
+	}
+	return &retryTransport{transport: transport, policy: policy}
+}
+
+// RoundTrip 发送请求，失败时按照重试策略重试
+func (t *retryTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	policy := t.policy
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return t.transport.RoundTrip(req)
+	}
+	if policy.Budget != nil {
+		policy.Budget.deposit()
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		// http.RoundTripper 不应该修改请求，每次尝试使用一份复制
+		r := req.Clone(withAttempt(ctx, attempt))
+		if attempt > 1 && req.GetBody != nil {
+			if r.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		resp, err = t.transport.RoundTrip(r)
+
+		if err == nil && resp.StatusCode/100 == 2 {
+			return
+		}
+		if attempt >= policy.MaxAttempts || !policy.shouldRetry(r, resp, err) ||
+			policy.Budget != nil && !policy.Budget.withdraw() {
+			return
+		}
+
+		d := policy.delay(attempt, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			resp = nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
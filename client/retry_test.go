@@ -0,0 +1,249 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+// flakyServer 前 failures 个请求返回 code，之后返回 200，并记录每个请求的请求体和签名
+type flakyServer struct {
+	lock     sync.Mutex
+	failures int
+	code     int
+	bodies   []string
+	auths    []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	body, _ := ioutil.ReadAll(req.Body)
+	s.bodies = append(s.bodies, string(body))
+	s.auths = append(s.auths, req.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", "application/json")
+	if len(s.bodies) <= s.failures {
+		w.WriteHeader(s.code)
+		w.Write([]byte(`{"error":"temporary error"}`))
+		return
+	}
+	w.Write([]byte(`{"ok":true}`))
+}
+
+func newRetryClient(maxAttempts int) Client {
+	policy := NewRetryPolicy(maxAttempts)
+	policy.BaseDelay = time.Millisecond
+	policy.MaxDelay = 5 * time.Millisecond
+	return Client{Client: &http.Client{}, RetryPolicy: policy}
+}
+
+func TestRetryIdempotentRequest(t *testing.T) {
+	s := &flakyServer{failures: 2, code: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// 每次获取密钥返回不同的密钥，用来验证每次重试都重新签名
+	n := 0
+	provider := auth.NewRotatingProvider(func() (*auth.Credentials, error) {
+		n++
+		return auth.New("ak", strings.Repeat("s", n)), nil
+	}, 0)
+	ctx := auth.WithCredentialsProviderType(context.Background(), provider, auth.TokenQiniu)
+
+	var ret struct {
+		OK bool `json:"ok"`
+	}
+	err := newRetryClient(3).CallWith(ctx, &ret, "PUT", srv.URL+"/put", nil, strings.NewReader("body"), 4)
+	if err != nil || !ret.OK {
+		t.Fatalf("CallWith() got %v, %v", ret, err)
+	}
+	if len(s.bodies) != 3 {
+		t.Fatalf("want 3 attempts, got %d", len(s.bodies))
+	}
+	for i, body := range s.bodies {
+		if body != "body" {
+			t.Errorf("attempt %d: body not rewound: %q", i, body)
+		}
+	}
+	if s.auths[0] == s.auths[1] || s.auths[1] == s.auths[2] {
+		t.Errorf("requests should be signed on each attempt: %v", s.auths)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	s := &flakyServer{failures: 10, code: 599}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	err := newRetryClient(3).Call(context.Background(), nil, "GET", srv.URL, nil)
+	if e, ok := err.(*ErrorInfo); !ok || e.Code != 599 || e.Err != "temporary error" {
+		t.Fatalf("want 599 error, got %v", err)
+	}
+	if len(s.bodies) != 3 {
+		t.Errorf("want 3 attempts, got %d", len(s.bodies))
+	}
+}
+
+func TestRetryNonIdempotentRequest(t *testing.T) {
+	cases := []struct {
+		code       int
+		idempotent bool
+		attempts   int
+	}{
+		{http.StatusInternalServerError, false, 1},
+		{http.StatusInternalServerError, true, 2},
+		{573, false, 2},
+		{http.StatusBadRequest, true, 1},
+		{http.StatusNotImplemented, true, 1},
+	}
+	for _, c := range cases {
+		s := &flakyServer{failures: 1, code: c.code}
+		srv := httptest.NewServer(s)
+
+		ctx := context.Background()
+		if c.idempotent {
+			ctx = WithIdempotent(ctx, true)
+		}
+		newRetryClient(3).CallWithForm(ctx, nil, "POST", srv.URL, nil, map[string][]string{"a": {"b"}})
+		if len(s.bodies) != c.attempts {
+			t.Errorf("code %d idempotent %v: want %d attempts, got %d", c.code, c.idempotent, c.attempts, len(s.bodies))
+		}
+		for _, body := range s.bodies {
+			if body != "a=b" {
+				t.Errorf("body not rewound: %q", body)
+			}
+		}
+		srv.Close()
+	}
+}
+
+func TestRetryNetworkError(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	if err := newRetryClient(2).Call(context.Background(), nil, "GET", srv.URL, nil); err != nil {
+		t.Errorf("Call() error: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("want 2 attempts, got %d", attempts)
+	}
+
+	// 连接失败时请求还没有发出，非幂等的请求也可以重试
+	policy := &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	var urls []string
+	policy.ShouldRetry = func(req *http.Request, resp *http.Response, err error) bool {
+		urls = append(urls, req.URL.String())
+		return DefaultShouldRetry(req, resp, err)
+	}
+	clt := Client{Client: &http.Client{}, RetryPolicy: policy}
+	if err := clt.Call(context.Background(), nil, "POST", "http://127.0.0.1:1/", nil); err == nil {
+		t.Errorf("want dial error")
+	}
+	if len(urls) != 1 {
+		t.Errorf("want dial error to be retried once, got %d", len(urls))
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	s := &flakyServer{failures: 100, code: http.StatusBadGateway}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	clt := newRetryClient(3)
+	clt.RetryPolicy.Budget = NewRetryBudget(0, 1)
+	clt.Call(context.Background(), nil, "GET", srv.URL, nil)
+	clt.Call(context.Background(), nil, "GET", srv.URL, nil)
+	// 额度只够重试一次
+	if len(s.bodies) != 3 {
+		t.Errorf("want 3 requests, got %d", len(s.bodies))
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	s := &flakyServer{failures: 100, code: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	clt := newRetryClient(5)
+	clt.RetryPolicy.BaseDelay = time.Hour
+	clt.RetryPolicy.MaxDelay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := clt.Call(ctx, nil, "GET", srv.URL, nil)
+	if err != context.DeadlineExceeded || time.Since(start) > 5*time.Second {
+		t.Errorf("want DeadlineExceeded quickly, got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if d := p.delay(i+1, nil); d != w {
+			t.Errorf("delay(%d) = %v, want %v", i+1, d, w)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.delay(2, nil); d < 100*time.Millisecond || d > 200*time.Millisecond {
+			t.Fatalf("delay with jitter out of range: %v", d)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	if d := p.delay(1, resp); d != 3*time.Second {
+		t.Errorf("delay with Retry-After = %v, want 3s", d)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	s := &flakyServer{failures: 2, code: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	policy := NewRetryPolicy(3)
+	policy.BaseDelay = time.Millisecond
+	hc := &http.Client{Transport: NewRetryTransport(nil, policy)}
+	req, _ := http.NewRequest("PUT", srv.URL+"/put", strings.NewReader("body"))
+	resp, err := hc.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Do() got %v, %v", resp, err)
+	}
+	resp.Body.Close()
+	if len(s.bodies) != 3 || s.bodies[2] != "body" {
+		t.Errorf("want 3 attempts with body, got %q", s.bodies)
+	}
+
+	// 非幂等的请求不重试
+	s = &flakyServer{failures: 1, code: http.StatusServiceUnavailable}
+	srv2 := httptest.NewServer(s)
+	defer srv2.Close()
+	req, _ = http.NewRequest("POST", srv2.URL, strings.NewReader("body"))
+	resp, err = hc.Do(req)
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable || len(s.bodies) != 1 {
+		t.Errorf("POST should not be retried: %v, %v, %d attempts", resp, err, len(s.bodies))
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/telemetry"
+)
+
+type attemptKey struct{}
+
+// withAttempt 记录当前是第几次尝试发送请求，从 1 开始
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+func attemptFromContext(ctx context.Context) int {
+	if attempt, ok := ctx.Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
+
+// recordAttempt 记录一次 HTTP 请求的指标，并作为事件记录到 context 中正在进行的操作上
+func recordAttempt(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	ctx := req.Context()
+	observer := telemetry.ObserverFromContext(ctx)
+
+	outcome := telemetry.Outcome(err)
+	statusCode, reqId := 0, ""
+	if resp != nil {
+		statusCode, reqId = resp.StatusCode, resp.Header.Get("X-Reqid")
+		if statusCode/100 != 2 {
+			outcome = telemetry.OutcomeError
+		}
+	}
+	metricAttrs := []telemetry.Attribute{
+		telemetry.String(telemetry.AttrHost, req.URL.Host),
+		telemetry.Int(telemetry.AttrStatusCode, statusCode),
+		telemetry.String(telemetry.AttrOutcome, outcome),
+	}
+	observer.AddCounter(ctx, telemetry.MetricRequests, 1, metricAttrs...)
+	observer.RecordHistogram(ctx, telemetry.MetricRequestDuration, elapsed.Seconds(), metricAttrs...)
+
+	op := telemetry.OperationFromContext(ctx)
+	if op == nil {
+		return
+	}
+	attrs := append(metricAttrs,
+		telemetry.String(telemetry.AttrHTTPMethod, req.Method),
+		telemetry.String(telemetry.AttrReqid, reqId),
+		telemetry.Int(telemetry.AttrAttempt, attemptFromContext(ctx)),
+	)
+	if err != nil {
+		attrs = append(attrs, telemetry.String("error", err.Error()))
+	}
+	op.AddEvent(telemetry.EventHTTPAttempt, attrs...)
+	// 操作的 Host 和 Reqid 使用最后一次请求的值
+	op.SetAttributes(telemetry.String(telemetry.AttrHost, req.URL.Host), telemetry.String(telemetry.AttrReqid, reqId))
+}
@@ -0,0 +1,249 @@
+// Package endpoints 提供了私有云等场景下各服务地址的配置
+//
+// 一组服务地址称为一个配置(Profile)，可以从配置文件或者环境变量中加载，然后设置到各个 Manager 上，
+// 同一个进程中不同的 Manager 可以使用不同的配置，比如同时访问公有云和私有云:
+//
+//	p, err := endpoints.Load("", "private")
+//	if err != nil {
+//		return err
+//	}
+//	cfg := storage.Config{}
+//	cfg.ApplyProfile(p)
+//	bucketManager := storage.NewBucketManager(mac, &cfg)
+//	cdnManager := cdn.NewCdnManager(mac)
+//	cdnManager.SetHost(p.FusionHost)
+package endpoints
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+// 环境变量名称
+const (
+	// EnvEndpointsFile 指定服务地址配置文件路径的环境变量
+	EnvEndpointsFile = "QINIU_ENDPOINTS_FILE"
+
+	// EnvPrefix 是覆盖配置中服务地址的环境变量的前缀，比如 QINIU_UC_HOSTS，QINIU_FUSION_HOST
+	EnvPrefix = "QINIU_"
+)
+
+// ErrProfileNotFound 表示配置文件中没有指定的配置
+var ErrProfileNotFound = errors.New("endpoint profile not found")
+
+// Profile 是一组服务地址，地址可以带 http:// 或者 https:// 前缀，为空的字段使用 SDK 的默认值
+type Profile struct {
+	// 配置名称
+	Name string
+
+	// 对象存储的 UC 服务地址列表，第一个地址用于空间管理接口，查询空间区域信息时依次尝试
+	UcHosts []string
+
+	// 对象存储各服务的地址
+	RsHost  string
+	RsfHost string
+	ApiHost string
+	IoHost  string
+	UpHosts []string
+
+	// 地址没有指定协议时是否使用 https，为 nil 时保持使用方原有的设置
+	UseHTTPS *bool
+
+	// CDN 服务地址，参考 cdn.FusionHost
+	FusionHost string
+
+	// 实时音视频服务地址，参考 rtc.RtcHost
+	RtcHost string
+
+	// 短信服务地址，参考 sms.Host
+	SmsHost string
+
+	// 视频监控服务地址，参考 qvs.APIHost
+	QvsHost string
+
+	// 物联网视频服务地址，参考 linking.APIHost
+	LinkingHost string
+}
+
+// Load 加载名为 profile 的配置，然后使用环境变量覆盖其中的地址
+// path 为空时依次使用环境变量 QINIU_ENDPOINTS_FILE 和 ~/.qiniu/endpoints，默认的文件不存在时只使用环境变量
+// profile 为空时依次使用环境变量 QINIU_PROFILE 和 auth.DefaultProfile，和密钥配置文件使用相同的配置名称
+func Load(path, profile string) (*Profile, error) {
+	optional := false
+	if path == "" {
+		path = os.Getenv(EnvEndpointsFile)
+	}
+	if path == "" {
+		optional = true
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".qiniu", "endpoints")
+		}
+	}
+	if profile == "" {
+		profile = os.Getenv(auth.EnvProfile)
+	}
+	if profile == "" {
+		profile = auth.DefaultProfile
+	}
+
+	p := &Profile{Name: profile}
+	if path != "" {
+		loaded, err := LoadFile(path, profile)
+		switch {
+		case err == nil:
+			p = loaded
+		case optional && os.IsNotExist(err):
+		default:
+			return nil, err
+		}
+	}
+	if err := p.applyEnv(EnvPrefix); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadFile 从 path 文件中读取名为 profile 的配置，不使用环境变量
+// 配置文件是 INI 格式，和密钥配置文件相同，每个配置是一个小节，多个地址用逗号分隔，例如:
+//
+//	[private]
+//	uc_hosts = https://uc.example.com, https://uc-backup.example.com
+//	rs_host = rs.example.com
+//	rsf_host = rsf.example.com
+//	api_host = api.example.com
+//	io_host = io.example.com
+//	up_hosts = up.example.com
+//	use_https = true
+//	fusion_host = https://fusion.example.com
+//	rtc_host = rtc.example.com
+//	sms_host = https://sms.example.com
+//	qvs_host = qvs.example.com/v1
+//	linking_host = linking.example.com/v1
+func LoadFile(path, profile string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		section string
+		found   bool
+		p       = &Profile{Name: profile}
+	)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			section = strings.Trim(section, `"'`)
+			if section == profile {
+				found = true
+			}
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+		if err = p.set(key, value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("profile %q in %s: %w", profile, path, ErrProfileNotFound)
+	}
+	return p, nil
+}
+
+// profileKeys 是配置文件中的键，对应的环境变量为 EnvPrefix 加上键的大写形式
+var profileKeys = []string{
+	"uc_hosts", "rs_host", "rsf_host", "api_host", "io_host", "up_hosts", "use_https",
+	"fusion_host", "rtc_host", "sms_host", "qvs_host", "linking_host",
+}
+
+// applyEnv 使用以 prefix 开头的环境变量覆盖配置中的值
+func (p *Profile) applyEnv(prefix string) error {
+	for _, key := range profileKeys {
+		name := prefix + strings.ToUpper(key)
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			if err := p.set(key, value); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Profile) set(key, value string) (err error) {
+	switch key {
+	case "uc_hosts":
+		p.UcHosts = splitHosts(value)
+	case "rs_host":
+		p.RsHost = value
+	case "rsf_host":
+		p.RsfHost = value
+	case "api_host":
+		p.ApiHost = value
+	case "io_host":
+		p.IoHost = value
+	case "up_hosts":
+		p.UpHosts = splitHosts(value)
+	case "use_https":
+		var useHTTPS bool
+		if useHTTPS, err = strconv.ParseBool(value); err == nil {
+			p.UseHTTPS = &useHTTPS
+		}
+	case "fusion_host":
+		p.FusionHost = value
+	case "rtc_host":
+		p.RtcHost = value
+	case "sms_host":
+		p.SmsHost = value
+	case "qvs_host":
+		p.QvsHost = value
+	case "linking_host":
+		p.LinkingHost = value
+	}
+	return
+}
+
+func splitHosts(value string) []string {
+	var hosts []string
+	for _, host := range strings.Split(value, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// URL 返回 host 对应的地址，host 没有指定协议时根据 useHTTPS 添加，末尾的 / 会被去掉
+func URL(host string, useHTTPS bool) string {
+	host = strings.TrimRight(host, "/")
+	if strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://") {
+		return host
+	}
+	if useHTTPS {
+		return "https://" + host
+	}
+	return "http://" + host
+}
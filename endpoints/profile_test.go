@@ -0,0 +1,112 @@
+package endpoints
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testEndpoints = `
+[default]
+uc_hosts = https://uc.qbox.me
+
+[private]
+uc_hosts = https://uc.example.com, uc-backup.example.com
+rs_host = rs.example.com
+up_hosts = "up1.example.com,up2.example.com"
+use_https = true
+fusion_host = https://fusion.example.com
+rtc_host = rtc.example.com
+sms_host = sms.example.com
+qvs_host = qvs.example.com/v1
+linking_host = linking.example.com/v1
+`
+
+func writeEndpoints(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "endpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "endpoints")
+	if err = ioutil.WriteFile(path, []byte(testEndpoints), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeEndpoints(t)
+
+	p, err := LoadFile(path, "private")
+	if err != nil {
+		t.Fatalf("LoadFile() error: %v", err)
+	}
+	if len(p.UcHosts) != 2 || p.UcHosts[1] != "uc-backup.example.com" || p.RsHost != "rs.example.com" ||
+		len(p.UpHosts) != 2 || p.UpHosts[1] != "up2.example.com" || p.UseHTTPS == nil || !*p.UseHTTPS ||
+		p.FusionHost != "https://fusion.example.com" || p.RtcHost != "rtc.example.com" || p.SmsHost != "sms.example.com" ||
+		p.QvsHost != "qvs.example.com/v1" || p.LinkingHost != "linking.example.com/v1" {
+		t.Errorf("LoadFile() got %+v", p)
+	}
+
+	if _, err = LoadFile(path, "missing"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("want ErrProfileNotFound, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := writeEndpoints(t)
+	setenv(t, EnvEndpointsFile, path)
+	setenv(t, "QINIU_PROFILE", "private")
+	setenv(t, "QINIU_RS_HOST", "rs2.example.com")
+
+	p, err := Load("", "")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if p.Name != "private" || p.RsHost != "rs2.example.com" || p.RtcHost != "rtc.example.com" {
+		t.Errorf("Load() got %+v", p)
+	}
+
+	// 指定的文件不存在时返回错误
+	if _, err = Load(path+".missing", ""); err == nil {
+		t.Errorf("Load() should fail when the file does not exist")
+	}
+
+	setenv(t, "QINIU_USE_HTTPS", "yes")
+	if _, err = Load("", ""); err == nil {
+		t.Errorf("Load() should fail with invalid QINIU_USE_HTTPS")
+	}
+}
+
+func TestURL(t *testing.T) {
+	cases := []struct {
+		host     string
+		useHTTPS bool
+		want     string
+	}{
+		{"a.com", true, "https://a.com"},
+		{"a.com/", false, "http://a.com"},
+		{"http://a.com", true, "http://a.com"},
+		{"https://a.com/v1", false, "https://a.com/v1"},
+	}
+	for _, c := range cases {
+		if got := URL(c.host, c.useHTTPS); got != c.want {
+			t.Errorf("URL(%q, %v) = %q, want %q", c.host, c.useHTTPS, got, c.want)
+		}
+	}
+}
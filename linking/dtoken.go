@@ -25,7 +25,11 @@ func (manager *Manager) deviceToken(policy *DeviceAccessToken) (string, error) {
 		return "", err
 	}
 	encodedDeviceAccessToken := base64.URLEncoding.EncodeToString(putPolicy)
-	sign := manager.mac.Sign([]byte(encodedDeviceAccessToken))
+	mac, err := manager.mac.Retrieve()
+	if err != nil {
+		return "", err
+	}
+	sign := mac.Sign([]byte(encodedDeviceAccessToken))
 	token := sign + ":" + encodedDeviceAccessToken
 	return token, nil
 }
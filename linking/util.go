@@ -10,10 +10,10 @@ import (
 
 type transport struct {
 	http.RoundTripper
-	mac *auth.Credentials
+	mac auth.CredentialsProvider
 }
 
-func newTransport(mac *auth.Credentials, tr http.RoundTripper) *transport {
+func newTransport(mac auth.CredentialsProvider, tr http.RoundTripper) *transport {
 	if tr == nil {
 		tr = http.DefaultTransport
 	}
@@ -21,7 +21,11 @@ func newTransport(mac *auth.Credentials, tr http.RoundTripper) *transport {
 }
 
 func (t *transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
-	token, err := t.mac.SignRequestV2(req)
+	mac, err := t.mac.Retrieve()
+	if err != nil {
+		return
+	}
+	token, err := mac.SignRequestV2(req)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,189 @@
+// Package logging 定义了 SDK 使用的结构化日志接口
+//
+// SDK 不依赖任何日志库，Logger 接口可以很容易地适配 slog，zap，logrus 等日志库，比如 zap:
+//
+//	sugar := zapLogger.Sugar()
+//	logger := logging.LoggerFunc(func(ctx context.Context, level logging.Level, msg string, fields ...logging.Field) {
+//		switch level {
+//		case logging.LevelDebug:
+//			sugar.Debugw(msg, logging.KeyValues(fields)...)
+//		default:
+//			sugar.Infow(msg, logging.KeyValues(fields)...)
+//		}
+//	})
+//
+// Go 1.21 及以上版本可以使用 NewSlogLogger 适配 slog。
+// SDK 输出的请求地址和请求头默认会隐藏密钥签名，上传凭证和私有链接的 token，参考 RedactURL 和 RedactHeader。
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level 是日志级别，取值和 slog.Level 相同
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// Field 是日志的一个结构化字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String 返回一个字符串字段
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int 返回一个整数字段
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration 返回一个时长字段
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err 返回一个 key 为 error 的字段
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// Any 返回一个任意类型的字段
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// KeyValues 把字段转换为 key1, value1, key2, value2... 的形式，适用于 zap 的 SugaredLogger 等接口
+func KeyValues(fields []Field) []interface{} {
+	kvs := make([]interface{}, 0, len(fields)*2)
+	for _, f := range fields {
+		kvs = append(kvs, f.Key, f.Value)
+	}
+	return kvs
+}
+
+// Map 把字段转换为 map，适用于 logrus.Fields 等接口
+func Map(fields []Field) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		m[f.Key] = f.Value
+	}
+	return m
+}
+
+// Logger 是结构化日志接口，实现需要支持并发调用
+type Logger interface {
+	// Enabled 判断是否输出该级别的日志，SDK 用它避免构建不需要的日志内容
+	Enabled(ctx context.Context, level Level) bool
+
+	// Log 输出一条日志
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// LoggerFunc 把一个函数转换为 Logger，所有级别的日志都会输出
+type LoggerFunc func(ctx context.Context, level Level, msg string, fields ...Field)
+
+// Enabled 总是返回 true
+func (f LoggerFunc) Enabled(ctx context.Context, level Level) bool {
+	return true
+}
+
+// Log 调用 f 输出日志
+func (f LoggerFunc) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	f(ctx, level, msg, fields...)
+}
+
+type discard struct{}
+
+func (discard) Enabled(ctx context.Context, level Level) bool                     { return false }
+func (discard) Log(ctx context.Context, level Level, msg string, fields ...Field) {}
+
+// Discard 不输出任何日志
+var Discard Logger = discard{}
+
+// DefaultLogger 是没有单独设置 Logger 时 SDK 使用的 Logger，默认不输出日志
+var DefaultLogger = Discard
+
+// textLogger 以 key=value 的文本格式输出日志
+type textLogger struct {
+	lock  sync.Mutex
+	out   io.Writer
+	level Level
+}
+
+// NewTextLogger 返回一个以文本格式输出 level 及以上级别日志的 Logger，格式为:
+//
+//	2006-01-02T15:04:05.000Z07:00 DEBUG msg key1=value1 key2="value 2"
+func NewTextLogger(out io.Writer, level Level) Logger {
+	return &textLogger{out: out, level: level}
+}
+
+func (l *textLogger) Enabled(ctx context.Context, level Level) bool {
+	return level >= l.level
+}
+
+func (l *textLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(time.Now().Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteByte(' ')
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(formatValue(f.Value))
+	}
+	b.WriteByte('\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	io.WriteString(l.out, b.String())
+}
+
+func formatValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
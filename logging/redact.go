@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted 是隐藏后的内容
+const Redacted = "REDACTED"
+
+var (
+	// DisableRedaction 为 true 时日志中不隐藏敏感信息，只应该在调试时使用
+	DisableRedaction = false
+
+	// RedactedQueryParams 是 RedactURL 需要隐藏的查询参数，不区分大小写
+	// 包括私有空间下载链接和 CDN 时间戳防盗链的签名，上传凭证等
+	RedactedQueryParams = []string{"token", "sign", "upToken", "uploadToken", "access_token", "X-Amz-Signature", "Signature"}
+
+	// RedactedHeaders 是 RedactHeader 需要隐藏的请求头和回复头
+	RedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+)
+
+// RedactToken 隐藏七牛的管理凭证，上传凭证和下载凭证中 AccessKey 之后的部分
+// 比如 "Qiniu ak:sign" 变为 "Qiniu ak:REDACTED"，"ak:sign:policy" 变为 "ak:REDACTED"
+func RedactToken(token string) string {
+	if DisableRedaction || token == "" {
+		return token
+	}
+	scheme := ""
+	if i := strings.IndexByte(token, ' '); i >= 0 {
+		scheme, token = token[:i+1], token[i+1:]
+	}
+	if i := strings.IndexByte(token, ':'); i > 0 {
+		return scheme + token[:i+1] + Redacted
+	}
+	return scheme + Redacted
+}
+
+// RedactURL 隐藏链接中的密码和 RedactedQueryParams 中的查询参数，其他部分保持不变
+func RedactURL(rawURL string) string {
+	if DisableRedaction {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redactQuery(u.RawQuery)
+	}
+	return u.String()
+}
+
+// RedactForm 隐藏 application/x-www-form-urlencoded 请求体中 RedactedQueryParams 的值
+func RedactForm(body string) string {
+	if DisableRedaction {
+		return body
+	}
+	return redactQuery(body)
+}
+
+// RedactMultipart 隐藏 multipart/form-data 请求体中名称属于 RedactedQueryParams 的字段的值，比如表单上传的 token 字段
+// 文件内容和其他字段保持不变
+func RedactMultipart(body []byte, boundary string) []byte {
+	if DisableRedaction || boundary == "" {
+		return body
+	}
+	delimiter := []byte("--" + boundary)
+	parts := bytes.Split(body, delimiter)
+	for i, part := range parts {
+		idx := bytes.Index(part, []byte("\r\n\r\n"))
+		if idx < 0 {
+			continue
+		}
+		header, value := part[:idx], part[idx+4:]
+		if !isRedactedFormField(string(header)) {
+			continue
+		}
+		end := bytes.LastIndex(value, []byte("\r\n"))
+		if end < 0 {
+			end = len(value)
+		}
+		redacted := append([]byte(nil), part[:idx+4]...)
+		redacted = append(redacted, RedactToken(string(value[:end]))...)
+		parts[i] = append(redacted, value[end:]...)
+	}
+	return bytes.Join(parts, delimiter)
+}
+
+// isRedactedFormField 判断 multipart 字段的头部是否是需要隐藏的非文件字段
+func isRedactedFormField(header string) bool {
+	for _, line := range strings.Split(header, "\r\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "Content-Disposition") {
+			continue
+		}
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return false
+		}
+		if _, ok := params["filename"]; ok {
+			return false
+		}
+		return isRedactedQueryParam(params["name"])
+	}
+	return false
+}
+
+func redactQuery(rawQuery string) string {
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || !isRedactedQueryParam(kv[0]) {
+			continue
+		}
+		value, uErr := url.QueryUnescape(kv[1])
+		if uErr != nil {
+			value = kv[1]
+		}
+		pairs[i] = kv[0] + "=" + url.QueryEscape(RedactToken(value))
+	}
+	return strings.Join(pairs, "&")
+}
+
+func isRedactedQueryParam(key string) bool {
+	if k, err := url.QueryUnescape(key); err == nil {
+		key = k
+	}
+	for _, param := range RedactedQueryParams {
+		if strings.EqualFold(key, param) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeader 返回隐藏了 RedactedHeaders 的头部的副本
+func RedactHeader(header http.Header) http.Header {
+	h := make(http.Header, len(header))
+	for k, v := range header {
+		h[k] = append([]string(nil), v...)
+	}
+	if DisableRedaction {
+		return h
+	}
+	for _, name := range RedactedHeaders {
+		values := h[http.CanonicalHeaderKey(name)]
+		for i, v := range values {
+			values[i] = RedactToken(v)
+		}
+	}
+	return h
+}
@@ -0,0 +1,33 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger 返回一个使用 slog 输出日志的 Logger，logger 为 nil 时使用 slog.Default()
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return slogLogger{logger: logger}
+}
+
+func (l slogLogger) Enabled(ctx context.Context, level Level) bool {
+	return l.logger.Enabled(ctx, slog.Level(level))
+}
+
+func (l slogLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+	l.logger.LogAttrs(ctx, slog.Level(level), msg, attrs...)
+}
@@ -0,0 +1,24 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var b bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(&b, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	if logger.Enabled(context.Background(), LevelDebug) || !logger.Enabled(context.Background(), LevelWarn) {
+		t.Errorf("levels should map to slog levels")
+	}
+	logger.Log(context.Background(), LevelWarn, "http request", String("method", "GET"), Int("status", 200))
+	if got := b.String(); !strings.Contains(got, "level=WARN msg=\"http request\" method=GET status=200") {
+		t.Errorf("unexpected output: %s", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/qiniu/api.v7/v7/auth"
 	"github.com/qiniu/api.v7/v7/client"
@@ -12,16 +13,40 @@ import (
 // Manager 代表一个 qvs 用户的客户端
 type Manager struct {
 	client *client.Client
-	mac    *auth.Credentials
+	mac    auth.CredentialsProvider
+	host   string
 }
 
 // New 初始化 Client.
 func NewManager(mac *auth.Credentials, tr http.RoundTripper) *Manager {
-	client := client.DefaultClient
-	client.Transport = newTransport(mac, nil)
+	return NewManagerWithProvider(mac, tr)
+}
+
+// NewManagerWithProvider 初始化一个使用 provider 获取密钥的 Client.
+// 每个请求都会通过 provider 获取密钥，因此更换密钥不需要重新构建 Manager
+func NewManagerWithProvider(provider auth.CredentialsProvider, tr http.RoundTripper) *Manager {
+	return NewManagerEx(provider, tr, nil)
+}
+
+// NewManagerEx 初始化一个使用 clt 发送请求的 Client，clt 为 nil 时使用 client.DefaultClient
+// 请求会经过 clt 的重试策略和中间件，tr 为 nil 时使用 clt 的 Transport，Manager 会复制 clt，不会修改它
+func NewManagerEx(provider auth.CredentialsProvider, tr http.RoundTripper, clt *client.Client) *Manager {
+	if clt == nil {
+		clt = &client.DefaultClient
+	}
+	c := *clt
+	hc := http.Client{}
+	if c.Client != nil {
+		hc = *c.Client
+	}
+	if tr == nil {
+		tr = hc.Transport
+	}
+	hc.Transport = newTransport(provider, tr)
+	c.Client = &hc
 	return &Manager{
-		client: &client,
-		mac:    mac,
+		client: &c,
+		mac:    provider,
 	}
 }
 
@@ -29,6 +54,19 @@ func setQuery(q url.Values, key string, v interface{}) {
 	q.Set(key, fmt.Sprint(v))
 }
 
+// SetHost 设置这个 Manager 使用的 API 服务器地址，比如私有云的地址，为空时使用 APIHost
+// 地址没有指定协议时使用 APIHTTPScheme，需要在发送请求之前设置，参考 endpoints.Profile
+func (manager *Manager) SetHost(host string) {
+	manager.host = host
+}
+
 func (manager *Manager) url(format string, args ...interface{}) string {
-	return APIHTTPScheme + APIHost + fmt.Sprintf(format, args...)
+	host := manager.host
+	if host == "" {
+		host = APIHost
+	}
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = APIHTTPScheme + host
+	}
+	return strings.TrimRight(host, "/") + fmt.Sprintf(format, args...)
 }
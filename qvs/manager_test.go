@@ -1,10 +1,14 @@
 package qvs
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"runtime/debug"
+	"strings"
 	"testing"
 
 	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
 )
 
 var (
@@ -35,3 +39,45 @@ func shouldBeEqual(t *testing.T, a interface{}, b interface{}) {
 		t.Fatalf("should be equal, expect = %#v, but got  = %#v", a, b)
 	}
 }
+
+func TestNewManagerExMiddlewares(t *testing.T) {
+	var auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auths = append(auths, req.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"ns"}`))
+	}))
+	defer srv.Close()
+
+	transport := client.DefaultClient.Transport
+	clt := client.Client{Client: &http.Client{}}
+	clt.Use(client.RewriteHost(map[string]string{"qvs.qiniuapi.com": strings.TrimPrefix(srv.URL, "http://")}))
+	manager := NewManagerEx(auth.New("ak", "sk"), nil, &clt)
+
+	_, err := manager.QueryNamespace("ns")
+	noError(t, err)
+	if len(auths) != 1 || !strings.HasPrefix(auths[0], "Qiniu ak:") {
+		t.Fatalf("request not signed: %v", auths)
+	}
+	if client.DefaultClient.Transport != transport || clt.Transport != nil {
+		t.Errorf("NewManagerEx should not modify the given client")
+	}
+}
+
+func TestSetHost(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"ns"}`))
+	}))
+	defer srv.Close()
+
+	manager := NewManagerEx(auth.New("ak", "sk"), nil, &client.Client{Client: &http.Client{}})
+	manager.SetHost(strings.TrimPrefix(srv.URL, "http://") + "/v1/")
+	_, err := manager.QueryNamespace("ns")
+	noError(t, err)
+	if len(paths) != 1 || paths[0] != "/v1/namespaces/ns" {
+		t.Errorf("paths = %v", paths)
+	}
+}
@@ -6,11 +6,11 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"strings"
 	"time"
 
 	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
 )
 
 var (
@@ -20,8 +20,9 @@ var (
 
 // Manager 提供了 Qiniu RTC Server API 相关功能
 type Manager struct {
-	mac        *auth.Credentials
-	httpClient *http.Client
+	mac    auth.CredentialsProvider
+	client *client.Client
+	host   string
 }
 
 // MergePublishRtmp  连麦合流转推 RTMP 的配置
@@ -94,38 +95,58 @@ type User struct {
 
 // NewManager 用来构建一个新的 Manager
 func NewManager(mac *auth.Credentials) *Manager {
-	httpClient := http.DefaultClient
-	return &Manager{mac: mac, httpClient: httpClient}
+	return NewManagerEx(mac, nil)
+}
+
+// NewManagerWithProvider 用来构建一个使用 provider 获取密钥的 Manager
+// 每个请求都会通过 provider 获取密钥，因此更换密钥不需要重新构建 Manager
+func NewManagerWithProvider(provider auth.CredentialsProvider) *Manager {
+	return NewManagerEx(provider, nil)
+}
+
+// NewManagerEx 用来构建一个使用指定 client.Client 发送请求的 Manager，clt 为 nil 时使用 client.DefaultClient
+// 请求会经过 clt 的重试策略和中间件
+func NewManagerEx(provider auth.CredentialsProvider, clt *client.Client) *Manager {
+	if clt == nil {
+		clt = &client.DefaultClient
+	}
+	return &Manager{mac: provider, client: clt}
+}
+
+// SetHost 设置这个 Manager 使用的服务地址，比如私有云的地址，为空时使用 RtcHost
+// 地址没有指定协议时使用 https，需要在发送请求之前设置，参考 endpoints.Profile
+func (r *Manager) SetHost(host string) {
+	r.host = host
 }
 
 // CreateApp 新建实时音视频云
 func (r *Manager) CreateApp(appReq AppInitConf) (App, error) {
-	url := buildURL("/v3/apps")
+	url := r.buildURL("/v3/apps")
 	ret := App{}
-	info := postReq(r.httpClient, r.mac, url, &appReq, &ret)
+	info := postReq(r.client, r.mac, url, &appReq, &ret)
 	return ret, info.Err
 }
 
 // GetApp 根据 appID 获取 实时音视频云 信息
 func (r *Manager) GetApp(appID string) (App, error) {
-	url := buildURL("/v3/apps/" + appID)
+	url := r.buildURL("/v3/apps/" + appID)
 	ret := App{}
-	info := getReq(r.httpClient, r.mac, url, &ret)
+	info := getReq(r.client, r.mac, url, &ret)
 	return ret, info.Err
 }
 
 // DeleteApp 根据 appID 删除 实时音视频云
 func (r *Manager) DeleteApp(appID string) error {
-	url := buildURL("/v3/apps/" + appID)
-	info := delReq(r.httpClient, r.mac, url, nil)
+	url := r.buildURL("/v3/apps/" + appID)
+	info := delReq(r.client, r.mac, url, nil)
 	return info.Err
 }
 
 // UpdateApp 根据 appID, App 更改实时音视频云 信息
 func (r *Manager) UpdateApp(appID string, appInfo AppUpdateInfo) (App, error) {
-	url := buildURL("/v3/apps/" + appID)
+	url := r.buildURL("/v3/apps/" + appID)
 	ret := App{}
-	info := postReq(r.httpClient, r.mac, url, &appInfo, &ret)
+	info := postReq(r.client, r.mac, url, &appInfo, &ret)
 	return ret, info.Err
 }
 
@@ -133,11 +154,11 @@ func (r *Manager) UpdateApp(appID string, appInfo AppUpdateInfo) (App, error) {
 // appID: 连麦房间所属的 app 。
 // roomName: 操作所查询的连麦房间。
 func (r *Manager) ListUser(appID, roomName string) ([]User, error) {
-	url := buildURL("/v3/apps/" + appID + "/rooms/" + roomName + "/users")
+	url := r.buildURL("/v3/apps/" + appID + "/rooms/" + roomName + "/users")
 	users := struct {
 		Users []User `json:"users"`
 	}{}
-	info := getReq(r.httpClient, r.mac, url, &users)
+	info := getReq(r.client, r.mac, url, &users)
 	return users.Users, info.Err
 }
 
@@ -146,8 +167,8 @@ func (r *Manager) ListUser(appID, roomName string) ([]User, error) {
 // roomName: 连麦房间。
 // userID: 操作所剔除的用户。
 func (r *Manager) KickUser(appID, roomName, userID string) error {
-	url := buildURL("/v3/apps/" + appID + "/rooms/" + roomName + "/users/" + userID)
-	info := delReq(r.httpClient, r.mac, url, nil)
+	url := r.buildURL("/v3/apps/" + appID + "/rooms/" + roomName + "/users/" + userID)
+	info := delReq(r.client, r.mac, url, nil)
 	return info.Err
 }
 
@@ -207,9 +228,9 @@ func (r *Manager) doListActiveRoom(appID, roomNamePrefix string, offset, limit i
 		query = "prefix=" + roomNamePrefix + "&"
 	}
 	query += fmt.Sprintf("offset=%v&limit=%v", offset, limit)
-	url := buildURL("/v3/apps/" + appID + "/rooms?" + query)
+	url := r.buildURL("/v3/apps/" + appID + "/rooms?" + query)
 	ret := RoomQuery{}
-	info := getReq(r.httpClient, r.mac, url, &ret)
+	info := getReq(r.client, r.mac, url, &ret)
 	return ret, *info, info.Err
 }
 
@@ -236,11 +257,15 @@ func (r *Manager) GetRoomToken(roomAccess RoomAccess) (token string, err error)
 	buf := make([]byte, base64.URLEncoding.EncodedLen(len(roomAccessByte)))
 	base64.URLEncoding.Encode(buf, roomAccessByte)
 
-	hmacsha1 := hmac.New(sha1.New, r.mac.SecretKey)
+	mac, err := r.mac.Retrieve()
+	if err != nil {
+		return
+	}
+	hmacsha1 := hmac.New(sha1.New, mac.SecretKey)
 	hmacsha1.Write(buf)
 	sign := hmacsha1.Sum(nil)
 
 	encodedSign := base64.URLEncoding.EncodeToString(sign)
-	token = r.mac.AccessKey + ":" + encodedSign + ":" + string(buf)
+	token = mac.AccessKey + ":" + encodedSign + ":" + string(buf)
 	return
 }
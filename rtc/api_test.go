@@ -11,19 +11,33 @@ import (
 	"time"
 
 	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/client/httpreplay"
 )
 
-var manager *Manager
+var (
+	accessKey = os.Getenv("accessKey")
+	secretKey = os.Getenv("secretKey")
+)
 
-func init() {
-	accessKey := os.Getenv("accessKey")
-	secretKey := os.Getenv("secretKey")
+var manager *Manager
 
-	mac := auth.New(accessKey, secretKey)
-	manager = NewManager(mac)
+// newReplayClient 返回从 testdata/<name>.json 回放请求的 http.Client，
+// testdata 中的 golden 文件是按照接口文档构造的示例数据，不是真实服务的录制，
+// 设置 QINIU_HTTP_REPLAY=record 以及 accessKey 和 secretKey 环境变量可以录制真实的回复替换它们
+func newReplayClient(t *testing.T, name string) *http.Client {
+	rt := httpreplay.NewForTest(t, name, accessKey, secretKey)
+	return rt.Client().Client
 }
 
 func TestApp(t *testing.T) {
+	mac := auth.New("ak", "sk")
+	if accessKey != "" && secretKey != "" {
+		mac = auth.New(accessKey, secretKey)
+	}
+	clt := newReplayClient(t, "app")
+	manager = NewManagerEx(mac, &client.Client{Client: clt})
+
 	app := checkCreateApp(t)
 	checkGetApp(t, app.AppID)
 	rooms := checkAllActiveRooms(t, app.AppID)
@@ -38,7 +52,7 @@ func TestApp(t *testing.T) {
 	}
 	checkKickUser(t, app.AppID, room, userID)
 	checkUpdate(t, app.AppID)
-	checkRoomToken(t, app.AppID)
+	checkRoomToken(t, clt, app.AppID)
 	checkDel(t, app.AppID)
 }
 
@@ -134,13 +148,13 @@ func checkKickUser(t *testing.T, appID, roomName, userID string) {
 	}
 }
 
-func checkRoomToken(t *testing.T, appID string) {
+func checkRoomToken(t *testing.T, clt *http.Client, appID string) {
 	roomName := "sdhfuexx"
 	userID := "ghjkdfie"
 	token, err := manager.GetRoomToken(RoomAccess{AppID: appID, RoomName: roomName, UserID: userID, ExpireAt: time.Now().Unix() + 3600})
 	url := fmt.Sprintf("https://rtc.qiniuapi.com/v3/apps/%v/rooms/%v/auth?user=%v&token=%v", appID, roomName, userID, token)
 	req, err := http.NewRequest("GET", url, strings.NewReader(""))
-	res, err := http.DefaultClient.Do(req)
+	res, err := clt.Do(req)
 	if err != nil {
 		t.Error(err)
 	}
@@ -0,0 +1,354 @@
+package rtc
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+// 回调事件类型
+const (
+	EventRoomCreated      = "room-created"
+	EventRoomClosed       = "room-closed"
+	EventUserJoined       = "user-joined"
+	EventUserLeft         = "user-left"
+	EventTrackPublished   = "track-published"
+	EventTrackUnpublished = "track-unpublished"
+	EventMergeJobState    = "merge-job-state"
+)
+
+// 合流任务的状态
+const (
+	MergeJobStarted = "started"
+	MergeJobStopped = "stopped"
+	MergeJobFailed  = "failed"
+)
+
+// ErrInvalidCallbackSignature 表示回调请求的签名不正确
+var ErrInvalidCallbackSignature = errors.New("invalid callback signature")
+
+// MaxCallbackBodySize 回调请求内容的最大长度，超过时验证失败
+var MaxCallbackBodySize int64 = 1 << 20
+
+// CallbackEvent 回调事件的公共字段
+// ID: 事件 ID，同一个事件重试回调时 ID 不变。
+// Type: 事件类型，参考 EventRoomCreated 等。
+// AppID: 房间所属的 app 。
+// RoomName: 房间名称。
+// Timestamp: 事件发生的时间，以秒为单位的 Unix 时间。
+type CallbackEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	AppID     string `json:"appId"`
+	RoomName  string `json:"roomName"`
+	Timestamp int64  `json:"timestamp"`
+
+	// 回调的原始内容，可以通过 Decode 解析事件类型相关的字段
+	Raw json.RawMessage `json:"-"`
+}
+
+// Decode 把回调的原始内容解析到 v
+func (e *CallbackEvent) Decode(v interface{}) error {
+	return json.Unmarshal(e.Raw, v)
+}
+
+// RoomEvent 房间创建和关闭事件
+type RoomEvent struct {
+	CallbackEvent
+}
+
+// UserEvent 用户加入和离开房间事件
+// UserID: 用户 ID。
+// Reason: 用户离开房间的原因，可选，比如 "kicked" 或 "timeout"。
+type UserEvent struct {
+	CallbackEvent
+	UserID string `json:"userId"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// TrackEvent 用户发布和取消发布 track 事件
+// UserID: 发布 track 的用户 ID。
+// TrackID: track ID。
+// Kind: track 类型，"audio" 或 "video"。
+// Tag: 发布 track 时设置的标签，可选。
+type TrackEvent struct {
+	CallbackEvent
+	UserID  string `json:"userId"`
+	TrackID string `json:"trackId"`
+	Kind    string `json:"kind"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+// MergeJobEvent 合流任务状态变化事件
+// JobID: 合流任务 ID。
+// State: 合流任务的状态，参考 MergeJobStarted 等。
+// Error: 合流任务失败的原因，可选。
+type MergeJobEvent struct {
+	CallbackEvent
+	JobID string `json:"jobId"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// VerifyCallback 验证回调请求是否来自七牛，回调请求使用 app 所属帐号的密钥签名，
+// 签名方式和 TokenQiniu 类型的管理凭证相同，包括请求内容；
+// 请求内容的长度不能超过 MaxCallbackBodySize
+func VerifyCallback(provider auth.CredentialsProvider, req *http.Request) (bool, error) {
+	authorization := req.Header.Get("Authorization")
+	if authorization == "" {
+		return false, nil
+	}
+	if req.Body != nil {
+		req.Body = http.MaxBytesReader(nil, req.Body, MaxCallbackBodySize)
+	}
+	mac, err := provider.Retrieve()
+	if err != nil {
+		return false, err
+	}
+	token, err := mac.SignRequestV2(req)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal([]byte(authorization), []byte("Qiniu "+token)), nil
+}
+
+// CallbackHandler 是接收回调事件的 http.Handler，验证签名后把事件分发给对应类型的回调函数
+//
+// 回调函数返回错误时响应 500，七牛会重试回调；同一个 ID 的事件在 DedupWindow 时间内只会成功处理一次，
+// 重复的事件直接响应 200；没有注册回调函数的事件类型也直接响应 200
+type CallbackHandler struct {
+	// 验证回调签名使用的密钥
+	Credentials auth.CredentialsProvider
+
+	// 记录已经处理的事件 ID 的时间，默认 10 分钟
+	DedupWindow time.Duration
+
+	lock      sync.Mutex
+	handlers  map[string]func(ctx context.Context, e *CallbackEvent) error
+	processed map[string]time.Time
+	pending   map[string]bool
+}
+
+// NewCallbackHandler 用来构建一个接收回调事件的 http.Handler
+func NewCallbackHandler(provider auth.CredentialsProvider) *CallbackHandler {
+	return &CallbackHandler{Credentials: provider}
+}
+
+// Handle 注册事件类型 eventType 的回调函数，替换之前注册的回调函数
+func (h *CallbackHandler) Handle(eventType string, fn func(ctx context.Context, e *CallbackEvent) error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.handlers == nil {
+		h.handlers = make(map[string]func(ctx context.Context, e *CallbackEvent) error)
+	}
+	h.handlers[eventType] = fn
+}
+
+// OnRoomCreated 注册房间创建事件的回调函数
+func (h *CallbackHandler) OnRoomCreated(fn func(ctx context.Context, e *RoomEvent) error) {
+	h.handleRoom(EventRoomCreated, fn)
+}
+
+// OnRoomClosed 注册房间关闭事件的回调函数
+func (h *CallbackHandler) OnRoomClosed(fn func(ctx context.Context, e *RoomEvent) error) {
+	h.handleRoom(EventRoomClosed, fn)
+}
+
+// OnUserJoined 注册用户加入房间事件的回调函数
+func (h *CallbackHandler) OnUserJoined(fn func(ctx context.Context, e *UserEvent) error) {
+	h.handleUser(EventUserJoined, fn)
+}
+
+// OnUserLeft 注册用户离开房间事件的回调函数
+func (h *CallbackHandler) OnUserLeft(fn func(ctx context.Context, e *UserEvent) error) {
+	h.handleUser(EventUserLeft, fn)
+}
+
+// OnTrackPublished 注册发布 track 事件的回调函数
+func (h *CallbackHandler) OnTrackPublished(fn func(ctx context.Context, e *TrackEvent) error) {
+	h.handleTrack(EventTrackPublished, fn)
+}
+
+// OnTrackUnpublished 注册取消发布 track 事件的回调函数
+func (h *CallbackHandler) OnTrackUnpublished(fn func(ctx context.Context, e *TrackEvent) error) {
+	h.handleTrack(EventTrackUnpublished, fn)
+}
+
+// OnMergeJobState 注册合流任务状态变化事件的回调函数
+func (h *CallbackHandler) OnMergeJobState(fn func(ctx context.Context, e *MergeJobEvent) error) {
+	h.Handle(EventMergeJobState, func(ctx context.Context, e *CallbackEvent) error {
+		event := MergeJobEvent{CallbackEvent: *e}
+		if err := e.Decode(&event); err != nil {
+			return err
+		}
+		return fn(ctx, &event)
+	})
+}
+
+func (h *CallbackHandler) handleRoom(eventType string, fn func(ctx context.Context, e *RoomEvent) error) {
+	h.Handle(eventType, func(ctx context.Context, e *CallbackEvent) error {
+		return fn(ctx, &RoomEvent{CallbackEvent: *e})
+	})
+}
+
+func (h *CallbackHandler) handleUser(eventType string, fn func(ctx context.Context, e *UserEvent) error) {
+	h.Handle(eventType, func(ctx context.Context, e *CallbackEvent) error {
+		event := UserEvent{CallbackEvent: *e}
+		if err := e.Decode(&event); err != nil {
+			return err
+		}
+		return fn(ctx, &event)
+	})
+}
+
+func (h *CallbackHandler) handleTrack(eventType string, fn func(ctx context.Context, e *TrackEvent) error) {
+	h.Handle(eventType, func(ctx context.Context, e *CallbackEvent) error {
+		event := TrackEvent{CallbackEvent: *e}
+		if err := e.Decode(&event); err != nil {
+			return err
+		}
+		return fn(ctx, &event)
+	})
+}
+
+// callbackError 是处理回调失败的原因
+type callbackError struct {
+	code int
+	msg  string
+}
+
+func (e *callbackError) Error() string {
+	return e.msg
+}
+
+func newCallbackError(code int, msg string) error {
+	return &callbackError{code: code, msg: msg}
+}
+
+// ServeHTTP 处理回调请求
+func (h *CallbackHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	err := h.serve(req)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		code := http.StatusInternalServerError
+		if e, ok := err.(*callbackError); ok {
+			code = e.code
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+func (h *CallbackHandler) serve(req *http.Request) error {
+	if req.Method != http.MethodPost {
+		return newCallbackError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	if h.Credentials == nil {
+		return errors.New("no credentials")
+	}
+	ok, err := VerifyCallback(h.Credentials, req)
+	if err != nil {
+		return newCallbackError(http.StatusBadRequest, err.Error())
+	}
+	if !ok {
+		return newCallbackError(http.StatusUnauthorized, ErrInvalidCallbackSignature.Error())
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return newCallbackError(http.StatusBadRequest, err.Error())
+	}
+	event := CallbackEvent{}
+	if err = json.Unmarshal(body, &event); err != nil || event.Type == "" {
+		return newCallbackError(http.StatusBadRequest, "invalid callback event")
+	}
+	event.Raw = body
+
+	h.lock.Lock()
+	fn := h.handlers[event.Type]
+	h.lock.Unlock()
+	if fn == nil {
+		return nil
+	}
+	if event.ID == "" {
+		return fn(req.Context(), &event)
+	}
+
+	switch h.begin(event.ID) {
+	case eventProcessed:
+		return nil
+	case eventPending:
+		return newCallbackError(http.StatusConflict, "event is being processed: "+event.ID)
+	}
+	// 回调函数 panic 时也要清除正在处理的标记，否则重试的事件一直返回 409
+	done := false
+	defer func() { h.finish(event.ID, done) }()
+	err = fn(req.Context(), &event)
+	done = err == nil
+	return err
+}
+
+const (
+	eventNew = iota
+	eventPending
+	eventProcessed
+)
+
+// begin 检查事件是否已经处理或者正在处理，都不是时标记为正在处理
+func (h *CallbackHandler) begin(id string) int {
+	window := h.DedupWindow
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	now := time.Now()
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if at, ok := h.processed[id]; ok {
+		if now.Sub(at) < window {
+			return eventProcessed
+		}
+		delete(h.processed, id)
+	}
+	if h.pending[id] {
+		return eventPending
+	}
+	if len(h.processed) >= 1024 {
+		for k, at := range h.processed {
+			if now.Sub(at) >= window {
+				delete(h.processed, k)
+			}
+		}
+	}
+	if h.pending == nil {
+		h.pending = make(map[string]bool)
+	}
+	h.pending[id] = true
+	return eventNew
+}
+
+// finish 结束事件的处理，成功时记录事件 ID，失败时允许重试
+func (h *CallbackHandler) finish(id string, ok bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	delete(h.pending, id)
+	if !ok {
+		return
+	}
+	if h.processed == nil {
+		h.processed = make(map[string]time.Time)
+	}
+	h.processed[id] = time.Now()
+}
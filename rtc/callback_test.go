@@ -0,0 +1,156 @@
+package rtc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+func TestCallbackHandler(t *testing.T) {
+	cred := auth.New("ak", "sk")
+	h := NewCallbackHandler(cred)
+
+	var joined []*UserEvent
+	var tracks []*TrackEvent
+	var jobs []*MergeJobEvent
+	var closed []*RoomEvent
+	failures := 1
+	h.OnUserJoined(func(ctx context.Context, e *UserEvent) error {
+		joined = append(joined, e)
+		return nil
+	})
+	h.OnTrackPublished(func(ctx context.Context, e *TrackEvent) error {
+		tracks = append(tracks, e)
+		return nil
+	})
+	h.OnMergeJobState(func(ctx context.Context, e *MergeJobEvent) error {
+		jobs = append(jobs, e)
+		return nil
+	})
+	h.OnRoomClosed(func(ctx context.Context, e *RoomEvent) error {
+		if failures > 0 {
+			failures--
+			return errors.New("database unavailable")
+		}
+		closed = append(closed, e)
+		return nil
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	post := func(cred *auth.Credentials, body string) int {
+		req, _ := http.NewRequest("POST", srv.URL+"/rtc/callback", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if cred != nil {
+			cred.AddToken(auth.TokenQiniu, req)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	userJoined := `{"id":"e1","type":"user-joined","appId":"app","roomName":"room","timestamp":1593590400,"userId":"alice"}`
+	for i := 0; i < 2; i++ {
+		if code := post(cred, userJoined); code != http.StatusOK {
+			t.Errorf("user-joined: %d", code)
+		}
+	}
+	if len(joined) != 1 || joined[0].UserID != "alice" || joined[0].RoomName != "room" || joined[0].Timestamp != 1593590400 {
+		t.Errorf("user-joined events: %+v", joined)
+	}
+
+	post(cred, `{"id":"e2","type":"track-published","roomName":"room","userId":"alice","trackId":"t1","kind":"video","tag":"camera"}`)
+	if len(tracks) != 1 || tracks[0].TrackID != "t1" || tracks[0].Kind != "video" || tracks[0].Tag != "camera" {
+		t.Errorf("track-published events: %+v", tracks)
+	}
+	post(cred, `{"id":"e3","type":"merge-job-state","roomName":"room","jobId":"job1","state":"failed","error":"publish failed"}`)
+	if len(jobs) != 1 || jobs[0].JobID != "job1" || jobs[0].State != MergeJobFailed || jobs[0].Error != "publish failed" {
+		t.Errorf("merge-job-state events: %+v", jobs)
+	}
+
+	// 处理失败的事件可以重试
+	roomClosed := `{"id":"e4","type":"room-closed","roomName":"room"}`
+	if code := post(cred, roomClosed); code != http.StatusInternalServerError {
+		t.Errorf("room-closed first try: %d", code)
+	}
+	if code := post(cred, roomClosed); code != http.StatusOK || len(closed) != 1 || closed[0].ID != "e4" {
+		t.Errorf("room-closed retry: %d %+v", code, closed)
+	}
+
+	if code := post(cred, `{"id":"e5","type":"room-created","roomName":"room"}`); code != http.StatusOK {
+		t.Errorf("event without handler: %d", code)
+	}
+	if code := post(auth.New("ak", "sk2"), userJoined); code != http.StatusUnauthorized {
+		t.Errorf("wrong signature: %d", code)
+	}
+	if code := post(nil, userJoined); code != http.StatusUnauthorized {
+		t.Errorf("no signature: %d", code)
+	}
+	if code := post(cred, `{"id":"e6"}`); code != http.StatusBadRequest {
+		t.Errorf("event without type: %d", code)
+	}
+	if len(joined) != 1 {
+		t.Errorf("rejected events should not be dispatched: %+v", joined)
+	}
+}
+
+func TestCallbackHandlerPending(t *testing.T) {
+	h := NewCallbackHandler(auth.New("ak", "sk"))
+	if h.begin("e1") != eventNew || h.begin("e1") != eventPending {
+		t.Fatalf("event should be pending")
+	}
+	h.finish("e1", true)
+	if h.begin("e1") != eventProcessed {
+		t.Errorf("event should be processed")
+	}
+}
+
+func TestCallbackHandlerPanicAndLargeBody(t *testing.T) {
+	cred := auth.New("ak", "sk")
+	h := NewCallbackHandler(cred)
+	panics := 1
+	h.OnRoomClosed(func(ctx context.Context, e *RoomEvent) error {
+		if panics > 0 {
+			panics--
+			panic("handler bug")
+		}
+		return nil
+	})
+
+	serve := func(body string) (code int) {
+		req := httptest.NewRequest("POST", "http://example.com/rtc/callback", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		cred.AddToken(auth.TokenQiniu, req)
+		w := httptest.NewRecorder()
+		defer func() {
+			if recover() != nil {
+				code = -1
+			}
+		}()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 回调函数 panic 后事件不能一直处于正在处理的状态
+	roomClosed := `{"id":"e1","type":"room-closed","roomName":"room"}`
+	if code := serve(roomClosed); code != -1 {
+		t.Fatalf("handler should panic: %d", code)
+	}
+	if code := serve(roomClosed); code != http.StatusOK {
+		t.Errorf("retry after panic: %d", code)
+	}
+
+	defer func(size int64) { MaxCallbackBodySize = size }(MaxCallbackBodySize)
+	MaxCallbackBodySize = 32
+	if code := serve(`{"id":"e2","type":"room-closed","roomName":"a-long-room-name"}`); code != http.StatusBadRequest {
+		t.Errorf("large body: %d", code)
+	}
+}
@@ -0,0 +1,150 @@
+package rtc
+
+import (
+	"errors"
+)
+
+// 合流画面的拉伸模式
+// StretchAspectFill: 等比缩放并裁剪，填满整个区域。
+// StretchAspectFit: 等比缩放，完整显示画面，空白部分填充黑色。
+// StretchScaleToFit: 不保持比例，拉伸填满整个区域。
+const (
+	StretchAspectFill = "aspectFill"
+	StretchAspectFit  = "aspectFit"
+	StretchScaleToFit = "scaleToFit"
+)
+
+// ErrEmptyMergeJobID 表示没有指定合流任务 ID
+var ErrEmptyMergeJobID = errors.New("empty merge job id")
+
+// MergeImage 合流画面中的图片，用于水印和背景
+// URL: 图片地址。
+// X, Y: 图片左上角在合流画面中的坐标。
+// W, H: 图片的宽和高，为 0 时使用图片的原始大小。
+// StretchMode: 拉伸模式，可选，参考 StretchAspectFill 等。
+type MergeImage struct {
+	URL         string `json:"url"`
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	W           int    `json:"w,omitempty"`
+	H           int    `json:"h,omitempty"`
+	StretchMode string `json:"stretchMode,omitempty"`
+}
+
+// MergeJob 单个房间的合流任务配置
+// ID: 合流任务 ID，可选，为空时由服务端生成，同一个房间中不能重复。
+// Width, Height: 合流输出画面的宽和高。
+// OutputFps: 合流输出的帧率，可选，默认为 25 fps。
+// OutputKbps: 合流输出的码率，可选，默认为 1000。
+// PublishURL: 合流后转推的 RTMP 地址。
+// StretchMode: 默认的拉伸模式，可选，track 没有指定拉伸模式时使用。
+// Background: 背景图片，可选。
+// Watermarks: 水印图片，可选。
+// AudioOnly: 是否只合成音频，可选。
+type MergeJob struct {
+	ID          string       `json:"id,omitempty"`
+	Width       int          `json:"w"`
+	Height      int          `json:"h"`
+	OutputFps   int          `json:"fps,omitempty"`
+	OutputKbps  int          `json:"kbps,omitempty"`
+	PublishURL  string       `json:"publishUrl"`
+	StretchMode string       `json:"stretchMode,omitempty"`
+	Background  *MergeImage  `json:"background,omitempty"`
+	Watermarks  []MergeImage `json:"watermarks,omitempty"`
+	AudioOnly   bool         `json:"audioOnly,omitempty"`
+}
+
+// MergeTrack 参与合流的 track 和它在合流画面中的布局
+// TrackID: 房间中的 track ID。
+// X, Y: 画面左上角在合流画面中的坐标。
+// W, H: 画面的宽和高，音频 track 不需要。
+// Z: 画面的层级，层级大的画面覆盖层级小的画面。
+// StretchMode: 拉伸模式，可选，为空时使用合流任务的 StretchMode。
+type MergeTrack struct {
+	TrackID     string `json:"trackId"`
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	W           int    `json:"w"`
+	H           int    `json:"h"`
+	Z           int    `json:"z"`
+	StretchMode string `json:"stretchMode,omitempty"`
+}
+
+// MergeJobInfo 正在运行的合流任务
+type MergeJobInfo struct {
+	MergeJob
+	Tracks []MergeTrack `json:"tracks"`
+}
+
+type mergeTracksReq struct {
+	Add    []MergeTrack `json:"add,omitempty"`
+	Remove []mergeTrack `json:"remove,omitempty"`
+}
+
+type mergeTrack struct {
+	TrackID string `json:"trackId"`
+}
+
+func (r *Manager) roomURL(appID, roomName, path string) string {
+	return r.buildURL("/v3/apps/" + appID + "/rooms/" + roomName + "/" + path)
+}
+
+// CreateMergeJob 为房间创建合流任务，返回合流任务 ID
+// appID: 连麦房间所属的 app 。
+// roomName: 连麦房间。
+// job: 合流任务配置，创建后通过 AddMergeTracks 添加参与合流的 track。
+func (r *Manager) CreateMergeJob(appID, roomName string, job MergeJob) (jobID string, err error) {
+	if job.Width <= 0 || job.Height <= 0 || job.PublishURL == "" {
+		return "", errors.New("merge job needs width, height and publishUrl")
+	}
+	ret := struct {
+		ID string `json:"id"`
+	}{}
+	info := postReq(r.client, r.mac, r.roomURL(appID, roomName, "merge_job"), &job, &ret)
+	return ret.ID, info.Err
+}
+
+// AddMergeTracks 添加参与合流的 track，已经在合流中的 track 会按照新的布局更新
+func (r *Manager) AddMergeTracks(appID, roomName, jobID string, tracks []MergeTrack) error {
+	return r.updateMergeTracks(appID, roomName, jobID, mergeTracksReq{Add: tracks})
+}
+
+// UpdateMergeTracks 更新合流中 track 的布局，包括坐标，大小，层级和拉伸模式
+func (r *Manager) UpdateMergeTracks(appID, roomName, jobID string, tracks []MergeTrack) error {
+	return r.AddMergeTracks(appID, roomName, jobID, tracks)
+}
+
+// RemoveMergeTracks 把 track 从合流中移除
+func (r *Manager) RemoveMergeTracks(appID, roomName, jobID string, trackIDs ...string) error {
+	req := mergeTracksReq{}
+	for _, id := range trackIDs {
+		req.Remove = append(req.Remove, mergeTrack{TrackID: id})
+	}
+	return r.updateMergeTracks(appID, roomName, jobID, req)
+}
+
+func (r *Manager) updateMergeTracks(appID, roomName, jobID string, req mergeTracksReq) error {
+	if jobID == "" {
+		return ErrEmptyMergeJobID
+	}
+	info := postReq(r.client, r.mac, r.roomURL(appID, roomName, "merge_job_tracks/"+jobID), &req, nil)
+	return info.Err
+}
+
+// ListMergeJobs 获取房间中正在运行的合流任务
+func (r *Manager) ListMergeJobs(appID, roomName string) ([]MergeJobInfo, error) {
+	ret := struct {
+		Jobs []MergeJobInfo `json:"jobs"`
+	}{}
+	info := getReq(r.client, r.mac, r.roomURL(appID, roomName, "merge_jobs"), &ret)
+	return ret.Jobs, info.Err
+}
+
+// StopMergeJob 停止合流任务
+func (r *Manager) StopMergeJob(appID, roomName, jobID string) error {
+	if jobID == "" {
+		return ErrEmptyMergeJobID
+	}
+	info := delReq(r.client, r.mac, r.roomURL(appID, roomName, "merge_job/"+jobID), nil)
+	return info.Err
+}
@@ -0,0 +1,102 @@
+package rtc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+type mergeRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+func TestMergeJob(t *testing.T) {
+	var requests []mergeRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "Qiniu ak:") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		requests = append(requests, mergeRequest{req.Method, req.URL.Path, string(body)})
+		switch req.URL.Path {
+		case "/v3/apps/app/rooms/room/merge_job":
+			w.Write([]byte(`{"id":"job1"}`))
+		case "/v3/apps/app/rooms/room/merge_jobs":
+			w.Write([]byte(`{"jobs":[{"id":"job1","w":1280,"h":720,"publishUrl":"rtmp://a/b","tracks":[{"trackId":"t1","w":640,"h":360,"z":1}]}]}`))
+		case "/v3/apps/app/rooms/room/merge_job/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"job not found"}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	m := NewManager(auth.New("ak", "sk"))
+	m.SetHost(srv.URL)
+
+	if _, err := m.CreateMergeJob("app", "room", MergeJob{Width: 1280}); err == nil {
+		t.Errorf("CreateMergeJob() should fail without height and publishUrl")
+	}
+	jobID, err := m.CreateMergeJob("app", "room", MergeJob{
+		Width: 1280, Height: 720, OutputFps: 30, OutputKbps: 2000, PublishURL: "rtmp://a/b",
+		Background: &MergeImage{URL: "http://a/bg.png", W: 1280, H: 720},
+		Watermarks: []MergeImage{{URL: "http://a/logo.png", X: 10, Y: 10}},
+	})
+	if err != nil || jobID != "job1" {
+		t.Fatalf("CreateMergeJob() = %q, %v", jobID, err)
+	}
+	tracks := []MergeTrack{
+		{TrackID: "t1", W: 640, H: 360, Z: 1},
+		{TrackID: "t2", X: 640, W: 640, H: 360, Z: 2, StretchMode: StretchAspectFit},
+	}
+	if err = m.AddMergeTracks("app", "room", jobID, tracks); err != nil {
+		t.Fatalf("AddMergeTracks() error: %v", err)
+	}
+	if err = m.UpdateMergeTracks("app", "room", jobID, tracks[:1]); err != nil {
+		t.Fatalf("UpdateMergeTracks() error: %v", err)
+	}
+	if err = m.RemoveMergeTracks("app", "room", jobID, "t2"); err != nil {
+		t.Fatalf("RemoveMergeTracks() error: %v", err)
+	}
+	jobs, err := m.ListMergeJobs("app", "room")
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "job1" || jobs[0].Width != 1280 || jobs[0].Tracks[0].TrackID != "t1" {
+		t.Errorf("ListMergeJobs() = %+v, %v", jobs, err)
+	}
+	if err = m.StopMergeJob("app", "room", jobID); err != nil {
+		t.Fatalf("StopMergeJob() error: %v", err)
+	}
+	if err = m.StopMergeJob("app", "room", "missing"); err == nil {
+		t.Errorf("StopMergeJob() should fail for missing job")
+	}
+	if err = m.StopMergeJob("app", "room", ""); err != ErrEmptyMergeJobID {
+		t.Errorf("StopMergeJob() error = %v", err)
+	}
+
+	want := []mergeRequest{
+		{"POST", "/v3/apps/app/rooms/room/merge_job", `{"w":1280,"h":720,"fps":30,"kbps":2000,"publishUrl":"rtmp://a/b",` +
+			`"background":{"url":"http://a/bg.png","x":0,"y":0,"w":1280,"h":720},"watermarks":[{"url":"http://a/logo.png","x":10,"y":10}]}`},
+		{"POST", "/v3/apps/app/rooms/room/merge_job_tracks/job1", `{"add":[{"trackId":"t1","x":0,"y":0,"w":640,"h":360,"z":1},` +
+			`{"trackId":"t2","x":640,"y":0,"w":640,"h":360,"z":2,"stretchMode":"aspectFit"}]}`},
+		{"POST", "/v3/apps/app/rooms/room/merge_job_tracks/job1", `{"add":[{"trackId":"t1","x":0,"y":0,"w":640,"h":360,"z":1}]}`},
+		{"POST", "/v3/apps/app/rooms/room/merge_job_tracks/job1", `{"remove":[{"trackId":"t2"}]}`},
+		{"GET", "/v3/apps/app/rooms/room/merge_jobs", ""},
+		{"DELETE", "/v3/apps/app/rooms/room/merge_job/job1", ""},
+		{"DELETE", "/v3/apps/app/rooms/room/merge_job/missing", ""},
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("got requests %+v", requests)
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("request %d = %+v, want %+v", i, requests[i], want[i])
+		}
+	}
+}
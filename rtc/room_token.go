@@ -0,0 +1,232 @@
+package rtc
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 用户的房间管理权限
+const (
+	PermissionUser  = "user"
+	PermissionAdmin = "admin"
+)
+
+// 房间管理凭证的错误
+var (
+	ErrInvalidRoomToken   = errors.New("invalid room token")
+	ErrRoomTokenSignature = errors.New("room token signature mismatch")
+	ErrRoomTokenExpired   = errors.New("room token expired")
+	ErrInvalidRoomName    = errors.New("invalid room name, should match ^[a-zA-Z0-9_-]{3,64}$")
+	ErrInvalidUserID      = errors.New("invalid user id, should match ^[a-zA-Z0-9_-]{3,50}$")
+	ErrInvalidPermission  = errors.New(`invalid permission, should be "admin" or "user"`)
+)
+
+var (
+	roomNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,64}$`)
+	userIDRegexp   = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,50}$`)
+)
+
+// Validate 检查 RoomName，UserID 和 Permission 是否满足规格，不检查 ExpireAt
+func (a *RoomAccess) Validate() error {
+	if !roomNameRegexp.MatchString(a.RoomName) {
+		return ErrInvalidRoomName
+	}
+	if !userIDRegexp.MatchString(a.UserID) {
+		return ErrInvalidUserID
+	}
+	if a.Permission != "" && a.Permission != PermissionUser && a.Permission != PermissionAdmin {
+		return ErrInvalidPermission
+	}
+	return nil
+}
+
+// ParseRoomToken 解析 GetRoomToken 生成的房间管理鉴权，不验证签名和有效期，一般用于排查用户加入房间失败的问题
+// 房间管理鉴权的格式为 AccessKey:EncodedSign:EncodedRoomAccess
+func ParseRoomToken(token string) (accessKey string, access RoomAccess, err error) {
+	parts := strings.Split(token, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		err = ErrInvalidRoomToken
+		return
+	}
+	data, dErr := base64.URLEncoding.DecodeString(parts[2])
+	if dErr != nil {
+		err = ErrInvalidRoomToken
+		return
+	}
+	if dErr = json.Unmarshal(data, &access); dErr != nil {
+		err = ErrInvalidRoomToken
+		return
+	}
+	accessKey = parts[0]
+	return
+}
+
+// VerifyRoomToken 验证房间管理鉴权，检查 AccessKey 和签名是否和 Manager 的密钥一致，
+// 是否已经过期，以及 RoomName 和 UserID 是否满足规格，验证通过时返回房间管理凭证
+func (r *Manager) VerifyRoomToken(token string) (access RoomAccess, err error) {
+	accessKey, access, err := ParseRoomToken(token)
+	if err != nil {
+		return
+	}
+	mac, err := r.mac.Retrieve()
+	if err != nil {
+		return
+	}
+	parts := strings.Split(token, ":")
+	sign, dErr := base64.URLEncoding.DecodeString(parts[1])
+	hmacsha1 := hmac.New(sha1.New, mac.SecretKey)
+	hmacsha1.Write([]byte(parts[2]))
+	if accessKey != mac.AccessKey || dErr != nil || !hmac.Equal(sign, hmacsha1.Sum(nil)) {
+		err = ErrRoomTokenSignature
+		return
+	}
+	if access.ExpireAt <= time.Now().Unix() {
+		err = ErrRoomTokenExpired
+		return
+	}
+	err = access.Validate()
+	return
+}
+
+// RoomTokenResponse 是 RoomTokenHandler 的响应内容
+type RoomTokenResponse struct {
+	RoomToken  string `json:"roomToken"`
+	AppID      string `json:"appId"`
+	RoomName   string `json:"roomName"`
+	UserID     string `json:"userId"`
+	Permission string `json:"permission"`
+
+	// 房间管理鉴权过期时间(Unix时间戳，单位为秒)
+	ExpireAt int64 `json:"expireAt"`
+}
+
+// RoomTokenHandler 是签发房间管理鉴权的 http.Handler，可以直接挂载到业务服务器上供连麦终端获取房间管理鉴权
+//
+// 支持 GET 和 POST(表单) 请求，参数如下：
+//
+//	room	要加入的房间名称，需满足规格 ^[a-zA-Z0-9_-]{3,64}$
+//
+// 成功时返回 RoomTokenResponse，失败时返回 {"error": "<错误信息>"}
+type RoomTokenHandler struct {
+	// 签发房间管理鉴权使用的 Manager
+	Manager *Manager
+
+	// 房间所属的 app
+	AppID string
+
+	// Authorize 用来认证请求的用户并检查是否允许加入房间，返回用户ID和权限，返回错误时拒绝签发(403)
+	// 权限为空时使用 "user"
+	Authorize func(req *http.Request, roomName string) (userID, permission string, err error)
+
+	// 房间管理鉴权的有效期，默认一小时
+	Expires time.Duration
+}
+
+// NewRoomTokenHandler 用来构建一个签发房间管理鉴权的 http.Handler
+func NewRoomTokenHandler(manager *Manager, appID string,
+	authorize func(req *http.Request, roomName string) (userID, permission string, err error)) *RoomTokenHandler {
+	return &RoomTokenHandler{
+		Manager:   manager,
+		AppID:     appID,
+		Authorize: authorize,
+	}
+}
+
+// roomTokenError 是签发房间管理鉴权失败的原因
+type roomTokenError struct {
+	code int
+	msg  string
+}
+
+func (e *roomTokenError) Error() string {
+	return e.msg
+}
+
+func newRoomTokenError(code int, msg string) error {
+	return &roomTokenError{code: code, msg: msg}
+}
+
+// ServeHTTP 签发房间管理鉴权
+func (h *RoomTokenHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ret, err := h.serve(req)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil {
+		code := http.StatusInternalServerError
+		if e, ok := err.(*roomTokenError); ok {
+			code = e.code
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (h *RoomTokenHandler) serve(req *http.Request) (ret RoomTokenResponse, err error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		err = newRoomTokenError(http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err = req.ParseForm(); err != nil {
+		err = newRoomTokenError(http.StatusBadRequest, err.Error())
+		return
+	}
+	roomName := req.Form.Get("room")
+	if !roomNameRegexp.MatchString(roomName) {
+		err = newRoomTokenError(http.StatusBadRequest, ErrInvalidRoomName.Error())
+		return
+	}
+	if h.Authorize == nil {
+		err = errors.New("no authorize hook")
+		return
+	}
+	userID, permission, aErr := h.Authorize(req, roomName)
+	if aErr != nil {
+		err = newRoomTokenError(http.StatusForbidden, aErr.Error())
+		return
+	}
+	if permission == "" {
+		permission = PermissionUser
+	}
+
+	expires := h.Expires
+	if expires <= 0 {
+		expires = time.Hour
+	}
+	access := RoomAccess{
+		AppID:      h.AppID,
+		RoomName:   roomName,
+		UserID:     userID,
+		ExpireAt:   time.Now().Add(expires).Unix(),
+		Permission: permission,
+	}
+	if vErr := access.Validate(); vErr != nil {
+		err = newRoomTokenError(http.StatusForbidden, vErr.Error())
+		return
+	}
+	if h.Manager == nil {
+		err = errors.New("no manager")
+		return
+	}
+	token, err := h.Manager.GetRoomToken(access)
+	if err != nil {
+		return
+	}
+	ret = RoomTokenResponse{
+		RoomToken:  token,
+		AppID:      access.AppID,
+		RoomName:   access.RoomName,
+		UserID:     access.UserID,
+		Permission: access.Permission,
+		ExpireAt:   access.ExpireAt,
+	}
+	return
+}
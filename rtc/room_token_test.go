@@ -0,0 +1,118 @@
+package rtc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+func TestVerifyRoomToken(t *testing.T) {
+	m := NewManager(auth.New("ak", "sk"))
+	access := RoomAccess{AppID: "app", RoomName: "room-1", UserID: "user_1", ExpireAt: time.Now().Add(time.Hour).Unix(), Permission: PermissionAdmin}
+	token, err := m.GetRoomToken(access)
+	if err != nil {
+		t.Fatalf("GetRoomToken() error: %v", err)
+	}
+
+	accessKey, parsed, err := ParseRoomToken(token)
+	if err != nil || accessKey != "ak" || parsed != access {
+		t.Errorf("ParseRoomToken() = %q, %+v, %v", accessKey, parsed, err)
+	}
+	if verified, err := m.VerifyRoomToken(token); err != nil || verified != access {
+		t.Errorf("VerifyRoomToken() = %+v, %v", verified, err)
+	}
+
+	if _, _, err = ParseRoomToken("ak:sign"); err != ErrInvalidRoomToken {
+		t.Errorf("ParseRoomToken() error = %v", err)
+	}
+	if _, err = NewManager(auth.New("ak", "sk2")).VerifyRoomToken(token); err != ErrRoomTokenSignature {
+		t.Errorf("VerifyRoomToken() with other secret key error = %v", err)
+	}
+	if _, err = NewManager(auth.New("ak2", "sk")).VerifyRoomToken(token); err != ErrRoomTokenSignature {
+		t.Errorf("VerifyRoomToken() with other access key error = %v", err)
+	}
+
+	cases := []struct {
+		modify func(a *RoomAccess)
+		err    error
+	}{
+		{func(a *RoomAccess) { a.ExpireAt = time.Now().Add(-time.Second).Unix() }, ErrRoomTokenExpired},
+		{func(a *RoomAccess) { a.RoomName = "ro" }, ErrInvalidRoomName},
+		{func(a *RoomAccess) { a.RoomName = "room/1" }, ErrInvalidRoomName},
+		{func(a *RoomAccess) { a.UserID = strings.Repeat("u", 51) }, ErrInvalidUserID},
+		{func(a *RoomAccess) { a.Permission = "root" }, ErrInvalidPermission},
+	}
+	for i, c := range cases {
+		a := access
+		c.modify(&a)
+		token, _ := m.GetRoomToken(a)
+		if _, err := m.VerifyRoomToken(token); err != c.err {
+			t.Errorf("case %d: VerifyRoomToken() error = %v, want %v", i, err, c.err)
+		}
+	}
+}
+
+func TestRoomTokenHandler(t *testing.T) {
+	m := NewManager(auth.New("ak", "sk"))
+	h := NewRoomTokenHandler(m, "app", func(req *http.Request, roomName string) (string, string, error) {
+		user := req.Header.Get("X-User")
+		if user == "" || roomName == "private" {
+			return "", "", errors.New("not allowed")
+		}
+		return user, "", nil
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	get := func(room, user string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("GET", srv.URL+"?room="+url.QueryEscape(room), nil)
+		req.Header.Set("X-User", user)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		defer resp.Body.Close()
+		ret := map[string]interface{}{}
+		json.NewDecoder(resp.Body).Decode(&ret)
+		return resp.StatusCode, ret
+	}
+
+	code, ret := get("room-1", "alice")
+	if code != http.StatusOK || ret["userId"] != "alice" || ret["permission"] != PermissionUser || ret["appId"] != "app" {
+		t.Fatalf("issue token: %d %v", code, ret)
+	}
+	access, err := m.VerifyRoomToken(ret["roomToken"].(string))
+	if err != nil || access.RoomName != "room-1" || access.ExpireAt != int64(ret["expireAt"].(float64)) {
+		t.Errorf("VerifyRoomToken() = %+v, %v", access, err)
+	}
+
+	for _, c := range []struct {
+		room, user string
+		code       int
+	}{
+		{"r", "alice", http.StatusBadRequest},
+		{"room-1", "", http.StatusForbidden},
+		{"private", "alice", http.StatusForbidden},
+		{"room-1", "al", http.StatusForbidden},
+	} {
+		if code, ret := get(c.room, c.user); code != c.code || ret["error"] == nil {
+			t.Errorf("room %q user %q: %d %v, want %d", c.room, c.user, code, ret, c.code)
+		}
+	}
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST without room: %d", resp.StatusCode)
+	}
+}
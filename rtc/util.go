@@ -2,6 +2,7 @@ package rtc
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/endpoints"
 )
 
 // resInfo is httpresponse infomation
@@ -22,24 +25,17 @@ func newResInfo() resInfo {
 	return info
 }
 
-func getReqid(src *http.Header) string {
-	for k, v := range *src {
-		K := strings.Title(k)
-		if strings.Contains(K, "Reqid") {
-			return strings.Join(v, ", ")
-		}
-	}
-	return ""
-}
-
-func buildURL(path string) string {
+func (r *Manager) buildURL(path string) string {
 	if strings.Index(path, "/") != 0 {
 		path = "/" + path
 	}
+	if r.host != "" {
+		return endpoints.URL(r.host, true) + path
+	}
 	return "https://" + RtcHost + path
 }
 
-func postReq(httpClient *http.Client, mac *auth.Credentials, url string,
+func postReq(clt *client.Client, mac auth.CredentialsProvider, url string,
 	reqParam interface{}, ret interface{}) *resInfo {
 	info := newResInfo()
 	var reqData []byte
@@ -62,63 +58,48 @@ func postReq(httpClient *http.Client, mac *auth.Credentials, url string,
 		info.Err = err
 		return &info
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewReader(reqData))
-	if err != nil {
-		info.Err = err
-		return &info
-	}
-	req.Header.Add("Content-Type", "application/json")
-	return callReq(httpClient, req, mac, &info, ret)
+	headers := http.Header{}
+	headers.Add("Content-Type", "application/json")
+	return callReq(clt, context.Background(), mac, "POST", url, headers, reqData, &info, ret)
 }
 
-func getReq(httpClient *http.Client, mac *auth.Credentials, url string, ret interface{}) *resInfo {
+func getReq(clt *client.Client, mac auth.CredentialsProvider, url string, ret interface{}) *resInfo {
 	info := newResInfo()
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		info.Err = err
-		return &info
-	}
-	return callReq(httpClient, req, mac, &info, ret)
+	ctx := client.WithIdempotent(context.Background(), true)
+	return callReq(clt, ctx, mac, "GET", url, nil, nil, &info, ret)
 }
 
-func delReq(httpClient *http.Client, mac *auth.Credentials, url string, ret interface{}) *resInfo {
+func delReq(clt *client.Client, mac auth.CredentialsProvider, url string, ret interface{}) *resInfo {
 	info := newResInfo()
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		info.Err = err
-		return &info
-	}
-	return callReq(httpClient, req, mac, &info, ret)
+	ctx := client.WithIdempotent(context.Background(), true)
+	return callReq(clt, ctx, mac, "DELETE", url, nil, nil, &info, ret)
 }
 
-func callReq(httpClient *http.Client, req *http.Request, mac *auth.Credentials,
-	info *resInfo, ret interface{}) (oinfo *resInfo) {
+// callReq 通过 clt 发送请求，请求按照 clt 的重试策略重试，每次重试都重新签名
+func callReq(clt *client.Client, ctx context.Context, mac auth.CredentialsProvider, method, url string,
+	headers http.Header, reqData []byte, info *resInfo, ret interface{}) (oinfo *resInfo) {
 	oinfo = info
-	accessToken, err := mac.SignRequestV2(req)
-	if err != nil {
-		info.Err = err
-		return
+	if clt == nil {
+		clt = &client.DefaultClient
 	}
-	req.Header.Add("Authorization", "Qiniu "+accessToken)
-	client := httpClient
-	if client == nil {
-		client = http.DefaultClient
-	}
-	resp, err := client.Do(req)
+	// 签名在 client.Client 的中间件之后进行
+	ctx = auth.WithCredentialsProviderType(ctx, mac, auth.TokenQiniu)
+	resp, err := clt.DoRequestWith(ctx, method, url, headers, bytes.NewReader(reqData), len(reqData))
 	if err != nil {
 		info.Err = err
 		return
 	}
 	defer resp.Body.Close()
 	info.Code = resp.StatusCode
-	reqid := getReqid(&resp.Header)
+	// 回复异常时返回的错误和接口错误一样包含 reqid，状态码，域名和方法
 	rebuildErr := func(msg string) error {
-		return fmt.Errorf("Code: %v, Reqid: %v, %v", info.Code, reqid, msg)
+		e := client.NewResponseError(resp, nil)
+		e.Err = msg
+		return e
 	}
 
 	if resp.ContentLength > 2*1024*1024 {
-		err = rebuildErr(fmt.Sprintf("response is too long. Content-Length: %v", resp.ContentLength))
-		info.Err = err
+		info.Err = rebuildErr(fmt.Sprintf("response is too long. Content-Length: %v", resp.ContentLength))
 		return
 	}
 	resData, err := ioutil.ReadAll(resp.Body)
@@ -127,13 +108,13 @@ func callReq(httpClient *http.Client, req *http.Request, mac *auth.Credentials,
 		return
 	}
 	if info.Code != 200 {
-		info.Err = rebuildErr(string(resData))
+		info.Err = client.NewResponseError(resp, resData)
 		return
 	}
 	if ret != nil {
 		err = json.Unmarshal(resData, ret)
 		if err != nil {
-			info.Err = rebuildErr(fmt.Sprintf("err: %v, res: %v", err, resData))
+			info.Err = rebuildErr(fmt.Sprintf("err: %v, res: %s", err, resData))
 		}
 	}
 	return
@@ -0,0 +1,75 @@
+package rtc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+func TestCallReqError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Reqid", "reqid-1")
+		if req.URL.Path == "/v3/apps/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"app not found"}`))
+			return
+		}
+		w.Write([]byte(`{"appId":`))
+	}))
+	defer srv.Close()
+
+	m := NewManager(auth.New("ak", "sk"))
+	m.SetHost(srv.URL)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	_, err := m.GetApp("missing")
+	var e *client.ErrorInfo
+	if !errors.As(err, &e) || !client.IsNotFound(err) || e.Reqid != "reqid-1" || e.Host != host || e.Method != "GET" {
+		t.Errorf("GetApp() error = %#v", err)
+	}
+
+	// 回复内容无法解析时同样返回包含 reqid，域名和方法的错误
+	_, err = m.GetApp("app")
+	if !errors.As(err, &e) || e.Code != http.StatusOK || e.Reqid != "reqid-1" || e.Host != host || e.Method != "GET" {
+		t.Errorf("GetApp() with invalid body error = %#v", err)
+	}
+}
+
+func TestCallReqRetry(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		methods = append(methods, req.Method)
+		if len(methods)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"appId":"app"}`))
+	}))
+	defer srv.Close()
+
+	policy := client.NewRetryPolicy(2)
+	policy.BaseDelay = time.Millisecond
+	m := NewManagerEx(auth.New("ak", "sk"), &client.Client{Client: &http.Client{}, RetryPolicy: policy})
+	m.SetHost(srv.URL)
+
+	// GET 和 DELETE 是幂等的，失败时重试
+	if app, err := m.GetApp("app"); err != nil || app.AppID != "app" {
+		t.Errorf("GetApp() = %+v, %v", app, err)
+	}
+	if err := m.DeleteApp("app"); err != nil {
+		t.Errorf("DeleteApp() error: %v", err)
+	}
+	// POST 不重试
+	if _, err := m.CreateApp(AppInitConf{Hub: "hub"}); !client.IsRetryable(err) {
+		t.Errorf("CreateApp() error = %v", err)
+	}
+	if strings.Join(methods, ",") != "GET,GET,DELETE,DELETE,POST" {
+		t.Errorf("requests: %v", methods)
+	}
+}
@@ -3,6 +3,8 @@ package client
 import (
 	"encoding/base64"
 	"net/http"
+
+	"github.com/qiniu/api.v7/v7/auth"
 )
 
 // Mac qiniu mac type
@@ -55,3 +57,43 @@ func NewClient(mac *Mac, transport http.RoundTripper) *http.Client {
 	t := NewTransport(mac, transport)
 	return &http.Client{Transport: t}
 }
+
+// ProviderTransport with qiniu mac retrieved from a credentials provider for each request
+type ProviderTransport struct {
+	provider  auth.CredentialsProvider
+	Transport http.RoundTripper
+}
+
+// RoundTrip transport round trip method
+func (t *ProviderTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+
+	mac, err := t.provider.Retrieve()
+	if err != nil {
+		return
+	}
+
+	sign, err := SignRequest(mac.SecretKey, req)
+	if err != nil {
+		return
+	}
+
+	auth := "Qiniu " + mac.AccessKey + ":" + base64.URLEncoding.EncodeToString(sign)
+	req.Header.Set("Authorization", auth)
+	return t.Transport.RoundTrip(req)
+}
+
+// NestedObject return transport
+func (t *ProviderTransport) NestedObject() interface{} {
+
+	return t.Transport
+}
+
+// NewProviderTransport return transport which signs each request with credentials retrieved from provider
+func NewProviderTransport(provider auth.CredentialsProvider, transport http.RoundTripper) *ProviderTransport {
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &ProviderTransport{provider: provider, Transport: transport}
+}
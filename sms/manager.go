@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/qiniu/api.v7/v7/auth"
+	qclient "github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/endpoints"
 	"github.com/qiniu/api.v7/v7/sms/client"
 	"github.com/qiniu/api.v7/v7/sms/rpc"
 )
@@ -15,22 +17,63 @@ var (
 
 // Manager 提供了 Qiniu SMS Server API 相关功能
 type Manager struct {
-	mac    *auth.Credentials
+	mac    auth.CredentialsProvider
 	client rpc.Client
+	host   string
 }
 
 // NewManager 用来构建一个新的 Manager
 func NewManager(mac *auth.Credentials) (manager *Manager) {
 
-	manager = &Manager{}
+	manager = &Manager{mac: mac}
 
 	mac1 := &client.Mac{
 		AccessKey: mac.AccessKey,
 		SecretKey: []byte(mac.SecretKey),
 	}
 
-	transport := client.NewTransport(mac1, nil)
+	transport := client.NewTransport(mac1, qclient.DefaultClient.Transport)
 	manager.client = rpc.Client{Client: &http.Client{Transport: transport}}
 
 	return
 }
+
+// NewManagerWithProvider 用来构建一个使用 provider 获取密钥的 Manager
+// 每个请求都会通过 provider 获取密钥，因此更换密钥不需要重新构建 Manager
+func NewManagerWithProvider(provider auth.CredentialsProvider) (manager *Manager) {
+	return NewManagerEx(provider, nil)
+}
+
+// NewManagerEx 用来构建一个使用 clt 的 Transport，中间件和重试策略发送请求的 Manager，clt 为 nil 时使用 qclient.DefaultClient
+// 中间件在签名之前执行，每次重试都重新签名，请求日志使用 clt 的 Logger
+func NewManagerEx(provider auth.CredentialsProvider, clt *qclient.Client) (manager *Manager) {
+
+	if clt == nil {
+		clt = &qclient.DefaultClient
+	}
+	hc := http.Client{}
+	if clt.Client != nil {
+		hc = *clt.Client
+	}
+
+	manager = &Manager{mac: provider}
+
+	transport := client.NewProviderTransport(provider, hc.Transport)
+	hc.Transport = qclient.NewRetryTransport(qclient.NewMiddlewareTransport(transport, clt.Middlewares...), clt.RetryPolicy)
+	manager.client = rpc.Client{Client: &hc, Logger: clt.Logger}
+
+	return
+}
+
+// SetHost 设置这个 Manager 使用的服务地址，比如私有云的地址，为空时使用 Host
+// 地址没有指定协议时使用 https，需要在发送请求之前设置，参考 endpoints.Profile
+func (m *Manager) SetHost(host string) {
+	m.host = host
+}
+
+func (m *Manager) apiHost() string {
+	if m.host == "" {
+		return Host
+	}
+	return endpoints.URL(m.host, true)
+}
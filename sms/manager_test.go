@@ -0,0 +1,45 @@
+package sms_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/sms"
+)
+
+func TestManagerRetry(t *testing.T) {
+	var auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auths = append(auths, req.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		if len(auths) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"temporary error"}`))
+			return
+		}
+		w.Write([]byte(`{"items":[{"id":"s1"}],"total":1}`))
+	}))
+	defer srv.Close()
+
+	policy := client.NewRetryPolicy(3)
+	policy.BaseDelay = time.Millisecond
+	m := sms.NewManagerEx(auth.New("ak", "sk"), &client.Client{Client: &http.Client{}, RetryPolicy: policy})
+	m.SetHost(srv.URL)
+
+	pagination, err := m.QuerySignature(sms.QuerySignatureRequest{})
+	if err != nil || pagination.Total != 1 {
+		t.Fatalf("QuerySignature() = %+v, %v", pagination, err)
+	}
+	if len(auths) != 3 {
+		t.Fatalf("want 3 attempts, got %d", len(auths))
+	}
+	for i, a := range auths {
+		if a == "" {
+			t.Errorf("attempt %d is not signed", i)
+		}
+	}
+}
@@ -17,7 +17,7 @@ type MessagesResponse struct {
 
 // SendMessage 发送短信
 func (m *Manager) SendMessage(args MessagesRequest) (ret MessagesResponse, err error) {
-	url := fmt.Sprintf("%s%s", Host, "/v1/message")
+	url := fmt.Sprintf("%s%s", m.apiHost(), "/v1/message")
 	err = m.client.CallWithJSON(&ret, url, args)
 	return
 }
@@ -3,24 +3,15 @@ package rpc
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
-)
 
-var (
-	green   = string([]byte{27, 91, 57, 55, 59, 52, 50, 109})
-	white   = string([]byte{27, 91, 57, 48, 59, 52, 55, 109})
-	yellow  = string([]byte{27, 91, 57, 55, 59, 52, 51, 109})
-	red     = string([]byte{27, 91, 57, 55, 59, 52, 49, 109})
-	blue    = string([]byte{27, 91, 57, 55, 59, 52, 52, 109})
-	magenta = string([]byte{27, 91, 57, 55, 59, 52, 53, 109})
-	cyan    = string([]byte{27, 91, 57, 55, 59, 52, 54, 109})
-	reset   = string([]byte{27, 91, 48, 109})
+	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/logging"
 )
 
 // UserAgent user agent
@@ -31,14 +22,17 @@ var UserAgent = "Golang qiniu/rpc package"
 // Client a golang http client
 type Client struct {
 	*http.Client
+
+	// Logger 输出请求日志，为 nil 时和 client.Client 一样使用默认的 Logger
+	Logger logging.Logger
 }
 
 // DefaultClient a golang default http client
-var DefaultClient = Client{&http.Client{Transport: DefaultTransport}}
+var DefaultClient = Client{Client: &http.Client{Transport: DefaultTransport}}
 
 // NewClientTimeout return a golang http client
 func NewClientTimeout(dial, resp time.Duration) Client {
-	return Client{&http.Client{Transport: NewTransportTimeout(dial, resp)}}
+	return Client{Client: &http.Client{Transport: NewTransportTimeout(dial, resp)}}
 }
 
 // --------------------------------------------------------------------
@@ -166,50 +160,29 @@ func (r Client) PutWithJSON(url1 string, data interface{}) (resp *http.Response,
 
 // Do 发送 HTTP Request, 并返回 HTTP Response
 func (r Client) Do(req *http.Request) (resp *http.Response, err error) {
-	// debug
-	start := time.Now()
-	defer func() {
-		end := time.Now()
-		latency := end.Sub(start)
-		if err != nil {
-
-		} else {
-			reqid := req.Header.Get("X-Reqid")
-			if rid := resp.Header.Get("X-Reqid"); len(rid) > 0 {
-				reqid = rid
-			}
-			method := req.Method
-			methodColor := colorForMethod(method)
-			statusCode := resp.StatusCode
-			statusColor := colorForStatus(statusCode)
-
-			fmt.Printf("[RPC] [%s] %v |%s %3d %s| %13v |%s %s %s|\t %s\n",
-				reqid,
-				start.Format("2006/01/02 - 15:04:05"),
-				statusColor, statusCode, reset,
-				latency,
-				methodColor, method, reset,
-				req.URL.String(),
-			)
-		}
-	}()
-
 	if req.Header.Get("User-Agent") == "" {
 		req.Header.Set("User-Agent", UserAgent)
 	}
 
-	resp, err = r.Client.Do(req)
-	return
+	return client.LogRequests(r.Logger)(r.Client.Do)(req)
 }
 
 // --------------------------------------------------------------------
 
 // ErrorInfo type
+// 可以通过 errors.As 转换为 *client.ErrorInfo，通过 client.IsNotFound 等函数判断错误类型
 type ErrorInfo struct {
 	Err       string `json:"error"`
 	RequestID string `json:"reqid"`
 	Message   string `json:"message"`
 	Code      int    `json:"code"`
+
+	// 回复中的错误码，client.IsQuotaExceeded 等函数同时根据它判断错误类型
+	Errno int `json:"errno,omitempty"`
+
+	// 请求的域名和方法
+	Host   string `json:"host,omitempty"`
+	Method string `json:"method,omitempty"`
 }
 
 // ErrorDetail return error detail
@@ -231,10 +204,39 @@ func (r *ErrorInfo) HTTPCode() int {
 	return r.Code
 }
 
+// clientError 转换为 SDK 统一的错误类型
+func (r *ErrorInfo) clientError() *client.ErrorInfo {
+	return &client.ErrorInfo{
+		Err:    r.Error(),
+		Reqid:  r.RequestID,
+		Errno:  r.Errno,
+		Code:   r.Code,
+		Host:   r.Host,
+		Method: r.Method,
+	}
+}
+
+// Is 使 errors.Is 可以使用 client.ErrNotFound 等错误判断错误类型
+func (r *ErrorInfo) Is(target error) bool {
+	return r.clientError().Is(target)
+}
+
+// As 使 errors.As 可以把错误转换为 *client.ErrorInfo
+func (r *ErrorInfo) As(target interface{}) bool {
+	if e, ok := target.(**client.ErrorInfo); ok {
+		*e = r.clientError()
+		return true
+	}
+	return false
+}
+
 // --------------------------------------------------------------------
 
 type errorRet struct {
-	Error string `json:"error"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Errno   int    `json:"errno"`
+	Code    int    `json:"code"`
 }
 
 // ResponseError return response error
@@ -243,12 +245,22 @@ func ResponseError(resp *http.Response) (err error) {
 		RequestID: resp.Header.Get("X-Reqid"),
 		Code:      resp.StatusCode,
 	}
+	if req := resp.Request; req != nil {
+		e.Method = req.Method
+		if req.URL != nil {
+			e.Host = req.URL.Host
+		}
+	}
 	if resp.StatusCode > 299 {
 		if resp.ContentLength != 0 {
 			if ct := resp.Header.Get("Content-Type"); strings.TrimSpace(strings.SplitN(ct, ";", 2)[0]) == "application/json" {
 				var ret1 errorRet
 				json.NewDecoder(resp.Body).Decode(&ret1)
-				e.Err = ret1.Error
+				e.Err, e.Message, e.Errno = ret1.Error, ret1.Message, ret1.Errno
+				// 和 client.ErrorInfo 一样，code 字段和 HTTP 状态码不同时作为错误码
+				if e.Errno == 0 && ret1.Code != 0 && ret1.Code != e.Code {
+					e.Errno = ret1.Code
+				}
 			}
 		}
 	}
@@ -402,39 +414,3 @@ func (r Client) DeleteCall(ret interface{}, url string) (err error) {
 	}
 	return callRet(ret, resp)
 }
-
-// --------------------------------------------------------------------
-
-func colorForStatus(code int) string {
-	switch {
-	case code >= 200 && code < 300:
-		return green
-	case code >= 300 && code < 400:
-		return white
-	case code >= 400 && code < 500:
-		return yellow
-	default:
-		return red
-	}
-}
-
-func colorForMethod(method string) string {
-	switch method {
-	case "GET":
-		return blue
-	case "POST":
-		return cyan
-	case "PUT":
-		return yellow
-	case "DELETE":
-		return red
-	case "PATCH":
-		return green
-	case "HEAD":
-		return magenta
-	case "OPTIONS":
-		return white
-	default:
-		return reset
-	}
-}
@@ -0,0 +1,38 @@
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+func TestResponseErrorErrno(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Reqid", "reqid-1")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"quota exceeded","message":"too many messages","errno":573}`))
+	}))
+	defer srv.Close()
+
+	err := DefaultClient.GetCall(nil, srv.URL+"/v1/message")
+	var e *ErrorInfo
+	if !errors.As(err, &e) {
+		t.Fatalf("want *ErrorInfo, got %T", err)
+	}
+	if e.Code != http.StatusBadRequest || e.Errno != 573 || e.Err != "quota exceeded" ||
+		e.Message != "too many messages" || e.RequestID != "reqid-1" {
+		t.Errorf("unexpected error info: %+v", e)
+	}
+
+	var ce *client.ErrorInfo
+	if !errors.As(err, &ce) || ce.Errno != 573 || ce.Reqid != "reqid-1" {
+		t.Errorf("unexpected client error info: %+v", ce)
+	}
+	if !client.IsQuotaExceeded(err) {
+		t.Errorf("IsQuotaExceeded() should match %v", err)
+	}
+}
@@ -41,14 +41,14 @@ type SignatureResponse struct {
 
 // CreateSignature 创建签名
 func (m *Manager) CreateSignature(args SignatureRequest) (ret SignatureResponse, err error) {
-	url := fmt.Sprintf("%s%s", Host, "/v1/signature")
+	url := fmt.Sprintf("%s%s", m.apiHost(), "/v1/signature")
 	err = m.client.CallWithJSON(&ret, url, args)
 	return
 }
 
 // UpdateSignature 更新签名
 func (m *Manager) UpdateSignature(id string, args SignatureRequest) (err error) {
-	url := fmt.Sprintf("%s%s/%s", Host, "/v1/signature", id)
+	url := fmt.Sprintf("%s%s/%s", m.apiHost(), "/v1/signature", id)
 	_, err = m.client.PutWithJSON(url, args)
 	return
 }
@@ -76,14 +76,14 @@ func (m *Manager) QuerySignature(args QuerySignatureRequest) (pagination Signatu
 		values.Set("page_size", fmt.Sprintf("%d", args.PageSize))
 	}
 
-	url := fmt.Sprintf("%s%s?%s", Host, "/v1/signature", values.Encode())
+	url := fmt.Sprintf("%s%s?%s", m.apiHost(), "/v1/signature", values.Encode())
 	err = m.client.GetCall(&pagination, url)
 	return
 }
 
 // DeleteSignature 删除签名
 func (m *Manager) DeleteSignature(id string) (err error) {
-	url := fmt.Sprintf("%s%s/%s", Host, "/v1/signature", id)
+	url := fmt.Sprintf("%s%s/%s", m.apiHost(), "/v1/signature", id)
 	_, err = m.client.Delete(url)
 	return
 }
@@ -43,14 +43,14 @@ type TemplateResponse struct {
 
 // CreateTemplate 创建模板
 func (m *Manager) CreateTemplate(args TemplateRequest) (ret TemplateResponse, err error) {
-	url := fmt.Sprintf("%s%s", Host, "/v1/template")
+	url := fmt.Sprintf("%s%s", m.apiHost(), "/v1/template")
 	err = m.client.CallWithJSON(&ret, url, args)
 	return
 }
 
 // UpdateTemplate 更新模板
 func (m *Manager) UpdateTemplate(id string, args TemplateRequest) (err error) {
-	url := fmt.Sprintf("%s%s/%s", Host, "/v1/template", id)
+	url := fmt.Sprintf("%s%s/%s", m.apiHost(), "/v1/template", id)
 	_, err = m.client.PutWithJSON(url, args)
 	return
 }
@@ -78,14 +78,14 @@ func (m *Manager) QueryTemplate(args QueryTemplateRequest) (pagination TemplateP
 		values.Set("page_size", fmt.Sprintf("%d", args.PageSize))
 	}
 
-	url := fmt.Sprintf("%s%s?%s", Host, "/v1/template", values.Encode())
+	url := fmt.Sprintf("%s%s?%s", m.apiHost(), "/v1/template", values.Encode())
 	err = m.client.GetCall(&pagination, url)
 	return
 }
 
 // DeleteTemplate 删除模板
 func (m *Manager) DeleteTemplate(id string) (err error) {
-	url := fmt.Sprintf("%s%s/%s", Host, "/v1/template", id)
+	url := fmt.Sprintf("%s%s/%s", m.apiHost(), "/v1/template", id)
 	_, err = m.client.Delete(url)
 	return
 }
@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+// 文件的存储类型
+const (
+	// FileTypeStandard 标准存储
+	FileTypeStandard = 0
+
+	// FileTypeIA 低频存储
+	FileTypeIA = 1
+
+	// FileTypeArchive 归档存储
+	FileTypeArchive = 2
+)
+
+// RestoreStatus 归档存储文件的解冻状态
+type RestoreStatus int
+
+const (
+	// RestoreStatusNone 文件没有解冻，归档存储文件处于冻结状态或者文件不是归档存储
+	RestoreStatusNone RestoreStatus = 0
+
+	// RestoreStatusRestoring 文件正在解冻中
+	RestoreStatusRestoring RestoreStatus = 1
+
+	// RestoreStatusRestored 文件已经解冻完成，可以读取
+	RestoreStatusRestored RestoreStatus = 2
+)
+
+func (s RestoreStatus) String() string {
+	switch s {
+	case RestoreStatusNone:
+		return "none"
+	case RestoreStatusRestoring:
+		return "restoring"
+	case RestoreStatusRestored:
+		return "restored"
+	}
+	return fmt.Sprintf("RestoreStatus(%d)", int(s))
+}
+
+// RestoreArPollInterval 是等待归档存储文件解冻时查询文件状态的时间间隔
+// 完成解冻任务通常需要1～5分钟
+var RestoreArPollInterval = 30 * time.Second
+
+// ErrArchiveNotRestoring 归档存储文件既没有在解冻中，也没有解冻完成
+var ErrArchiveNotRestoring = errors.New("archive file is not restoring, call RestoreAr first")
+
+// WaitRestored 等待归档存储文件解冻完成，每隔 RestoreArPollInterval 查询一次文件状态
+// 文件可读(不是归档存储或者已经解冻完成)时返回文件信息
+// 如果文件是归档存储但是没有在解冻中，返回 ErrArchiveNotRestoring
+// ctx 可以用来取消等待
+func (m *BucketManager) WaitRestored(ctx context.Context, bucket, key string) (info FileInfo, err error) {
+	for {
+		info, err = m.StatContext(ctx, bucket, key)
+		if err != nil {
+			return
+		}
+		if info.Readable() {
+			return
+		}
+		if info.RestoreStatus == RestoreStatusNone {
+			err = ErrArchiveNotRestoring
+			return
+		}
+		if err = sleepContext(ctx, RestoreArPollInterval); err != nil {
+			return
+		}
+	}
+}
+
+// RestoreArOptions 是批量解冻归档存储文件的可选项
+type RestoreArOptions struct {
+	// 解冻有效期，1～7天，默认为1天
+	FreezeAfterDays int
+
+	// 每个批量请求中包含的操作数，默认100，最大1000
+	BatchSize int
+
+	// 每秒最多发起的操作数(包括解冻操作和查询文件状态的操作)，小于等于0表示不限制
+	OpsPerSecond int
+
+	// 查询解冻进度的时间间隔，默认为 RestoreArPollInterval
+	PollInterval time.Duration
+
+	// 进度通知，每个批量请求结束后调用。这个回调函数应该尽可能快地结束。
+	OnProgress func(progress RestoreArProgress)
+}
+
+// RestoreArProgress 是批量解冻的进度信息
+type RestoreArProgress struct {
+	// 需要解冻的文件总数
+	Total int
+
+	// 已经提交解冻请求的文件数
+	Submitted int
+
+	// 已经可读的文件数
+	Restored int
+
+	// 解冻失败的文件数
+	Failed int
+}
+
+// Done 返回是否所有的文件都已经有了结果
+func (p *RestoreArProgress) Done() bool {
+	return p.Restored+p.Failed >= p.Total
+}
+
+// RestoreArResult 是单个文件的解冻结果
+type RestoreArResult struct {
+	Key string
+
+	// 文件可读时的文件信息
+	Info FileInfo
+
+	// 解冻失败的原因，为nil表示文件已经可读
+	Err error
+}
+
+// BatchRestoreAr 批量解冻 keys 对应的归档存储文件，并等待所有文件都可读或者失败
+// 返回结果的顺序和 keys 的顺序一致
+// 如果解冻或者查询的批量请求本身失败，返回已经得到的结果和错误
+func (m *BucketManager) BatchRestoreAr(ctx context.Context, bucket string, keys []string,
+	opts *RestoreArOptions) (results []RestoreArResult, err error) {
+
+	if opts == nil {
+		opts = &RestoreArOptions{}
+	}
+	freezeAfterDays := opts.FreezeAfterDays
+	if freezeAfterDays <= 0 {
+		freezeAfterDays = 1
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	} else if batchSize > 1000 {
+		batchSize = 1000
+	}
+	pollInterval := opts.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = RestoreArPollInterval
+	}
+
+	limiter := newOpsLimiter(opts.OpsPerSecond)
+	progress := RestoreArProgress{Total: len(keys)}
+	notify := func() {
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+	}
+
+	results = make([]RestoreArResult, len(keys))
+	restoreErrs := make([]error, len(keys))
+	pending := make([]int, 0, len(keys))
+	for i, key := range keys {
+		results[i].Key = key
+		pending = append(pending, i)
+	}
+
+	for start := 0; start < len(pending); start += batchSize {
+		chunk := pending[start:minInt(start+batchSize, len(pending))]
+		ops := make([]string, 0, len(chunk))
+		for _, i := range chunk {
+			ops = append(ops, URIRestoreAr(bucket, keys[i], freezeAfterDays))
+		}
+		if err = limiter.wait(ctx, len(ops)); err != nil {
+			return
+		}
+		rets, bErr := m.BatchContext(ctx, ops)
+		if bErr != nil {
+			err = bErr
+			return
+		}
+		for j, i := range chunk {
+			if j < len(rets) && rets[j].Code != 200 {
+				restoreErrs[i] = batchOpError(&rets[j])
+			}
+		}
+		progress.Submitted += len(chunk)
+		notify()
+	}
+
+	for len(pending) > 0 {
+		stillPending := pending[:0]
+		for start := 0; start < len(pending); start += batchSize {
+			chunk := pending[start:minInt(start+batchSize, len(pending))]
+			ops := make([]string, 0, len(chunk))
+			for _, i := range chunk {
+				ops = append(ops, URIStat(bucket, keys[i]))
+			}
+			if err = limiter.wait(ctx, len(ops)); err != nil {
+				return
+			}
+			rets, bErr := m.BatchContext(ctx, ops)
+			if bErr != nil {
+				err = bErr
+				return
+			}
+			for j, i := range chunk {
+				if j >= len(rets) {
+					stillPending = append(stillPending, i)
+					continue
+				}
+				ret := &rets[j]
+				if ret.Code != 200 {
+					results[i].Err = batchOpError(ret)
+					progress.Failed++
+					continue
+				}
+				info := fileInfoFromBatchOpRet(ret)
+				switch {
+				case info.Readable():
+					results[i].Info = info
+					progress.Restored++
+				case info.RestoreStatus == RestoreStatusNone:
+					results[i].Err = restoreErrs[i]
+					if results[i].Err == nil {
+						results[i].Err = ErrArchiveNotRestoring
+					}
+					progress.Failed++
+				default:
+					stillPending = append(stillPending, i)
+				}
+			}
+			notify()
+		}
+		pending = stillPending
+		if len(pending) == 0 {
+			break
+		}
+		if err = sleepContext(ctx, pollInterval); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// RestoreArPrefix 解冻空间中以 prefix 为前缀的所有归档存储文件，并等待所有文件都可读或者失败
+// 非归档存储的文件会被忽略
+func (m *BucketManager) RestoreArPrefix(ctx context.Context, bucket, prefix string,
+	opts *RestoreArOptions) (results []RestoreArResult, err error) {
+
+	var keys []string
+	marker := ""
+	for {
+		entries, _, nextMarker, hasNext, lErr := m.ListFilesContext(ctx, bucket, prefix, "", marker, 1000)
+		if lErr != nil {
+			err = lErr
+			return
+		}
+		for _, entry := range entries {
+			if entry.Type == FileTypeArchive {
+				keys = append(keys, entry.Key)
+			}
+		}
+		if !hasNext {
+			break
+		}
+		marker = nextMarker
+	}
+	return m.BatchRestoreAr(ctx, bucket, keys, opts)
+}
+
+func fileInfoFromBatchOpRet(ret *BatchOpRet) FileInfo {
+	return FileInfo{
+		Hash:              ret.Data.Hash,
+		Fsize:             ret.Data.Fsize,
+		PutTime:           ret.Data.PutTime,
+		MimeType:          ret.Data.MimeType,
+		Type:              ret.Data.Type,
+		RestoreStatus:     ret.Data.RestoreStatus,
+		RestoreExpiration: ret.Data.RestoreExpiration,
+	}
+}
+
+func batchOpError(ret *BatchOpRet) error {
+	return &client.ErrorInfo{
+		Err:  ret.Data.Error,
+		Code: ret.Code,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// opsLimiter 限制每秒发起的操作数
+type opsLimiter struct {
+	opsPerSecond int
+	lock         sync.Mutex
+	next         time.Time
+}
+
+func newOpsLimiter(opsPerSecond int) *opsLimiter {
+	return &opsLimiter{opsPerSecond: opsPerSecond}
+}
+
+// wait 等待直到可以发起 n 个操作
+func (l *opsLimiter) wait(ctx context.Context, n int) error {
+	if l.opsPerSecond <= 0 {
+		return ctx.Err()
+	}
+
+	l.lock.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.opsPerSecond))
+	l.lock.Unlock()
+
+	if d := at.Sub(now); d > 0 {
+		return sleepContext(ctx, d)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+// fakeArchiveServer 模拟归档存储文件的解冻过程，每次查询文件状态后解冻进度前进一步
+type fakeArchiveServer struct {
+	lock   sync.Mutex
+	files  map[string]*FileInfo
+	polled map[string]int
+}
+
+func (s *fakeArchiveServer) handleOp(op string) (code int, data map[string]interface{}) {
+	parts := strings.Split(strings.TrimPrefix(op, "/"), "/")
+	entry, _ := base64.URLEncoding.DecodeString(parts[1])
+	key := strings.SplitN(string(entry), ":", 2)[1]
+
+	info, ok := s.files[key]
+	if !ok {
+		return 612, map[string]interface{}{"error": "no such file or directory"}
+	}
+	switch parts[0] {
+	case "restoreAr":
+		if info.Type != FileTypeArchive {
+			return 400, map[string]interface{}{"error": "invalid file type"}
+		}
+		if info.RestoreStatus != RestoreStatusNone {
+			return 400, map[string]interface{}{"error": "already in restore"}
+		}
+		info.RestoreStatus = RestoreStatusRestoring
+		return 200, nil
+	case "stat":
+		if info.RestoreStatus == RestoreStatusRestoring {
+			s.polled[key]++
+			if s.polled[key] >= 2 {
+				info.RestoreStatus = RestoreStatusRestored
+				info.RestoreExpiration = time.Now().Add(24 * time.Hour).Unix()
+			}
+		}
+		bs, _ := json.Marshal(info)
+		json.Unmarshal(bs, &data)
+		return 200, data
+	}
+	return 400, map[string]interface{}{"error": "unknown op"}
+}
+
+func (s *fakeArchiveServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if req.URL.Path == "/batch" {
+		req.ParseForm()
+		rets := make([]map[string]interface{}, 0, len(req.Form["op"]))
+		for _, op := range req.Form["op"] {
+			code, data := s.handleOp(op)
+			rets = append(rets, map[string]interface{}{"code": code, "data": data})
+		}
+		json.NewEncoder(w).Encode(rets)
+		return
+	}
+	code, data := s.handleOp(req.URL.Path)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(data)
+}
+
+func newFakeArchiveManager(t *testing.T, files map[string]*FileInfo) *BucketManager {
+	srv := httptest.NewServer(&fakeArchiveServer{files: files, polled: make(map[string]int)})
+	t.Cleanup(srv.Close)
+
+	cfg := Config{
+		RsHost:        srv.URL,
+		CentralRsHost: strings.TrimPrefix(srv.URL, "http://"),
+	}
+	return NewBucketManager(auth.New("ak", "sk"), &cfg)
+}
+
+func TestWaitRestored(t *testing.T) {
+	oldInterval := RestoreArPollInterval
+	RestoreArPollInterval = time.Millisecond
+	defer func() { RestoreArPollInterval = oldInterval }()
+
+	m := newFakeArchiveManager(t, map[string]*FileInfo{
+		"frozen":    {Type: FileTypeArchive},
+		"restoring": {Type: FileTypeArchive, RestoreStatus: RestoreStatusRestoring},
+		"standard":  {Type: FileTypeStandard},
+	})
+
+	info, err := m.WaitRestored(context.Background(), "bucket", "restoring")
+	if err != nil {
+		t.Fatalf("WaitRestored() error: %v", err)
+	}
+	if info.RestoreStatus != RestoreStatusRestored || info.RestoreExpiration == 0 {
+		t.Errorf("WaitRestored() got %+v", info)
+	}
+
+	if _, err = m.WaitRestored(context.Background(), "bucket", "standard"); err != nil {
+		t.Errorf("WaitRestored() for standard file error: %v", err)
+	}
+
+	if _, err = m.WaitRestored(context.Background(), "bucket", "frozen"); err != ErrArchiveNotRestoring {
+		t.Errorf("WaitRestored() for frozen file, want ErrArchiveNotRestoring, got %v", err)
+	}
+}
+
+func TestBatchRestoreAr(t *testing.T) {
+	m := newFakeArchiveManager(t, map[string]*FileInfo{
+		"a": {Type: FileTypeArchive},
+		"b": {Type: FileTypeArchive},
+		"c": {Type: FileTypeArchive, RestoreStatus: RestoreStatusRestoring},
+		"d": {Type: FileTypeStandard},
+	})
+
+	var last RestoreArProgress
+	results, err := m.BatchRestoreAr(context.Background(), "bucket", []string{"a", "b", "c", "d", "missing"}, &RestoreArOptions{
+		BatchSize:    2,
+		PollInterval: time.Millisecond,
+		OnProgress:   func(p RestoreArProgress) { last = p },
+	})
+	if err != nil {
+		t.Fatalf("BatchRestoreAr() error: %v", err)
+	}
+	if !last.Done() || last.Total != 5 || last.Submitted != 5 || last.Restored != 4 || last.Failed != 1 {
+		t.Errorf("unexpected progress: %+v", last)
+	}
+	for _, ret := range results {
+		if ret.Key == "missing" {
+			if ret.Err == nil {
+				t.Errorf("want error for missing key")
+			}
+			continue
+		}
+		if ret.Err != nil || !ret.Info.Readable() {
+			t.Errorf("key %s not restored: %+v", ret.Key, ret)
+		}
+	}
+}
+
+func TestBatchRestoreArCanceled(t *testing.T) {
+	m := newFakeArchiveManager(t, map[string]*FileInfo{
+		"a": {Type: FileTypeArchive},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.BatchRestoreAr(ctx, "bucket", []string{"a"}, nil); err == nil {
+		t.Errorf("want error for canceled context")
+	}
+}
@@ -86,8 +86,8 @@ func (p *Base64Uploader) put(
 		return
 	}
 
-	var upHost string
-	upHost, err = p.upHost(ak, bucket)
+	var upHosts []string
+	upHosts, err = getUpHosts(ctx, p.cfg, p.client, ak, bucket)
 	if err != nil {
 		return
 	}
@@ -139,14 +139,17 @@ func (p *Base64Uploader) put(
 		}
 	}
 
-	postURL := fmt.Sprintf("%s%s", upHost, postPath.String())
 	headers := http.Header{}
 	headers.Add("Content-Type", "application/octet-stream")
 	headers.Add("Authorization", "UpToken "+uptoken)
 
-	return p.client.CallWith(ctx, ret, "POST", postURL, headers, bytes.NewReader(base64Data), len(base64Data))
+	// 使用相同的凭证和内容重新上传不会产生不同的结果，当作幂等请求换域名
+	return doWithHosts(client.WithIdempotent(ctx, true), "POST", upHosts, func(upHost string) error {
+		postURL := fmt.Sprintf("%s%s", upHost, postPath.String())
+		return p.client.CallWith(ctx, ret, "POST", postURL, headers, bytes.NewReader(base64Data), len(base64Data))
+	})
 }
 
-func (p *Base64Uploader) upHost(ak, bucket string) (upHost string, err error) {
-	return getUpHost(p.cfg, ak, bucket)
+func (p *Base64Uploader) upHost(ctx context.Context, ak, bucket string) (upHost string, err error) {
+	return getUpHost(ctx, p.cfg, p.client, ak, bucket)
 }
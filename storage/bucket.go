@@ -14,12 +14,14 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 
 	"github.com/qiniu/api.v7/v7/auth"
 	"github.com/qiniu/api.v7/v7/client"
+	qendpoints "github.com/qiniu/api.v7/v7/endpoints"
+	"github.com/qiniu/api.v7/v7/logging"
+	"github.com/qiniu/api.v7/v7/telemetry"
 )
 
 // 资源管理相关的默认域名
@@ -37,6 +39,13 @@ type FileInfo struct {
 	PutTime  int64  `json:"putTime"`
 	MimeType string `json:"mimeType"`
 	Type     int    `json:"type"`
+
+	// 归档存储文件的解冻状态，参考 RestoreStatus
+	RestoreStatus RestoreStatus `json:"restoreStatus,omitempty"`
+
+	// 归档存储文件解冻后的过期时间(Unix时间戳，单位为秒)，过期后文件重新冻结
+	// 只有解冻完成的文件该字段才有意义
+	RestoreExpiration int64 `json:"restoreExpiration,omitempty"`
 }
 
 func (f *FileInfo) String() string {
@@ -46,9 +55,19 @@ func (f *FileInfo) String() string {
 	str += fmt.Sprintf("PutTime:  %d\n", f.PutTime)
 	str += fmt.Sprintf("MimeType: %s\n", f.MimeType)
 	str += fmt.Sprintf("Type:     %d\n", f.Type)
+	if f.RestoreStatus != RestoreStatusNone {
+		str += fmt.Sprintf("RestoreStatus:     %s\n", f.RestoreStatus)
+		str += fmt.Sprintf("RestoreExpiration: %d\n", f.RestoreExpiration)
+	}
 	return str
 }
 
+// Readable 返回文件当前是否可以读取
+// 非归档存储的文件总是可读的，归档存储的文件只有解冻完成后才可读
+func (f *FileInfo) Readable() bool {
+	return f.Type != FileTypeArchive || f.RestoreStatus == RestoreStatusRestored
+}
+
 // FetchRet 资源抓取的返回值
 type FetchRet struct {
 	Hash     string `json:"hash"`
@@ -79,6 +98,9 @@ type BatchOpRet struct {
 		MimeType string `json:"mimeType"`
 		Type     int    `json:"type"`
 		Error    string `json:"error"`
+
+		RestoreStatus     RestoreStatus `json:"restoreStatus,omitempty"`
+		RestoreExpiration int64         `json:"restoreExpiration,omitempty"`
 	} `json:"data,omitempty"`
 }
 
@@ -87,6 +109,9 @@ type BucketManager struct {
 	Client *client.Client
 	Mac    *auth.Credentials
 	Cfg    *Config
+
+	// 密钥获取方式，设置后优先于 Mac 使用，每个请求都会重新获取密钥
+	CredentialsProvider auth.CredentialsProvider
 }
 
 // NewBucketManager 用来构建一个新的资源管理对象
@@ -125,6 +150,43 @@ func NewBucketManagerEx(mac *auth.Credentials, cfg *Config, clt *client.Client)
 	}
 }
 
+// NewBucketManagerWithProvider 用来构建一个使用 provider 获取密钥的资源管理对象
+// 每个请求都会通过 provider 获取密钥，因此更换密钥不需要重新构建资源管理对象
+func NewBucketManagerWithProvider(provider auth.CredentialsProvider, cfg *Config, clt *client.Client) *BucketManager {
+	m := NewBucketManagerEx(nil, cfg, clt)
+	m.CredentialsProvider = provider
+	return m
+}
+
+// credentials 返回发送请求时使用的密钥获取方式
+func (m *BucketManager) credentials() auth.CredentialsProvider {
+	if m.CredentialsProvider != nil {
+		return m.CredentialsProvider
+	}
+	return m.Mac
+}
+
+// ucHost 返回空间管理接口使用的UC服务地址，Cfg.UcHosts 不为空时使用其中的第一个地址
+func (m *BucketManager) ucHost() string {
+	if m.Cfg == nil || len(m.Cfg.UcHosts) == 0 {
+		return UcHost
+	}
+	ucHost := strings.TrimRight(m.Cfg.UcHosts[0], "/")
+	if !strings.HasPrefix(ucHost, "http") {
+		ucHost = "https://" + ucHost
+	}
+	return ucHost
+}
+
+// accessKey 返回当前使用的 AccessKey
+func (m *BucketManager) accessKey() (string, error) {
+	cred, err := m.credentials().Retrieve()
+	if err != nil {
+		return "", err
+	}
+	return cred.AccessKey, nil
+}
+
 // UpdateObjectStatus 用来修改文件状态, 禁用和启用文件的可访问性
 
 // 请求包：
@@ -139,6 +201,11 @@ func NewBucketManagerEx(mac *auth.Credentials, cfg *Config, clt *client.Client)
 // 当文件不存在时，返回612 status code 612 {"error":"no such file or directory"}
 // 当文件当前状态和设置的状态已经一致，返回400 {"error":"already enabled"}或400 {"error":"already disabled"}
 func (m *BucketManager) UpdateObjectStatus(bucketName string, key string, enable bool) error {
+	return m.UpdateObjectStatusContext(context.Background(), bucketName, key, enable)
+}
+
+// UpdateObjectStatusContext 和 UpdateObjectStatus 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) UpdateObjectStatusContext(ctx context.Context, bucketName string, key string, enable bool) error {
 	var status string
 	ee := EncodedEntry(bucketName, key)
 	if enable {
@@ -148,254 +215,294 @@ func (m *BucketManager) UpdateObjectStatus(bucketName string, key string, enable
 	}
 	path := fmt.Sprintf("/chstatus/%s/status/%s", ee, status)
 
-	reqHost, reqErr := m.RsReqHost(bucketName)
-	if reqErr != nil {
-		return reqErr
-	}
-	reqURL := fmt.Sprintf("%s%s", reqHost, path)
-	return m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.callWithHosts(ctx, "rs", bucketName, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, path)
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 }
 
 // CreateBucket 创建一个七牛存储空间
 func (m *BucketManager) CreateBucket(bucketName string, regionID RegionID) error {
+	return m.CreateBucketContext(context.Background(), bucketName, regionID)
+}
+
+// CreateBucketContext 和 CreateBucket 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) CreateBucketContext(ctx context.Context, bucketName string, regionID RegionID) error {
 	var reqHost string
 
 	reqHost = m.Cfg.RsReqHost()
 	reqURL := fmt.Sprintf("%s/mkbucketv3/%s/region/%s", reqHost, bucketName, string(regionID))
-	return m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 }
 
 // Buckets 用来获取空间列表，如果指定了 shared 参数为 true，那么一同列表被授权访问的空间
 func (m *BucketManager) Buckets(shared bool) (buckets []string, err error) {
+	return m.BucketsContext(context.Background(), shared)
+}
+
+// BucketsContext 和 Buckets 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) BucketsContext(ctx context.Context, shared bool) (buckets []string, err error) {
 	var reqHost string
 
 	reqHost = m.Cfg.RsReqHost()
 	reqURL := fmt.Sprintf("%s/buckets?shared=%v", reqHost, shared)
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &buckets, "POST", reqURL, nil)
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &buckets, "POST", reqURL, nil)
 	return
 }
 
 // DropBucket 删除七牛存储空间
 func (m *BucketManager) DropBucket(bucketName string) (err error) {
+	return m.DropBucketContext(context.Background(), bucketName)
+}
+
+// DropBucketContext 和 DropBucket 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) DropBucketContext(ctx context.Context, bucketName string) (err error) {
 	var reqHost string
 
 	reqHost = m.Cfg.RsReqHost()
 	reqURL := fmt.Sprintf("%s/drop/%s", reqHost, bucketName)
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 	return
 }
 
 // Stat 用来获取一个文件的基本信息
 func (m *BucketManager) Stat(bucket, key string) (info FileInfo, err error) {
-	reqHost, reqErr := m.RsReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
+	return m.StatContext(context.Background(), bucket, key)
+}
 
-	reqURL := fmt.Sprintf("%s%s", reqHost, URIStat(bucket, key))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &info, "POST", reqURL, nil)
+// StatContext 和 Stat 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) StatContext(ctx context.Context, bucket, key string) (info FileInfo, err error) {
+	// 查询文件信息是幂等的，可以安全重试
+	ctx = client.WithIdempotent(ctx, true)
+	err = m.callWithHosts(ctx, "rs", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, URIStat(bucket, key))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &info, "POST", reqURL, nil)
+	})
 	return
 }
 
 // Delete 用来删除空间中的一个文件
 func (m *BucketManager) Delete(bucket, key string) (err error) {
-	reqHost, reqErr := m.RsReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
-	reqURL := fmt.Sprintf("%s%s", reqHost, URIDelete(bucket, key))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.DeleteContext(context.Background(), bucket, key)
+}
+
+// DeleteContext 和 Delete 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) DeleteContext(ctx context.Context, bucket, key string) (err error) {
+	err = m.callWithHosts(ctx, "rs", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, URIDelete(bucket, key))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 	return
 }
 
 // Copy 用来创建已有空间中的文件的一个新的副本
 func (m *BucketManager) Copy(srcBucket, srcKey, destBucket, destKey string, force bool) (err error) {
-	reqHost, reqErr := m.RsReqHost(srcBucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
+	return m.CopyContext(context.Background(), srcBucket, srcKey, destBucket, destKey, force)
+}
 
-	reqURL := fmt.Sprintf("%s%s", reqHost, URICopy(srcBucket, srcKey, destBucket, destKey, force))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+// CopyContext 和 Copy 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) CopyContext(ctx context.Context, srcBucket, srcKey, destBucket, destKey string, force bool) (err error) {
+	err = m.callWithHosts(ctx, "rs", srcBucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, URICopy(srcBucket, srcKey, destBucket, destKey, force))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 	return
 }
 
 // Move 用来将空间中的一个文件移动到新的空间或者重命名
 func (m *BucketManager) Move(srcBucket, srcKey, destBucket, destKey string, force bool) (err error) {
-	reqHost, reqErr := m.RsReqHost(srcBucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
+	return m.MoveContext(context.Background(), srcBucket, srcKey, destBucket, destKey, force)
+}
 
-	reqURL := fmt.Sprintf("%s%s", reqHost, URIMove(srcBucket, srcKey, destBucket, destKey, force))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+// MoveContext 和 Move 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) MoveContext(ctx context.Context, srcBucket, srcKey, destBucket, destKey string, force bool) (err error) {
+	err = m.callWithHosts(ctx, "rs", srcBucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, URIMove(srcBucket, srcKey, destBucket, destKey, force))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 	return
 }
 
 // ChangeMime 用来更新文件的MimeType
 func (m *BucketManager) ChangeMime(bucket, key, newMime string) (err error) {
-	reqHost, reqErr := m.RsReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
-	reqURL := fmt.Sprintf("%s%s", reqHost, URIChangeMime(bucket, key, newMime))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.ChangeMimeContext(context.Background(), bucket, key, newMime)
+}
+
+// ChangeMimeContext 和 ChangeMime 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) ChangeMimeContext(ctx context.Context, bucket, key, newMime string) (err error) {
+	err = m.callWithHosts(ctx, "rs", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, URIChangeMime(bucket, key, newMime))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 	return
 }
 
 // ChangeType 用来更新文件的存储类型，0 表示普通存储，1 表示低频存储，2 表示归档存储
 func (m *BucketManager) ChangeType(bucket, key string, fileType int) (err error) {
-	reqHost, reqErr := m.RsReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
-	reqURL := fmt.Sprintf("%s%s", reqHost, URIChangeType(bucket, key, fileType))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.ChangeTypeContext(context.Background(), bucket, key, fileType)
+}
+
+// ChangeTypeContext 和 ChangeType 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) ChangeTypeContext(ctx context.Context, bucket, key string, fileType int) (err error) {
+	err = m.callWithHosts(ctx, "rs", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, URIChangeType(bucket, key, fileType))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 	return
 }
 
 // RestoreAr 解冻归档存储类型的文件，可设置解冻有效期1～7天, 完成解冻任务通常需要1～5分钟
 func (m *BucketManager) RestoreAr(bucket, key string, freezeAfterDays int) (err error) {
-	reqHost, reqErr := m.RsReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
-	reqURL := fmt.Sprintf("%s%s", reqHost, URIRestoreAr(bucket, key, freezeAfterDays))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.RestoreArContext(context.Background(), bucket, key, freezeAfterDays)
+}
+
+// RestoreArContext 和 RestoreAr 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) RestoreArContext(ctx context.Context, bucket, key string, freezeAfterDays int) (err error) {
+	err = m.callWithHosts(ctx, "rs", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, URIRestoreAr(bucket, key, freezeAfterDays))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 	return
 }
 
 // DeleteAfterDays 用来更新文件生命周期，如果 days 设置为0，则表示取消文件的定期删除功能，永久存储
 func (m *BucketManager) DeleteAfterDays(bucket, key string, days int) (err error) {
-	reqHost, reqErr := m.RsReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
+	return m.DeleteAfterDaysContext(context.Background(), bucket, key, days)
+}
 
-	reqURL := fmt.Sprintf("%s%s", reqHost, URIDeleteAfterDays(bucket, key, days))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+// DeleteAfterDaysContext 和 DeleteAfterDays 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) DeleteAfterDaysContext(ctx context.Context, bucket, key string, days int) (err error) {
+	err = m.callWithHosts(ctx, "rs", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, URIDeleteAfterDays(bucket, key, days))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 	return
 }
 
 // Batch 接口提供了资源管理的批量操作，支持 stat，copy，move，delete，chgm，chtype，deleteAfterDays几个接口
 func (m *BucketManager) Batch(operations []string) (batchOpRet []BatchOpRet, err error) {
+	return m.BatchContext(context.Background(), operations)
+}
+
+// BatchContext 和 Batch 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) BatchContext(ctx context.Context, operations []string) (batchOpRet []BatchOpRet, err error) {
 	if len(operations) > 1000 {
 		err = errors.New("batch operation count exceeds the limit of 1000")
 		return
 	}
-	scheme := "http://"
-	if m.Cfg.UseHTTPS {
-		scheme = "https://"
-	}
-	reqURL := fmt.Sprintf("%s%s/batch", scheme, m.Cfg.CentralRsHost)
+	reqURL := qendpoints.URL(m.Cfg.CentralRsHost, m.Cfg.UseHTTPS) + "/batch"
 	params := map[string][]string{
 		"op": operations,
 	}
-	err = m.Client.CredentialedCallWithForm(context.Background(), m.Mac, auth.TokenQiniu, &batchOpRet, "POST", reqURL, nil, params)
+	ctx, op := telemetry.Start(ctx, telemetry.OpBatch, telemetry.Int(telemetry.AttrBatchSize, len(operations)))
+	defer func() { op.End(err) }()
+	err = m.Client.CredentialedCallWithForm(ctx, m.credentials(), auth.TokenQiniu, &batchOpRet, "POST", reqURL, nil, params)
 	return
 }
 
 // Fetch 根据提供的远程资源链接来抓取一个文件到空间并已指定文件名保存
 func (m *BucketManager) Fetch(resURL, bucket, key string) (fetchRet FetchRet, err error) {
-	reqHost, rErr := m.IoReqHost(bucket)
-	if rErr != nil {
-		err = rErr
-		return
-	}
-	reqURL := fmt.Sprintf("%s%s", reqHost, uriFetch(resURL, bucket, key))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQBox, &fetchRet, "POST", reqURL, nil)
+	return m.FetchContext(context.Background(), resURL, bucket, key)
+}
+
+// FetchContext 和 Fetch 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) FetchContext(ctx context.Context, resURL, bucket, key string) (fetchRet FetchRet, err error) {
+	err = m.callWithHosts(ctx, "io", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, uriFetch(resURL, bucket, key))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQBox, &fetchRet, "POST", reqURL, nil)
+	})
 	return
 }
 
 func (m *BucketManager) RsReqHost(bucket string) (reqHost string, err error) {
-	var reqErr error
-
-	if m.Cfg.RsHost == "" {
-		reqHost, reqErr = m.RsHost(bucket)
-		if reqErr != nil {
-			err = reqErr
-			return
-		}
-	} else {
-		reqHost = m.Cfg.RsHost
-	}
-	if !strings.HasPrefix(reqHost, "http") {
-		reqHost = "http://" + reqHost
-	}
-	return
+	return m.reqHost(context.Background(), "rs", bucket)
 }
 
 func (m *BucketManager) ApiReqHost(bucket string) (reqHost string, err error) {
-	var reqErr error
-
-	if m.Cfg.ApiHost == "" {
-		reqHost, reqErr = m.ApiHost(bucket)
-		if reqErr != nil {
-			err = reqErr
-			return
-		}
-	} else {
-		reqHost = m.Cfg.ApiHost
-	}
-	if !strings.HasPrefix(reqHost, "http") {
-		reqHost = "http://" + reqHost
-	}
-	return
+	return m.reqHost(context.Background(), "api", bucket)
 }
 
 func (m *BucketManager) RsfReqHost(bucket string) (reqHost string, err error) {
-	var reqErr error
+	return m.reqHost(context.Background(), "rsf", bucket)
+}
 
-	if m.Cfg.RsfHost == "" {
-		reqHost, reqErr = m.RsfHost(bucket)
-		if reqErr != nil {
-			err = reqErr
-			return
-		}
-	} else {
-		reqHost = m.Cfg.RsfHost
-	}
-	if !strings.HasPrefix(reqHost, "http") {
-		reqHost = "http://" + reqHost
+func (m *BucketManager) IoReqHost(bucket string) (reqHost string, err error) {
+	return m.reqHost(context.Background(), "io", bucket)
+}
+
+// reqHost 返回 typ 类型服务的主请求地址，参考 reqHosts
+func (m *BucketManager) reqHost(ctx context.Context, typ, bucket string) (reqHost string, err error) {
+	hosts, err := m.reqHosts(ctx, typ, bucket)
+	if err != nil {
+		return
 	}
+	reqHost = hosts[0]
 	return
 }
 
-func (m *BucketManager) IoReqHost(bucket string) (reqHost string, err error) {
-	var reqErr error
-
-	if m.Cfg.IoHost == "" {
-		reqHost, reqErr = m.IovipHost(bucket)
-		if reqErr != nil {
-			err = reqErr
+// reqHosts 返回 typ 类型服务的全部请求地址，第一个为主地址，其余的为备用地址
+// Cfg 中设置了该服务的地址时只使用该地址，否则查询空间所在的区域，ctx 用于查询空间区域信息
+func (m *BucketManager) reqHosts(ctx context.Context, typ, bucket string) (hosts []string, err error) {
+	var host string
+	switch typ {
+	case "rs":
+		host = m.Cfg.RsHost
+	case "rsf":
+		host = m.Cfg.RsfHost
+	case "api":
+		host = m.Cfg.ApiHost
+	case "io":
+		host = m.Cfg.IoHost
+	}
+	if host != "" {
+		hosts = []string{host}
+	} else {
+		zone, zErr := m.ZoneContext(ctx, bucket)
+		if zErr != nil {
+			err = zErr
 			return
 		}
-	} else {
-		reqHost = m.Cfg.IoHost
+		switch typ {
+		case "rs":
+			hosts = zone.GetRsHosts(m.Cfg.UseHTTPS)
+		case "rsf":
+			hosts = zone.GetRsfHosts(m.Cfg.UseHTTPS)
+		case "api":
+			hosts = zone.GetApiHosts(m.Cfg.UseHTTPS)
+		case "io":
+			hosts = zone.GetIoHosts(m.Cfg.UseHTTPS)
+		}
 	}
-	if !strings.HasPrefix(reqHost, "http") {
-		reqHost = "http://" + reqHost
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	for i, h := range hosts {
+		hosts[i] = qendpoints.URL(h, m.Cfg.UseHTTPS)
 	}
 	return
 }
 
+// callWithHosts 依次使用 typ 类型服务的每个请求地址调用 call，直到成功或者遇到不应该换地址的错误
+// 地址网络错误或者返回可以重试的错误时使用下一个地址，非幂等的请求只在请求没有被处理时换地址
+func (m *BucketManager) callWithHosts(ctx context.Context, typ, bucket, method string, call func(reqHost string) error) error {
+	hosts, err := m.reqHosts(ctx, typ, bucket)
+	if err != nil {
+		return err
+	}
+	return doWithHosts(ctx, method, hosts, call)
+}
+
 // FetchWithoutKey 根据提供的远程资源链接来抓取一个文件到空间并以文件的内容hash作为文件名
 func (m *BucketManager) FetchWithoutKey(resURL, bucket string) (fetchRet FetchRet, err error) {
-	reqHost, rErr := m.IoReqHost(bucket)
-	if rErr != nil {
-		err = rErr
-		return
-	}
-	reqURL := fmt.Sprintf("%s%s", reqHost, uriFetchWithoutKey(resURL, bucket))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQBox, &fetchRet, "POST", reqURL, nil)
+	return m.FetchWithoutKeyContext(context.Background(), resURL, bucket)
+}
+
+// FetchWithoutKeyContext 和 FetchWithoutKey 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) FetchWithoutKeyContext(ctx context.Context, resURL, bucket string) (fetchRet FetchRet, err error) {
+	err = m.callWithHosts(ctx, "io", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, uriFetchWithoutKey(resURL, bucket))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQBox, &fetchRet, "POST", reqURL, nil)
+	})
 	return
 }
 
@@ -415,70 +522,95 @@ type DomainInfo struct {
 
 // ListBucketDomains 返回绑定在存储空间中的域名信息
 func (m *BucketManager) ListBucketDomains(bucket string) (info []DomainInfo, err error) {
-	reqHost, err := m.ApiReqHost(bucket)
-	if err != nil {
-		return
-	}
-	reqURL := fmt.Sprintf("%s/v7/domain/list?tbl=%s", reqHost, bucket)
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &info, "GET", reqURL, nil)
+	return m.ListBucketDomainsContext(context.Background(), bucket)
+}
+
+// ListBucketDomainsContext 和 ListBucketDomains 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) ListBucketDomainsContext(ctx context.Context, bucket string) (info []DomainInfo, err error) {
+	err = m.callWithHosts(ctx, "api", bucket, "GET", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s/v7/domain/list?tbl=%s", reqHost, bucket)
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &info, "GET", reqURL, nil)
+	})
 	return
 }
 
 // Prefetch 用来同步镜像空间的资源和镜像源资源内容
 func (m *BucketManager) Prefetch(bucket, key string) (err error) {
-	reqHost, reqErr := m.IoReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
-	reqURL := fmt.Sprintf("%s%s", reqHost, uriPrefetch(bucket, key))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.PrefetchContext(context.Background(), bucket, key)
+}
+
+// PrefetchContext 和 Prefetch 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) PrefetchContext(ctx context.Context, bucket, key string) (err error) {
+	err = m.callWithHosts(ctx, "io", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, uriPrefetch(bucket, key))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 	return
 }
 
 // SetImage 用来设置空间镜像源
 func (m *BucketManager) SetImage(siteURL, bucket string) (err error) {
+	return m.SetImageContext(context.Background(), siteURL, bucket)
+}
+
+// SetImageContext 和 SetImage 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) SetImageContext(ctx context.Context, siteURL, bucket string) (err error) {
 	reqURL := fmt.Sprintf("http://%s%s", DefaultPubHost, uriSetImage(siteURL, bucket))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 	return
 }
 
 // SetImageWithHost 用来设置空间镜像源，额外添加回源Host头部
 func (m *BucketManager) SetImageWithHost(siteURL, bucket, host string) (err error) {
+	return m.SetImageWithHostContext(context.Background(), siteURL, bucket, host)
+}
+
+// SetImageWithHostContext 和 SetImageWithHost 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) SetImageWithHostContext(ctx context.Context, siteURL, bucket, host string) (err error) {
 	reqURL := fmt.Sprintf("http://%s%s", DefaultPubHost,
 		uriSetImageWithHost(siteURL, bucket, host))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 	return
 }
 
 // UnsetImage 用来取消空间镜像源设置
 func (m *BucketManager) UnsetImage(bucket string) (err error) {
+	return m.UnsetImageContext(context.Background(), bucket)
+}
+
+// UnsetImageContext 和 UnsetImage 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) UnsetImageContext(ctx context.Context, bucket string) (err error) {
 	reqURL := fmt.Sprintf("http://%s%s", DefaultPubHost, uriUnsetImage(bucket))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 	return err
 }
 
 // ListFiles 用来获取空间文件列表，可以根据需要指定文件的前缀 prefix，文件的目录 delimiter，循环列举的时候下次
 // 列举的位置 marker，以及每次返回的文件的最大数量limit，其中limit最大为1000。
 func (m *BucketManager) ListFiles(bucket, prefix, delimiter, marker string,
+	limit int) (entries []ListItem, commonPrefixes []string, nextMarker string, hasNext bool, err error) {
+	return m.ListFilesContext(context.Background(), bucket, prefix, delimiter, marker, limit)
+}
+
+// ListFilesContext 和 ListFiles 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) ListFilesContext(ctx context.Context, bucket, prefix, delimiter, marker string,
 	limit int) (entries []ListItem, commonPrefixes []string, nextMarker string, hasNext bool, err error) {
 	if limit <= 0 || limit > 1000 {
 		err = errors.New("invalid list limit, only allow [1, 1000]")
 		return
 	}
 
-	reqHost, reqErr := m.RsfReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
-
 	ret := listFilesRet{}
-	reqURL := fmt.Sprintf("%s%s", reqHost, uriListFiles(bucket, prefix, delimiter, marker, limit))
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &ret, "POST", reqURL, nil)
+	ctx, op := telemetry.Start(client.WithIdempotent(ctx, true), telemetry.OpListPage, telemetry.String(telemetry.AttrBucket, bucket))
+	defer func() { op.End(err) }()
+	err = m.callWithHosts(ctx, "rsf", bucket, "POST", func(reqHost string) error {
+		reqURL := fmt.Sprintf("%s%s", reqHost, uriListFiles(bucket, prefix, delimiter, marker, limit))
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &ret, "POST", reqURL, nil)
+	})
 	if err != nil {
 		return
 	}
+	op.SetAttributes(telemetry.Int(telemetry.AttrListCount, len(ret.Items)+len(ret.CommonPrefixes)))
 
 	commonPrefixes = ret.CommonPrefixes
 	nextMarker = ret.Marker
@@ -492,34 +624,21 @@ func (m *BucketManager) ListFiles(bucket, prefix, delimiter, marker string,
 
 // ListBucket 用来获取空间文件列表，可以根据需要指定文件的前缀 prefix，文件的目录 delimiter，流式返回每条数据。
 func (m *BucketManager) ListBucket(bucket, prefix, delimiter, marker string) (retCh chan listFilesRet2, err error) {
-
-	ctx := auth.WithCredentialsType(context.Background(), m.Mac, auth.TokenQiniu)
-	reqHost, reqErr := m.RsfReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
-		return
-	}
-
-	// limit 0 ==> 列举所有文件
-	reqURL := fmt.Sprintf("%s%s", reqHost, uriListFiles2(bucket, prefix, delimiter, marker))
-	retCh, err = callChan(m.Client, ctx, "POST", reqURL, nil)
-	return
+	return m.ListBucketContext(context.Background(), bucket, prefix, delimiter, marker)
 }
 
 // ListBucketContext 用来获取空间文件列表，可以根据需要指定文件的前缀 prefix，文件的目录 delimiter，流式返回每条数据。
 // 接受的context可以用来取消列举操作
 func (m *BucketManager) ListBucketContext(ctx context.Context, bucket, prefix, delimiter, marker string) (retCh chan listFilesRet2, err error) {
 
-	ctx = auth.WithCredentialsType(context.Background(), m.Mac, auth.TokenQiniu)
-	reqHost, reqErr := m.RsfReqHost(bucket)
-	if reqErr != nil {
-		err = reqErr
+	ctx = client.WithIdempotent(auth.WithCredentialsProviderType(ctx, m.credentials(), auth.TokenQiniu), true)
+	// 只在开始列举前切换地址，开始接收数据后出错不再重试
+	err = m.callWithHosts(ctx, "rsf", bucket, "POST", func(reqHost string) (cErr error) {
+		// limit 0 ==> 列举所有文件
+		reqURL := fmt.Sprintf("%s%s", reqHost, uriListFiles2(bucket, prefix, delimiter, marker))
+		retCh, cErr = callChan(m.Client, ctx, "POST", reqURL, nil)
 		return
-	}
-
-	// limit 0 ==> 列举所有文件
-	reqURL := fmt.Sprintf("%s%s", reqHost, uriListFiles2(bucket, prefix, delimiter, marker))
-	retCh, err = callChan(m.Client, ctx, "POST", reqURL, nil)
+	})
 	return
 }
 
@@ -542,15 +661,16 @@ type AsyncFetchRet struct {
 }
 
 func (m *BucketManager) AsyncFetch(param AsyncFetchParam) (ret AsyncFetchRet, err error) {
+	return m.AsyncFetchContext(context.Background(), param)
+}
 
-	reqUrl, err := m.ApiReqHost(param.Bucket)
-	if err != nil {
-		return
-	}
-
-	reqUrl += "/sisyphus/fetch"
+// AsyncFetchContext 和 AsyncFetch 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) AsyncFetchContext(ctx context.Context, param AsyncFetchParam) (ret AsyncFetchRet, err error) {
 
-	err = m.Client.CredentialedCallWithJson(context.Background(), m.Mac, auth.TokenQiniu, &ret, "POST", reqUrl, nil, param)
+	err = m.callWithHosts(ctx, "api", param.Bucket, "POST", func(reqHost string) error {
+		reqUrl := reqHost + "/sisyphus/fetch"
+		return m.Client.CredentialedCallWithJson(ctx, m.credentials(), auth.TokenQiniu, &ret, "POST", reqUrl, nil, param)
+	})
 	return
 }
 
@@ -595,13 +715,23 @@ func (m *BucketManager) ApiHost(bucket string) (apiHost string, err error) {
 }
 
 func (m *BucketManager) Zone(bucket string) (z *Zone, err error) {
+	return m.ZoneContext(context.Background(), bucket)
+}
+
+// ZoneContext 和 Zone 相同，查询空间区域信息时使用 ctx 和 m.Client，
+// 查询请求可以被取消，并经过 m.Client 的中间件和重试策略
+func (m *BucketManager) ZoneContext(ctx context.Context, bucket string) (z *Zone, err error) {
 
 	if m.Cfg.Zone != nil {
 		z = m.Cfg.Zone
 		return
 	}
 
-	z, err = GetZone(m.Mac.AccessKey, bucket)
+	ak, err := m.accessKey()
+	if err != nil {
+		return
+	}
+	z, err = getRegionByConfig(ctx, m.Cfg, m.Client, ak, bucket)
 	return
 }
 
@@ -795,16 +925,17 @@ func callChan(r *client.Client, ctx context.Context, method, reqUrl string, head
 	if resp.StatusCode/100 != 2 {
 		return nil, client.ResponseError(resp)
 	}
-	return callRetChan(ctx, resp)
+	return callRetChan(ctx, client.LoggerOf(r), resp)
 }
 
-func callRetChan(ctx context.Context, resp *http.Response) (retCh chan listFilesRet2, err error) {
+func callRetChan(ctx context.Context, logger logging.Logger, resp *http.Response) (retCh chan listFilesRet2, err error) {
 
 	retCh = make(chan listFilesRet2)
 	if resp.StatusCode/100 != 2 {
 		return nil, client.ResponseError(resp)
 	}
 
+	// 解码在函数返回之后进行，不能修改返回值 err
 	go func() {
 		defer resp.Body.Close()
 		defer close(retCh)
@@ -813,10 +944,9 @@ func callRetChan(ctx context.Context, resp *http.Response) (retCh chan listFiles
 		var ret listFilesRet2
 
 		for {
-			err = dec.Decode(&ret)
-			if err != nil {
-				if err != io.EOF {
-					fmt.Fprintf(os.Stderr, "decode error: %v\n", err)
+			if dErr := dec.Decode(&ret); dErr != nil {
+				if dErr != io.EOF {
+					logger.Log(ctx, logging.LevelWarn, "decode list result failed", logging.Err(dErr))
 				}
 				return
 			}
@@ -12,6 +12,7 @@ import (
 	"github.com/qiniu/api.v7/v7/auth"
 	"github.com/qiniu/api.v7/v7/auth/qbox"
 	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/client/httpreplay"
 )
 
 var (
@@ -43,6 +44,13 @@ var (
 )
 
 func init() {
+	// 回放 golden 文件时不需要真实的帐号和空间
+	if testAK == "" || testSK == "" {
+		testAK, testSK = "ak", "sk"
+	}
+	if testBucket == "" {
+		testBucket = "gosdk-test"
+	}
 	if testDebug == "true" {
 		client.TurnOnDebug()
 	}
@@ -64,9 +72,21 @@ func init() {
 	rand.Seed(time.Now().Unix())
 }
 
+// newReplayBucketManager 返回从 testdata/<name>.json 回放请求的 BucketManager，
+// testdata 中的 golden 文件是按照接口文档构造的示例数据，不是真实服务的录制，
+// 设置 QINIU_HTTP_REPLAY=record 以及 accessKey，secretKey 和 QINIU_TEST_BUCKET 环境变量可以录制真实的回复替换它们
+func newReplayBucketManager(t *testing.T, name string, cfg *Config) *BucketManager {
+	rt := httpreplay.NewForTest(t, name, os.Getenv("accessKey"), os.Getenv("secretKey"))
+	if cfg == nil {
+		cfg = &Config{Zone: &Zone_z0, UseCdnDomains: true}
+	}
+	return NewBucketManagerEx(mac, cfg, rt.Client())
+}
+
 //Test get zone
 func TestGetZone(t *testing.T) {
-	zone, err := GetZone(testAK, testBucket)
+	bucketManager := newReplayBucketManager(t, "get_zone", &Config{RegionCache: NewMemoryRegionCache()})
+	zone, err := bucketManager.Zone(testBucket)
 	if err != nil {
 		t.Fatalf("GetZone() error, %s", err)
 	}
@@ -75,6 +95,7 @@ func TestGetZone(t *testing.T) {
 
 // TestCreate 测试创建空间的功能
 func TestCreate(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "create", nil)
 	const bucketName = "gosdk-test111111111"
 	bucketManager.DropBucket(bucketName)
 	err := bucketManager.CreateBucket(bucketName, RIDHuadong)
@@ -86,6 +107,7 @@ func TestCreate(t *testing.T) {
 
 // TestUpdateObjectStatus 测试更新文件状态的功能
 func TestUpdateObjectStatus(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "update_object_status", nil)
 	keysToStat := []string{"qiniu.png"}
 
 	for _, eachKey := range keysToStat {
@@ -106,6 +128,7 @@ func TestUpdateObjectStatus(t *testing.T) {
 
 //Test get bucket list
 func TestBuckets(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "buckets", nil)
 	shared := true
 	buckets, err := bucketManager.Buckets(shared)
 	if err != nil {
@@ -119,6 +142,7 @@ func TestBuckets(t *testing.T) {
 
 //Test get file info
 func TestStat(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "stat", nil)
 	keysToStat := []string{"qiniu.png"}
 
 	for _, eachKey := range keysToStat {
@@ -133,6 +157,7 @@ func TestStat(t *testing.T) {
 }
 
 func TestCopyMoveDelete(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "copy_move_delete", nil)
 	keysCopyTarget := []string{"qiniu_1.png", "qiniu_2.png", "qiniu_3.png"}
 	keysToDelete := make([]string, 0, len(keysCopyTarget))
 	for _, eachKey := range keysCopyTarget {
@@ -164,6 +189,7 @@ func TestCopyMoveDelete(t *testing.T) {
 }
 
 func TestFetch(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "fetch", nil)
 	ret, err := bucketManager.Fetch(testFetchUrl, testBucket, "qiniu-fetch.png")
 	if err != nil {
 		t.Logf("Fetch() error, %s", err)
@@ -174,6 +200,7 @@ func TestFetch(t *testing.T) {
 }
 
 func TestAsyncFetch(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "async_fetch", nil)
 
 	param := AsyncFetchParam{Url: testFetchUrl, Bucket: testBucket}
 	ret, err := bucketManager.AsyncFetch(param)
@@ -186,6 +213,7 @@ func TestAsyncFetch(t *testing.T) {
 }
 
 func TestFetchWithoutKey(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "fetch_without_key", nil)
 	ret, err := bucketManager.FetchWithoutKey(testFetchUrl, testBucket)
 	if err != nil {
 		t.Logf("FetchWithoutKey() error, %s", err)
@@ -196,6 +224,7 @@ func TestFetchWithoutKey(t *testing.T) {
 }
 
 func TestDeleteAfterDays(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "delete_after_days", nil)
 	deleteKey := testKey + "_deleteAfterDays"
 	days := 7
 	bucketManager.Copy(testBucket, testKey, testBucket, deleteKey, true)
@@ -207,6 +236,7 @@ func TestDeleteAfterDays(t *testing.T) {
 }
 
 func TestChangeMime(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "change_mime", nil)
 	toChangeKey := testKey + "_changeMime"
 	bucketManager.Copy(testBucket, testKey, testBucket, toChangeKey, true)
 	newMime := "text/plain"
@@ -223,7 +253,8 @@ func TestChangeMime(t *testing.T) {
 }
 
 func TestChangeType(t *testing.T) {
-	toChangeKey := fmt.Sprintf("%s_changeType_%d", testKey, rand.Int())
+	bucketManager := newReplayBucketManager(t, "change_type", nil)
+	toChangeKey := testKey + "_changeType"
 	bucketManager.Copy(testBucket, testKey, testBucket, toChangeKey, true)
 	fileType := 1
 	err := bucketManager.ChangeType(testBucket, toChangeKey, fileType)
@@ -239,7 +270,8 @@ func TestChangeType(t *testing.T) {
 }
 
 func TestRestoreAr(t *testing.T) {
-	toRestoreArKey := fmt.Sprintf("%s_RestoreAr_%d", testKey, rand.Int())
+	bucketManager := newReplayBucketManager(t, "restore_ar", nil)
+	toRestoreArKey := testKey + "_RestoreAr"
 	bucketManager.Copy(testBucket, testKey, testBucket, toRestoreArKey, true)
 	fileType := 2
 	err := bucketManager.ChangeType(testBucket, toRestoreArKey, fileType)
@@ -287,6 +319,7 @@ func TestPrefetchAndImage(t *testing.T) {
 */
 
 func TestListFiles(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "list_files", nil)
 	limit := 100
 	prefix := "listfiles/"
 	for i := 0; i < limit; i++ {
@@ -331,6 +364,7 @@ func TestMakePrivateUrl(t *testing.T) {
 */
 
 func TestBatch(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "batch", nil)
 	copyCnt := 100
 	copyOps := make([]string, 0, copyCnt)
 	testKeys := make([]string, 0, copyCnt)
@@ -358,6 +392,7 @@ func TestBatch(t *testing.T) {
 }
 
 func TestBatchPartialFailure(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "batch_partial_failure", nil)
 	copyOps := make([]string, 0, 2)
 	cpKey := fmt.Sprintf("%s_batchcopy_%d", testKey, 0)
 	copyOps = append(copyOps, URICopy(testBucket, testKey, testBucket, cpKey, true))
@@ -380,6 +415,7 @@ func TestBatchPartialFailure(t *testing.T) {
 }
 
 func TestListBucket(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "list_bucket", nil)
 	retChan, lErr := bucketManager.ListBucket(testBucket, "", "", "")
 	if lErr != nil {
 		t.Fatalf("ListBucket: %v\n", lErr)
@@ -390,6 +426,7 @@ func TestListBucket(t *testing.T) {
 }
 
 func TestGetBucketInfo(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "get_bucket_info", nil)
 	bInfo, bErr := bucketManager.GetBucketInfo(testBucket)
 	if bErr != nil {
 		t.Fatalf("GetBucketInfo: %v\n", bErr)
@@ -398,6 +435,7 @@ func TestGetBucketInfo(t *testing.T) {
 }
 
 func TestBucketInfosInRegion(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "bucket_infos_in_region", nil)
 	bInfos, bErr := bucketManager.BucketInfosInRegion(RIDHuadong, true)
 	if bErr != nil {
 		t.Fatalf("BucketInfosInRegion: %v\n", bErr)
@@ -408,6 +446,7 @@ func TestBucketInfosInRegion(t *testing.T) {
 }
 
 func TestRefererAntiLeechMode(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "referer_anti_leech_mode", nil)
 	cfgs := []*ReferAntiLeechConfig{
 		&ReferAntiLeechConfig{
 			Mode: 0, // 关闭referer防盗链
@@ -441,6 +480,7 @@ func TestRefererAntiLeechMode(t *testing.T) {
 }
 
 func TestBucketLifeCycleRule(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "bucket_life_cycle_rule", nil)
 	err := bucketManager.AddBucketLifeCycleRule(testBucket, &BucketLifeCycleRule{
 		Name:            "golangIntegrationTest",
 		Prefix:          "testPutFileKey",
@@ -483,6 +523,7 @@ func TestBucketLifeCycleRule(t *testing.T) {
 }
 
 func TestBucketEventRule(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "bucket_event_rule", nil)
 	err := bucketManager.AddBucketEvent(testBucket, &BucketEventRule{
 		Name:        "golangIntegrationTest",
 		Event:       []string{"put", "mkfile"},
@@ -525,6 +566,7 @@ func TestBucketEventRule(t *testing.T) {
 }
 
 func TestCorsRules(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "cors_rules", nil)
 	err := bucketManager.AddCorsRules(testBucket, []CorsRule{
 		CorsRule{
 			AllowedOrigin: []string{"http://www.test1.com"},
@@ -545,6 +587,7 @@ func TestCorsRules(t *testing.T) {
 }
 
 func TestListBucketDomains(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "list_bucket_domains", nil)
 	bInfos, err := bucketManager.ListBucketDomains(testBucket)
 	if err != nil {
 		/*
@@ -560,6 +603,7 @@ func TestListBucketDomains(t *testing.T) {
 }
 
 func TestBucketQuota(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "bucket_quota", nil)
 	err := bucketManager.SetBucketQuota(testBucket, 0, 1000000000000000)
 	if err != nil {
 		t.Fatalf("TestBucketQuota: %q\n", err)
@@ -572,6 +616,7 @@ func TestBucketQuota(t *testing.T) {
 }
 
 func TestSetBucketAccessStyle(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "set_bucket_access_style", nil)
 	err := bucketManager.TurnOnBucketProtected(testBucket)
 	if err != nil {
 		t.Fatalf("TestSetBucketAccessStyle: %q\n", err)
@@ -583,6 +628,7 @@ func TestSetBucketAccessStyle(t *testing.T) {
 }
 
 func TestSetBucketMaxAge(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "set_bucket_max_age", nil)
 	err := bucketManager.SetBucketMaxAge(testBucket, 20)
 	if err != nil {
 		t.Fatalf("TestSetBucketMaxAge: %q\n", err)
@@ -594,6 +640,7 @@ func TestSetBucketMaxAge(t *testing.T) {
 }
 
 func TestSetBucketAccessMode(t *testing.T) {
+	bucketManager := newReplayBucketManager(t, "set_bucket_access_mode", nil)
 	err := bucketManager.MakeBucketPrivate(testBucket)
 	if err != nil {
 		t.Fatalf("TestSetBucketAccessMode: %q\n", err)
@@ -1,5 +1,9 @@
 package storage
 
+import (
+	qendpoints "github.com/qiniu/api.v7/v7/endpoints"
+)
+
 // Config 为文件上传，资源管理等配置
 type Config struct {
 	//兼容保留
@@ -13,6 +17,15 @@ type Config struct {
 	UseCdnDomains bool   //是否使用cdn加速域名
 	CentralRsHost string //中心机房的RsHost，用于list bucket
 
+	// 查询空间区域信息时使用的缓存，为nil时使用默认缓存，参考 DefaultRegionCache
+	RegionCache RegionCache
+
+	// 区域信息缓存的事件回调，可以用来统计缓存命中情况，可以为nil
+	RegionCacheHook RegionCacheHook
+
+	// 查询空间区域信息的UC服务地址列表，依次尝试，为空时使用 DefaultUcHosts
+	UcHosts []string
+
 	// 兼容保留
 	RsHost  string
 	RsfHost string
@@ -83,3 +96,46 @@ func (c *Config) ApiReqHost() string {
 	rzHost := c.hostFromRegion("api")
 	return reqHost(c.UseHTTPS, rzHost, c.ApiHost, DefaultAPIHost)
 }
+
+// ApplyProfile 使用 p 中对象存储相关的服务地址，p 中为空的地址保持不变
+// 地址中指定的协议会被保留，没有指定协议的地址根据 UseHTTPS 决定协议，p 中没有设置 UseHTTPS 时保持原有的设置
+// p 中设置了上传地址时会同时设置 Region，不再向UC服务查询空间所在的区域
+func (c *Config) ApplyProfile(p *qendpoints.Profile) {
+	if p == nil {
+		return
+	}
+	if p.UseHTTPS != nil {
+		c.UseHTTPS = *p.UseHTTPS
+	}
+	if len(p.UcHosts) > 0 {
+		c.UcHosts = append([]string(nil), p.UcHosts...)
+	}
+	if p.RsHost != "" {
+		c.RsHost = qendpoints.URL(p.RsHost, c.UseHTTPS)
+		c.CentralRsHost = c.RsHost
+	}
+	if p.RsfHost != "" {
+		c.RsfHost = qendpoints.URL(p.RsfHost, c.UseHTTPS)
+	}
+	if p.ApiHost != "" {
+		c.ApiHost = qendpoints.URL(p.ApiHost, c.UseHTTPS)
+	}
+	if p.IoHost != "" {
+		c.IoHost = qendpoints.URL(p.IoHost, c.UseHTTPS)
+	}
+	if len(p.UpHosts) > 0 {
+		upHosts := make([]string, 0, len(p.UpHosts))
+		for _, host := range p.UpHosts {
+			upHosts = append(upHosts, qendpoints.URL(host, c.UseHTTPS))
+		}
+		c.Region = &Region{
+			SrcUpHosts: upHosts,
+			CdnUpHosts: upHosts,
+			RsHost:     c.RsHost,
+			RsfHost:    c.RsfHost,
+			ApiHost:    c.ApiHost,
+			IovipHost:  c.IoHost,
+		}
+		c.Zone = c.Region
+	}
+}
@@ -1,7 +1,14 @@
 package storage
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
+	qendpoints "github.com/qiniu/api.v7/v7/endpoints"
 )
 
 func TestReqHost(t *testing.T) {
@@ -32,14 +39,15 @@ func TestReqHost(t *testing.T) {
 		{UseHTTPS: false, Zone: &zoneHuadong, RsHost: "http://rshost.com"},
 		{UseHTTPS: false, Region: &zoneHuadong, RsHost: "http://rshost.com"},
 	}
+	// 地址中指定的协议优先于 UseHTTPS
 	wantRsHosts := []string{
 		"https://rs.qbox.me",
-		"https://rshost.com",
+		"http://rshost.com",
 		"https://rshost.com",
 		"https://rs.qbox.me",
 		"http://rs.qbox.me",
 		"http://rshost.com",
-		"http://rshost.com",
+		"https://rshost.com",
 		"http://rs.qbox.me",
 		"http://rs.qbox.me",
 	}
@@ -52,3 +60,85 @@ func TestReqHost(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyProfile(t *testing.T) {
+	useHTTPS := true
+	cfg := Config{}
+	cfg.ApplyProfile(&qendpoints.Profile{
+		UcHosts:  []string{"https://uc.example.com"},
+		RsHost:   "https://rs.example.com",
+		RsfHost:  "rsf.example.com",
+		UpHosts:  []string{"up.example.com"},
+		UseHTTPS: &useHTTPS,
+	})
+	if got := cfg.RsReqHost(); got != "https://rs.example.com" {
+		t.Errorf("RsReqHost() = %s", got)
+	}
+	if got := cfg.RsfReqHost(); got != "https://rsf.example.com" {
+		t.Errorf("RsfReqHost() = %s", got)
+	}
+	if got := cfg.ApiReqHost(); got != "https://"+DefaultAPIHost {
+		t.Errorf("ApiReqHost() = %s", got)
+	}
+	if cfg.CentralRsHost != "https://rs.example.com" || cfg.Region == nil || cfg.Region.SrcUpHosts[0] != "https://up.example.com" {
+		t.Errorf("ApplyProfile() got %+v", cfg)
+	}
+	m := NewBucketManager(nil, &cfg)
+	if got := m.ucHost(); got != "https://uc.example.com" {
+		t.Errorf("ucHost() = %s", got)
+	}
+	if got := NewBucketManager(nil, nil).ucHost(); got != UcHost {
+		t.Errorf("default ucHost() = %s", got)
+	}
+
+	// 没有设置 UseHTTPS 时保持原有设置，地址中的协议不变
+	cfg = Config{UseHTTPS: true}
+	cfg.ApplyProfile(&qendpoints.Profile{RsHost: "http://rs.example.com", RsfHost: "rsf.example.com"})
+	if !cfg.UseHTTPS {
+		t.Errorf("ApplyProfile() without use_https reset UseHTTPS")
+	}
+	cfg.UseHTTPS = false
+	cfg.ApplyProfile(&qendpoints.Profile{RsHost: "https://rs.example.com"})
+	m = NewBucketManager(nil, &cfg)
+	if got, err := m.reqHost(context.Background(), "rs", "bucket"); err != nil || got != "https://rs.example.com" {
+		t.Errorf("reqHost(rs) = %s, %v", got, err)
+	}
+	if got, err := m.reqHost(context.Background(), "rsf", "bucket"); err != nil || got != "https://rsf.example.com" {
+		t.Errorf("reqHost(rsf) = %s, %v", got, err)
+	}
+}
+
+func TestApplyProfileKeepsHTTPSWithoutUseHTTPS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`["bucket"]`))
+	}))
+	defer srv.Close()
+
+	// 没有设置 use_https 时，地址中的 https 不能被改成 http
+	cfg := Config{}
+	cfg.ApplyProfile(&qendpoints.Profile{
+		RsHost:  srv.URL,
+		RsfHost: "https://rsf.example.com",
+		UpHosts: []string{"https://up.example.com"},
+	})
+	if cfg.UseHTTPS {
+		t.Fatalf("ApplyProfile() should not set UseHTTPS")
+	}
+	if got := cfg.RsReqHost(); got != srv.URL {
+		t.Errorf("RsReqHost() = %s", got)
+	}
+	if got := cfg.RsfReqHost(); got != "https://rsf.example.com" {
+		t.Errorf("RsfReqHost() = %s", got)
+	}
+	cfg.Region = nil
+	cfg.Zone = nil
+	if got := cfg.RsReqHost(); got != srv.URL {
+		t.Errorf("RsReqHost() without region = %s", got)
+	}
+
+	m := NewBucketManagerEx(auth.New("ak", "sk"), &cfg, &client.Client{Client: srv.Client()})
+	if buckets, err := m.Buckets(false); err != nil || len(buckets) != 1 {
+		t.Errorf("Buckets() = %v, %v", buckets, err)
+	}
+}
@@ -161,15 +161,55 @@ func (p *FormUploader) put(
 	ctx context.Context, ret interface{}, uptoken string,
 	key string, hasKey bool, data io.Reader, size int64, extra *PutExtra, fileName string) (err error) {
 
-	var upHost string
+	ctx, op := startUpload(ctx, uptoken, key, hasKey, "form")
+	defer func() { op.End(err) }()
+
+	var upHosts []string
 	if extra == nil {
 		extra = &PutExtra{}
 	}
 	if extra.UpHost != "" {
-		upHost = extra.UpHost
-	} else if upHost, err = p.getUpHostFromUploadToken(uptoken); err != nil {
+		upHosts = []string{extra.UpHost}
+	} else if upHosts, err = p.getUpHostsFromUploadToken(ctx, uptoken); err != nil {
+		return
+	}
+
+	// 只有可以重新读取文件内容时才能换域名重新上传
+	seeker, seekable := data.(io.Seeker)
+	var offset int64
+	if seekable {
+		if offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seekable, err = false, nil
+		}
+	}
+	if !seekable {
+		upHosts = upHosts[:1]
+	}
+
+	// 使用相同的凭证和内容重新上传不会产生不同的结果，当作幂等请求换域名
+	err = doWithHosts(client.WithIdempotent(ctx, true), "POST", upHosts, func(upHost string) error {
+		if seekable {
+			if _, sErr := seeker.Seek(offset, io.SeekStart); sErr != nil {
+				return sErr
+			}
+		}
+		return p.putToHost(ctx, ret, upHost, uptoken, key, hasKey, data, size, extra, fileName)
+	})
+	if err != nil {
 		return
 	}
+	op.AddBytes(size)
+	if extra.OnProgress != nil {
+		extra.OnProgress(size, size)
+	}
+
+	return
+}
+
+// putToHost 使用 upHost 上传一次文件
+func (p *FormUploader) putToHost(
+	ctx context.Context, ret interface{}, upHost, uptoken string,
+	key string, hasKey bool, data io.Reader, size int64, extra *PutExtra, fileName string) (err error) {
 
 	var b bytes.Buffer
 	writer := multipart.NewWriter(&b)
@@ -215,24 +255,16 @@ func (p *FormUploader) put(
 	contentType := writer.FormDataContentType()
 	headers := http.Header{}
 	headers.Add("Content-Type", contentType)
-	err = p.Client.CallWith64(ctx, ret, "POST", upHost, headers, mr, bodyLen)
-	if err != nil {
-		return
-	}
-	if extra.OnProgress != nil {
-		extra.OnProgress(size, size)
-	}
-
-	return
+	return p.Client.CallWith64(ctx, ret, "POST", upHost, headers, mr, bodyLen)
 }
 
-func (p *FormUploader) getUpHostFromUploadToken(upToken string) (upHost string, err error) {
+func (p *FormUploader) getUpHostsFromUploadToken(ctx context.Context, upToken string) (upHosts []string, err error) {
 	var ak, bucket string
 
 	if ak, bucket, err = getAkBucketFromUploadToken(upToken); err != nil {
 		return
 	}
-	upHost, err = p.UpHost(ak, bucket)
+	upHosts, err = getUpHosts(ctx, p.Cfg, p.Client, ak, bucket)
 	return
 }
 
@@ -273,7 +305,7 @@ func (r crc32Reader) length() (length int64) {
 }
 
 func (p *FormUploader) UpHost(ak, bucket string) (upHost string, err error) {
-	return getUpHost(p.Cfg, ak, bucket)
+	return getUpHost(context.Background(), p.Cfg, p.Client, ak, bucket)
 }
 
 type readerWithProgress struct {
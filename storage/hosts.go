@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/qiniu/api.v7/v7/client"
+)
+
+// shouldTryNextHost 返回请求失败后是否应该使用下一个域名
+// 建立连接失败和 573(请求被限流)时请求没有被处理，总是换域名；
+// 其他网络错误和可以重试的错误只在请求幂等时换域名，避免重复执行非幂等的操作，参考 client.IsIdempotent
+func shouldTryNextHost(ctx context.Context, method string, err error) bool {
+	if err == nil || ctx.Err() != nil || !client.IsRetryable(err) {
+		return false
+	}
+	var e *client.ErrorInfo
+	if isDialError(err) || errors.As(err, &e) && e.Code == 573 {
+		return true
+	}
+	return isIdempotent(ctx, method)
+}
+
+// isIdempotent 使用和 client.Client 重试相同的规则判断请求是否幂等
+func isIdempotent(ctx context.Context, method string) bool {
+	req, err := http.NewRequest(method, "/", nil)
+	if err != nil {
+		return false
+	}
+	return client.IsIdempotent(req.WithContext(ctx))
+}
+
+// isDialError 判断是否是建立连接时发生的错误，这时请求还没有发出
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// doWithHosts 依次使用 hosts 中的域名调用 call，直到成功或者遇到不应该换域名的错误
+func doWithHosts(ctx context.Context, method string, hosts []string, call func(host string) error) (err error) {
+	for i, host := range hosts {
+		err = call(host)
+		if i == len(hosts)-1 || !shouldTryNextHost(ctx, method, err) {
+			return
+		}
+	}
+	return
+}
+
+// upHostList 是一次上传使用的上传域名列表，并发上传的分片共享
+// 当前域名请求失败并且应该换域名时，之后的请求(包括分片的重试)使用下一个域名
+type upHostList struct {
+	lock  sync.Mutex
+	hosts []string
+	index int
+}
+
+func newUpHostList(hosts ...string) *upHostList {
+	return &upHostList{hosts: hosts}
+}
+
+// current 返回当前使用的上传域名
+func (l *upHostList) current() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.hosts[l.index]
+}
+
+// failed 记录使用 host 的请求失败，应该换域名并且 host 仍然是当前域名时切换到下一个域名
+func (l *upHostList) failed(ctx context.Context, method, host string, err error) {
+	if !shouldTryNextHost(ctx, method, err) {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.hosts[l.index] == host && l.index < len(l.hosts)-1 {
+		l.index++
+	}
+}
+
+// do 从当前域名开始依次调用 call，直到成功或者遇到不应该换域名的错误
+func (l *upHostList) do(ctx context.Context, method string, call func(host string) error) (err error) {
+	for {
+		host := l.current()
+		if err = call(host); err == nil {
+			return
+		}
+		l.failed(ctx, method, host, err)
+		if l.current() == host {
+			return
+		}
+	}
+}
@@ -14,6 +14,9 @@ type OperationManager struct {
 	Client *client.Client
 	Mac    *auth.Credentials
 	Cfg    *Config
+
+	// 密钥获取方式，设置后优先于 Mac 使用，每个请求都会重新获取密钥
+	CredentialsProvider auth.CredentialsProvider
 }
 
 // NewOperationManager 用来构建一个新的数据处理对象
@@ -46,6 +49,21 @@ func NewOperationManagerEx(mac *auth.Credentials, cfg *Config, clt *client.Clien
 	}
 }
 
+// NewOperationManagerWithProvider 用来构建一个使用 provider 获取密钥的数据处理对象
+func NewOperationManagerWithProvider(provider auth.CredentialsProvider, cfg *Config, clt *client.Client) *OperationManager {
+	m := NewOperationManagerEx(nil, cfg, clt)
+	m.CredentialsProvider = provider
+	return m
+}
+
+// credentials 返回发送请求时使用的密钥获取方式
+func (m *OperationManager) credentials() auth.CredentialsProvider {
+	if m.CredentialsProvider != nil {
+		return m.CredentialsProvider
+	}
+	return m.Mac
+}
+
 // PfopRet 为数据处理请求的回复内容
 type PfopRet struct {
 	PersistentID string `json:"persistentId,omitempty"`
@@ -126,6 +144,12 @@ type FopResult struct {
 //	force		强制执行数据处理
 //
 func (m *OperationManager) Pfop(bucket, key, fops, pipeline, notifyURL string,
+	force bool) (persistentID string, err error) {
+	return m.PfopContext(context.Background(), bucket, key, fops, pipeline, notifyURL, force)
+}
+
+// PfopContext 和 Pfop 相同，ctx 可以用来取消请求和传递 reqid
+func (m *OperationManager) PfopContext(ctx context.Context, bucket, key, fops, pipeline, notifyURL string,
 	force bool) (persistentID string, err error) {
 	pfopParams := map[string][]string{
 		"bucket": []string{bucket},
@@ -145,8 +169,8 @@ func (m *OperationManager) Pfop(bucket, key, fops, pipeline, notifyURL string,
 		pfopParams["force"] = []string{"1"}
 	}
 	var ret PfopRet
-	ctx := auth.WithCredentials(context.TODO(), m.Mac)
-	reqHost, reqErr := m.ApiHost(bucket)
+	ctx = auth.WithCredentialsProvider(ctx, m.credentials())
+	reqHost, reqErr := m.apiHost(ctx, bucket)
 	if reqErr != nil {
 		err = reqErr
 		return
@@ -165,7 +189,11 @@ func (m *OperationManager) Pfop(bucket, key, fops, pipeline, notifyURL string,
 
 // Prefop 持久化处理状态查询
 func (m *OperationManager) Prefop(persistentID string) (ret PrefopRet, err error) {
-	ctx := context.TODO()
+	return m.PrefopContext(context.Background(), persistentID)
+}
+
+// PrefopContext 和 Prefop 相同，ctx 可以用来取消请求和传递 reqid
+func (m *OperationManager) PrefopContext(ctx context.Context, persistentID string) (ret PrefopRet, err error) {
 	reqHost := m.PrefopApiHost(persistentID)
 	reqURL := fmt.Sprintf("%s/status/get/prefop?id=%s", reqHost, persistentID)
 	headers := http.Header{}
@@ -175,11 +203,21 @@ func (m *OperationManager) Prefop(persistentID string) (ret PrefopRet, err error
 }
 
 func (m *OperationManager) ApiHost(bucket string) (apiHost string, err error) {
+	return m.apiHost(context.Background(), bucket)
+}
+
+// apiHost 和 ApiHost 相同，查询空间区域信息时使用 ctx 和 m.Client
+func (m *OperationManager) apiHost(ctx context.Context, bucket string) (apiHost string, err error) {
 	var zone *Zone
 	if m.Cfg.Zone != nil {
 		zone = m.Cfg.Zone
 	} else {
-		if v, zoneErr := GetZone(m.Mac.AccessKey, bucket); zoneErr != nil {
+		cred, credErr := m.credentials().Retrieve()
+		if credErr != nil {
+			err = credErr
+			return
+		}
+		if v, zoneErr := getRegionByConfig(ctx, m.Cfg, m.Client, cred.AccessKey, bucket); zoneErr != nil {
 			err = zoneErr
 			return
 		} else {
@@ -2,17 +2,17 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"net/http"
+	"net/url"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/qiniu/api.v7/v7/auth"
 	"github.com/qiniu/api.v7/v7/client"
-	"golang.org/x/sync/singleflight"
+	qendpoints "github.com/qiniu/api.v7/v7/endpoints"
+	"github.com/qiniu/api.v7/v7/telemetry"
 )
 
 // 存储所在的地区，例如华东，华南，华北
@@ -34,6 +34,13 @@ type Region struct {
 
 	// 存储io 入口
 	IovipHost string `json:"io,omitempty"`
+
+	// 以下为各服务的全部域名，第一个为主域名，其余的为备用域名
+	// 没有设置时只使用上面的主域名
+	RsHosts  []string `json:"rs_hosts,omitempty"`
+	RsfHosts []string `json:"rsf_hosts,omitempty"`
+	ApiHosts []string `json:"api_hosts,omitempty"`
+	IoHosts  []string `json:"io_hosts,omitempty"`
 }
 
 type RegionID string
@@ -54,21 +61,28 @@ func (r *Region) String() string {
 	str += fmt.Sprintf("RsHost: %s\n", r.RsHost)
 	str += fmt.Sprintf("RsfHost: %s\n", r.RsfHost)
 	str += fmt.Sprintf("ApiHost: %s\n", r.ApiHost)
+	if len(r.RsHosts) > 0 {
+		str += fmt.Sprintf("RsHosts: %v\n", r.RsHosts)
+	}
+	if len(r.RsfHosts) > 0 {
+		str += fmt.Sprintf("RsfHosts: %v\n", r.RsfHosts)
+	}
+	if len(r.ApiHosts) > 0 {
+		str += fmt.Sprintf("ApiHosts: %v\n", r.ApiHosts)
+	}
+	if len(r.IoHosts) > 0 {
+		str += fmt.Sprintf("IoHosts: %v\n", r.IoHosts)
+	}
 	return str
 }
 
+// endpoint 返回 host 的地址，host 中指定的协议会被保留，没有指定协议时根据 useHttps 决定协议
 func endpoint(useHttps bool, host string) string {
 	host = strings.TrimSpace(host)
-	host = strings.TrimLeft(host, "http://")
-	host = strings.TrimLeft(host, "https://")
 	if host == "" {
 		return ""
 	}
-	scheme := "http://"
-	if useHttps {
-		scheme = "https://"
-	}
-	return fmt.Sprintf("%s%s", scheme, host)
+	return qendpoints.URL(host, useHttps)
 }
 
 // 获取rsfHost
@@ -91,6 +105,39 @@ func (r *Region) GetApiHost(useHttps bool) string {
 	return endpoint(useHttps, r.ApiHost)
 }
 
+func endpoints(useHttps bool, mainHost string, hosts []string) []string {
+	if len(hosts) == 0 {
+		hosts = []string{mainHost}
+	}
+	ret := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if e := endpoint(useHttps, host); e != "" {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// GetRsHosts 获取全部 rs 域名，第一个为主域名
+func (r *Region) GetRsHosts(useHttps bool) []string {
+	return endpoints(useHttps, r.RsHost, r.RsHosts)
+}
+
+// GetRsfHosts 获取全部 rsf 域名，第一个为主域名
+func (r *Region) GetRsfHosts(useHttps bool) []string {
+	return endpoints(useHttps, r.RsfHost, r.RsfHosts)
+}
+
+// GetApiHosts 获取全部 api 域名，第一个为主域名
+func (r *Region) GetApiHosts(useHttps bool) []string {
+	return endpoints(useHttps, r.ApiHost, r.ApiHosts)
+}
+
+// GetIoHosts 获取全部 io 域名，第一个为主域名
+func (r *Region) GetIoHosts(useHttps bool) []string {
+	return endpoints(useHttps, r.IovipHost, r.IoHosts)
+}
+
 var (
 	// regionHuadong 表示华东机房
 	regionHuadong = Region{
@@ -205,6 +252,14 @@ var regionMap = map[RegionID]Region{
 // UcHost 为查询空间相关域名的API服务地址
 const UcHost = "https://uc.qbox.me"
 
+// DefaultUcHosts 为默认的查询空间相关域名的API服务地址列表
+// 查询时依次尝试，前一个地址网络错误或者服务端错误时使用下一个地址
+var DefaultUcHosts = []string{
+	UcHost,
+	"https://kodo-config.qiniuapi.com",
+	"https://api.qiniu.com",
+}
+
 // UcQueryRet 为查询请求的回复
 type UcQueryRet struct {
 	TTL int                            `json:"ttl"`
@@ -219,143 +274,302 @@ type UcQueryUp struct {
 	Info   string   `json:"info,omitempty"`
 }
 
-type regionCacheValue struct {
-	Region   *Region   `json:"region"`
-	Deadline time.Time `json:"deadline"`
+// UcQueryV4Ret 为 v4 版本查询请求的回复，包含空间所在区域所有服务的域名列表
+type UcQueryV4Ret struct {
+	Hosts []UcQueryV4Region `json:"hosts"`
 }
 
-type regionCacheMap map[string]regionCacheValue
+// UcQueryV4Region 为 v4 版本查询请求回复中一个区域的域名信息
+type UcQueryV4Region struct {
+	RegionID string          `json:"region"`
+	TTL      int             `json:"ttl"`
+	Io       UcQueryV4Server `json:"io"`
+	Up       UcQueryV4Server `json:"up"`
+	Rs       UcQueryV4Server `json:"rs"`
+	Rsf      UcQueryV4Server `json:"rsf"`
+	Api      UcQueryV4Server `json:"api"`
+}
 
-var (
-	regionCachePath     = filepath.Join(os.TempDir(), "qiniu-golang-sdk", "query.cache.json")
-	regionCache         sync.Map
-	regionCacheLock     sync.RWMutex
-	regionCacheSyncLock sync.Mutex
-	regionCacheGroup    singleflight.Group
-	regionCacheLoaded   bool = false
-)
+// UcQueryV4Server 为 v4 版本查询请求回复中一个服务的域名列表
+// Domains 为推荐使用的域名，Old 为兼容保留的域名，可以作为备用域名
+type UcQueryV4Server struct {
+	Domains []string `json:"domains"`
+	Old     []string `json:"old,omitempty"`
+}
 
-func SetRegionCachePath(newPath string) {
-	regionCacheLock.Lock()
-	defer regionCacheLock.Unlock()
+func (s *UcQueryV4Server) hosts() []string {
+	hosts := make([]string, 0, len(s.Domains)+len(s.Old))
+	hosts = append(hosts, s.Domains...)
+	return append(hosts, s.Old...)
+}
 
-	regionCachePath = newPath
-	regionCacheLoaded = false
+// Region 将查询结果转换为 Region，每个服务的第一个域名作为主域名，其余的作为备用域名
+func (r *UcQueryV4Region) Region() (*Region, error) {
+	region := &Region{
+		SrcUpHosts: r.Up.hosts(),
+		CdnUpHosts: r.Up.hosts(),
+		RsHosts:    r.Rs.hosts(),
+		RsfHosts:   r.Rsf.hosts(),
+		ApiHosts:   r.Api.hosts(),
+		IoHosts:    r.Io.hosts(),
+	}
+	if len(region.IoHosts) == 0 {
+		return nil, fmt.Errorf("empty io host list")
+	}
+	if len(region.SrcUpHosts) == 0 {
+		return nil, fmt.Errorf("empty up host list")
+	}
+	region.IovipHost = region.IoHosts[0]
+	region.RsHost = firstOrDefault(region.RsHosts, DefaultRsHost)
+	region.RsfHost = firstOrDefault(region.RsfHosts, DefaultRsfHost)
+	region.ApiHost = firstOrDefault(region.ApiHosts, DefaultAPIHost)
+	return region, nil
 }
 
-func loadRegionCache() {
-	cacheFile, err := os.Open(regionCachePath)
-	if err != nil {
-		return
+func firstOrDefault(hosts []string, defaultHost string) string {
+	if len(hosts) > 0 {
+		return hosts[0]
 	}
-	defer cacheFile.Close()
+	return defaultHost
+}
 
-	var cacheMap regionCacheMap
-	if err = json.NewDecoder(cacheFile).Decode(&cacheMap); err != nil {
-		return
+// GetRegion 用来根据ak和bucket来获取空间相关的机房信息
+// 查询结果保存在默认的区域信息缓存中，参考 SetDefaultRegionCache
+func GetRegion(ak, bucket string) (*Region, error) {
+	return newRegionResolver(nil, nil).resolve(context.Background(), ak, bucket)
+}
+
+// getRegionByConfig 使用 cfg 中设置的区域信息缓存和UC服务地址查询空间相关的机房信息
+// 查询请求使用 clt 发送，clt 为nil时使用 client.DefaultClient
+func getRegionByConfig(ctx context.Context, cfg *Config, clt *client.Client, ak, bucket string) (*Region, error) {
+	return newRegionResolver(cfg, clt).resolve(ctx, ak, bucket)
+}
+
+// regionResolver 负责查询空间相关的机房信息，并维护缓存
+type regionResolver struct {
+	cache   RegionCache
+	hook    RegionCacheHook
+	ucHosts []string
+	client  *client.Client
+}
+
+func newRegionResolver(cfg *Config, clt *client.Client) *regionResolver {
+	r := &regionResolver{client: clt}
+	if cfg != nil {
+		r.cache = cfg.RegionCache
+		r.hook = cfg.RegionCacheHook
+		r.ucHosts = cfg.UcHosts
+	}
+	if r.cache == nil {
+		r.cache = DefaultRegionCache()
 	}
-	for cacheKey, cacheValue := range cacheMap {
-		regionCache.Store(cacheKey, cacheValue)
+	if r.hook == nil {
+		r.hook = func(RegionCacheEvent, string) {}
 	}
+	if len(r.ucHosts) == 0 {
+		r.ucHosts = DefaultUcHosts
+	}
+	if r.client == nil {
+		r.client = &client.DefaultClient
+	}
+	return r
 }
 
-func storeRegionCache() {
-	err := os.MkdirAll(filepath.Dir(regionCachePath), 0700)
-	if err != nil {
-		return
+// cacheKey 返回区域信息缓存的 key，包含UC服务地址，公有云和私有云使用相同的 AK 时不会互相覆盖
+func (r *regionResolver) cacheKey(ak, bucket string) string {
+	return fmt.Sprintf("%s:%s:%s", ak, bucket, strings.Join(r.ucHosts, ","))
+}
+
+func (r *regionResolver) resolve(ctx context.Context, ak, bucket string) (*Region, error) {
+	cacheKey := r.cacheKey(ak, bucket)
+	if v, ok := r.cache.Load(cacheKey); ok && v.Region != nil {
+		now := time.Now()
+		switch {
+		case now.Before(v.Deadline.Add(-RegionCacheRefreshAhead)):
+			r.hook(RegionCacheHit, cacheKey)
+			return v.Region, nil
+		case now.Before(v.Deadline.Add(RegionCacheMaxStale)):
+			// 即将过期或者已经过期不久的缓存先直接使用，同时在后台刷新
+			r.hook(RegionCacheStale, cacheKey)
+			r.refreshInBackground(detachedContext{ctx}, cacheKey, ak, bucket)
+			return v.Region, nil
+		}
 	}
 
-	cacheFile, err := os.OpenFile(regionCachePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-	if err != nil {
-		return
+	r.hook(RegionCacheMiss, cacheKey)
+	for {
+		// 同一个 cacheKey 的查询请求由第一个调用方发起，其他调用方等待并共享结果
+		ch := regionCacheGroup.DoChan(cacheKey, func() (interface{}, error) {
+			return r.queryForCache(ctx, cacheKey, ak, bucket)
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case ret := <-ch:
+			if ret.Err != nil {
+				// 发起查询的调用方取消了请求，当前调用方没有取消时重新查询
+				if isContextError(ret.Err) && ctx.Err() == nil {
+					continue
+				}
+				return nil, ret.Err
+			}
+			value := ret.Val.(RegionCacheValue)
+			r.store(cacheKey, value)
+			return value.Region, nil
+		}
 	}
-	defer cacheFile.Close()
+}
 
-	cacheMap := make(regionCacheMap)
-	regionCache.Range(func(cacheKey, cacheValue interface{}) bool {
-		cacheMap[cacheKey.(string)] = cacheValue.(regionCacheValue)
-		return true
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// detachedContext 保留 parent 中的值(比如 reqid 和 telemetry 的父 span)，但不继承 parent 的取消和超时，
+// 用于调用方返回后仍然需要继续的后台请求
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (r *regionResolver) refreshInBackground(ctx context.Context, cacheKey, ak, bucket string) {
+	// DoChan 保证同一个 cacheKey 同时只有一个查询请求
+	ch := regionCacheGroup.DoChan(cacheKey, func() (interface{}, error) {
+		return r.queryForCache(ctx, cacheKey, ak, bucket)
 	})
-	if err = json.NewEncoder(cacheFile).Encode(cacheMap); err != nil {
-		return
-	}
+	go func() {
+		ret := <-ch
+		if ret.Err == nil {
+			r.store(cacheKey, ret.Val.(RegionCacheValue))
+		}
+	}()
 }
 
-// GetRegion 用来根据ak和bucket来获取空间相关的机房信息
-func GetRegion(ak, bucket string) (*Region, error) {
-	regionCacheLock.RLock()
-	if regionCacheLoaded {
-		regionCacheLock.RUnlock()
-	} else {
-		regionCacheLock.RUnlock()
-		func() {
-			regionCacheLock.Lock()
-			defer regionCacheLock.Unlock()
-
-			if !regionCacheLoaded {
-				loadRegionCache()
-				regionCacheLoaded = true
-			}
-		}()
+func (r *regionResolver) queryForCache(ctx context.Context, cacheKey, ak, bucket string) (RegionCacheValue, error) {
+	region, ttl, err := r.query(ctx, ak, bucket)
+	if err != nil {
+		r.hook(RegionCacheRefreshError, cacheKey)
+		return RegionCacheValue{}, err
 	}
+	r.hook(RegionCacheRefreshed, cacheKey)
+	return RegionCacheValue{
+		Region:   region,
+		Deadline: time.Now().Add(ttl),
+	}, nil
+}
 
-	regionID := fmt.Sprintf("%s:%s", ak, bucket)
-	//check from cache
-	if v, ok := regionCache.Load(regionID); ok && time.Now().Before(v.(regionCacheValue).Deadline) {
-		return v.(regionCacheValue).Region, nil
+// store 保存查询结果，同一个查询结果可能被多个调用方共享，已经保存过的不再重复保存
+func (r *regionResolver) store(cacheKey string, value RegionCacheValue) {
+	if old, ok := r.cache.Load(cacheKey); ok && !old.Deadline.Before(value.Deadline) {
+		return
 	}
+	r.cache.Store(cacheKey, value)
+}
 
-	newRegion, err, _ := regionCacheGroup.Do(regionID, func() (interface{}, error) {
-		reqURL := fmt.Sprintf("%s/v2/query?ak=%s&bucket=%s", UcHost, ak, bucket)
-
-		var ret UcQueryRet
-		err := client.DefaultClient.CallWithForm(context.Background(), &ret, "GET", reqURL, nil, nil)
-		if err != nil {
-			return nil, fmt.Errorf("query region error, %s", err.Error())
-		}
+// query 依次向每个UC服务地址查询空间相关的机房信息
+// 优先使用 v4 接口，UC服务不支持 v4 接口时(比如较老的私有云部署)使用 v2 接口
+func (r *regionResolver) query(ctx context.Context, ak, bucket string) (region *Region, ttl time.Duration, err error) {
+	ctx, op := telemetry.Start(ctx, telemetry.OpRegionQuery, telemetry.String(telemetry.AttrBucket, bucket))
+	defer func() { op.End(err) }()
 
-		if len(ret.Io["src"]["main"]) <= 0 {
-			return nil, fmt.Errorf("empty io host list")
+	for _, ucHost := range r.ucHosts {
+		ucHost = strings.TrimRight(ucHost, "/")
+		if !strings.HasPrefix(ucHost, "http") {
+			ucHost = "https://" + ucHost
 		}
 
-		ioHost := ret.Io["src"]["main"][0]
-		srcUpHosts := ret.Up["src"].Main
-		if ret.Up["src"].Backup != nil {
-			srcUpHosts = append(srcUpHosts, ret.Up["src"].Backup...)
+		region, ttl, err = queryRegionV4(ctx, r.client, ucHost, ak, bucket)
+		if isUcQueryUnsupported(err) {
+			region, ttl, err = queryRegionV2(ctx, r.client, ucHost, ak, bucket)
 		}
-		cdnUpHosts := ret.Up["acc"].Main
-		if ret.Up["acc"].Backup != nil {
-			cdnUpHosts = append(cdnUpHosts, ret.Up["acc"].Backup...)
+		if err == nil || !shouldTryNextUcHost(err) || ctx.Err() != nil {
+			break
 		}
+	}
+	if err != nil {
+		err = fmt.Errorf("query region error, %w", err)
+	}
+	return
+}
 
-		region := &Region{
-			SrcUpHosts: srcUpHosts,
-			CdnUpHosts: cdnUpHosts,
-			IovipHost:  ioHost,
-			RsHost:     DefaultRsHost,
-			RsfHost:    DefaultRsfHost,
-			ApiHost:    DefaultAPIHost,
-		}
+// isUcQueryUnsupported 返回UC服务是否不支持该查询接口
+func isUcQueryUnsupported(err error) bool {
+	if e, ok := err.(*client.ErrorInfo); ok {
+		return e.Code == http.StatusNotFound || e.Code == http.StatusMethodNotAllowed
+	}
+	return false
+}
 
-		//set specific hosts if possible
-		setSpecificHosts(ioHost, region)
-		regionCache.Store(regionID, regionCacheValue{
-			Region:   region,
-			Deadline: time.Now().Add(time.Duration(ret.TTL) * time.Second),
-		})
+// shouldTryNextUcHost 返回查询失败后是否应该尝试下一个UC服务地址
+// 网络错误和服务端错误换一个地址重试，其他错误(比如空间不存在)直接返回
+func shouldTryNextUcHost(err error) bool {
+	if e, ok := err.(*client.ErrorInfo); ok {
+		return e.Code/100 == 5 || isUcQueryUnsupported(err)
+	}
+	return true
+}
 
-		regionCacheSyncLock.Lock()
-		defer regionCacheSyncLock.Unlock()
+func queryRegionV4(ctx context.Context, clt *client.Client, ucHost, ak, bucket string) (region *Region, ttl time.Duration, err error) {
+	reqURL := fmt.Sprintf("%s/v4/query?ak=%s&bucket=%s", ucHost, url.QueryEscape(ak), url.QueryEscape(bucket))
 
-		storeRegionCache()
-		return region, nil
-	})
+	var ret UcQueryV4Ret
+	err = clt.CallWithForm(ctx, &ret, "GET", reqURL, nil, nil)
+	if err != nil {
+		return
+	}
+	if len(ret.Hosts) == 0 {
+		err = fmt.Errorf("empty region host list")
+		return
+	}
 
+	region, err = ret.Hosts[0].Region()
 	if err != nil {
-		return nil, err
-	} else {
-		return newRegion.(*Region), nil
+		return
 	}
+	ttl = time.Duration(ret.Hosts[0].TTL) * time.Second
+	return
+}
+
+func queryRegionV2(ctx context.Context, clt *client.Client, ucHost, ak, bucket string) (region *Region, ttl time.Duration, err error) {
+	reqURL := fmt.Sprintf("%s/v2/query?ak=%s&bucket=%s", ucHost, ak, bucket)
+
+	var ret UcQueryRet
+	err = clt.CallWithForm(ctx, &ret, "GET", reqURL, nil, nil)
+	if err != nil {
+		return
+	}
+
+	if len(ret.Io["src"]["main"]) <= 0 {
+		err = fmt.Errorf("empty io host list")
+		return
+	}
+
+	ioHost := ret.Io["src"]["main"][0]
+	srcUpHosts := ret.Up["src"].Main
+	if ret.Up["src"].Backup != nil {
+		srcUpHosts = append(srcUpHosts, ret.Up["src"].Backup...)
+	}
+	cdnUpHosts := ret.Up["acc"].Main
+	if ret.Up["acc"].Backup != nil {
+		cdnUpHosts = append(cdnUpHosts, ret.Up["acc"].Backup...)
+	}
+
+	region = &Region{
+		SrcUpHosts: srcUpHosts,
+		CdnUpHosts: cdnUpHosts,
+		IovipHost:  ioHost,
+		IoHosts:    ret.Io["src"]["main"],
+		RsHost:     DefaultRsHost,
+		RsfHost:    DefaultRsfHost,
+		ApiHost:    DefaultAPIHost,
+	}
+
+	//set specific hosts if possible
+	setSpecificHosts(ioHost, region)
+	ttl = time.Duration(ret.TTL) * time.Second
+	return
 }
 
 func regionFromHost(ioHost string) (Region, bool) {
@@ -389,13 +603,24 @@ type RegionInfo struct {
 	Description string `json:"description"`
 }
 
+// GetRegionsInfo 使用默认的UC服务地址查询所有区域的信息，参考 BucketManager.GetRegionsInfo
 func GetRegionsInfo(mac *auth.Credentials) ([]RegionInfo, error) {
+	return NewBucketManager(mac, nil).GetRegionsInfo()
+}
+
+// GetRegionsInfo 查询所有区域的信息，使用 Cfg 中设置的UC服务地址
+func (m *BucketManager) GetRegionsInfo() ([]RegionInfo, error) {
+	return m.GetRegionsInfoContext(context.Background())
+}
+
+// GetRegionsInfoContext 和 GetRegionsInfo 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) GetRegionsInfoContext(ctx context.Context) ([]RegionInfo, error) {
 	var regions struct {
 		Regions []RegionInfo `json:"regions"`
 	}
-	qErr := client.DefaultClient.CredentialedCallWithForm(context.Background(), mac, auth.TokenQiniu, &regions, "GET", UcHost+"/regions", nil, nil)
+	qErr := m.Client.CredentialedCallWithForm(ctx, m.credentials(), auth.TokenQiniu, &regions, "GET", m.ucHost()+"/regions", nil, nil)
 	if qErr != nil {
-		return nil, fmt.Errorf("query region error, %s", qErr.Error())
+		return nil, fmt.Errorf("query region error, %w", qErr)
 	} else {
 		return regions.Regions, nil
 	}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// RegionCacheValue 是区域信息缓存中保存的值
+type RegionCacheValue struct {
+	Region   *Region   `json:"region"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// RegionCache 用来缓存空间对应的区域信息，key 的格式为 "<ak>:<bucket>:<UC服务地址列表>"，UC服务地址之间用逗号分隔
+// 除了SDK提供的内存缓存和文件缓存，用户也可以自己实现，比如保存在 Redis 中，供多个进程共享
+// 实现需要保证并发安全
+type RegionCache interface {
+	// Load 返回缓存的区域信息，如果没有缓存返回 false
+	// 过期的缓存也应该返回，由调用方决定是否继续使用
+	Load(key string) (value RegionCacheValue, ok bool)
+
+	// Store 保存区域信息
+	Store(key string, value RegionCacheValue)
+}
+
+// RegionCacheEvent 是区域信息缓存的事件类型
+type RegionCacheEvent int
+
+const (
+	// RegionCacheHit 命中缓存
+	RegionCacheHit RegionCacheEvent = iota
+
+	// RegionCacheMiss 没有命中缓存或者缓存已经过期太久，需要同步查询
+	RegionCacheMiss
+
+	// RegionCacheStale 缓存即将过期或者已经过期，先使用缓存，同时在后台刷新
+	RegionCacheStale
+
+	// RegionCacheRefreshed 查询区域信息成功，缓存已经更新
+	RegionCacheRefreshed
+
+	// RegionCacheRefreshError 查询区域信息失败
+	RegionCacheRefreshError
+)
+
+func (e RegionCacheEvent) String() string {
+	switch e {
+	case RegionCacheHit:
+		return "hit"
+	case RegionCacheMiss:
+		return "miss"
+	case RegionCacheStale:
+		return "stale"
+	case RegionCacheRefreshed:
+		return "refreshed"
+	case RegionCacheRefreshError:
+		return "refresh_error"
+	}
+	return "unknown"
+}
+
+// RegionCacheHook 是区域信息缓存事件的回调，可以用来统计缓存的命中率
+// 回调可能在后台的goroutine中调用，应该尽可能快地结束
+type RegionCacheHook func(event RegionCacheEvent, key string)
+
+var (
+	// RegionCacheRefreshAhead 表示缓存在过期前多长时间开始在后台刷新
+	RegionCacheRefreshAhead = 5 * time.Minute
+
+	// RegionCacheMaxStale 表示缓存过期后还可以继续使用多长时间(同时在后台刷新)
+	// 超过这个时间的缓存不再使用，需要同步查询
+	RegionCacheMaxStale = time.Hour
+)
+
+var (
+	defaultRegionCache     RegionCache = NewFileRegionCache(filepath.Join(os.TempDir(), "qiniu-golang-sdk", "query.cache.json"))
+	defaultRegionCacheLock sync.RWMutex
+	regionCacheGroup       singleflight.Group
+)
+
+// DefaultRegionCache 返回默认的区域信息缓存
+// 没有在 Config 中设置 RegionCache 时使用该缓存
+func DefaultRegionCache() RegionCache {
+	defaultRegionCacheLock.RLock()
+	defer defaultRegionCacheLock.RUnlock()
+
+	return defaultRegionCache
+}
+
+// SetDefaultRegionCache 设置默认的区域信息缓存
+func SetDefaultRegionCache(cache RegionCache) {
+	if cache == nil {
+		cache = NewMemoryRegionCache()
+	}
+
+	defaultRegionCacheLock.Lock()
+	defer defaultRegionCacheLock.Unlock()
+
+	defaultRegionCache = cache
+}
+
+// SetRegionCachePath 设置默认区域信息缓存使用的文件路径
+// 默认缓存会被替换为使用新路径的文件缓存
+func SetRegionCachePath(newPath string) {
+	SetDefaultRegionCache(NewFileRegionCache(newPath))
+}
+
+// MemoryRegionCache 是保存在内存中的区域信息缓存
+type MemoryRegionCache struct {
+	cache sync.Map
+}
+
+// NewMemoryRegionCache 返回一个内存缓存
+func NewMemoryRegionCache() *MemoryRegionCache {
+	return &MemoryRegionCache{}
+}
+
+// Load 返回缓存的区域信息
+func (c *MemoryRegionCache) Load(key string) (value RegionCacheValue, ok bool) {
+	v, ok := c.cache.Load(key)
+	if !ok {
+		return
+	}
+	return v.(RegionCacheValue), true
+}
+
+// Store 保存区域信息
+func (c *MemoryRegionCache) Store(key string, value RegionCacheValue) {
+	c.cache.Store(key, value)
+}
+
+type regionCacheMap map[string]RegionCacheValue
+
+// FileRegionCache 是持久化到本地文件的区域信息缓存
+// 第一次访问时从文件加载，每次更新后写回文件；文件不可读写时(比如只读的临时目录)退化为内存缓存
+type FileRegionCache struct {
+	path     string
+	memory   MemoryRegionCache
+	loadOnce sync.Once
+	syncLock sync.Mutex
+}
+
+// NewFileRegionCache 返回一个使用 path 文件持久化的缓存
+func NewFileRegionCache(path string) *FileRegionCache {
+	return &FileRegionCache{path: path}
+}
+
+// Load 返回缓存的区域信息
+func (c *FileRegionCache) Load(key string) (value RegionCacheValue, ok bool) {
+	c.loadOnce.Do(c.load)
+	return c.memory.Load(key)
+}
+
+// Store 保存区域信息并写回文件
+func (c *FileRegionCache) Store(key string, value RegionCacheValue) {
+	c.loadOnce.Do(c.load)
+	c.memory.Store(key, value)
+
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	c.store()
+}
+
+func (c *FileRegionCache) load() {
+	cacheFile, err := os.Open(c.path)
+	if err != nil {
+		return
+	}
+	defer cacheFile.Close()
+
+	var cacheMap regionCacheMap
+	if err = json.NewDecoder(cacheFile).Decode(&cacheMap); err != nil {
+		return
+	}
+	for cacheKey, cacheValue := range cacheMap {
+		c.memory.Store(cacheKey, cacheValue)
+	}
+}
+
+func (c *FileRegionCache) store() {
+	err := os.MkdirAll(filepath.Dir(c.path), 0700)
+	if err != nil {
+		return
+	}
+
+	cacheFile, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	defer cacheFile.Close()
+
+	cacheMap := make(regionCacheMap)
+	c.memory.cache.Range(func(cacheKey, cacheValue interface{}) bool {
+		cacheMap[cacheKey.(string)] = cacheValue.(RegionCacheValue)
+		return true
+	})
+	if err = json.NewEncoder(cacheFile).Encode(cacheMap); err != nil {
+		return
+	}
+}
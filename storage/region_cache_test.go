@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileRegionCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qiniu-region-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cachePath := filepath.Join(dir, "query.cache.json")
+	value := RegionCacheValue{
+		Region:   &regionHuabei,
+		Deadline: time.Now().Add(time.Hour).Round(0),
+	}
+
+	cache := NewFileRegionCache(cachePath)
+	if _, ok := cache.Load("ak:bucket"); ok {
+		t.Fatalf("Load() from empty cache should fail")
+	}
+	cache.Store("ak:bucket", value)
+
+	// 新的缓存对象从文件中加载
+	got, ok := NewFileRegionCache(cachePath).Load("ak:bucket")
+	if !ok {
+		t.Fatalf("Load() after Store() failed")
+	}
+	if got.Region.RsHost != value.Region.RsHost || !got.Deadline.Equal(value.Deadline) {
+		t.Errorf("Load() got %+v, want %+v", got, value)
+	}
+}
+
+func TestGetRegionFromConfigCache(t *testing.T) {
+	cache := NewMemoryRegionCache()
+	cacheKey := "ak:bucket:" + strings.Join(DefaultUcHosts, ",")
+	cache.Store(cacheKey, RegionCacheValue{
+		Region:   &regionHuanan,
+		Deadline: time.Now().Add(time.Hour),
+	})
+
+	var events []RegionCacheEvent
+	cfg := Config{
+		RegionCache: cache,
+		RegionCacheHook: func(event RegionCacheEvent, key string) {
+			if key != cacheKey {
+				t.Errorf("unexpected cache key: %s", key)
+			}
+			events = append(events, event)
+		},
+	}
+
+	region, err := getRegionByConfig(context.Background(), &cfg, nil, "ak", "bucket")
+	if err != nil {
+		t.Fatalf("getRegionByConfig() error: %v", err)
+	}
+	if region.RsHost != regionHuanan.RsHost {
+		t.Errorf("getRegionByConfig() got RsHost %s", region.RsHost)
+	}
+	if len(events) != 1 || events[0] != RegionCacheHit {
+		t.Errorf("want one hit event, got %v", events)
+	}
+}
+
+func TestRegionCacheKeyIncludesUcHosts(t *testing.T) {
+	cache := NewMemoryRegionCache()
+	public := Config{RegionCache: cache}
+	private := Config{RegionCache: cache, UcHosts: []string{"https://uc.example.com"}}
+	cache.Store(newRegionResolver(&public, nil).cacheKey("ak", "bucket"), RegionCacheValue{
+		Region:   &regionHuanan,
+		Deadline: time.Now().Add(time.Hour),
+	})
+	cache.Store(newRegionResolver(&private, nil).cacheKey("ak", "bucket"), RegionCacheValue{
+		Region:   &regionHuabei,
+		Deadline: time.Now().Add(time.Hour),
+	})
+
+	if region, err := getRegionByConfig(context.Background(), &public, nil, "ak", "bucket"); err != nil || region.RsHost != regionHuanan.RsHost {
+		t.Errorf("public region = %v, %v", region, err)
+	}
+	if region, err := getRegionByConfig(context.Background(), &private, nil, "ak", "bucket"); err != nil || region.RsHost != regionHuabei.RsHost {
+		t.Errorf("private region = %v, %v", region, err)
+	}
+}
+
+func TestRegionCacheRefreshInBackground(t *testing.T) {
+	var fail int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"hosts":[{"region":"z1","ttl":86400,
+			"io":{"domains":["iovip-z1.qbox.me"]},"up":{"domains":["up-z1.qiniup.com"]},
+			"rs":{"domains":["rs-z1.qiniuapi.com"]}}]}`))
+	}))
+	defer srv.Close()
+
+	cache := NewMemoryRegionCache()
+	events := make(chan RegionCacheEvent, 10)
+	cfg := Config{
+		RegionCache:     cache,
+		RegionCacheHook: func(event RegionCacheEvent, key string) { events <- event },
+		UcHosts:         []string{srv.URL},
+	}
+	cacheKey := newRegionResolver(&cfg, nil).cacheKey("ak", "bucket")
+	waitEvent := func(want RegionCacheEvent) {
+		select {
+		case event := <-events:
+			if event != want {
+				t.Fatalf("want event %s, got %s", want, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for event %s", want)
+		}
+	}
+
+	for _, c := range []struct {
+		fail      int32
+		event     RegionCacheEvent
+		refreshed bool
+	}{
+		{fail: 1, event: RegionCacheRefreshError},
+		{fail: 0, event: RegionCacheRefreshed, refreshed: true},
+	} {
+		// 缓存即将过期，先返回旧的区域信息，同时在后台刷新
+		deadline := time.Now().Add(time.Minute)
+		cache.Store(cacheKey, RegionCacheValue{Region: &regionHuanan, Deadline: deadline})
+		atomic.StoreInt32(&fail, c.fail)
+
+		region, err := getRegionByConfig(context.Background(), &cfg, nil, "ak", "bucket")
+		if err != nil || region.RsHost != regionHuanan.RsHost {
+			t.Fatalf("getRegionByConfig() = %v, %v", region, err)
+		}
+		waitEvent(RegionCacheStale)
+		waitEvent(c.event)
+
+		// 后台刷新完成后才更新缓存，稍等保存完成
+		for i := 0; i < 100; i++ {
+			if v, _ := cache.Load(cacheKey); v.Deadline.After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		v, _ := cache.Load(cacheKey)
+		if refreshed := v.Region.RsHost == "rs-z1.qiniuapi.com"; refreshed != c.refreshed {
+			t.Errorf("cache refreshed = %v, want %v, got %+v", refreshed, c.refreshed, v.Region)
+		}
+	}
+}
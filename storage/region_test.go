@@ -1,7 +1,16 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
 )
 
 func TestEndpoint(t *testing.T) {
@@ -19,7 +28,7 @@ func TestEndpoint(t *testing.T) {
 		{UseHttps: false, Host: "http://rs.qiniu.com"},
 	}
 	testWants := []string{"https://rs.qiniu.com", "http://rs.qiniu.com", "", "", "https://rs.qiniu.com",
-		"http://rs.qiniu.com", "http://rs.qiniu.com"}
+		"https://rs.qiniu.com", "http://rs.qiniu.com"}
 
 	for ind, testInput := range testInputs {
 		testGot := endpoint(testInput.UseHttps, testInput.Host)
@@ -40,3 +49,164 @@ func TestRegion(t *testing.T) {
 		t.Fatalf("region1.IovipHost is wrong")
 	}
 }
+
+func TestQueryRegionWithUcHostsFailover(t *testing.T) {
+	var v4Calls, v2Calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/v4/query":
+			v4Calls++
+			w.Write([]byte(`{"hosts":[{"region":"z1","ttl":86400,
+				"io":{"domains":["iovip-z1.qbox.me"]},
+				"up":{"domains":["upload-z1.qiniup.com","up-z1.qiniup.com"],"old":["up-z1.qbox.me"]},
+				"rs":{"domains":["rs-z1.qiniuapi.com"],"old":["rs-z1.qbox.me"]},
+				"rsf":{"domains":["rsf-z1.qiniuapi.com"]},
+				"api":{"domains":["api-z1.qiniuapi.com"]}}]}`))
+		default:
+			v2Calls++
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	var events []RegionCacheEvent
+	cfg := Config{
+		RegionCache:     NewMemoryRegionCache(),
+		RegionCacheHook: func(event RegionCacheEvent, key string) { events = append(events, event) },
+		// 第一个地址无法连接，应该使用第二个地址
+		UcHosts: []string{"http://127.0.0.1:1", srv.URL},
+	}
+
+	region, err := getRegionByConfig(context.Background(), &cfg, nil, "ak", "bucket")
+	if err != nil {
+		t.Fatalf("getRegionByConfig() error: %v", err)
+	}
+	if region.RsHost != "rs-z1.qiniuapi.com" || region.RsfHost != "rsf-z1.qiniuapi.com" ||
+		region.ApiHost != "api-z1.qiniuapi.com" || region.IovipHost != "iovip-z1.qbox.me" {
+		t.Errorf("unexpected region: %s", region.String())
+	}
+	if got := region.GetRsHosts(true); len(got) != 2 || got[1] != "https://rs-z1.qbox.me" {
+		t.Errorf("GetRsHosts() got %v", got)
+	}
+	if len(region.SrcUpHosts) != 3 {
+		t.Errorf("SrcUpHosts got %v", region.SrcUpHosts)
+	}
+
+	// 第二次查询使用缓存
+	if _, err = getRegionByConfig(context.Background(), &cfg, nil, "ak", "bucket"); err != nil {
+		t.Fatalf("getRegionByConfig() error: %v", err)
+	}
+	if v4Calls != 1 || v2Calls != 0 {
+		t.Errorf("want 1 v4 query, got v4 = %d, v2 = %d", v4Calls, v2Calls)
+	}
+	wantEvents := []RegionCacheEvent{RegionCacheMiss, RegionCacheRefreshed, RegionCacheHit}
+	if len(events) != len(wantEvents) {
+		t.Fatalf("want events %v, got %v", wantEvents, events)
+	}
+	for i := range events {
+		if events[i] != wantEvents[i] {
+			t.Errorf("want events %v, got %v", wantEvents, events)
+		}
+	}
+}
+
+func TestQueryRegionFallbackToV2(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ttl":86400,
+			"io":{"src":{"main":["iovip-z2.qbox.me"]}},
+			"up":{"src":{"main":["up-z2.qiniup.com"]},"acc":{"main":["upload-z2.qiniup.com"]}}}`))
+	}))
+	defer srv.Close()
+
+	cfg := Config{RegionCache: NewMemoryRegionCache(), UcHosts: []string{srv.URL}}
+	region, err := getRegionByConfig(context.Background(), &cfg, nil, "ak", "bucket")
+	if err != nil {
+		t.Fatalf("getRegionByConfig() error: %v", err)
+	}
+	if region.RsHost != regionHuanan.RsHost || region.CdnUpHosts[0] != "upload-z2.qiniup.com" {
+		t.Errorf("unexpected region: %s", region.String())
+	}
+}
+
+func TestRegionQueryWithContextAndClient(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("bucket") == "slow" {
+			<-block
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"hosts":[{"region":"z1","ttl":86400,
+			"io":{"domains":["iovip-z1.qbox.me"]},
+			"up":{"domains":["up-z1.qiniup.com"]},
+			"rs":{"domains":["rs-z1.qiniuapi.com"]}}]}`))
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	var requests int32
+	clt := &client.Client{Client: http.DefaultClient}
+	clt.Use(func(next client.Handler) client.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&requests, 1)
+			return next(req)
+		}
+	})
+	cfg := &Config{RegionCache: NewMemoryRegionCache(), UcHosts: []string{srv.URL}}
+	m := NewBucketManagerEx(auth.New("ak", "sk"), cfg, clt)
+
+	// 查询请求经过 BucketManager 的 Client
+	reqHost, err := m.reqHost(context.Background(), "rs", "bucket")
+	if err != nil || reqHost != "http://rs-z1.qiniuapi.com" {
+		t.Fatalf("reqHost() = %q, %v", reqHost, err)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("want 1 request through client middleware, got %d", requests)
+	}
+
+	// 取消 ctx 时查询立即返回
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = m.ZoneContext(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ZoneContext() with canceled ctx error = %v", err)
+	}
+}
+
+func TestRegionQueryError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(631)
+		w.Write([]byte(`{"error":"no such bucket"}`))
+	}))
+	defer srv.Close()
+
+	cfg := Config{RegionCache: NewMemoryRegionCache(), UcHosts: []string{srv.URL}}
+	_, err := getRegionByConfig(context.Background(), &cfg, nil, "ak", "bucket")
+	var e *client.ErrorInfo
+	if !errors.As(err, &e) || e.Code != 631 || !client.IsNotFound(err) {
+		t.Errorf("getRegionByConfig() error = %v", err)
+	}
+}
+
+func TestGetRegionsInfoWithUcHosts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/regions" || req.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"regions":[{"id":"z0","description":"East China"}]}`))
+	}))
+	defer srv.Close()
+
+	m := NewBucketManager(auth.New("ak", "sk"), &Config{UcHosts: []string{srv.URL}})
+	regions, err := m.GetRegionsInfoContext(context.Background())
+	if err != nil || len(regions) != 1 || regions[0].ID != "z0" {
+		t.Errorf("GetRegionsInfoContext() = %v, %v", regions, err)
+	}
+}
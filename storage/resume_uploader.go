@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/telemetry"
 )
 
 // ResumeUploader 表示一个分片上传的对象
@@ -115,13 +116,14 @@ func (p *ResumeUploader) rput(ctx context.Context, ret interface{}, upToken stri
 	extra.init()
 
 	var (
-		upHost, accessKey, bucket, recorderKey string
-		fileInfo                               os.FileInfo = nil
+		accessKey, bucket, recorderKey string
+		upHosts                        []string
+		fileInfo                       os.FileInfo = nil
 	)
 
 	if extra.UpHost != "" {
-		upHost = extra.UpHost
-	} else if accessKey, bucket, upHost, err = p.resumeUploaderAPIs().getAkAndBucketAndUpHostFromUploadToken(upToken); err != nil {
+		upHosts = []string{extra.UpHost}
+	} else if accessKey, bucket, upHosts, err = p.resumeUploaderAPIs().getAkAndBucketAndUpHostsFromUploadToken(ctx, upToken); err != nil {
 		return
 	}
 
@@ -133,7 +135,7 @@ func (p *ResumeUploader) rput(ctx context.Context, ret interface{}, upToken stri
 	}
 
 	return uploadByWorkers(
-		newResumeUploaderImpl(p, key, hasKey, upToken, upHost, fileInfo, extra, ret, recorderKey),
+		newResumeUploaderImpl(p, key, hasKey, upToken, newUpHostList(upHosts...), fileInfo, extra, ret, recorderKey),
 		ctx, newSizedChunkReader(f, fsize, 1<<blockBits), extra.TryTimes)
 }
 
@@ -143,15 +145,15 @@ func (p *ResumeUploader) rputWithoutSize(ctx context.Context, ret interface{}, u
 	}
 	extra.init()
 
-	var upHost string
+	var upHosts []string
 	if extra.UpHost != "" {
-		upHost = extra.UpHost
-	} else if upHost, err = p.resumeUploaderAPIs().getUpHostFromUploadToken(upToken); err != nil {
+		upHosts = []string{extra.UpHost}
+	} else if upHosts, err = p.resumeUploaderAPIs().getUpHostsFromUploadToken(ctx, upToken); err != nil {
 		return
 	}
 
 	return uploadByWorkers(
-		newResumeUploaderImpl(p, key, hasKey, upToken, upHost, nil, extra, ret, ""),
+		newResumeUploaderImpl(p, key, hasKey, upToken, newUpHostList(upHosts...), nil, extra, ret, ""),
 		ctx, newUnsizedChunkReader(r, 1<<blockBits), extra.TryTimes)
 }
 
@@ -194,7 +196,7 @@ func (p *ResumeUploader) Mkfile(ctx context.Context, upToken string, upHost stri
 }
 
 func (p *ResumeUploader) UpHost(ak, bucket string) (upHost string, err error) {
-	return p.resumeUploaderAPIs().upHost(ak, bucket)
+	return p.resumeUploaderAPIs().upHost(context.Background(), ak, bucket)
 }
 
 func (p *ResumeUploader) resumeUploaderAPIs() *resumeUploaderAPIs {
@@ -210,7 +212,7 @@ type (
 		key         string
 		hasKey      bool
 		upToken     string
-		upHost      string
+		upHosts     *upHostList
 		extra       *RputExtra
 		ret         interface{}
 		fileSize    int64
@@ -234,14 +236,14 @@ type (
 	}
 )
 
-func newResumeUploaderImpl(resumeUploader *ResumeUploader, key string, hasKey bool, upToken string, upHost string, fileInfo os.FileInfo, extra *RputExtra, ret interface{}, recorderKey string) *resumeUploaderImpl {
+func newResumeUploaderImpl(resumeUploader *ResumeUploader, key string, hasKey bool, upToken string, upHosts *upHostList, fileInfo os.FileInfo, extra *RputExtra, ret interface{}, recorderKey string) *resumeUploaderImpl {
 	return &resumeUploaderImpl{
 		client:      resumeUploader.Client,
 		cfg:         resumeUploader.Cfg,
 		key:         key,
 		hasKey:      hasKey,
 		upToken:     upToken,
-		upHost:      upHost,
+		upHosts:     upHosts,
 		extra:       extra,
 		ret:         ret,
 		fileSize:    0,
@@ -279,7 +281,10 @@ func (impl *resumeUploaderImpl) uploadChunk(ctx context.Context, c chunk) error
 	UploadSingleChunk:
 		for retried := 0; retried < impl.extra.TryTimes; retried += 1 {
 			if chunkOffset == 0 {
-				err = apis.mkBlk(ctx, impl.upToken, impl.upHost, &blkPutRet, len(c.data), bytes.NewReader(chunkData), len(chunkData))
+				upHost := impl.upHosts.current()
+				err = apis.mkBlk(ctx, impl.upToken, upHost, &blkPutRet, len(c.data), bytes.NewReader(chunkData), len(chunkData))
+				// 重新创建块不会影响已经上传的数据，可以当作幂等请求换域名重试
+				impl.upHosts.failed(client.WithIdempotent(ctx, true), "POST", upHost, err)
 			} else {
 				err = apis.bput(ctx, impl.upToken, &blkPutRet, bytes.NewReader(chunkData), len(chunkData))
 			}
@@ -323,13 +328,19 @@ func (impl *resumeUploaderImpl) uploadChunk(ctx context.Context, c chunk) error
 	return nil
 }
 
+func (impl *resumeUploaderImpl) startTelemetry(ctx context.Context) (context.Context, *telemetry.Operation) {
+	return startUpload(ctx, impl.upToken, impl.key, impl.hasKey, "resume_v1")
+}
+
 func (impl *resumeUploaderImpl) final(ctx context.Context) error {
 	if impl.extra.Recorder != nil {
 		impl.extra.Recorder.Delete(impl.recorderKey)
 	}
 
 	sort.Sort(blkputRets(impl.extra.Progresses))
-	return impl.resumeUploaderAPIs().mkfile(ctx, impl.upToken, impl.upHost, impl.ret, impl.key, impl.hasKey, impl.fileSize, impl.extra)
+	return impl.upHosts.do(ctx, "POST", func(upHost string) error {
+		return impl.resumeUploaderAPIs().mkfile(ctx, impl.upToken, upHost, impl.ret, impl.key, impl.hasKey, impl.fileSize, impl.extra)
+	})
 }
 
 func (impl *resumeUploaderImpl) recover(ctx context.Context, recoverData []byte) (recovered []int64) {
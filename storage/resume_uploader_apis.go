@@ -150,25 +150,25 @@ func (p *resumeUploaderAPIs) completeParts(ctx context.Context, upToken, upHost
 	return p.Client.CallWithJson(ctx, ret, "POST", reqUrl, makeHeadersForUploadEx(upToken, conf.CONTENT_TYPE_JSON), &completePartBody)
 }
 
-func (p *resumeUploaderAPIs) upHost(ak, bucket string) (upHost string, err error) {
-	return getUpHost(p.Cfg, ak, bucket)
+func (p *resumeUploaderAPIs) upHost(ctx context.Context, ak, bucket string) (upHost string, err error) {
+	return getUpHost(ctx, p.Cfg, p.Client, ak, bucket)
 }
 
-func (p *resumeUploaderAPIs) getUpHostFromUploadToken(upToken string) (upHost string, err error) {
-	_, upHost, err = p.getBucketAndUpHostFromUploadToken(upToken)
+func (p *resumeUploaderAPIs) getUpHostsFromUploadToken(ctx context.Context, upToken string) (upHosts []string, err error) {
+	_, upHosts, err = p.getBucketAndUpHostsFromUploadToken(ctx, upToken)
 	return
 }
 
-func (p *resumeUploaderAPIs) getBucketAndUpHostFromUploadToken(upToken string) (bucket, upHost string, err error) {
-	_, bucket, upHost, err = p.getAkAndBucketAndUpHostFromUploadToken(upToken)
+func (p *resumeUploaderAPIs) getBucketAndUpHostsFromUploadToken(ctx context.Context, upToken string) (bucket string, upHosts []string, err error) {
+	_, bucket, upHosts, err = p.getAkAndBucketAndUpHostsFromUploadToken(ctx, upToken)
 	return
 }
 
-func (p *resumeUploaderAPIs) getAkAndBucketAndUpHostFromUploadToken(upToken string) (ak, bucket, upHost string, err error) {
+func (p *resumeUploaderAPIs) getAkAndBucketAndUpHostsFromUploadToken(ctx context.Context, upToken string) (ak, bucket string, upHosts []string, err error) {
 	if ak, bucket, err = getAkBucketFromUploadToken(upToken); err != nil {
 		return
 	}
-	upHost, err = p.upHost(ak, bucket)
+	upHosts, err = getUpHosts(ctx, p.Cfg, p.Client, ak, bucket)
 	return
 }
 
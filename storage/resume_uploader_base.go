@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/qiniu/api.v7/v7"
+	"github.com/qiniu/api.v7/v7/telemetry"
 )
 
 // 分片上传过程中可能遇到的错误
@@ -116,6 +117,8 @@ type (
 		uploadChunk(context.Context, chunk) error
 		// 上传所有分片后调用一次用于结束上传，在 v1 中该接口对应 mkfile，而在 v2 中该接口对应 completeParts
 		final(context.Context) error
+		// 开始记录上传操作
+		startTelemetry(context.Context) (context.Context, *telemetry.Operation)
 	}
 
 	// 将已知数据流大小的情况和未知数据流大小的情况抽象成一个接口
@@ -147,6 +150,9 @@ func uploadByWorkers(uploader resumeUploaderBase, ctx context.Context, body chun
 
 	initWorkers()
 
+	ctx, op := uploader.startTelemetry(ctx)
+	defer func() { op.End(err) }()
+
 	if recovered, err = uploader.initUploader(ctx); err != nil {
 		return
 	}
@@ -157,7 +163,7 @@ func uploadByWorkers(uploader resumeUploaderBase, ctx context.Context, body chun
 		wg.Add(1)
 		tasks <- func() {
 			defer wg.Done()
-			if err := uploader.uploadChunk(ctx, newChunk); err != nil {
+			if err := uploadChunkWithTelemetry(ctx, op, uploader, newChunk); err != nil {
 				newChunk.retried += 1
 				failedChunks.LoadOrStore(newChunk.id, chunkError{chunk: newChunk, err: err})
 			}
@@ -186,7 +192,7 @@ func uploadByWorkers(uploader resumeUploaderBase, ctx context.Context, body chun
 				wg.Add(1)
 				tasks <- func() {
 					defer wg.Done()
-					if cerr := uploader.uploadChunk(ctx, chunkErr.chunk); cerr != nil {
+					if cerr := uploadChunkWithTelemetry(ctx, op, uploader, chunkErr.chunk); cerr != nil {
 						chunkErr.retried += 1
 						failedChunks.LoadOrStore(chunkErr.id, chunkErr)
 					}
@@ -14,6 +14,7 @@ import (
 	"sync"
 
 	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/telemetry"
 )
 
 // ResumeUploaderV2 表示一个分片上传 v2 的对象
@@ -110,15 +111,16 @@ func (p *ResumeUploaderV2) rput(ctx context.Context, ret interface{}, upToken st
 	extra.init()
 
 	var (
-		upHost, accessKey, bucket, recorderKey string
-		fileInfo                               os.FileInfo = nil
+		accessKey, bucket, recorderKey string
+		upHosts                        []string
+		fileInfo                       os.FileInfo = nil
 	)
 
-	if accessKey, bucket, upHost, err = p.resumeUploaderAPIs().getAkAndBucketAndUpHostFromUploadToken(upToken); err != nil {
+	if accessKey, bucket, upHosts, err = p.resumeUploaderAPIs().getAkAndBucketAndUpHostsFromUploadToken(ctx, upToken); err != nil {
 		return
 	}
 	if extra.UpHost != "" {
-		upHost = extra.UpHost
+		upHosts = []string{extra.UpHost}
 	}
 	if extra.Recorder != nil && fileDetails != nil {
 		recorderKey = extra.Recorder.GenerateRecorderKey(
@@ -128,7 +130,7 @@ func (p *ResumeUploaderV2) rput(ctx context.Context, ret interface{}, upToken st
 	}
 
 	return uploadByWorkers(
-		newResumeUploaderV2Impl(p, bucket, key, hasKey, upToken, upHost, fileInfo, extra, ret, recorderKey),
+		newResumeUploaderV2Impl(p, bucket, key, hasKey, upToken, newUpHostList(upHosts...), fileInfo, extra, ret, recorderKey),
 		ctx, newSizedChunkReader(f, fsize, extra.PartSize), extra.TryTimes)
 }
 
@@ -138,16 +140,19 @@ func (p *ResumeUploaderV2) rputWithoutSize(ctx context.Context, ret interface{},
 	}
 	extra.init()
 
-	var bucket, upHost string
-	if bucket, upHost, err = p.resumeUploaderAPIs().getBucketAndUpHostFromUploadToken(upToken); err != nil {
+	var (
+		bucket  string
+		upHosts []string
+	)
+	if bucket, upHosts, err = p.resumeUploaderAPIs().getBucketAndUpHostsFromUploadToken(ctx, upToken); err != nil {
 		return
 	}
 	if extra.UpHost != "" {
-		upHost = extra.UpHost
+		upHosts = []string{extra.UpHost}
 	}
 
 	return uploadByWorkers(
-		newResumeUploaderV2Impl(p, bucket, key, hasKey, upToken, upHost, nil, extra, ret, ""),
+		newResumeUploaderV2Impl(p, bucket, key, hasKey, upToken, newUpHostList(upHosts...), nil, extra, ret, ""),
 		ctx, newUnsizedChunkReader(r, extra.PartSize), extra.TryTimes)
 }
 
@@ -190,7 +195,7 @@ func (p *ResumeUploaderV2) CompleteParts(ctx context.Context, upToken, upHost st
 }
 
 func (p *ResumeUploaderV2) UpHost(ak, bucket string) (upHost string, err error) {
-	return p.resumeUploaderAPIs().upHost(ak, bucket)
+	return p.resumeUploaderAPIs().upHost(context.Background(), ak, bucket)
 }
 
 func (p *ResumeUploaderV2) resumeUploaderAPIs() *resumeUploaderAPIs {
@@ -208,7 +213,7 @@ type (
 		hasKey      bool
 		uploadId    string
 		upToken     string
-		upHost      string
+		upHosts     *upHostList
 		extra       *RputV2Extra
 		fileInfo    os.FileInfo
 		recorderKey string
@@ -231,7 +236,7 @@ type (
 	}
 )
 
-func newResumeUploaderV2Impl(resumeUploader *ResumeUploaderV2, bucket, key string, hasKey bool, upToken string, upHost string, fileInfo os.FileInfo, extra *RputV2Extra, ret interface{}, recorderKey string) *resumeUploaderV2Impl {
+func newResumeUploaderV2Impl(resumeUploader *ResumeUploaderV2, bucket, key string, hasKey bool, upToken string, upHosts *upHostList, fileInfo os.FileInfo, extra *RputV2Extra, ret interface{}, recorderKey string) *resumeUploaderV2Impl {
 	return &resumeUploaderV2Impl{
 		client:      resumeUploader.Client,
 		cfg:         resumeUploader.Cfg,
@@ -239,7 +244,7 @@ func newResumeUploaderV2Impl(resumeUploader *ResumeUploaderV2, bucket, key strin
 		key:         key,
 		hasKey:      hasKey,
 		upToken:     upToken,
-		upHost:      upHost,
+		upHosts:     upHosts,
 		fileInfo:    fileInfo,
 		recorderKey: recorderKey,
 		extra:       extra,
@@ -261,7 +266,9 @@ func (impl *resumeUploaderV2Impl) initUploader(ctx context.Context) ([]int64, er
 		}
 	}
 
-	err := impl.resumeUploaderAPIs().initParts(ctx, impl.upToken, impl.upHost, impl.bucket, impl.key, impl.hasKey, &ret)
+	err := impl.upHosts.do(ctx, "POST", func(upHost string) error {
+		return impl.resumeUploaderAPIs().initParts(ctx, impl.upToken, upHost, impl.bucket, impl.key, impl.hasKey, &ret)
+	})
 	if err == nil {
 		impl.uploadId = ret.UploadID
 	}
@@ -279,7 +286,10 @@ func (impl *resumeUploaderV2Impl) uploadChunk(ctx context.Context, c chunk) erro
 	md5Value := hex.EncodeToString(md5ByteArray[:])
 	partNumber := c.id + 1
 
-	if err = apis.uploadParts(ctx, impl.upToken, impl.upHost, impl.bucket, impl.key, impl.hasKey, impl.uploadId, partNumber, md5Value, &ret, bytes.NewReader(c.data), len(c.data)); err != nil {
+	upHost := impl.upHosts.current()
+	if err = apis.uploadParts(ctx, impl.upToken, upHost, impl.bucket, impl.key, impl.hasKey, impl.uploadId, partNumber, md5Value, &ret, bytes.NewReader(c.data), len(c.data)); err != nil {
+		// 分片重试时使用新的域名
+		impl.upHosts.failed(ctx, "PUT", upHost, err)
 		impl.extra.NotifyErr(partNumber, err)
 	} else {
 		impl.extra.Notify(partNumber, &ret)
@@ -302,13 +312,19 @@ func (impl *resumeUploaderV2Impl) uploadChunk(ctx context.Context, c chunk) erro
 	return err
 }
 
+func (impl *resumeUploaderV2Impl) startTelemetry(ctx context.Context) (context.Context, *telemetry.Operation) {
+	return startUpload(ctx, impl.upToken, impl.key, impl.hasKey, "resume_v2")
+}
+
 func (impl *resumeUploaderV2Impl) final(ctx context.Context) error {
 	if impl.extra.Recorder != nil {
 		impl.extra.Recorder.Delete(impl.recorderKey)
 	}
 
 	sort.Sort(uploadPartInfos(impl.extra.progresses))
-	return impl.resumeUploaderAPIs().completeParts(ctx, impl.upToken, impl.upHost, impl.ret, impl.bucket, impl.key, impl.hasKey, impl.uploadId, impl.extra)
+	return impl.upHosts.do(ctx, "POST", func(upHost string) error {
+		return impl.resumeUploaderAPIs().completeParts(ctx, impl.upToken, upHost, impl.ret, impl.bucket, impl.key, impl.hasKey, impl.uploadId, impl.extra)
+	})
 }
 
 func (impl *resumeUploaderV2Impl) recover(ctx context.Context, recoverData []byte) (recovered []int64) {
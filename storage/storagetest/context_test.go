@@ -0,0 +1,67 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/reqid"
+	"github.com/qiniu/api.v7/v7/storage"
+)
+
+func TestContextMethods(t *testing.T) {
+	srv := newTestServer(t)
+	srv.PutObject("test", "a.txt", []byte("hello"), "text/plain")
+
+	var reqids []string
+	clt := &client.Client{Client: &http.Client{}}
+	clt.Use(func(next client.Handler) client.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			reqids = append(reqids, req.Header.Get("X-Reqid"))
+			return next(req)
+		}
+	})
+	m := storage.NewBucketManagerEx(srv.Credentials, srv.Config(), clt)
+
+	// reqid 通过 ctx 传递到请求头
+	ctx := reqid.WithReqid(context.Background(), "test-reqid")
+	if _, err := m.StatContext(ctx, "test", "a.txt"); err != nil {
+		t.Fatalf("StatContext() error: %v", err)
+	}
+	if err := m.ChangeMimeContext(ctx, "test", "a.txt", "application/json"); err != nil {
+		t.Fatalf("ChangeMimeContext() error: %v", err)
+	}
+	if len(reqids) != 2 || reqids[0] != "test-reqid" || reqids[1] != "test-reqid" {
+		t.Errorf("reqids = %v", reqids)
+	}
+
+	// 取消的 ctx 不会发出请求
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	reqids = nil
+	if _, err := m.StatContext(canceled, "test", "a.txt"); !errors.Is(err, context.Canceled) {
+		t.Errorf("StatContext() want context.Canceled, got %v", err)
+	}
+	if err := m.DeleteContext(canceled, "test", "a.txt"); !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteContext() want context.Canceled, got %v", err)
+	}
+	if _, ok := srv.GetObject("test", "a.txt"); !ok {
+		t.Errorf("DeleteContext() with canceled ctx should not delete the file")
+	}
+
+	// ListBucketContext 使用传入的 ctx
+	reqids = nil
+	retCh, err := m.ListBucketContext(ctx, "test", "", "", "")
+	if err != nil {
+		t.Fatalf("ListBucketContext() error: %v", err)
+	}
+	var keys []string
+	for ret := range retCh {
+		keys = append(keys, ret.Item.Key)
+	}
+	if len(keys) != 1 || len(reqids) != 1 || reqids[0] != "test-reqid" {
+		t.Errorf("ListBucketContext() got keys %v, reqids %v", keys, reqids)
+	}
+}
@@ -0,0 +1,863 @@
+// Package storagetest 提供一个进程内的模拟七牛对象存储服务，用来在没有网络和真实密钥的情况下测试基于 storage 包的代码
+//
+// Server 基于 net/http/httptest 实现了 SDK 使用的 rs、rsf、up、io、uc 服务的主要接口，文件保存在内存中：
+//
+//	srv := storagetest.NewServer()
+//	defer srv.Close()
+//
+//	cfg := srv.Config()
+//	bucketManager := storage.NewBucketManager(srv.Credentials, cfg)
+//	formUploader := storage.NewFormUploader(cfg)
+//
+// 通过 InjectFault 可以让指定的请求返回错误，用来测试重试和错误处理逻辑
+package storagetest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/storage"
+)
+
+// 模拟服务返回的错误码，和七牛对象存储一致
+const (
+	CodeBadRequest   = 400
+	CodeUnauthorized = 401
+	CodeNoSuchEntry  = 612
+	CodeEntryExists  = 614
+	CodeNoSuchBucket = 631
+	CodeInvalidCtx   = 701
+)
+
+// blockSize 是七牛 etag 算法的分块大小
+const blockSize = 1 << 22
+
+// Object 是模拟服务中保存的一个文件
+type Object struct {
+	Data     []byte
+	Hash     string
+	MimeType string
+	EndUser  string
+
+	// 上传时间，单位为100纳秒，和七牛对象存储一致
+	PutTime int64
+
+	// 存储类型，参考 storage.FileTypeStandard 等
+	Type int
+
+	// 归档存储文件的解冻状态
+	RestoreStatus storage.RestoreStatus
+
+	// 设置的文件生命周期，0 表示不删除
+	DeleteAfterDays int
+
+	// 上传时指定的自定义变量和元数据
+	Params map[string]string
+}
+
+func (o *Object) fileInfo() storage.FileInfo {
+	return storage.FileInfo{
+		Hash:          o.Hash,
+		Fsize:         int64(len(o.Data)),
+		PutTime:       o.PutTime,
+		MimeType:      o.MimeType,
+		Type:          o.Type,
+		RestoreStatus: o.RestoreStatus,
+	}
+}
+
+func (o *Object) listItem(key string) storage.ListItem {
+	return storage.ListItem{
+		Key:      key,
+		Hash:     o.Hash,
+		Fsize:    int64(len(o.Data)),
+		PutTime:  o.PutTime,
+		MimeType: o.MimeType,
+		Type:     o.Type,
+		EndUser:  o.EndUser,
+	}
+}
+
+func (o *Object) clone() *Object {
+	c := *o
+	c.Data = append([]byte(nil), o.Data...)
+	if o.Params != nil {
+		c.Params = make(map[string]string, len(o.Params))
+		for k, v := range o.Params {
+			c.Params[k] = v
+		}
+	}
+	return &c
+}
+
+// Fault 描述一个注入的故障，匹配的请求不会被正常处理，而是按照 Fault 的设置返回
+type Fault struct {
+	// 匹配的请求方法，为空匹配所有方法
+	Method string
+
+	// 匹配的请求路径前缀，比如 "/mkblk/"、"/batch"，为空匹配所有请求
+	Path string
+
+	// 故障生效的次数，0 表示一直生效直到调用 ClearFaults
+	Times int
+
+	// 返回的 HTTP 状态码，默认为 503
+	Code int
+
+	// 返回的错误信息
+	Error string
+
+	// 返回前等待的时长，可以用来模拟超时
+	Delay time.Duration
+
+	// 直接断开连接，模拟网络错误，设置后忽略 Code 和 Error
+	CloseConn bool
+}
+
+func (f *Fault) match(req *http.Request) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, req.Method) {
+		return false
+	}
+	return strings.HasPrefix(req.URL.Path, f.Path)
+}
+
+type multipartUpload struct {
+	bucket  string
+	key     string
+	hasKey  bool
+	token   *upToken
+	parts   map[int64][]byte
+	expires time.Time
+}
+
+// Server 是模拟的七牛对象存储服务
+type Server struct {
+	*httptest.Server
+
+	// 服务使用的密钥，请求的管理凭证和上传凭证会用它来校验
+	// 设置为 nil 时不校验签名
+	Credentials *auth.Credentials
+
+	// RegionID 是区域查询接口返回的区域ID
+	RegionID string
+
+	host string
+
+	lock     sync.Mutex
+	buckets  map[string]map[string]*Object
+	blocks   map[string]*block
+	uploads  map[string]*multipartUpload
+	faults   []*Fault
+	requests []string
+	seq      int64
+	now      func() time.Time
+}
+
+// NewServer 启动一个模拟的七牛对象存储服务，使用完毕后需要调用 Close 关闭
+func NewServer() *Server {
+	s := &Server{
+		Credentials: auth.New("storagetest-ak", "storagetest-sk"),
+		RegionID:    "z0",
+		buckets:     make(map[string]map[string]*Object),
+		blocks:      make(map[string]*block),
+		uploads:     make(map[string]*multipartUpload),
+		now:         time.Now,
+	}
+	s.Server = httptest.NewServer(s)
+	s.host = strings.TrimPrefix(s.URL, "http://")
+	return s
+}
+
+// Host 返回服务的地址，格式为 host:port
+func (s *Server) Host() string {
+	return s.host
+}
+
+// Region 返回所有服务都指向模拟服务的区域信息
+func (s *Server) Region() *storage.Region {
+	hosts := []string{s.host}
+	return &storage.Region{
+		SrcUpHosts: hosts,
+		CdnUpHosts: hosts,
+		RsHost:     s.host,
+		RsfHost:    s.host,
+		ApiHost:    s.host,
+		IovipHost:  s.host,
+		RsHosts:    hosts,
+		RsfHosts:   hosts,
+		ApiHosts:   hosts,
+		IoHosts:    hosts,
+	}
+}
+
+// Config 返回指向模拟服务的 storage.Config，其中的区域信息缓存只属于这个 Config
+func (s *Server) Config() *storage.Config {
+	region := s.Region()
+	return &storage.Config{
+		Zone:          region,
+		Region:        region,
+		CentralRsHost: s.host,
+		UcHosts:       []string{s.URL},
+		RegionCache:   storage.NewMemoryRegionCache(),
+	}
+}
+
+// UploadToken 使用服务的密钥为 bucket 生成上传凭证，key 为空时只限制空间
+func (s *Server) UploadToken(bucket, key string) string {
+	policy := storage.PutPolicy{Scope: bucket}
+	if key != "" {
+		policy.Scope = bucket + ":" + key
+	}
+	return policy.UploadToken(s.credentials())
+}
+
+func (s *Server) credentials() *auth.Credentials {
+	if s.Credentials == nil {
+		return auth.New("storagetest-ak", "storagetest-sk")
+	}
+	return s.Credentials
+}
+
+// CreateBucket 创建一个空间，空间已经存在时什么也不做
+func (s *Server) CreateBucket(bucket string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = make(map[string]*Object)
+	}
+}
+
+// PutObject 直接保存一个文件，空间不存在时自动创建
+func (s *Server) PutObject(bucket, key string, data []byte, mimeType string) *Object {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = make(map[string]*Object)
+	}
+	obj := s.newObject(data, mimeType)
+	s.buckets[bucket][key] = obj
+	return obj.clone()
+}
+
+// GetObject 返回保存的文件的副本
+func (s *Server) GetObject(bucket, key string) (*Object, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj, ok := s.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return obj.clone(), true
+}
+
+// Keys 返回空间中所有文件的文件名，按字典序排列
+func (s *Server) Keys(bucket string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return sortedKeys(s.buckets[bucket])
+}
+
+// InjectFault 注入一个故障，多个故障按照注入的顺序匹配
+func (s *Server) InjectFault(fault Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults 清除所有注入的故障
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.faults = nil
+}
+
+// Requests 返回路径以 pathPrefix 开头的请求数量，包括被注入故障的请求
+func (s *Server) Requests(pathPrefix string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := 0
+	for _, path := range s.requests {
+		if strings.HasPrefix(path, pathPrefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Server) newObject(data []byte, mimeType string) *Object {
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return &Object{
+		Data:     data,
+		Hash:     Etag(data),
+		MimeType: mimeType,
+		PutTime:  s.now().UnixNano() / 100,
+	}
+}
+
+func (s *Server) nextID() string {
+	s.seq++
+	return strconv.FormatInt(s.now().UnixNano(), 36) + strconv.FormatInt(s.seq, 36)
+}
+
+// serverError 是模拟服务返回的错误
+type serverError struct {
+	code int
+	msg  string
+}
+
+func (e *serverError) Error() string {
+	return e.msg
+}
+
+func newError(code int, format string, args ...interface{}) error {
+	return &serverError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// ServeHTTP 处理请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if s.injectFault(w, req) {
+		return
+	}
+
+	var (
+		ret interface{}
+		err error
+	)
+	path := req.URL.Path
+	switch {
+	case path == "/v4/query":
+		ret, err = s.queryV4(req)
+	case path == "/v2/query":
+		ret, err = s.queryV2(req)
+	case path == "/batch":
+		ret, err = s.batch(req)
+	case path == "/list":
+		ret, err = s.list(req)
+	case path == "/v2/list":
+		s.listV2(w, req)
+		return
+	case path == "/" && req.Method == http.MethodPost:
+		ret, err = s.formUpload(req)
+	case strings.HasPrefix(path, "/mkblk/"):
+		ret, err = s.mkblk(req)
+	case strings.HasPrefix(path, "/bput/"):
+		ret, err = s.bput(req)
+	case strings.HasPrefix(path, "/mkfile/"):
+		ret, err = s.mkfile(req)
+	case strings.HasPrefix(path, "/buckets/"):
+		ret, err = s.multipart(req)
+	case strings.HasPrefix(path, "/fetch/"):
+		ret, err = s.fetch(req)
+	default:
+		if err = s.checkManagementAuth(req); err == nil {
+			s.lock.Lock()
+			ret, err = s.op(path)
+			s.lock.Unlock()
+		}
+	}
+	writeResponse(w, ret, err)
+}
+
+func (s *Server) injectFault(w http.ResponseWriter, req *http.Request) bool {
+	s.lock.Lock()
+	s.requests = append(s.requests, req.URL.Path)
+	var fault *Fault
+	for i, f := range s.faults {
+		if !f.match(req) {
+			continue
+		}
+		fault = f
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		break
+	}
+	s.lock.Unlock()
+
+	if fault == nil {
+		return false
+	}
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-req.Context().Done():
+			return true
+		}
+	}
+	if fault.CloseConn {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+	}
+	code, msg := fault.Code, fault.Error
+	if code == 0 {
+		code = http.StatusServiceUnavailable
+	}
+	if msg == "" {
+		msg = http.StatusText(code)
+	}
+	writeResponse(w, nil, newError(code, "%s", msg))
+	return true
+}
+
+func writeResponse(w http.ResponseWriter, ret interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Reqid", "storagetest")
+	if err != nil {
+		code := http.StatusInternalServerError
+		if e, ok := err.(*serverError); ok {
+			code = e.code
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if ret == nil {
+		ret = struct{}{}
+	}
+	json.NewEncoder(w).Encode(ret)
+}
+
+// checkManagementAuth 校验管理凭证，支持 QBox 和 Qiniu 两种签名方式
+func (s *Server) checkManagementAuth(req *http.Request) error {
+	if s.Credentials == nil {
+		return nil
+	}
+	authorization := req.Header.Get("Authorization")
+	var (
+		token string
+		err   error
+	)
+	switch {
+	case strings.HasPrefix(authorization, "Qiniu "):
+		token, err = s.Credentials.SignRequestV2(req)
+		token = "Qiniu " + token
+	case strings.HasPrefix(authorization, "QBox "):
+		token, err = s.Credentials.SignRequest(req)
+		token = "QBox " + token
+	default:
+		return newError(CodeUnauthorized, "bad token")
+	}
+	if err != nil {
+		return newError(CodeBadRequest, "%v", err)
+	}
+	if token != authorization {
+		return newError(CodeUnauthorized, "bad token")
+	}
+	return nil
+}
+
+func decodeEntry(encoded string) (bucket, key string, hasKey bool, err error) {
+	entry, dErr := base64.URLEncoding.DecodeString(encoded)
+	if dErr != nil {
+		err = newError(CodeBadRequest, "invalid entry")
+		return
+	}
+	items := strings.SplitN(string(entry), ":", 2)
+	bucket = items[0]
+	if len(items) == 2 {
+		key, hasKey = items[1], true
+	}
+	return
+}
+
+func decodeString(encoded string) (string, error) {
+	bs, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", newError(CodeBadRequest, "invalid base64 string")
+	}
+	return string(bs), nil
+}
+
+// lookup 查找文件，调用时需要持有锁
+func (s *Server) lookup(bucket, key string) (map[string]*Object, *Object, error) {
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return nil, nil, newError(CodeNoSuchBucket, "no such bucket")
+	}
+	obj, ok := objects[key]
+	if !ok {
+		return objects, nil, newError(CodeNoSuchEntry, "no such file or directory")
+	}
+	return objects, obj, nil
+}
+
+// op 执行一个资源管理命令，比如 /stat/<EncodedEntry>，调用时需要持有锁
+func (s *Server) op(cmd string) (interface{}, error) {
+	parts := strings.Split(strings.TrimPrefix(cmd, "/"), "/")
+	if len(parts) < 2 {
+		return nil, newError(CodeBadRequest, "unknown op: %s", cmd)
+	}
+	bucket, key, _, err := decodeEntry(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	switch parts[0] {
+	case "stat":
+		_, obj, err := s.lookup(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		return obj.fileInfo(), nil
+	case "delete":
+		objects, _, err := s.lookup(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		delete(objects, key)
+		return nil, nil
+	case "copy", "move":
+		if len(parts) < 3 {
+			return nil, newError(CodeBadRequest, "invalid %s op", parts[0])
+		}
+		destBucket, destKey, _, err := decodeEntry(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		force := len(parts) >= 5 && parts[3] == "force" && parts[4] == "true"
+		objects, obj, err := s.lookup(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		destObjects, ok := s.buckets[destBucket]
+		if !ok {
+			return nil, newError(CodeNoSuchBucket, "no such bucket")
+		}
+		if _, exists := destObjects[destKey]; exists && !force {
+			return nil, newError(CodeEntryExists, "file exists")
+		}
+		if parts[0] == "move" {
+			delete(objects, key)
+			destObjects[destKey] = obj
+		} else {
+			destObjects[destKey] = obj.clone()
+		}
+		return nil, nil
+	case "chgm":
+		if len(parts) < 4 {
+			return nil, newError(CodeBadRequest, "invalid chgm op")
+		}
+		mimeType, err := decodeString(parts[3])
+		if err != nil {
+			return nil, err
+		}
+		_, obj, err := s.lookup(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		obj.MimeType = mimeType
+		return nil, nil
+	case "chtype":
+		if len(parts) < 4 {
+			return nil, newError(CodeBadRequest, "invalid chtype op")
+		}
+		fileType, pErr := strconv.Atoi(parts[3])
+		if pErr != nil {
+			return nil, newError(CodeBadRequest, "invalid file type")
+		}
+		_, obj, err := s.lookup(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		obj.Type = fileType
+		obj.RestoreStatus = storage.RestoreStatusNone
+		return nil, nil
+	case "deleteAfterDays":
+		if len(parts) < 3 {
+			return nil, newError(CodeBadRequest, "invalid deleteAfterDays op")
+		}
+		days, pErr := strconv.Atoi(parts[2])
+		if pErr != nil {
+			return nil, newError(CodeBadRequest, "invalid days")
+		}
+		_, obj, err := s.lookup(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		obj.DeleteAfterDays = days
+		return nil, nil
+	case "restoreAr":
+		_, obj, err := s.lookup(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		if obj.Type != storage.FileTypeArchive {
+			return nil, newError(CodeBadRequest, "invalid file type")
+		}
+		if obj.RestoreStatus != storage.RestoreStatusNone {
+			return nil, newError(CodeBadRequest, "already in restore")
+		}
+		// 模拟服务中解冻立即完成
+		obj.RestoreStatus = storage.RestoreStatusRestored
+		return nil, nil
+	case "prefetch":
+		_, _, err := s.lookup(bucket, key)
+		return nil, err
+	}
+	return nil, newError(CodeBadRequest, "unknown op: %s", parts[0])
+}
+
+type batchOpRet struct {
+	Code int         `json:"code"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+func (s *Server) batch(req *http.Request) (interface{}, error) {
+	if err := s.checkManagementAuth(req); err != nil {
+		return nil, err
+	}
+	if err := req.ParseForm(); err != nil {
+		return nil, newError(CodeBadRequest, "%v", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	rets := make([]batchOpRet, 0, len(req.PostForm["op"]))
+	for _, op := range req.PostForm["op"] {
+		data, err := s.op(op)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if e, ok := err.(*serverError); ok {
+				code = e.code
+			}
+			rets = append(rets, batchOpRet{Code: code, Data: map[string]string{"error": err.Error()}})
+			continue
+		}
+		rets = append(rets, batchOpRet{Code: http.StatusOK, Data: data})
+	}
+	return rets, nil
+}
+
+// listEntries 列举文件，返回文件、目录和下一页的 marker，调用时需要持有锁
+// marker 为上一页最后一个文件名或者目录的 URL Safe Base64 编码
+func (s *Server) listEntries(query url.Values) (items []storage.ListItem, dirs []string, nextMarker string, err error) {
+	objects, ok := s.buckets[query.Get("bucket")]
+	if !ok {
+		err = newError(CodeNoSuchBucket, "no such bucket")
+		return
+	}
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	after := ""
+	if marker := query.Get("marker"); marker != "" {
+		if after, err = decodeString(marker); err != nil {
+			return
+		}
+	}
+	limit := 1000
+	if l := query.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+			err = newError(CodeBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	last := ""
+	for _, key := range sortedKeys(objects) {
+		if !strings.HasPrefix(key, prefix) || after != "" && key <= after {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				dir := key[:len(prefix)+i+len(delimiter)]
+				if dir == after || len(dirs) > 0 && dirs[len(dirs)-1] == dir {
+					continue
+				}
+				if len(items)+len(dirs) >= limit {
+					nextMarker = base64.URLEncoding.EncodeToString([]byte(last))
+					return
+				}
+				dirs = append(dirs, dir)
+				last = dir
+				continue
+			}
+		}
+		if len(items)+len(dirs) >= limit {
+			nextMarker = base64.URLEncoding.EncodeToString([]byte(last))
+			return
+		}
+		items = append(items, objects[key].listItem(key))
+		last = key
+	}
+	return
+}
+
+func (s *Server) list(req *http.Request) (interface{}, error) {
+	if err := s.checkManagementAuth(req); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	items, dirs, marker, err := s.listEntries(req.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"marker":         marker,
+		"items":          items,
+		"commonPrefixes": dirs,
+	}, nil
+}
+
+// listV2 以流的方式返回列举结果，每个文件或者目录是一个 JSON 对象
+func (s *Server) listV2(w http.ResponseWriter, req *http.Request) {
+	if err := s.checkManagementAuth(req); err != nil {
+		writeResponse(w, nil, err)
+		return
+	}
+
+	query := req.URL.Query()
+	query.Set("limit", "1000000")
+	s.lock.Lock()
+	items, dirs, _, err := s.listEntries(query)
+	s.lock.Unlock()
+	if err != nil {
+		writeResponse(w, nil, err)
+		return
+	}
+
+	type entry struct {
+		Marker string           `json:"marker"`
+		Item   storage.ListItem `json:"item"`
+		Dir    string           `json:"dir"`
+	}
+	entries := make([]entry, 0, len(items)+len(dirs))
+	for _, item := range items {
+		entries = append(entries, entry{Item: item})
+	}
+	for _, dir := range dirs {
+		entries = append(entries, entry{Dir: dir})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Item.Key+entries[i].Dir < entries[j].Item.Key+entries[j].Dir
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		e.Marker = base64.URLEncoding.EncodeToString([]byte(e.Item.Key + e.Dir))
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) fetch(req *http.Request) (interface{}, error) {
+	if err := s.checkManagementAuth(req); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[2] != "to" {
+		return nil, newError(CodeBadRequest, "invalid fetch op")
+	}
+	resURL, err := decodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	bucket, key, hasKey, err := decodeEntry(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	resp, gErr := http.Get(resURL)
+	if gErr != nil {
+		return nil, newError(478, "fetch failed: %v", gErr)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, newError(478, "fetch failed: %s", resp.Status)
+	}
+	data, rErr := ioutil.ReadAll(resp.Body)
+	if rErr != nil {
+		return nil, newError(478, "fetch failed: %v", rErr)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return nil, newError(CodeNoSuchBucket, "no such bucket")
+	}
+	obj := s.newObject(data, resp.Header.Get("Content-Type"))
+	if !hasKey {
+		key = obj.Hash
+	}
+	objects[key] = obj
+	return storage.FetchRet{Hash: obj.Hash, Fsize: int64(len(data)), MimeType: obj.MimeType, Key: key}, nil
+}
+
+func sortedKeys(objects map[string]*Object) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Etag 按照七牛的 etag 算法计算数据的 hash 值
+func Etag(data []byte) string {
+	if len(data) <= blockSize {
+		sum := sha1.Sum(data)
+		return base64.URLEncoding.EncodeToString(append([]byte{0x16}, sum[:]...))
+	}
+	h := sha1.New()
+	for offset := 0; offset < len(data); offset += blockSize {
+		end := offset + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha1.Sum(data[offset:end])
+		h.Write(sum[:])
+	}
+	return base64.URLEncoding.EncodeToString(h.Sum([]byte{0x96}))
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func crc32Of(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, newError(CodeBadRequest, "read body: %v", err)
+	}
+	return data, nil
+}
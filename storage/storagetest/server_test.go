@@ -0,0 +1,351 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+	"github.com/qiniu/api.v7/v7/client"
+	"github.com/qiniu/api.v7/v7/storage"
+)
+
+func newTestServer(t *testing.T) *Server {
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	srv.CreateBucket("test")
+	srv.CreateBucket("backup")
+	return srv
+}
+
+func randomData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+func errorCode(err error) int {
+	if e, ok := err.(*client.ErrorInfo); ok {
+		return e.Code
+	}
+	return 0
+}
+
+func TestBucketManager(t *testing.T) {
+	srv := newTestServer(t)
+	m := storage.NewBucketManager(srv.Credentials, srv.Config())
+
+	obj := srv.PutObject("test", "a.txt", []byte("hello"), "text/plain")
+	info, err := m.Stat("test", "a.txt")
+	if err != nil {
+		t.Fatalf("Stat() error: %v", err)
+	}
+	if info.Hash != obj.Hash || info.Fsize != 5 || info.MimeType != "text/plain" {
+		t.Errorf("Stat() got %+v", info)
+	}
+	if _, err = m.Stat("test", "missing"); errorCode(err) != CodeNoSuchEntry {
+		t.Errorf("Stat() missing file want 612, got %v", err)
+	}
+
+	if err = m.Copy("test", "a.txt", "backup", "a.txt", false); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if err = m.Copy("test", "a.txt", "backup", "a.txt", false); errorCode(err) != CodeEntryExists {
+		t.Errorf("Copy() existing file want 614, got %v", err)
+	}
+	if err = m.Move("test", "a.txt", "test", "b.txt", false); err != nil {
+		t.Fatalf("Move() error: %v", err)
+	}
+	if err = m.ChangeMime("test", "b.txt", "application/json"); err != nil {
+		t.Fatalf("ChangeMime() error: %v", err)
+	}
+	if err = m.Delete("backup", "a.txt"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if keys := srv.Keys("test"); len(keys) != 1 || keys[0] != "b.txt" {
+		t.Errorf("want [b.txt], got %v", keys)
+	}
+	if obj, _ := srv.GetObject("test", "b.txt"); obj.MimeType != "application/json" {
+		t.Errorf("ChangeMime() not applied: %s", obj.MimeType)
+	}
+
+	rets, err := m.Batch([]string{
+		storage.URIStat("test", "b.txt"),
+		storage.URIStat("test", "missing"),
+		storage.URIChangeType("test", "b.txt", storage.FileTypeIA),
+	})
+	if err != nil {
+		t.Fatalf("Batch() error: %v", err)
+	}
+	if rets[0].Code != 200 || rets[0].Data.Hash != obj.Hash || rets[1].Code != CodeNoSuchEntry || rets[2].Code != 200 {
+		t.Errorf("Batch() got %+v", rets)
+	}
+}
+
+func TestBucketManagerBadCredentials(t *testing.T) {
+	srv := newTestServer(t)
+	srv.PutObject("test", "a.txt", []byte("hello"), "")
+
+	m := storage.NewBucketManager(auth.New(srv.Credentials.AccessKey, "wrong"), srv.Config())
+	if _, err := m.Stat("test", "a.txt"); errorCode(err) != CodeUnauthorized {
+		t.Errorf("want 401, got %v", err)
+	}
+	if _, err := m.Batch([]string{storage.URIStat("test", "a.txt")}); errorCode(err) != CodeUnauthorized {
+		t.Errorf("want 401, got %v", err)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	srv := newTestServer(t)
+	m := storage.NewBucketManager(srv.Credentials, srv.Config())
+	for _, key := range []string{"a/1", "a/2", "b/1", "c", "d"} {
+		srv.PutObject("test", key, []byte(key), "")
+	}
+
+	var (
+		keys   []string
+		dirs   []string
+		marker string
+	)
+	for {
+		items, prefixes, next, hasNext, err := m.ListFiles("test", "", "/", marker, 2)
+		if err != nil {
+			t.Fatalf("ListFiles() error: %v", err)
+		}
+		for _, item := range items {
+			keys = append(keys, item.Key)
+		}
+		dirs = append(dirs, prefixes...)
+		if !hasNext {
+			break
+		}
+		marker = next
+	}
+	if len(keys) != 2 || keys[0] != "c" || keys[1] != "d" || len(dirs) != 2 || dirs[0] != "a/" || dirs[1] != "b/" {
+		t.Errorf("ListFiles() got keys %v dirs %v", keys, dirs)
+	}
+
+	retCh, err := m.ListBucket("test", "a/", "", "")
+	if err != nil {
+		t.Fatalf("ListBucket() error: %v", err)
+	}
+	keys = nil
+	for ret := range retCh {
+		keys = append(keys, ret.Item.Key)
+	}
+	if len(keys) != 2 || keys[0] != "a/1" || keys[1] != "a/2" {
+		t.Errorf("ListBucket() got %v", keys)
+	}
+}
+
+func TestFormUpload(t *testing.T) {
+	srv := newTestServer(t)
+	uploader := storage.NewFormUploader(srv.Config())
+	data := []byte("form upload content")
+
+	var ret storage.PutRet
+	err := uploader.Put(context.Background(), &ret, srv.UploadToken("test", ""), "form.txt",
+		bytes.NewReader(data), int64(len(data)), &storage.PutExtra{Params: map[string]string{"x:foo": "bar"}})
+	if err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	obj, ok := srv.GetObject("test", "form.txt")
+	if !ok || !bytes.Equal(obj.Data, data) || ret.Hash != Etag(data) || ret.Key != "form.txt" || obj.Params["x:foo"] != "bar" {
+		t.Errorf("Put() got %+v, stored %+v", ret, obj)
+	}
+
+	// scope 只有空间时不能覆盖内容不同的文件
+	err = uploader.Put(context.Background(), &ret, srv.UploadToken("test", ""), "form.txt",
+		bytes.NewReader([]byte("other")), 5, nil)
+	if errorCode(err) != CodeEntryExists {
+		t.Errorf("Put() existing file want 614, got %v", err)
+	}
+	err = uploader.Put(context.Background(), &ret, srv.UploadToken("test", "form.txt"), "form.txt",
+		bytes.NewReader([]byte("other")), 5, nil)
+	if err != nil {
+		t.Errorf("Put() overwrite error: %v", err)
+	}
+
+	policy := storage.PutPolicy{Scope: "test", ReturnBody: `{"key":"$(key)","size":$(fsize),"foo":"$(x:foo)"}`}
+	var custom struct {
+		Key  string `json:"key"`
+		Size int    `json:"size"`
+		Foo  string `json:"foo"`
+	}
+	err = uploader.PutWithoutKey(context.Background(), &custom, policy.UploadToken(srv.Credentials),
+		bytes.NewReader(data), int64(len(data)), &storage.PutExtra{Params: map[string]string{"x:foo": "bar"}})
+	if err != nil || custom.Key != Etag(data) || custom.Size != len(data) || custom.Foo != "bar" {
+		t.Errorf("PutWithoutKey() got %+v, %v", custom, err)
+	}
+
+	policy = storage.PutPolicy{Scope: "test"}
+	err = uploader.Put(context.Background(), &ret, policy.UploadToken(auth.New(srv.Credentials.AccessKey, "wrong")), "bad.txt", bytes.NewReader(data), int64(len(data)), nil)
+	if errorCode(err) != CodeUnauthorized {
+		t.Errorf("Put() with bad token want 401, got %v", err)
+	}
+}
+
+func TestResumeUpload(t *testing.T) {
+	srv := newTestServer(t)
+	uploader := storage.NewResumeUploader(srv.Config())
+	data := randomData(5<<20 + 123)
+
+	var ret storage.PutRet
+	err := uploader.Put(context.Background(), &ret, srv.UploadToken("test", ""), "resume.bin",
+		bytes.NewReader(data), int64(len(data)), &storage.RputExtra{ChunkSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	obj, ok := srv.GetObject("test", "resume.bin")
+	if !ok || !bytes.Equal(obj.Data, data) || ret.Hash != Etag(data) {
+		t.Errorf("Put() got %+v", ret)
+	}
+}
+
+func TestResumeUploadV2(t *testing.T) {
+	srv := newTestServer(t)
+	uploader := storage.NewResumeUploaderV2(srv.Config())
+	data := randomData(3<<20 + 7)
+
+	var ret storage.PutRet
+	err := uploader.Put(context.Background(), &ret, srv.UploadToken("test", ""), "resume-v2.bin",
+		bytes.NewReader(data), int64(len(data)), &storage.RputV2Extra{PartSize: 1 << 20, MimeType: "application/x-test"})
+	if err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	obj, ok := srv.GetObject("test", "resume-v2.bin")
+	if !ok || !bytes.Equal(obj.Data, data) || obj.MimeType != "application/x-test" || ret.Key != "resume-v2.bin" {
+		t.Errorf("Put() got %+v", ret)
+	}
+}
+
+func TestRegionQuery(t *testing.T) {
+	srv := newTestServer(t)
+	cfg := srv.Config()
+	cfg.Zone, cfg.Region = nil, nil
+
+	m := storage.NewBucketManager(srv.Credentials, cfg)
+	region, err := m.Zone("test")
+	if err != nil {
+		t.Fatalf("Zone() error: %v", err)
+	}
+	if region.SrcUpHosts[0] != srv.Host() || region.RsHost != srv.Host() {
+		t.Errorf("Zone() got %v", region)
+	}
+	if srv.Requests("/v4/query") != 1 {
+		t.Errorf("want 1 region query, got %d", srv.Requests("/v4/query"))
+	}
+}
+
+func TestInjectFault(t *testing.T) {
+	srv := newTestServer(t)
+	srv.PutObject("test", "a.txt", []byte("hello"), "")
+	m := storage.NewBucketManager(srv.Credentials, srv.Config())
+
+	srv.InjectFault(Fault{Path: "/stat/", Code: 579, Times: 1})
+	if _, err := m.Stat("test", "a.txt"); errorCode(err) != 579 {
+		t.Errorf("want 579, got %v", err)
+	}
+	if _, err := m.Stat("test", "a.txt"); err != nil {
+		t.Errorf("fault should be used up, got %v", err)
+	}
+
+	srv.InjectFault(Fault{Method: http.MethodPost, Path: "/delete/", CloseConn: true})
+	if err := m.Delete("test", "a.txt"); err == nil || errorCode(err) != 0 {
+		t.Errorf("want network error, got %v", err)
+	}
+	srv.ClearFaults()
+	if err := m.Delete("test", "a.txt"); err != nil {
+		t.Errorf("Delete() after ClearFaults error: %v", err)
+	}
+	if srv.Requests("/stat/") != 2 || srv.Requests("/delete/") != 2 {
+		t.Errorf("unexpected request count: stat %d delete %d", srv.Requests("/stat/"), srv.Requests("/delete/"))
+	}
+}
+
+func TestRetryWithFault(t *testing.T) {
+	srv := newTestServer(t)
+	srv.PutObject("test", "a.txt", []byte("hello"), "")
+
+	policy := client.NewRetryPolicy(3)
+	policy.BaseDelay = time.Millisecond
+	clt := client.Client{Client: &http.Client{}, RetryPolicy: policy}
+	m := storage.NewBucketManagerEx(srv.Credentials, srv.Config(), &clt)
+
+	srv.InjectFault(Fault{Path: "/stat/", Code: 599, Times: 2})
+	if _, err := m.Stat("test", "a.txt"); err != nil {
+		t.Fatalf("Stat() with retry error: %v", err)
+	}
+	if srv.Requests("/stat/") != 3 {
+		t.Errorf("want 3 stat requests, got %d", srv.Requests("/stat/"))
+	}
+
+	// 删除不是幂等的请求，不会重试
+	srv.InjectFault(Fault{Path: "/delete/", Code: 599, Times: 1})
+	if err := m.Delete("test", "a.txt"); errorCode(err) != 599 {
+		t.Errorf("want 599, got %v", err)
+	}
+	if srv.Requests("/delete/") != 1 {
+		t.Errorf("want 1 delete request, got %d", srv.Requests("/delete/"))
+	}
+}
+
+func TestHostFailover(t *testing.T) {
+	srv := newTestServer(t)
+	srv.PutObject("test", "a.txt", []byte("hello"), "")
+
+	// 第一个地址无法连接，第二个地址和第三个地址都指向模拟服务
+	cfg := srv.Config()
+	hosts := []string{"127.0.0.1:1", srv.Host(), srv.Host()}
+	for _, region := range []*storage.Region{cfg.Zone, cfg.Region} {
+		region.SrcUpHosts, region.CdnUpHosts = hosts, hosts
+		region.RsHosts, region.RsfHosts, region.ApiHosts, region.IoHosts = hosts, hosts, hosts, hosts
+	}
+	m := storage.NewBucketManager(srv.Credentials, cfg)
+
+	if _, err := m.Stat("test", "a.txt"); err != nil {
+		t.Fatalf("Stat() with dead host error: %v", err)
+	}
+	// 幂等的请求返回可以重试的错误时使用下一个地址
+	srv.InjectFault(Fault{Path: "/stat/", Code: 503, Times: 1})
+	if _, err := m.Stat("test", "a.txt"); err != nil {
+		t.Fatalf("Stat() with fault error: %v", err)
+	}
+	if srv.Requests("/stat/") != 3 {
+		t.Errorf("want 3 stat requests, got %d", srv.Requests("/stat/"))
+	}
+
+	// 非幂等的请求只在请求没有被处理时使用下一个地址
+	srv.InjectFault(Fault{Path: "/delete/", Code: 503, Times: 1})
+	if err := m.Delete("test", "a.txt"); errorCode(err) != 503 {
+		t.Errorf("want 503, got %v", err)
+	}
+	if err := m.Delete("test", "a.txt"); err != nil {
+		t.Errorf("Delete() with dead host error: %v", err)
+	}
+	if srv.Requests("/delete/") != 2 {
+		t.Errorf("want 2 delete requests, got %d", srv.Requests("/delete/"))
+	}
+
+	data := randomData(3<<20 + 7)
+	var ret storage.PutRet
+	err := storage.NewFormUploader(cfg).Put(context.Background(), &ret, srv.UploadToken("test", ""), "form.bin",
+		bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil || ret.Hash != Etag(data) {
+		t.Errorf("form Put() got %+v, %v", ret, err)
+	}
+	err = storage.NewResumeUploader(cfg).Put(context.Background(), &ret, srv.UploadToken("test", ""), "resume.bin",
+		bytes.NewReader(data), int64(len(data)), &storage.RputExtra{ChunkSize: 1 << 20})
+	if err != nil || ret.Hash != Etag(data) {
+		t.Errorf("resume Put() got %+v, %v", ret, err)
+	}
+	srv.InjectFault(Fault{Method: http.MethodPut, Path: "/buckets/test/objects/", Code: 503, Times: 1})
+	err = storage.NewResumeUploaderV2(cfg).Put(context.Background(), &ret, srv.UploadToken("test", ""), "resume-v2.bin",
+		bytes.NewReader(data), int64(len(data)), &storage.RputV2Extra{PartSize: 1 << 20})
+	if err != nil || ret.Key != "resume-v2.bin" {
+		t.Errorf("resume v2 Put() got %+v, %v", ret, err)
+	}
+}
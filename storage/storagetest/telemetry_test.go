@@ -0,0 +1,83 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/storage"
+	"github.com/qiniu/api.v7/v7/telemetry"
+)
+
+func TestTelemetry(t *testing.T) {
+	srv := newTestServer(t)
+	r := telemetry.NewRecorder()
+	ctx := telemetry.WithObserver(context.Background(), r)
+
+	data := randomData(2<<20 + 5)
+	srv.InjectFault(Fault{Method: http.MethodPut, Path: "/buckets/test/objects/", Code: 599, Times: 1})
+	uploader := storage.NewResumeUploaderV2(srv.Config())
+	err := uploader.Put(ctx, nil, srv.UploadToken("test", ""), "a.bin",
+		bytes.NewReader(data), int64(len(data)), &storage.RputV2Extra{PartSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+
+	uploads := r.Spans(telemetry.OpUpload)
+	if len(uploads) != 1 {
+		t.Fatalf("want 1 upload span, got %d", len(uploads))
+	}
+	attrs := uploads[0].Attributes
+	if attrs[telemetry.AttrBucket] != "test" || attrs[telemetry.AttrKey] != "a.bin" ||
+		attrs[telemetry.AttrBytes] != int64(len(data)) || attrs[telemetry.AttrOutcome] != telemetry.OutcomeSuccess ||
+		attrs[telemetry.AttrUploadMethod] != "resume_v2" {
+		t.Errorf("unexpected upload attributes: %v", attrs)
+	}
+
+	// 3 个分片，其中一个分片第一次上传失败
+	parts := r.Spans(telemetry.OpUploadPart)
+	if len(parts) != 4 {
+		t.Fatalf("want 4 part spans, got %d", len(parts))
+	}
+	failed, retried := 0, 0
+	for _, part := range parts {
+		if part.Parent != uploads[0] {
+			t.Errorf("part span should be a child of the upload span")
+		}
+		if part.Attributes[telemetry.AttrOutcome] == telemetry.OutcomeError {
+			failed++
+		}
+		if part.Attributes[telemetry.AttrAttempt] == int64(2) {
+			retried++
+		}
+		if len(part.Events) != 1 || part.Events[0].Name != telemetry.EventHTTPAttempt ||
+			part.Events[0].Attributes[telemetry.AttrHost] != srv.Host() || part.Events[0].Attributes[telemetry.AttrReqid] == "" {
+			t.Errorf("unexpected part events: %+v", part.Events)
+		}
+	}
+	if failed != 1 || retried != 1 {
+		t.Errorf("want 1 failed part and 1 retried part, got %d, %d", failed, retried)
+	}
+
+	// 没有 context 参数的方法使用 DefaultObserver
+	telemetry.DefaultObserver = r
+	defer func() { telemetry.DefaultObserver = telemetry.NopObserver{} }()
+	m := storage.NewBucketManager(srv.Credentials, srv.Config())
+	if _, err = m.Batch([]string{storage.URIStat("test", "a.bin")}); err != nil {
+		t.Fatalf("Batch() error: %v", err)
+	}
+	if batches := r.Spans(telemetry.OpBatch); len(batches) != 1 || batches[0].Attributes[telemetry.AttrBatchSize] != int64(1) {
+		t.Errorf("unexpected batch spans: %+v", batches)
+	}
+	if _, _, _, _, err = m.ListFiles("test", "", "", "", 10); err != nil {
+		t.Fatalf("ListFiles() error: %v", err)
+	}
+	if pages := r.Spans(telemetry.OpListPage); len(pages) != 1 || pages[0].Attributes[telemetry.AttrListCount] != int64(1) {
+		t.Errorf("unexpected list spans: %+v", pages)
+	}
+	if r.Counter(telemetry.MetricOperations) != 7 || r.Counter(telemetry.MetricRequests) < 6 {
+		t.Errorf("unexpected counters: operations %d, requests %d",
+			r.Counter(telemetry.MetricOperations), r.Counter(telemetry.MetricRequests))
+	}
+}
@@ -0,0 +1,500 @@
+package storagetest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/storage"
+)
+
+// upToken 是解析后的上传凭证
+type upToken struct {
+	policy storage.PutPolicy
+	bucket string
+	key    string
+
+	// scope 中是否指定了文件名或者文件名前缀
+	scopeHasKey bool
+}
+
+// parseUpToken 解析并校验上传凭证
+func (s *Server) parseUpToken(token string) (*upToken, error) {
+	items := strings.Split(token, ":")
+	if len(items) != 3 {
+		return nil, newError(CodeUnauthorized, "bad token")
+	}
+	policyBytes, err := base64.URLEncoding.DecodeString(items[2])
+	if err != nil {
+		return nil, newError(CodeUnauthorized, "bad token")
+	}
+	if s.Credentials != nil && s.Credentials.SignWithData(policyBytes) != token {
+		return nil, newError(CodeUnauthorized, "bad token")
+	}
+
+	t := &upToken{}
+	if err = json.Unmarshal(policyBytes, &t.policy); err != nil {
+		return nil, newError(CodeUnauthorized, "bad token")
+	}
+	if int64(t.policy.Expires) < s.now().Unix() {
+		return nil, newError(CodeUnauthorized, "expired token")
+	}
+	scope := strings.SplitN(t.policy.Scope, ":", 2)
+	t.bucket = scope[0]
+	if len(scope) == 2 {
+		t.key, t.scopeHasKey = scope[1], true
+	}
+	return t, nil
+}
+
+// upTokenFromHeader 从 "UpToken <token>" 格式的 Authorization 头中解析上传凭证
+func (s *Server) upTokenFromHeader(req *http.Request) (*upToken, error) {
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "UpToken ") {
+		return nil, newError(CodeUnauthorized, "bad token")
+	}
+	return s.parseUpToken(strings.TrimPrefix(authorization, "UpToken "))
+}
+
+// upload 描述一次上传完成时的文件信息
+type upload struct {
+	key      string
+	hasKey   bool
+	fname    string
+	mimeType string
+	data     []byte
+	params   map[string]string
+}
+
+// save 按照上传策略保存上传的文件，返回上传的回复内容
+func (s *Server) save(t *upToken, u *upload) (interface{}, error) {
+	fsize := int64(len(u.data))
+	if t.policy.FsizeLimit > 0 && fsize > t.policy.FsizeLimit {
+		return nil, newError(http.StatusRequestEntityTooLarge, "file size exceeds the limit")
+	}
+	if t.policy.FsizeMin > 0 && fsize < t.policy.FsizeMin {
+		return nil, newError(403, "file size is smaller than the minimum")
+	}
+	if u.mimeType == "" || u.mimeType == "application/octet-stream" || t.policy.DetectMime != 0 {
+		u.mimeType = http.DetectContentType(u.data)
+	}
+	if !storage.MatchMimeLimit(t.policy.MimeLimit, u.mimeType) {
+		return nil, newError(403, "limited mimeType: this file type (%s) is forbidden to upload", u.mimeType)
+	}
+
+	hash := Etag(u.data)
+	vars := map[string]string{
+		"bucket":   t.bucket,
+		"etag":     hash,
+		"fsize":    strconv.FormatInt(fsize, 10),
+		"mimeType": u.mimeType,
+		"endUser":  t.policy.EndUser,
+		"fname":    u.fname,
+		"ext":      path.Ext(u.fname),
+	}
+	for k, v := range u.params {
+		vars[k] = v
+	}
+
+	key, hasKey := u.key, u.hasKey
+	if t.policy.SaveKey != "" && (t.policy.ForceSaveKey || !hasKey) {
+		key, hasKey = expandMagicVariables(t.policy.SaveKey, vars), true
+	}
+	switch {
+	case t.scopeHasKey && t.policy.IsPrefixalScope != 0:
+		if !hasKey || !strings.HasPrefix(key, t.key) {
+			return nil, newError(403, "key doesn't match with scope")
+		}
+	case t.scopeHasKey:
+		if hasKey && key != t.key {
+			return nil, newError(403, "key doesn't match with scope")
+		}
+		key, hasKey = t.key, true
+	}
+	if !hasKey {
+		key = hash
+	}
+	vars["key"] = key
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	objects, ok := s.buckets[t.bucket]
+	if !ok {
+		return nil, newError(CodeNoSuchBucket, "no such bucket")
+	}
+	// scope 中没有指定文件名时只能新增文件，内容相同的重复上传视为成功
+	insertOnly := !t.scopeHasKey || t.policy.IsPrefixalScope != 0 || t.policy.InsertOnly != 0
+	if old, exists := objects[key]; exists && insertOnly && old.Hash != hash {
+		return nil, newError(CodeEntryExists, "file exists")
+	}
+
+	obj := s.newObject(u.data, u.mimeType)
+	obj.EndUser = t.policy.EndUser
+	obj.Type = t.policy.FileType
+	obj.DeleteAfterDays = t.policy.DeleteAfterDays
+	obj.Params = u.params
+	objects[key] = obj
+
+	if t.policy.ReturnBody != "" {
+		return json.RawMessage(expandMagicVariables(t.policy.ReturnBody, vars)), nil
+	}
+	return storage.PutRet{Hash: hash, Key: key}, nil
+}
+
+// expandMagicVariables 替换上传策略中的魔法变量和自定义变量，比如 $(key)、$(x:foo)
+func expandMagicVariables(tpl string, vars map[string]string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(tpl, "$(")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(tpl[start:], ")")
+		if end < 0 {
+			break
+		}
+		b.WriteString(tpl[:start])
+		b.WriteString(vars[tpl[start+2:start+end]])
+		tpl = tpl[start+end+1:]
+	}
+	b.WriteString(tpl)
+	return b.String()
+}
+
+func (s *Server) formUpload(req *http.Request) (interface{}, error) {
+	if err := req.ParseMultipartForm(32 << 20); err != nil {
+		return nil, newError(CodeBadRequest, "invalid multipart form: %v", err)
+	}
+	t, err := s.parseUpToken(req.FormValue("token"))
+	if err != nil {
+		return nil, err
+	}
+
+	file, header, fErr := req.FormFile("file")
+	if fErr != nil {
+		return nil, newError(CodeBadRequest, "file is not specified in multipart")
+	}
+	defer file.Close()
+	data, rErr := ioutil.ReadAll(file)
+	if rErr != nil {
+		return nil, newError(CodeBadRequest, "read file: %v", rErr)
+	}
+	if crc := req.FormValue("crc32"); crc != "" {
+		if want, pErr := strconv.ParseUint(crc, 10, 32); pErr != nil || uint32(want) != crc32Of(data) {
+			return nil, newError(CodeBadRequest, "crc32 not match")
+		}
+	}
+
+	u := &upload{
+		fname:    header.Filename,
+		mimeType: header.Header.Get("Content-Type"),
+		data:     data,
+		params:   make(map[string]string),
+	}
+	if keys, ok := req.MultipartForm.Value["key"]; ok && len(keys) > 0 {
+		u.key, u.hasKey = keys[0], true
+	}
+	for k, v := range req.MultipartForm.Value {
+		if (strings.HasPrefix(k, "x:") || strings.HasPrefix(k, "x-qn-meta-")) && len(v) > 0 {
+			u.params[k] = v[0]
+		}
+	}
+	return s.save(t, u)
+}
+
+// block 是分片上传 v1 中正在上传的块
+type block struct {
+	data []byte
+	size int
+}
+
+func (s *Server) mkblk(req *http.Request) (interface{}, error) {
+	if _, err := s.upTokenFromHeader(req); err != nil {
+		return nil, err
+	}
+	size, pErr := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/mkblk/"))
+	if pErr != nil || size <= 0 || size > blockSize {
+		return nil, newError(CodeBadRequest, "invalid block size")
+	}
+	data, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > size {
+		return nil, newError(CodeBadRequest, "chunk exceeds the block size")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ctx := s.nextID()
+	s.blocks[ctx] = &block{data: data, size: size}
+	return s.blkputRet(ctx, data, data), nil
+}
+
+func (s *Server) bput(req *http.Request) (interface{}, error) {
+	if _, err := s.upTokenFromHeader(req); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/bput/"), "/")
+	if len(parts) != 2 {
+		return nil, newError(CodeBadRequest, "invalid bput request")
+	}
+	offset, pErr := strconv.Atoi(parts[1])
+	if pErr != nil {
+		return nil, newError(CodeBadRequest, "invalid offset")
+	}
+	data, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	blk, ok := s.blocks[parts[0]]
+	if !ok || offset != len(blk.data) {
+		return nil, newError(CodeInvalidCtx, "invalid context")
+	}
+	if len(blk.data)+len(data) > blk.size {
+		return nil, newError(CodeBadRequest, "chunk exceeds the block size")
+	}
+	blk.data = append(blk.data, data...)
+	return s.blkputRet(parts[0], blk.data, data), nil
+}
+
+// blkputRet 构建块上传的回复，crc32 为本次上传的数据的校验值
+func (s *Server) blkputRet(ctx string, data, chunk []byte) storage.BlkputRet {
+	return storage.BlkputRet{
+		Ctx:       ctx,
+		Checksum:  Etag(data),
+		Crc32:     crc32Of(chunk),
+		Offset:    uint32(len(data)),
+		Host:      s.URL,
+		ExpiredAt: s.now().Add(7 * 24 * time.Hour).Unix(),
+	}
+}
+
+func (s *Server) mkfile(req *http.Request) (interface{}, error) {
+	t, err := s.upTokenFromHeader(req)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/mkfile/"), "/")
+	fsize, pErr := strconv.ParseInt(parts[0], 10, 64)
+	if pErr != nil || len(parts)%2 != 1 {
+		return nil, newError(CodeBadRequest, "invalid mkfile request")
+	}
+	u := &upload{params: make(map[string]string)}
+	for i := 1; i < len(parts); i += 2 {
+		value, dErr := decodeString(parts[i+1])
+		if dErr != nil {
+			return nil, dErr
+		}
+		switch name := parts[i]; {
+		case name == "key":
+			u.key, u.hasKey = value, true
+		case name == "mimeType":
+			u.mimeType = value
+		case name == "fname":
+			u.fname = value
+		case strings.HasPrefix(name, "x:") || strings.HasPrefix(name, "x-qn-meta-"):
+			u.params[name] = value
+		}
+	}
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	var ctxs []string
+	if len(body) > 0 {
+		ctxs = strings.Split(string(body), ",")
+	}
+	for i, ctx := range ctxs {
+		blk, ok := s.blocks[ctx]
+		if !ok || i < len(ctxs)-1 && len(blk.data) != blk.size {
+			s.lock.Unlock()
+			return nil, newError(CodeInvalidCtx, "invalid context")
+		}
+		u.data = append(u.data, blk.data...)
+	}
+	if int64(len(u.data)) != fsize {
+		s.lock.Unlock()
+		return nil, newError(CodeBadRequest, "fsize mismatch")
+	}
+	for _, ctx := range ctxs {
+		delete(s.blocks, ctx)
+	}
+	s.lock.Unlock()
+
+	return s.save(t, u)
+}
+
+// multipart 处理分片上传 v2 的请求，路径为 /buckets/<bucket>/objects/<EncodedKey>/uploads[/<uploadId>[/<partNumber>]]
+func (s *Server) multipart(req *http.Request) (interface{}, error) {
+	t, err := s.upTokenFromHeader(req)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if len(parts) < 5 || parts[2] != "objects" || parts[4] != "uploads" {
+		return nil, newError(http.StatusNotFound, "not found")
+	}
+	bucket := parts[1]
+	if bucket != t.bucket {
+		return nil, newError(403, "bucket doesn't match with scope")
+	}
+	key, hasKey := "", false
+	if parts[3] != "~" {
+		if key, err = decodeString(parts[3]); err != nil {
+			return nil, err
+		}
+		hasKey = true
+	}
+
+	switch {
+	case len(parts) == 5 && req.Method == http.MethodPost:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if _, ok := s.buckets[bucket]; !ok {
+			return nil, newError(CodeNoSuchBucket, "no such bucket")
+		}
+		id := s.nextID()
+		expires := s.now().Add(7 * 24 * time.Hour)
+		s.uploads[id] = &multipartUpload{
+			bucket: bucket, key: key, hasKey: hasKey, token: t,
+			parts: make(map[int64][]byte), expires: expires,
+		}
+		return map[string]interface{}{"uploadId": id, "expireAt": expires.Unix()}, nil
+	case len(parts) == 7 && req.Method == http.MethodPut:
+		return s.uploadPart(req, parts[5], parts[6])
+	case len(parts) == 6 && req.Method == http.MethodPost:
+		return s.completeParts(req, parts[5])
+	case len(parts) == 6 && req.Method == http.MethodDelete:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if _, ok := s.uploads[parts[5]]; !ok {
+			return nil, newError(CodeNoSuchEntry, "no such upload")
+		}
+		delete(s.uploads, parts[5])
+		return nil, nil
+	}
+	return nil, newError(http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func (s *Server) uploadPart(req *http.Request, uploadID, partNumberStr string) (interface{}, error) {
+	partNumber, pErr := strconv.ParseInt(partNumberStr, 10, 64)
+	if pErr != nil || partNumber < 1 || partNumber > 10000 {
+		return nil, newError(CodeBadRequest, "invalid part number")
+	}
+	data, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	sum := md5Hex(data)
+	if want := req.Header.Get("Content-MD5"); want != "" && want != sum {
+		return nil, newError(CodeBadRequest, "Content-MD5 not match")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	up, ok := s.uploads[uploadID]
+	if !ok {
+		return nil, newError(CodeNoSuchEntry, "no such upload")
+	}
+	up.parts[partNumber] = data
+	return storage.UploadPartsRet{Etag: Etag(data), MD5: sum}, nil
+}
+
+func (s *Server) completeParts(req *http.Request, uploadID string) (interface{}, error) {
+	var body struct {
+		Parts []struct {
+			Etag       string `json:"etag"`
+			PartNumber int64  `json:"partNumber"`
+		} `json:"parts"`
+		Fname      string            `json:"fname"`
+		MimeType   string            `json:"mimeType"`
+		Metadata   map[string]string `json:"metadata"`
+		CustomVars map[string]string `json:"customVars"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, newError(CodeBadRequest, "invalid request body")
+	}
+	if len(body.Parts) == 0 {
+		return nil, newError(CodeBadRequest, "empty parts")
+	}
+	if !sort.SliceIsSorted(body.Parts, func(i, j int) bool {
+		return body.Parts[i].PartNumber < body.Parts[j].PartNumber
+	}) {
+		return nil, newError(CodeBadRequest, "parts must be in ascending order")
+	}
+
+	s.lock.Lock()
+	up, ok := s.uploads[uploadID]
+	if !ok {
+		s.lock.Unlock()
+		return nil, newError(CodeNoSuchEntry, "no such upload")
+	}
+	u := &upload{
+		key:      up.key,
+		hasKey:   up.hasKey,
+		fname:    body.Fname,
+		mimeType: body.MimeType,
+		params:   make(map[string]string),
+	}
+	for _, part := range body.Parts {
+		data, ok := up.parts[part.PartNumber]
+		if !ok || Etag(data) != part.Etag {
+			s.lock.Unlock()
+			return nil, newError(CodeBadRequest, "invalid part %d", part.PartNumber)
+		}
+		u.data = append(u.data, data...)
+	}
+	delete(s.uploads, uploadID)
+	s.lock.Unlock()
+
+	for k, v := range body.CustomVars {
+		u.params[k] = v
+	}
+	for k, v := range body.Metadata {
+		u.params[k] = v
+	}
+	return s.save(up.token, u)
+}
+
+func (s *Server) queryV4(req *http.Request) (interface{}, error) {
+	hosts := storage.UcQueryV4Server{Domains: []string{s.host}}
+	return storage.UcQueryV4Ret{Hosts: []storage.UcQueryV4Region{{
+		RegionID: s.RegionID,
+		TTL:      86400,
+		Io:       hosts,
+		Up:       hosts,
+		Rs:       hosts,
+		Rsf:      hosts,
+		Api:      hosts,
+	}}}, nil
+}
+
+func (s *Server) queryV2(req *http.Request) (interface{}, error) {
+	hosts := map[string][]string{"main": {s.host}}
+	return storage.UcQueryRet{
+		TTL: 86400,
+		Io:  map[string]map[string][]string{"src": hosts},
+		Up: map[string]storage.UcQueryUp{
+			"src": {Main: []string{s.host}},
+			"acc": {Main: []string{s.host}},
+		},
+	}, nil
+}
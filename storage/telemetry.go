@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/qiniu/api.v7/v7/telemetry"
+)
+
+// startUpload 开始记录一次上传操作，method 为上传方式，比如 form，resume_v1，resume_v2
+func startUpload(ctx context.Context, upToken, key string, hasKey bool, method string) (context.Context, *telemetry.Operation) {
+	if !telemetry.Enabled(ctx) {
+		return ctx, nil
+	}
+	attrs := []telemetry.Attribute{telemetry.String(telemetry.AttrUploadMethod, method)}
+	if _, bucket, err := getAkBucketFromUploadToken(upToken); err == nil {
+		attrs = append(attrs, telemetry.String(telemetry.AttrBucket, bucket))
+	}
+	if hasKey {
+		attrs = append(attrs, telemetry.String(telemetry.AttrKey, key))
+	}
+	return telemetry.Start(ctx, telemetry.OpUpload, attrs...)
+}
+
+// uploadChunkWithTelemetry 上传一个分片，并记录为上传操作 op 的子操作
+func uploadChunkWithTelemetry(ctx context.Context, op *telemetry.Operation, uploader resumeUploaderBase, c chunk) error {
+	if op == nil {
+		return uploader.uploadChunk(ctx, c)
+	}
+	ctx, partOp := telemetry.Start(ctx, telemetry.OpUploadPart,
+		telemetry.Int64(telemetry.AttrPartNumber, c.id+1),
+		telemetry.Int(telemetry.AttrAttempt, c.retried+1))
+	err := uploader.uploadChunk(ctx, c)
+	if err == nil {
+		partOp.AddBytes(int64(len(c.data)))
+		op.AddBytes(int64(len(c.data)))
+	}
+	partOp.End(err)
+	return err
+}
@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+// EndUserVariable 是上传凭证模板中表示当前用户ID的变量
+// 和七牛上传策略中的魔法变量 $(endUser) 一致，在 SaveKey 中由服务端替换，在 KeyPrefix 中由 UploadTokenHandler 替换
+const EndUserVariable = "$(endUser)"
+
+// UploadTokenTemplate 是上传凭证模板，UploadTokenHandler 根据模板和当前用户生成上传凭证
+type UploadTokenTemplate struct {
+	// 上传的目标存储空间
+	Bucket string
+
+	// 允许上传的文件名前缀，可以使用 $(endUser) 表示当前用户ID，比如 "avatars/$(endUser)/"
+	// 为空表示不限制文件名
+	KeyPrefix string
+
+	// 强制使用的文件名，可以使用七牛上传策略支持的魔法变量，比如 "avatars/$(endUser)/$(etag)$(ext)"
+	// 设置后忽略客户端请求的文件名
+	SaveKey string
+
+	// 允许上传的最大文件大小(字节)，0 表示不限制
+	MaxSize int64
+
+	// 允许上传的文件类型，格式和上传策略中的 mimeLimit 一致，比如 "image/*" 或者 "!application/json;text/plain"
+	MimeLimit string
+
+	// 上传凭证的有效期，默认一小时
+	Expires time.Duration
+
+	// 其他的上传策略，比如回调和持久化数据处理的设置
+	// 其中 Scope，Expires，IsPrefixalScope，SaveKey，ForceSaveKey，FsizeLimit，MimeLimit，EndUser 由模板生成，设置了也会被覆盖
+	Policy PutPolicy
+}
+
+// UploadTokenResponse 是 UploadTokenHandler 的响应内容
+type UploadTokenResponse struct {
+	UpToken string `json:"uptoken"`
+
+	// 上传凭证过期时间(Unix时间戳，单位为秒)
+	ExpireAt int64 `json:"expireAt"`
+
+	Bucket string `json:"bucket"`
+
+	// 客户端请求了文件名时为最终的文件名
+	Key string `json:"key,omitempty"`
+
+	// 允许上传的文件名前缀
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+}
+
+// UploadTokenHandler 是签发上传凭证的 http.Handler，可以直接挂载到业务服务器上供移动端和网页端获取上传凭证
+//
+// 支持 GET 和 POST(表单) 请求，参数如下：
+//
+//	template	上传凭证模板名称，默认为 "default"
+//	key		可选，客户端希望使用的文件名，最终的文件名为模板的 KeyPrefix 加上该值
+//	size		可选，要上传的文件大小，超过模板的 MaxSize 时拒绝签发
+//	mime		可选，要上传的文件类型，不满足模板的 MimeLimit 时拒绝签发
+//
+// 成功时返回 UploadTokenResponse，失败时返回 {"error": "<错误信息>"}
+// 签发的上传凭证会被缓存，过期前 RefreshBefore 时间内重新签发；
+// 作用域包含客户端指定的 key 的上传凭证不缓存，缓存最多保存 maxUploadTokenCache 个上传凭证
+type UploadTokenHandler struct {
+	// 签发上传凭证使用的密钥
+	Credentials auth.CredentialsProvider
+
+	// Authenticate 用来认证请求的用户，返回用户ID，返回错误时拒绝签发(401)
+	// 用户ID会作为上传策略的 endUser 并替换模板中的 $(endUser)，因此不能包含 "/"
+	Authenticate func(req *http.Request) (userID string, err error)
+
+	// 上传凭证过期前多长时间重新签发，默认5分钟
+	RefreshBefore time.Duration
+
+	lock      sync.RWMutex
+	templates map[string]*UploadTokenTemplate
+	cache     map[string]UploadTokenResponse
+}
+
+// DefaultUploadTokenTemplate 是默认的上传凭证模板名称
+const DefaultUploadTokenTemplate = "default"
+
+// maxUploadTokenCache 是 UploadTokenHandler 最多缓存的上传凭证数量，缓存满时清理过期的上传凭证，仍然满时不再缓存新的上传凭证
+const maxUploadTokenCache = 1024
+
+// NewUploadTokenHandler 用来构建一个签发上传凭证的 http.Handler
+func NewUploadTokenHandler(provider auth.CredentialsProvider,
+	authenticate func(req *http.Request) (userID string, err error)) *UploadTokenHandler {
+	return &UploadTokenHandler{
+		Credentials:  provider,
+		Authenticate: authenticate,
+	}
+}
+
+// SetTemplate 添加或者替换一个上传凭证模板，替换后之前缓存的上传凭证失效
+func (h *UploadTokenHandler) SetTemplate(name string, template *UploadTokenTemplate) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.templates == nil {
+		h.templates = make(map[string]*UploadTokenTemplate)
+	}
+	h.templates[name] = template
+	h.cache = nil
+}
+
+// uploadTokenError 是签发上传凭证失败的原因
+type uploadTokenError struct {
+	code int
+	msg  string
+}
+
+func (e *uploadTokenError) Error() string {
+	return e.msg
+}
+
+func newUploadTokenError(code int, msg string) error {
+	return &uploadTokenError{code: code, msg: msg}
+}
+
+// ServeHTTP 签发上传凭证
+func (h *UploadTokenHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ret, err := h.serve(req)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil {
+		code := http.StatusInternalServerError
+		if e, ok := err.(*uploadTokenError); ok {
+			code = e.code
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (h *UploadTokenHandler) serve(req *http.Request) (ret UploadTokenResponse, err error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		err = newUploadTokenError(http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err = req.ParseForm(); err != nil {
+		err = newUploadTokenError(http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.Authenticate == nil {
+		err = errors.New("no authenticate hook")
+		return
+	}
+	userID, aErr := h.Authenticate(req)
+	if aErr != nil {
+		err = newUploadTokenError(http.StatusUnauthorized, aErr.Error())
+		return
+	}
+	if userID == "" || strings.Contains(userID, "/") {
+		err = newUploadTokenError(http.StatusUnauthorized, "invalid user id")
+		return
+	}
+
+	name := req.Form.Get("template")
+	if name == "" {
+		name = DefaultUploadTokenTemplate
+	}
+	h.lock.RLock()
+	template, ok := h.templates[name]
+	h.lock.RUnlock()
+	if !ok {
+		err = newUploadTokenError(http.StatusBadRequest, "unknown template: "+name)
+		return
+	}
+
+	if sizeStr := req.Form.Get("size"); sizeStr != "" {
+		size, pErr := strconv.ParseInt(sizeStr, 10, 64)
+		if pErr != nil || size < 0 {
+			err = newUploadTokenError(http.StatusBadRequest, "invalid size")
+			return
+		}
+		if template.MaxSize > 0 && size > template.MaxSize {
+			err = newUploadTokenError(http.StatusBadRequest, "file size exceeds the limit")
+			return
+		}
+	}
+	if mime := req.Form.Get("mime"); mime != "" && !MatchMimeLimit(template.MimeLimit, mime) {
+		err = newUploadTokenError(http.StatusBadRequest, "mime type not allowed: "+mime)
+		return
+	}
+	return h.issue(name, template, userID, req.Form.Get("key"))
+}
+
+// issue 根据模板签发上传凭证，优先使用缓存
+func (h *UploadTokenHandler) issue(name string, template *UploadTokenTemplate, userID, key string) (ret UploadTokenResponse, err error) {
+	refreshBefore := h.RefreshBefore
+	if refreshBefore <= 0 {
+		refreshBefore = 5 * time.Minute
+	}
+	// 作用域包含客户端指定的 key 时每个请求的上传凭证都不同，不缓存
+	cacheable := template.SaveKey != "" || key == ""
+	cacheKey := name + "\x00" + userID
+	now := time.Now()
+
+	if cacheable {
+		h.lock.RLock()
+		cached, ok := h.cache[cacheKey]
+		h.lock.RUnlock()
+		if ok && now.Add(refreshBefore).Before(time.Unix(cached.ExpireAt, 0)) {
+			return cached, nil
+		}
+	}
+
+	if h.Credentials == nil {
+		err = errors.New("no credentials")
+		return
+	}
+	cred, cErr := h.Credentials.Retrieve()
+	if cErr != nil {
+		err = cErr
+		return
+	}
+
+	expires := template.Expires
+	if expires <= 0 {
+		expires = time.Hour
+	}
+	keyPrefix := strings.Replace(template.KeyPrefix, EndUserVariable, userID, -1)
+
+	policy := template.Policy
+	policy.EndUser = userID
+	policy.FsizeLimit = template.MaxSize
+	policy.MimeLimit = template.MimeLimit
+	policy.Expires = uint64(expires / time.Second)
+	policy.t = now
+	policy.IsPrefixalScope = 0
+	policy.SaveKey = ""
+	policy.ForceSaveKey = false
+
+	ret = UploadTokenResponse{Bucket: template.Bucket, KeyPrefix: keyPrefix}
+	switch {
+	case template.SaveKey != "":
+		policy.SaveKey = template.SaveKey
+		policy.ForceSaveKey = true
+		policy.Scope = template.Bucket
+		if keyPrefix != "" {
+			policy.Scope = template.Bucket + ":" + keyPrefix
+			policy.IsPrefixalScope = 1
+		}
+	case key != "":
+		ret.Key = keyPrefix + key
+		policy.Scope = template.Bucket + ":" + ret.Key
+	case keyPrefix != "":
+		policy.Scope = template.Bucket + ":" + keyPrefix
+		policy.IsPrefixalScope = 1
+	default:
+		policy.Scope = template.Bucket
+	}
+	ret.UpToken = policy.UploadToken(cred)
+	ret.ExpireAt = int64(policy.Expires)
+	if cacheable {
+		h.store(cacheKey, ret, now)
+	}
+	return
+}
+
+// store 缓存上传凭证，缓存满时先清理过期的上传凭证，仍然满时不缓存
+func (h *UploadTokenHandler) store(cacheKey string, ret UploadTokenResponse, now time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.cache == nil {
+		h.cache = make(map[string]UploadTokenResponse)
+	}
+	if _, ok := h.cache[cacheKey]; !ok && len(h.cache) >= maxUploadTokenCache {
+		for k, v := range h.cache {
+			if !now.Before(time.Unix(v.ExpireAt, 0)) {
+				delete(h.cache, k)
+			}
+		}
+		if len(h.cache) >= maxUploadTokenCache {
+			return
+		}
+	}
+	h.cache[cacheKey] = ret
+}
+
+// MatchMimeLimit 检查文件类型 mime 是否满足上传策略中的 mimeLimit 限制
+// mimeLimit 为空表示不限制；多个类型用 ; 分隔，支持 image/* 这样的通配符；以 ! 开头表示禁止列出的类型
+func MatchMimeLimit(mimeLimit, mime string) bool {
+	if mimeLimit == "" {
+		return true
+	}
+	deny := strings.HasPrefix(mimeLimit, "!")
+	mimeLimit = strings.TrimPrefix(mimeLimit, "!")
+
+	mime = strings.ToLower(strings.TrimSpace(strings.SplitN(mime, ";", 2)[0]))
+	matched := false
+	for _, pattern := range strings.Split(mimeLimit, ";") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if pattern == mime || strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mime, strings.TrimSuffix(pattern, "*")) {
+			matched = true
+			break
+		}
+	}
+	return matched != deny
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/auth"
+)
+
+func decodeUploadTokenPolicy(t *testing.T, token string) PutPolicy {
+	items := strings.Split(token, ":")
+	if len(items) != 3 {
+		t.Fatalf("invalid upload token: %s", token)
+	}
+	bs, err := base64.URLEncoding.DecodeString(items[2])
+	if err != nil {
+		t.Fatalf("invalid upload token: %v", err)
+	}
+	var policy PutPolicy
+	if err = json.Unmarshal(bs, &policy); err != nil {
+		t.Fatalf("invalid put policy: %v", err)
+	}
+	return policy
+}
+
+func newTestUploadTokenHandler() *UploadTokenHandler {
+	h := NewUploadTokenHandler(auth.New("ak", "sk"), func(req *http.Request) (string, error) {
+		user := req.Header.Get("X-User")
+		if user == "" {
+			return "", errors.New("not logged in")
+		}
+		return user, nil
+	})
+	h.SetTemplate(DefaultUploadTokenTemplate, &UploadTokenTemplate{
+		Bucket:    "photos",
+		KeyPrefix: "users/$(endUser)/",
+		MaxSize:   1024,
+		MimeLimit: "image/*",
+	})
+	h.SetTemplate("avatar", &UploadTokenTemplate{
+		Bucket:  "avatars",
+		SaveKey: "$(endUser)/$(etag)$(ext)",
+		Policy:  PutPolicy{ReturnBody: `{"key":"$(key)"}`},
+	})
+	return h
+}
+
+func requestUploadToken(h http.Handler, user, query string) (int, UploadTokenResponse, string) {
+	req := httptest.NewRequest("GET", "/uptoken?"+query, nil)
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	var ret UploadTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &ret)
+	return w.Code, ret, w.Body.String()
+}
+
+func TestUploadTokenHandler(t *testing.T) {
+	h := newTestUploadTokenHandler()
+
+	code, ret, body := requestUploadToken(h, "u1", "key=a.png&size=100&mime=image/png")
+	if code != http.StatusOK {
+		t.Fatalf("want 200, got %d %s", code, body)
+	}
+	if ret.Key != "users/u1/a.png" || ret.Bucket != "photos" {
+		t.Errorf("unexpected response: %+v", ret)
+	}
+	policy := decodeUploadTokenPolicy(t, ret.UpToken)
+	if policy.Scope != "photos:users/u1/a.png" || policy.EndUser != "u1" || policy.FsizeLimit != 1024 ||
+		policy.MimeLimit != "image/*" || int64(policy.Expires) != ret.ExpireAt {
+		t.Errorf("unexpected put policy: %+v", policy)
+	}
+
+	_, ret, _ = requestUploadToken(h, "u1", "")
+	policy = decodeUploadTokenPolicy(t, ret.UpToken)
+	if policy.Scope != "photos:users/u1/" || policy.IsPrefixalScope != 1 || ret.KeyPrefix != "users/u1/" {
+		t.Errorf("unexpected prefix scope policy: %+v", policy)
+	}
+
+	_, ret, _ = requestUploadToken(h, "u2", "template=avatar&key=ignored")
+	policy = decodeUploadTokenPolicy(t, ret.UpToken)
+	if policy.Scope != "avatars" || !policy.ForceSaveKey || policy.SaveKey != "$(endUser)/$(etag)$(ext)" ||
+		policy.EndUser != "u2" || policy.ReturnBody == "" || ret.Key != "" {
+		t.Errorf("unexpected save key policy: %+v", policy)
+	}
+}
+
+func TestUploadTokenHandlerRejects(t *testing.T) {
+	h := newTestUploadTokenHandler()
+
+	cases := []struct {
+		user  string
+		query string
+		code  int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"a/b", "", http.StatusUnauthorized},
+		{"u1", "template=missing", http.StatusBadRequest},
+		{"u1", "size=2048", http.StatusBadRequest},
+		{"u1", "mime=video/mp4", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		code, _, body := requestUploadToken(h, c.user, c.query)
+		if code != c.code {
+			t.Errorf("user %q query %q: want %d, got %d", c.user, c.query, c.code, code)
+		}
+		if !strings.Contains(body, `"error"`) {
+			t.Errorf("want json error body, got %s", body)
+		}
+	}
+}
+
+func TestUploadTokenHandlerCache(t *testing.T) {
+	h := newTestUploadTokenHandler()
+
+	_, ret1, _ := requestUploadToken(h, "u1", "")
+	_, ret2, _ := requestUploadToken(h, "u1", "")
+	if ret1.UpToken == "" || ret1.UpToken != ret2.UpToken {
+		t.Errorf("want cached token")
+	}
+	_, ret3, _ := requestUploadToken(h, "u2", "")
+	if ret3.UpToken == ret1.UpToken {
+		t.Errorf("tokens for different users should be different")
+	}
+
+	// 作用域包含客户端指定的 key 的上传凭证不缓存，使用 SaveKey 的模板忽略 key
+	requestUploadToken(h, "u1", "key=a.png")
+	requestUploadToken(h, "u1", "key=b.png")
+	requestUploadToken(h, "u1", "template=avatar&key=a.png")
+	requestUploadToken(h, "u1", "template=avatar&key=b.png")
+	if n := len(h.cache); n != 3 {
+		t.Errorf("want 3 cached tokens, got %d", n)
+	}
+}
+
+func TestUploadTokenHandlerCacheLimit(t *testing.T) {
+	h := newTestUploadTokenHandler()
+
+	for i := 0; i < maxUploadTokenCache+10; i++ {
+		code, ret, body := requestUploadToken(h, fmt.Sprintf("u%d", i), "")
+		if code != http.StatusOK || ret.UpToken == "" {
+			t.Fatalf("request %d: %d %s", i, code, body)
+		}
+	}
+	if n := len(h.cache); n != maxUploadTokenCache {
+		t.Errorf("want %d cached tokens, got %d", maxUploadTokenCache, n)
+	}
+}
+
+func TestMatchMimeLimit(t *testing.T) {
+	cases := []struct {
+		limit string
+		mime  string
+		want  bool
+	}{
+		{"", "text/plain", true},
+		{"image/*", "image/png", true},
+		{"image/*", "video/mp4", false},
+		{"image/jpeg;image/png", "image/png", true},
+		{"!application/json;text/plain", "text/plain", false},
+		{"!application/json;text/plain", "image/png", true},
+		{"text/plain", "text/plain; charset=utf-8", true},
+	}
+	for _, c := range cases {
+		if got := MatchMimeLimit(c.limit, c.mime); got != c.want {
+			t.Errorf("MatchMimeLimit(%q, %q) = %v, want %v", c.limit, c.mime, got, c.want)
+		}
+	}
+}
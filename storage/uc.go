@@ -215,22 +215,37 @@ func (b *BucketInfo) TokenAntiLeechModeOn() bool {
 
 // GetBucketInfo 返回BucketInfo结构
 func (m *BucketManager) GetBucketInfo(bucketName string) (bucketInfo BucketInfo, err error) {
-	reqURL := fmt.Sprintf("%s/v2/bucketInfo?bucket=%s", UcHost, bucketName)
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &bucketInfo, "POST", reqURL, nil)
+	return m.GetBucketInfoContext(context.Background(), bucketName)
+}
+
+// GetBucketInfoContext 和 GetBucketInfo 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) GetBucketInfoContext(ctx context.Context, bucketName string) (bucketInfo BucketInfo, err error) {
+	reqURL := fmt.Sprintf("%s/v2/bucketInfo?bucket=%s", m.ucHost(), bucketName)
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &bucketInfo, "POST", reqURL, nil)
 	return
 }
 
 // BucketInfosForRegion 获取指定区域的该用户的所有bucketInfo信息
 func (m *BucketManager) BucketInfosInRegion(region RegionID, statistics bool) (bucketInfos []BucketSummary, err error) {
-	reqURL := fmt.Sprintf("%s/v2/bucketInfos?region=%s&fs=%t", UcHost, string(region), statistics)
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &bucketInfos, "POST", reqURL, nil)
+	return m.BucketInfosInRegionContext(context.Background(), region, statistics)
+}
+
+// BucketInfosInRegionContext 和 BucketInfosInRegion 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) BucketInfosInRegionContext(ctx context.Context, region RegionID, statistics bool) (bucketInfos []BucketSummary, err error) {
+	reqURL := fmt.Sprintf("%s/v2/bucketInfos?region=%s&fs=%t", m.ucHost(), string(region), statistics)
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &bucketInfos, "POST", reqURL, nil)
 	return
 }
 
 // SetReferAntiLeechMode 配置存储空间referer防盗链模式
 func (m *BucketManager) SetReferAntiLeechMode(bucketName string, refererAntiLeechConfig *ReferAntiLeechConfig) (err error) {
-	reqURL := fmt.Sprintf("%s/referAntiLeech?bucket=%s&%s", UcHost, bucketName, refererAntiLeechConfig.AsQueryString())
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.SetReferAntiLeechModeContext(context.Background(), bucketName, refererAntiLeechConfig)
+}
+
+// SetReferAntiLeechModeContext 和 SetReferAntiLeechMode 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) SetReferAntiLeechModeContext(ctx context.Context, bucketName string, refererAntiLeechConfig *ReferAntiLeechConfig) (err error) {
+	reqURL := fmt.Sprintf("%s/referAntiLeech?bucket=%s&%s", m.ucHost(), bucketName, refererAntiLeechConfig.AsQueryString())
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 	return
 }
 
@@ -259,6 +274,11 @@ type BucketLifeCycleRule struct {
 
 // SetBucketLifeCycleRule 设置存储空间内文件的生命周期规则
 func (m *BucketManager) AddBucketLifeCycleRule(bucketName string, lifeCycleRule *BucketLifeCycleRule) (err error) {
+	return m.AddBucketLifeCycleRuleContext(context.Background(), bucketName, lifeCycleRule)
+}
+
+// AddBucketLifeCycleRuleContext 和 AddBucketLifeCycleRule 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) AddBucketLifeCycleRuleContext(ctx context.Context, bucketName string, lifeCycleRule *BucketLifeCycleRule) (err error) {
 	params := make(map[string][]string)
 
 	// 没有检查参数的合法性，交给服务端检查
@@ -268,26 +288,36 @@ func (m *BucketManager) AddBucketLifeCycleRule(bucketName string, lifeCycleRule
 	params["delete_after_days"] = []string{strconv.Itoa(lifeCycleRule.DeleteAfterDays)}
 	params["to_line_after_days"] = []string{strconv.Itoa(lifeCycleRule.ToLineAfterDays)}
 
-	reqURL := UcHost + "/rules/add"
-	err = m.Client.CredentialedCallWithForm(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil, params)
+	reqURL := m.ucHost() + "/rules/add"
+	err = m.Client.CredentialedCallWithForm(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil, params)
 	return
 
 }
 
 // DelBucketLifeCycleRule 删除特定存储空间上设定的规则
 func (m *BucketManager) DelBucketLifeCycleRule(bucketName, ruleName string) (err error) {
+	return m.DelBucketLifeCycleRuleContext(context.Background(), bucketName, ruleName)
+}
+
+// DelBucketLifeCycleRuleContext 和 DelBucketLifeCycleRule 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) DelBucketLifeCycleRuleContext(ctx context.Context, bucketName, ruleName string) (err error) {
 	params := make(map[string][]string)
 
 	params["bucket"] = []string{bucketName}
 	params["name"] = []string{ruleName}
 
-	reqURL := UcHost + "/rules/delete"
-	err = m.Client.CredentialedCallWithForm(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil, params)
+	reqURL := m.ucHost() + "/rules/delete"
+	err = m.Client.CredentialedCallWithForm(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil, params)
 	return
 }
 
 // UpdateBucketLifeCycleRule 更新特定存储空间上的生命周期规则
 func (m *BucketManager) UpdateBucketLifeCycleRule(bucketName string, rule *BucketLifeCycleRule) (err error) {
+	return m.UpdateBucketLifeCycleRuleContext(context.Background(), bucketName, rule)
+}
+
+// UpdateBucketLifeCycleRuleContext 和 UpdateBucketLifeCycleRule 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) UpdateBucketLifeCycleRuleContext(ctx context.Context, bucketName string, rule *BucketLifeCycleRule) (err error) {
 	params := make(map[string][]string)
 
 	params["bucket"] = []string{bucketName}
@@ -295,15 +325,20 @@ func (m *BucketManager) UpdateBucketLifeCycleRule(bucketName string, rule *Bucke
 	params["delete_after_days"] = []string{strconv.Itoa(rule.DeleteAfterDays)}
 	params["to_line_after_days"] = []string{strconv.Itoa(rule.ToLineAfterDays)}
 
-	reqURL := UcHost + "/rules/update"
-	err = m.Client.CredentialedCallWithForm(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil, params)
+	reqURL := m.ucHost() + "/rules/update"
+	err = m.Client.CredentialedCallWithForm(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil, params)
 	return
 }
 
 // GetBucketLifeCycleRule 获取指定空间上设置的生命周期规则
 func (m *BucketManager) GetBucketLifeCycleRule(bucketName string) (rules []BucketLifeCycleRule, err error) {
-	reqURL := UcHost + "/rules/get?bucket=" + bucketName
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &rules, "GET", reqURL, nil)
+	return m.GetBucketLifeCycleRuleContext(context.Background(), bucketName)
+}
+
+// GetBucketLifeCycleRuleContext 和 GetBucketLifeCycleRule 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) GetBucketLifeCycleRuleContext(ctx context.Context, bucketName string) (rules []BucketLifeCycleRule, err error) {
+	reqURL := m.ucHost() + "/rules/get?bucket=" + bucketName
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &rules, "GET", reqURL, nil)
 	return
 }
 
@@ -360,35 +395,55 @@ func (r *BucketEventRule) Params(bucket string) map[string][]string {
 
 // AddBucketEvent 增加存储空间事件通知规则
 func (m *BucketManager) AddBucketEvent(bucket string, rule *BucketEventRule) (err error) {
+	return m.AddBucketEventContext(context.Background(), bucket, rule)
+}
+
+// AddBucketEventContext 和 AddBucketEvent 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) AddBucketEventContext(ctx context.Context, bucket string, rule *BucketEventRule) (err error) {
 	params := rule.Params(bucket)
-	reqURL := UcHost + "/events/add"
-	err = m.Client.CredentialedCallWithForm(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil, params)
+	reqURL := m.ucHost() + "/events/add"
+	err = m.Client.CredentialedCallWithForm(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil, params)
 	return
 }
 
 // DelBucketEvent 删除指定存储空间的通知事件规则
 func (m *BucketManager) DelBucketEvent(bucket, ruleName string) (err error) {
+	return m.DelBucketEventContext(context.Background(), bucket, ruleName)
+}
+
+// DelBucketEventContext 和 DelBucketEvent 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) DelBucketEventContext(ctx context.Context, bucket, ruleName string) (err error) {
 	params := make(map[string][]string)
 	params["bucket"] = []string{bucket}
 	params["name"] = []string{ruleName}
 
-	reqURL := UcHost + "/events/delete"
-	err = m.Client.CredentialedCallWithForm(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil, params)
+	reqURL := m.ucHost() + "/events/delete"
+	err = m.Client.CredentialedCallWithForm(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil, params)
 	return
 }
 
 // UpdateBucketEnvent 更新指定存储空间的事件通知规则
 func (m *BucketManager) UpdateBucketEnvent(bucket string, rule *BucketEventRule) (err error) {
+	return m.UpdateBucketEnventContext(context.Background(), bucket, rule)
+}
+
+// UpdateBucketEnventContext 和 UpdateBucketEnvent 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) UpdateBucketEnventContext(ctx context.Context, bucket string, rule *BucketEventRule) (err error) {
 	params := rule.Params(bucket)
-	reqURL := UcHost + "/events/update"
-	err = m.Client.CredentialedCallWithForm(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil, params)
+	reqURL := m.ucHost() + "/events/update"
+	err = m.Client.CredentialedCallWithForm(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil, params)
 	return
 }
 
 // GetBucketEvent 获取指定存储空间的事件通知规则
 func (m *BucketManager) GetBucketEvent(bucket string) (rule []BucketEventRule, err error) {
-	reqURL := UcHost + "/events/get?bucket=" + bucket
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &rule, "GET", reqURL, nil)
+	return m.GetBucketEventContext(context.Background(), bucket)
+}
+
+// GetBucketEventContext 和 GetBucketEvent 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) GetBucketEventContext(ctx context.Context, bucket string) (rule []BucketEventRule, err error) {
+	reqURL := m.ucHost() + "/events/get?bucket=" + bucket
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &rule, "GET", reqURL, nil)
 	return
 }
 
@@ -423,15 +478,25 @@ type CorsRule struct {
 
 // AddCorsRules 设置指定存储空间的跨域规则
 func (m *BucketManager) AddCorsRules(bucket string, corsRules []CorsRule) (err error) {
-	reqURL := UcHost + "/corsRules/set/" + bucket
-	err = m.Client.CredentialedCallWithJson(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil, corsRules)
+	return m.AddCorsRulesContext(context.Background(), bucket, corsRules)
+}
+
+// AddCorsRulesContext 和 AddCorsRules 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) AddCorsRulesContext(ctx context.Context, bucket string, corsRules []CorsRule) (err error) {
+	reqURL := m.ucHost() + "/corsRules/set/" + bucket
+	err = m.Client.CredentialedCallWithJson(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil, corsRules)
 	return
 }
 
 // GetCorsRules 获取指定存储空间的跨域规则
 func (m *BucketManager) GetCorsRules(bucket string) (corsRules []CorsRule, err error) {
-	reqURL := UcHost + "/corsRules/get/" + bucket
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &corsRules, "GET", reqURL, nil)
+	return m.GetCorsRulesContext(context.Background(), bucket)
+}
+
+// GetCorsRulesContext 和 GetCorsRules 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) GetCorsRulesContext(ctx context.Context, bucket string) (corsRules []CorsRule, err error) {
+	reqURL := m.ucHost() + "/corsRules/get/" + bucket
+	err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &corsRules, "GET", reqURL, nil)
 	return
 }
 
@@ -451,27 +516,31 @@ type BucketQuota struct {
 // SetBucketQuota 设置存储空间的配额限制
 // 配额限制主要是两块， 空间存储量的限制和空间文件数限制
 func (m *BucketManager) SetBucketQuota(bucket string, size, count int64) (err error) {
-	reqHost, rErr := m.ApiReqHost(bucket)
-	if rErr != nil {
-		err = rErr
-		return
-	}
-	reqHost = strings.TrimRight(reqHost, "/")
-	reqURL := fmt.Sprintf("%s/setbucketquota/%s/size/%d/count/%d", reqHost, bucket, size, count)
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.SetBucketQuotaContext(context.Background(), bucket, size, count)
+}
+
+// SetBucketQuotaContext 和 SetBucketQuota 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) SetBucketQuotaContext(ctx context.Context, bucket string, size, count int64) (err error) {
+	err = m.callWithHosts(ctx, "api", bucket, "POST", func(reqHost string) error {
+		reqHost = strings.TrimRight(reqHost, "/")
+		reqURL := fmt.Sprintf("%s/setbucketquota/%s/size/%d/count/%d", reqHost, bucket, size, count)
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
+	})
 	return
 }
 
 // GetBucketQuota 获取存储空间的配额信息
 func (m *BucketManager) GetBucketQuota(bucket string) (quota BucketQuota, err error) {
-	reqHost, rErr := m.ApiReqHost(bucket)
-	if rErr != nil {
-		err = rErr
-		return
-	}
-	reqHost = strings.TrimRight(reqHost, "/")
-	reqURL := reqHost + "/getbucketquota/" + bucket
-	err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &quota, "POST", reqURL, nil)
+	return m.GetBucketQuotaContext(context.Background(), bucket)
+}
+
+// GetBucketQuotaContext 和 GetBucketQuota 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) GetBucketQuotaContext(ctx context.Context, bucket string) (quota BucketQuota, err error) {
+	err = m.callWithHosts(ctx, "api", bucket, "POST", func(reqHost string) error {
+		reqHost = strings.TrimRight(reqHost, "/")
+		reqURL := reqHost + "/getbucketquota/" + bucket
+		return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &quota, "POST", reqURL, nil)
+	})
 	return
 }
 
@@ -479,25 +548,45 @@ func (m *BucketManager) GetBucketQuota(bucket string) (quota BucketQuota, err er
 // mode - 1 ==> 开启原图保护
 // mode - 0 ==> 关闭原图保护
 func (m *BucketManager) SetBucketAccessStyle(bucket string, mode int) error {
-	reqURL := fmt.Sprintf("%s/accessMode/%s/mode/%d", UcHost, bucket, mode)
-	return m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.SetBucketAccessStyleContext(context.Background(), bucket, mode)
+}
+
+// SetBucketAccessStyleContext 和 SetBucketAccessStyle 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) SetBucketAccessStyleContext(ctx context.Context, bucket string, mode int) error {
+	reqURL := fmt.Sprintf("%s/accessMode/%s/mode/%d", m.ucHost(), bucket, mode)
+	return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 }
 
 // TurnOffBucketProtected 开启指定存储空间的原图保护
 func (m *BucketManager) TurnOnBucketProtected(bucket string) error {
-	return m.SetBucketAccessStyle(bucket, 1)
+	return m.TurnOnBucketProtectedContext(context.Background(), bucket)
+}
+
+// TurnOnBucketProtectedContext 和 TurnOnBucketProtected 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) TurnOnBucketProtectedContext(ctx context.Context, bucket string) error {
+	return m.SetBucketAccessStyleContext(ctx, bucket, 1)
 }
 
 // TurnOffBucketProtected 关闭指定空间的原图保护
 func (m *BucketManager) TurnOffBucketProtected(bucket string) error {
-	return m.SetBucketAccessStyle(bucket, 0)
+	return m.TurnOffBucketProtectedContext(context.Background(), bucket)
+}
+
+// TurnOffBucketProtectedContext 和 TurnOffBucketProtected 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) TurnOffBucketProtectedContext(ctx context.Context, bucket string) error {
+	return m.SetBucketAccessStyleContext(ctx, bucket, 0)
 }
 
 // SetBucketMaxAge 设置指定存储空间的MaxAge响应头
 // maxAge <= 0时，表示使用默认值31536000
 func (m *BucketManager) SetBucketMaxAge(bucket string, maxAge int64) error {
-	reqURL := fmt.Sprintf("%s/maxAge?bucket=%s&maxAge=%d", UcHost, bucket, maxAge)
-	return m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.SetBucketMaxAgeContext(context.Background(), bucket, maxAge)
+}
+
+// SetBucketMaxAgeContext 和 SetBucketMaxAge 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) SetBucketMaxAgeContext(ctx context.Context, bucket string, maxAge int64) error {
+	reqURL := fmt.Sprintf("%s/maxAge?bucket=%s&maxAge=%d", m.ucHost(), bucket, maxAge)
+	return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 }
 
 // SetBucketAccessMode 设置指定空间的私有属性
@@ -505,33 +594,58 @@ func (m *BucketManager) SetBucketMaxAge(bucket string, maxAge int64) error {
 // mode - 1 表示设置空间为私有空间， 私有空间访问需要鉴权
 // mode - 0 表示设置空间为公开空间
 func (m *BucketManager) SetBucketAccessMode(bucket string, mode int) error {
-	reqURL := fmt.Sprintf("%s/private?bucket=%s&private=%d", UcHost, bucket, mode)
-	return m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+	return m.SetBucketAccessModeContext(context.Background(), bucket, mode)
+}
+
+// SetBucketAccessModeContext 和 SetBucketAccessMode 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) SetBucketAccessModeContext(ctx context.Context, bucket string, mode int) error {
+	reqURL := fmt.Sprintf("%s/private?bucket=%s&private=%d", m.ucHost(), bucket, mode)
+	return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 }
 
 // MakeBucketPublic 设置空间为公有空间
 func (m *BucketManager) MakeBucketPublic(bucket string) error {
-	return m.SetBucketAccessMode(bucket, 0)
+	return m.MakeBucketPublicContext(context.Background(), bucket)
+}
+
+// MakeBucketPublicContext 和 MakeBucketPublic 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) MakeBucketPublicContext(ctx context.Context, bucket string) error {
+	return m.SetBucketAccessModeContext(ctx, bucket, 0)
 }
 
 // MakeBucketPrivate 设置空间为私有空间
 func (m *BucketManager) MakeBucketPrivate(bucket string) error {
-	return m.SetBucketAccessMode(bucket, 1)
+	return m.MakeBucketPrivateContext(context.Background(), bucket)
+}
+
+// MakeBucketPrivateContext 和 MakeBucketPrivate 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) MakeBucketPrivateContext(ctx context.Context, bucket string) error {
+	return m.SetBucketAccessModeContext(ctx, bucket, 1)
 }
 
 // TurnOnIndexPage 设置默认首页
 func (m *BucketManager) TurnOnIndexPage(bucket string) error {
-	return m.setIndexPage(bucket, 0)
+	return m.TurnOnIndexPageContext(context.Background(), bucket)
+}
+
+// TurnOnIndexPageContext 和 TurnOnIndexPage 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) TurnOnIndexPageContext(ctx context.Context, bucket string) error {
+	return m.setIndexPage(ctx, bucket, 0)
 }
 
 // TurnOnIndexPage 关闭默认首页
 func (m *BucketManager) TurnOffIndexPage(bucket string) error {
-	return m.setIndexPage(bucket, 1)
+	return m.TurnOffIndexPageContext(context.Background(), bucket)
+}
+
+// TurnOffIndexPageContext 和 TurnOffIndexPage 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) TurnOffIndexPageContext(ctx context.Context, bucket string) error {
+	return m.setIndexPage(ctx, bucket, 1)
 }
 
-func (m *BucketManager) setIndexPage(bucket string, noIndexPage int) error {
-	reqURL := fmt.Sprintf("%s/noIndexPage?bucket=%s&noIndexPage=%d", UcHost, bucket, noIndexPage)
-	return m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "POST", reqURL, nil)
+func (m *BucketManager) setIndexPage(ctx context.Context, bucket string, noIndexPage int) error {
+	reqURL := fmt.Sprintf("%s/noIndexPage?bucket=%s&noIndexPage=%d", m.ucHost(), bucket, noIndexPage)
+	return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "POST", reqURL, nil)
 }
 
 // BucketTagging 为 Bucket 设置标签
@@ -549,26 +663,41 @@ type BucketTag struct {
 // 该方法为覆盖所有 Bucket 上之前设置的标签，标签 Key 最大 64 字节，Value 最大 128 字节，均不能为空，且区分大小写
 // Key 不能以 kodo 为前缀，Key 和 Value 的字符只能为：字母，数字，空格，+，-，=，.，_，:，/，@，不能支持中文
 func (m *BucketManager) SetTagging(bucket string, tags map[string]string) error {
+	return m.SetTaggingContext(context.Background(), bucket, tags)
+}
+
+// SetTaggingContext 和 SetTagging 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) SetTaggingContext(ctx context.Context, bucket string, tags map[string]string) error {
 	tagging := BucketTagging{Tags: make([]BucketTag, 0, len(tags))}
 	for key, value := range tags {
 		tagging.Tags = append(tagging.Tags, BucketTag{Key: key, Value: value})
 	}
 
-	reqURL := fmt.Sprintf("%s/bucketTagging?bucket=%s", UcHost, bucket)
-	return m.Client.CredentialedCallWithJson(context.Background(), m.Mac, auth.TokenQiniu, nil, "PUT", reqURL, nil, &tagging)
+	reqURL := fmt.Sprintf("%s/bucketTagging?bucket=%s", m.ucHost(), bucket)
+	return m.Client.CredentialedCallWithJson(ctx, m.credentials(), auth.TokenQiniu, nil, "PUT", reqURL, nil, &tagging)
 }
 
 // ClearTagging 清空 Bucket 标签
 func (m *BucketManager) ClearTagging(bucket string) error {
-	reqURL := fmt.Sprintf("%s/bucketTagging?bucket=%s", UcHost, bucket)
-	return m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, nil, "DELETE", reqURL, nil)
+	return m.ClearTaggingContext(context.Background(), bucket)
+}
+
+// ClearTaggingContext 和 ClearTagging 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) ClearTaggingContext(ctx context.Context, bucket string) error {
+	reqURL := fmt.Sprintf("%s/bucketTagging?bucket=%s", m.ucHost(), bucket)
+	return m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, nil, "DELETE", reqURL, nil)
 }
 
 // GetTagging 获取 Bucket 标签
 func (m *BucketManager) GetTagging(bucket string) (tags map[string]string, err error) {
+	return m.GetTaggingContext(context.Background(), bucket)
+}
+
+// GetTaggingContext 和 GetTagging 相同，ctx 可以用来取消请求和传递 reqid
+func (m *BucketManager) GetTaggingContext(ctx context.Context, bucket string) (tags map[string]string, err error) {
 	var tagging BucketTagging
-	reqURL := fmt.Sprintf("%s/bucketTagging?bucket=%s", UcHost, bucket)
-	if err = m.Client.CredentialedCall(context.Background(), m.Mac, auth.TokenQiniu, &tagging, "GET", reqURL, nil); err != nil {
+	reqURL := fmt.Sprintf("%s/bucketTagging?bucket=%s", m.ucHost(), bucket)
+	if err = m.Client.CredentialedCall(ctx, m.credentials(), auth.TokenQiniu, &tagging, "GET", reqURL, nil); err != nil {
 		return
 	}
 	tags = make(map[string]string, len(tagging.Tags))
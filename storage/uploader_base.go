@@ -1,23 +1,43 @@
 package storage
 
-func getUpHost(config *Config, ak, bucket string) (upHost string, err error) {
+import (
+	"context"
+	"errors"
+
+	"github.com/qiniu/api.v7/v7/client"
+	qendpoints "github.com/qiniu/api.v7/v7/endpoints"
+)
+
+// getUpHost 返回上传地址，config 中没有设置区域时使用 ctx 和 clt 查询空间所在的区域
+func getUpHost(ctx context.Context, config *Config, clt *client.Client, ak, bucket string) (upHost string, err error) {
+	upHosts, err := getUpHosts(ctx, config, clt, ak, bucket)
+	if err != nil {
+		return
+	}
+	upHost = upHosts[0]
+	return
+}
+
+// getUpHosts 返回全部上传地址，第一个为主地址，其余的为请求失败时使用的备用地址
+func getUpHosts(ctx context.Context, config *Config, clt *client.Client, ak, bucket string) (upHosts []string, err error) {
 	var zone *Zone
 	if config.Zone != nil {
 		zone = config.Zone
-	} else if zone, err = GetZone(ak, bucket); err != nil {
+	} else if zone, err = getRegionByConfig(ctx, config, clt, ak, bucket); err != nil {
 		return
 	}
 
-	scheme := "http://"
-	if config.UseHTTPS {
-		scheme = "https://"
-	}
-
-	host := zone.SrcUpHosts[0]
+	hosts := zone.SrcUpHosts
 	if config.UseCdnDomains {
-		host = zone.CdnUpHosts[0]
+		hosts = zone.CdnUpHosts
+	}
+	for _, host := range hosts {
+		if host != "" {
+			upHosts = append(upHosts, qendpoints.URL(host, config.UseHTTPS))
+		}
+	}
+	if len(upHosts) == 0 {
+		err = errors.New("no up host found")
 	}
-
-	upHost = scheme + host
 	return
 }
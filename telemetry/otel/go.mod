@@ -0,0 +1,24 @@
+module github.com/qiniu/api.v7/v7/telemetry/otel
+
+go 1.25.0
+
+require (
+	github.com/qiniu/api.v7/v7 v7.8.3-0.20261019162821-10a572879e45
+	go.opentelemetry.io/otel v1.44.0
+	go.opentelemetry.io/otel/metric v1.44.0
+	go.opentelemetry.io/otel/sdk v1.44.0
+	go.opentelemetry.io/otel/sdk/metric v1.44.0
+	go.opentelemetry.io/otel/trace v1.44.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/go-logr/logr v1.4.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
+	golang.org/x/sys v0.45.0 // indirect
+)
+
+// 仅用于在仓库中开发时使用本地的 SDK，依赖这个模块的项目会忽略 replace，使用上面包含 telemetry 包的伪版本
+replace github.com/qiniu/api.v7/v7 => ../../
@@ -0,0 +1,131 @@
+// Package otel 把 SDK 的 telemetry.Observer 适配到 OpenTelemetry
+//
+// 这是一个独立的模块，只有需要 OpenTelemetry 的用户才会引入它的依赖:
+//
+//	telemetry.DefaultObserver = otel.New(nil, nil)
+//
+// SDK 的每个操作对应一个 Span，HTTP 请求对应 Span 上的事件，
+// 计数器和直方图对应同名的 Int64Counter 和 Float64Histogram。
+package otel
+
+import (
+	"context"
+	"sync"
+
+	"github.com/qiniu/api.v7/v7/telemetry"
+	gootel "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName 是创建 Tracer 和 Meter 使用的名称
+const InstrumentationName = "github.com/qiniu/api.v7/v7"
+
+// Observer 使用 OpenTelemetry 的 Tracer 和 Meter 实现 telemetry.Observer
+type Observer struct {
+	tracer trace.Tracer
+	meter  metric.Meter
+
+	lock       sync.Mutex
+	counters   map[string]metric.Int64Counter
+	histograms map[string]metric.Float64Histogram
+}
+
+// New 返回一个 Observer，tp 或 mp 为 nil 时使用 OpenTelemetry 全局的 Provider
+func New(tp trace.TracerProvider, mp metric.MeterProvider) *Observer {
+	if tp == nil {
+		tp = gootel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = gootel.GetMeterProvider()
+	}
+	return &Observer{
+		tracer:     tp.Tracer(InstrumentationName),
+		meter:      mp.Meter(InstrumentationName),
+		counters:   make(map[string]metric.Int64Counter),
+		histograms: make(map[string]metric.Float64Histogram),
+	}
+}
+
+// StartSpan 开始一个 Client 类型的 Span
+func (o *Observer) StartSpan(ctx context.Context, name string, attrs ...telemetry.Attribute) (context.Context, telemetry.Span) {
+	ctx, span := o.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(convert(attrs)...))
+	return ctx, spanAdapter{span}
+}
+
+// AddCounter 增加同名的 Int64Counter
+func (o *Observer) AddCounter(ctx context.Context, name string, value int64, attrs ...telemetry.Attribute) {
+	o.lock.Lock()
+	counter, ok := o.counters[name]
+	if !ok {
+		var err error
+		if counter, err = o.meter.Int64Counter(name); err != nil {
+			gootel.Handle(err)
+		}
+		o.counters[name] = counter
+	}
+	o.lock.Unlock()
+
+	if counter != nil {
+		counter.Add(ctx, value, metric.WithAttributes(convert(attrs)...))
+	}
+}
+
+// RecordHistogram 记录同名的 Float64Histogram，单位为秒的指标名称以 duration 结尾
+func (o *Observer) RecordHistogram(ctx context.Context, name string, value float64, attrs ...telemetry.Attribute) {
+	o.lock.Lock()
+	histogram, ok := o.histograms[name]
+	if !ok {
+		var err error
+		if histogram, err = o.meter.Float64Histogram(name, metric.WithUnit("s")); err != nil {
+			gootel.Handle(err)
+		}
+		o.histograms[name] = histogram
+	}
+	o.lock.Unlock()
+
+	if histogram != nil {
+		histogram.Record(ctx, value, metric.WithAttributes(convert(attrs)...))
+	}
+}
+
+type spanAdapter struct {
+	span trace.Span
+}
+
+func (s spanAdapter) SetAttributes(attrs ...telemetry.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+func (s spanAdapter) AddEvent(name string, attrs ...telemetry.Attribute) {
+	s.span.AddEvent(name, trace.WithAttributes(convert(attrs)...))
+}
+
+func (s spanAdapter) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+func convert(attrs []telemetry.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch v := attr.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(attr.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(attr.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(attr.Key, v))
+		case float64:
+			kvs = append(kvs, attribute.Float64(attr.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(attr.Key, v))
+		}
+	}
+	return kvs
+}
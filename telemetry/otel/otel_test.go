@@ -0,0 +1,64 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/qiniu/api.v7/v7/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestObserver(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	ctx := telemetry.WithObserver(context.Background(), New(tp, mp))
+	ctx, op := telemetry.Start(ctx, telemetry.OpUpload, telemetry.String(telemetry.AttrBucket, "b"))
+	_, part := telemetry.Start(ctx, telemetry.OpUploadPart, telemetry.Int(telemetry.AttrPartNumber, 1))
+	part.AddEvent(telemetry.EventHTTPAttempt, telemetry.Int(telemetry.AttrStatusCode, 599))
+	part.End(errors.New("server error"))
+	op.End(nil)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, got %d", len(spans))
+	}
+	partSpan, uploadSpan := spans[0], spans[1]
+	if partSpan.Name != telemetry.OpUploadPart || partSpan.Parent.SpanID() != uploadSpan.SpanContext.SpanID() {
+		t.Errorf("part span should be a child of upload span")
+	}
+	if partSpan.Status.Code != codes.Error || len(partSpan.Events) != 2 {
+		t.Errorf("unexpected part span: %+v, %+v", partSpan.Status, partSpan.Events)
+	}
+	found := false
+	for _, kv := range uploadSpan.Attributes {
+		if kv == attribute.String(telemetry.AttrBucket, "b") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("bucket attribute missing: %v", uploadSpan.Attributes)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names[m.Name] = true
+		}
+	}
+	if !names[telemetry.MetricOperations] || !names[telemetry.MetricOperationDuration] {
+		t.Errorf("unexpected metrics: %v", names)
+	}
+}
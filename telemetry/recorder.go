@@ -0,0 +1,120 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+)
+
+// RecordedSpan 是 Recorder 记录的已经结束的 Span
+type RecordedSpan struct {
+	Name       string
+	Parent     *RecordedSpan
+	Attributes map[string]interface{}
+	Events     []RecordedEvent
+	Err        error
+}
+
+// RecordedEvent 是 Span 上记录的事件
+type RecordedEvent struct {
+	Name       string
+	Attributes map[string]interface{}
+}
+
+// Recorder 是在内存中记录 Span 和指标的 Observer，用于测试
+type Recorder struct {
+	lock       sync.Mutex
+	spans      []*RecordedSpan
+	counters   map[string]int64
+	histograms map[string][]float64
+}
+
+// NewRecorder 返回一个 Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{counters: make(map[string]int64), histograms: make(map[string][]float64)}
+}
+
+type recorderSpanKey struct{}
+
+type recorderSpan struct {
+	recorder *Recorder
+	span     *RecordedSpan
+}
+
+// StartSpan 开始一个 Span，context 中已经有 Recorder 的 Span 时作为它的子 Span
+func (r *Recorder) StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &RecordedSpan{Name: name, Attributes: make(map[string]interface{})}
+	if parent, ok := ctx.Value(recorderSpanKey{}).(*RecordedSpan); ok {
+		span.Parent = parent
+	}
+	s := &recorderSpan{recorder: r, span: span}
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, recorderSpanKey{}, span), s
+}
+
+// AddCounter 增加计数器的值，不区分属性
+func (r *Recorder) AddCounter(ctx context.Context, name string, value int64, attrs ...Attribute) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.counters[name] += value
+}
+
+// RecordHistogram 记录直方图的值，不区分属性
+func (r *Recorder) RecordHistogram(ctx context.Context, name string, value float64, attrs ...Attribute) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.histograms[name] = append(r.histograms[name], value)
+}
+
+// Spans 返回名称为 name 的已经结束的 Span，name 为空时返回所有 Span
+func (r *Recorder) Spans(name string) []*RecordedSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var spans []*RecordedSpan
+	for _, span := range r.spans {
+		if name == "" || span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// Counter 返回计数器的值
+func (r *Recorder) Counter(name string) int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.counters[name]
+}
+
+// Histogram 返回直方图记录的所有值
+func (r *Recorder) Histogram(name string) []float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]float64(nil), r.histograms[name]...)
+}
+
+func toMap(m map[string]interface{}, attrs []Attribute) map[string]interface{} {
+	for _, attr := range attrs {
+		m[attr.Key] = attr.Value
+	}
+	return m
+}
+
+func (s *recorderSpan) SetAttributes(attrs ...Attribute) {
+	s.recorder.lock.Lock()
+	defer s.recorder.lock.Unlock()
+	toMap(s.span.Attributes, attrs)
+}
+
+func (s *recorderSpan) AddEvent(name string, attrs ...Attribute) {
+	s.recorder.lock.Lock()
+	defer s.recorder.lock.Unlock()
+	s.span.Events = append(s.span.Events, RecordedEvent{Name: name, Attributes: toMap(make(map[string]interface{}), attrs)})
+}
+
+func (s *recorderSpan) End(err error) {
+	s.recorder.lock.Lock()
+	defer s.recorder.lock.Unlock()
+	s.span.Err = err
+	s.recorder.spans = append(s.recorder.spans, s.span)
+}
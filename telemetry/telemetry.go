@@ -0,0 +1,260 @@
+// Package telemetry 定义了 SDK 的可观测性接口
+//
+// SDK 在每个逻辑操作(上传，分片上传，批量操作，列举一页文件，查询区域)开始时创建一个 Span，
+// 操作内部的每次 HTTP 请求会作为事件记录到 Span 上，操作结束时记录计数器和耗时直方图。
+// 默认不做任何记录，设置 DefaultObserver 或者使用 WithObserver 设置 context 来开启，
+// OpenTelemetry 的适配实现在 telemetry/otel 模块中，本包不依赖任何第三方库。
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// 操作名称
+const (
+	OpUpload      = "qiniu.upload"
+	OpUploadPart  = "qiniu.upload.part"
+	OpBatch       = "qiniu.batch"
+	OpListPage    = "qiniu.list.page"
+	OpRegionQuery = "qiniu.region.query"
+)
+
+// EventHTTPAttempt 是每次 HTTP 请求完成时记录到当前操作上的事件
+const EventHTTPAttempt = "qiniu.http.attempt"
+
+// 属性名称
+const (
+	AttrOperation    = "qiniu.operation"
+	AttrBucket       = "qiniu.bucket"
+	AttrKey          = "qiniu.key"
+	AttrHost         = "qiniu.host"
+	AttrReqid        = "qiniu.reqid"
+	AttrBytes        = "qiniu.bytes"
+	AttrAttempt      = "qiniu.attempt"
+	AttrOutcome      = "qiniu.outcome"
+	AttrUploadMethod = "qiniu.upload.method"
+	AttrPartNumber   = "qiniu.upload.part_number"
+	AttrBatchSize    = "qiniu.batch.size"
+	AttrListCount    = "qiniu.list.count"
+	AttrHTTPMethod   = "http.method"
+	AttrStatusCode   = "http.status_code"
+)
+
+// 指标名称，时长的单位都是秒
+const (
+	// 操作次数，属性为 AttrOperation 和 AttrOutcome
+	MetricOperations = "qiniu.operations"
+	// 操作耗时，属性为 AttrOperation 和 AttrOutcome
+	MetricOperationDuration = "qiniu.operation.duration"
+	// 操作传输的字节数，属性为 AttrOperation
+	MetricBytes = "qiniu.bytes"
+	// HTTP 请求次数，属性为 AttrHost，AttrStatusCode 和 AttrOutcome
+	MetricRequests = "qiniu.http.requests"
+	// HTTP 请求耗时，属性为 AttrHost，AttrStatusCode 和 AttrOutcome
+	MetricRequestDuration = "qiniu.http.request.duration"
+)
+
+// 操作结果
+const (
+	OutcomeSuccess  = "success"
+	OutcomeError    = "error"
+	OutcomeCanceled = "canceled"
+)
+
+// Attribute 是 Span，事件和指标的属性
+type Attribute struct {
+	Key string
+	// 值的类型为 string，int64，float64 或 bool
+	Value interface{}
+}
+
+// String 返回一个字符串属性
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 返回一个整数属性
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int 返回一个整数属性，值会被转换为 int64
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Float64 返回一个浮点数属性
+func Float64(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool 返回一个布尔属性
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Observer 接收 SDK 产生的 Span 和指标，实现需要支持并发调用
+type Observer interface {
+	// StartSpan 开始一个 Span，返回的 context 会传递给操作内部的请求，可以用来关联父子 Span
+	StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+
+	// AddCounter 增加计数器的值
+	AddCounter(ctx context.Context, name string, value int64, attrs ...Attribute)
+
+	// RecordHistogram 记录直方图的一个值
+	RecordHistogram(ctx context.Context, name string, value float64, attrs ...Attribute)
+}
+
+// Span 代表一个操作
+type Span interface {
+	// SetAttributes 设置属性
+	SetAttributes(attrs ...Attribute)
+
+	// AddEvent 记录一个事件
+	AddEvent(name string, attrs ...Attribute)
+
+	// End 结束 Span，err 不为 nil 表示操作失败
+	End(err error)
+}
+
+// NopObserver 不做任何记录
+type NopObserver struct{}
+
+// StartSpan 返回不做任何记录的 Span
+func (NopObserver) StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+// AddCounter 不做任何事情
+func (NopObserver) AddCounter(ctx context.Context, name string, value int64, attrs ...Attribute) {}
+
+// RecordHistogram 不做任何事情
+func (NopObserver) RecordHistogram(ctx context.Context, name string, value float64, attrs ...Attribute) {
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(attrs ...Attribute)         {}
+func (nopSpan) AddEvent(name string, attrs ...Attribute) {}
+func (nopSpan) End(err error)                            {}
+
+// DefaultObserver 是 context 中没有设置 Observer 时使用的 Observer，默认不做任何记录
+var DefaultObserver Observer = NopObserver{}
+
+type observerKey struct{}
+
+// WithObserver 返回一个使用 observer 记录操作的 context，优先级高于 DefaultObserver
+func WithObserver(ctx context.Context, observer Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, observer)
+}
+
+// ObserverFromContext 返回 context 中设置的 Observer，没有设置时返回 DefaultObserver
+func ObserverFromContext(ctx context.Context) Observer {
+	if observer, ok := ctx.Value(observerKey{}).(Observer); ok && observer != nil {
+		return observer
+	}
+	if DefaultObserver == nil {
+		return NopObserver{}
+	}
+	return DefaultObserver
+}
+
+// Enabled 判断 context 对应的 Observer 是否需要记录
+func Enabled(ctx context.Context) bool {
+	_, nop := ObserverFromContext(ctx).(NopObserver)
+	return !nop
+}
+
+// Outcome 根据错误返回操作结果
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return OutcomeCanceled
+	}
+	return OutcomeError
+}
+
+// Operation 是 SDK 内部记录一个逻辑操作的辅助类型，结束时同时记录 Span 和指标
+type Operation struct {
+	ctx      context.Context
+	observer Observer
+	span     Span
+	name     string
+	start    time.Time
+
+	lock  sync.Mutex
+	bytes int64
+}
+
+type operationKey struct{}
+
+// Start 开始一个操作，返回的 context 中带有这个操作，操作内部的 HTTP 请求会记录到这个操作上
+// Observer 不需要记录时返回的 *Operation 为 nil，它的方法都可以安全调用
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Operation) {
+	if !Enabled(ctx) {
+		return ctx, nil
+	}
+	observer := ObserverFromContext(ctx)
+	attrs = append([]Attribute{String(AttrOperation, name)}, attrs...)
+	ctx, span := observer.StartSpan(ctx, name, attrs...)
+	op := &Operation{ctx: ctx, observer: observer, span: span, name: name, start: time.Now()}
+	return context.WithValue(ctx, operationKey{}, op), op
+}
+
+// OperationFromContext 返回 context 中正在进行的操作，没有时返回 nil
+func OperationFromContext(ctx context.Context) *Operation {
+	op, _ := ctx.Value(operationKey{}).(*Operation)
+	return op
+}
+
+// SetAttributes 设置操作的属性
+func (op *Operation) SetAttributes(attrs ...Attribute) {
+	if op == nil {
+		return
+	}
+	op.span.SetAttributes(attrs...)
+}
+
+// AddEvent 记录一个事件
+func (op *Operation) AddEvent(name string, attrs ...Attribute) {
+	if op == nil {
+		return
+	}
+	op.span.AddEvent(name, attrs...)
+}
+
+// AddBytes 增加操作传输的字节数，可以并发调用
+func (op *Operation) AddBytes(n int64) {
+	if op == nil {
+		return
+	}
+	op.lock.Lock()
+	op.bytes += n
+	op.lock.Unlock()
+}
+
+// End 结束操作，记录结果，耗时和传输的字节数
+func (op *Operation) End(err error) {
+	if op == nil {
+		return
+	}
+	op.lock.Lock()
+	bytes := op.bytes
+	op.lock.Unlock()
+
+	outcome := Outcome(err)
+	op.span.SetAttributes(String(AttrOutcome, outcome), Int64(AttrBytes, bytes))
+	op.span.End(err)
+
+	metricAttrs := []Attribute{String(AttrOperation, op.name), String(AttrOutcome, outcome)}
+	op.observer.AddCounter(op.ctx, MetricOperations, 1, metricAttrs...)
+	op.observer.RecordHistogram(op.ctx, MetricOperationDuration, time.Since(op.start).Seconds(), metricAttrs...)
+	if bytes > 0 {
+		op.observer.AddCounter(op.ctx, MetricBytes, bytes, String(AttrOperation, op.name))
+	}
+}
@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStartDisabled(t *testing.T) {
+	ctx, op := Start(context.Background(), OpBatch)
+	if op != nil || OperationFromContext(ctx) != nil {
+		t.Fatalf("operation should be nil when observer is disabled")
+	}
+	// nil 的 *Operation 也可以安全调用
+	op.SetAttributes(String(AttrBucket, "b"))
+	op.AddBytes(1)
+	op.End(nil)
+}
+
+func TestOperation(t *testing.T) {
+	r := NewRecorder()
+	ctx := WithObserver(context.Background(), r)
+
+	ctx, op := Start(ctx, OpUpload, String(AttrBucket, "b"))
+	if OperationFromContext(ctx) != op {
+		t.Fatalf("context should carry the operation")
+	}
+	partCtx, part := Start(ctx, OpUploadPart, Int(AttrPartNumber, 1))
+	part.AddEvent(EventHTTPAttempt, Int(AttrAttempt, 1))
+	part.AddBytes(10)
+	part.End(errors.New("failed"))
+	_, part = Start(ctx, OpUploadPart, Int(AttrPartNumber, 1))
+	part.AddBytes(10)
+	part.End(nil)
+	op.AddBytes(10)
+	op.End(nil)
+
+	if OperationFromContext(partCtx) == op {
+		t.Errorf("part context should carry the part operation")
+	}
+	parts := r.Spans(OpUploadPart)
+	if len(parts) != 2 || parts[0].Parent == nil || parts[0].Parent.Name != OpUpload {
+		t.Fatalf("unexpected part spans: %+v", parts)
+	}
+	if parts[0].Attributes[AttrOutcome] != OutcomeError || parts[1].Attributes[AttrOutcome] != OutcomeSuccess {
+		t.Errorf("unexpected outcomes: %v, %v", parts[0].Attributes, parts[1].Attributes)
+	}
+	if len(parts[0].Events) != 1 || parts[0].Events[0].Attributes[AttrAttempt] != int64(1) {
+		t.Errorf("unexpected events: %+v", parts[0].Events)
+	}
+	upload := r.Spans(OpUpload)[0]
+	if upload.Attributes[AttrBucket] != "b" || upload.Attributes[AttrBytes] != int64(10) ||
+		upload.Attributes[AttrOperation] != OpUpload {
+		t.Errorf("unexpected upload attributes: %v", upload.Attributes)
+	}
+	if r.Counter(MetricOperations) != 3 || len(r.Histogram(MetricOperationDuration)) != 3 || r.Counter(MetricBytes) != 30 {
+		t.Errorf("unexpected metrics: %d, %v, %d", r.Counter(MetricOperations), r.Histogram(MetricOperationDuration), r.Counter(MetricBytes))
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	if Outcome(nil) != OutcomeSuccess || Outcome(context.Canceled) != OutcomeCanceled ||
+		Outcome(context.DeadlineExceeded) != OutcomeCanceled || Outcome(errors.New("x")) != OutcomeError {
+		t.Errorf("Outcome() classifies errors wrong")
+	}
+}